@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudbees-io/kaniko/internal/kaniko"
+)
+
+func newBuildCommand() *cobra.Command {
+	cfg := &kaniko.Config{}
+	command := &cobra.Command{
+		Use:   "build",
+		Short: "Build and push the image",
+		Long:  "Build the image with the configured backend and push it to all destinations",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(command *cobra.Command, args []string) error {
+			return runBuild(command, cfg, args)
+		},
+	}
+	addBuildFlags(command, cfg)
+	return command
+}
+
+func runBuild(command *cobra.Command, cfg *kaniko.Config, args []string) error {
+	if err := unknownArguments(args); err != nil {
+		return err
+	}
+
+	cfg.Version, _ = buildVersion()
+	ctx, cancel := signalContext(commandContext(command))
+	defer cancel()
+	return cfg.Run(ctx)
+}
+
+// commandContext returns the context the command was executed with.
+func commandContext(command *cobra.Command) context.Context {
+	if ctx := command.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// addBuildFlags defines the flags configuring the build.
+// Base image patterns, which may span multiple lines, are also read from the environment.
+func addBuildFlags(command *cobra.Command, cfg *kaniko.Config) {
+	flags := command.Flags()
+	flags.StringVar(&cfg.Backend, "backend", kaniko.BackendKaniko, "Build backend to use: kaniko or buildah (requires buildah in the PATH)")
+	flags.StringVar(&cfg.Dockerfile, "dockerfile", "", "Dockerfile is the path to the Dockerfile to build")
+	flags.StringVar(&cfg.DockerContext, "context", "", "Context is the path to the build context, or a git (git://, https://...git#ref:subdir), archive (tar://, https://...tar.gz) or OCI artifact (oci://) URL")
+	flags.StringVar(&cfg.ContextChecksum, "context-checksum", "", "Expected sha256:<hex> digest of an archive build context")
+	flags.StringVar(&cfg.StageContext, "stage-context", "", "Stage the build context pruned by .dockerignore before building: none, dir or tar")
+	flags.StringVar(&cfg.MaxContextSize, "max-context-size", "", "Fail if the build context exceeds this size after applying .dockerignore, e.g. 500MiB")
+	flags.BoolVar(&cfg.ImageSizeReport, "image-size-report", false, "Print the size of the built image and its layers")
+	flags.StringVar(&cfg.MaxImageSize, "max-image-size", "", "Fail if the compressed image exceeds this size, e.g. 1GiB")
+	flags.StringVar(&cfg.MaxImageGrowth, "max-image-growth", "", "Fail if the compressed image grew by more than this size or percentage since the previous image at the same tag, e.g. 100MiB or 20%")
+	flags.IntVar(&cfg.MaxLayers, "max-layers", 0, "Fail if the image has more layers")
+	flags.StringVar(&cfg.AllowedBaseImages, "allowed-base-images", os.Getenv("INPUT_ALLOWED_BASE_IMAGES"), "Comma or newline separated glob patterns of the registries and repositories FROM and COPY --from images must match")
+	flags.StringVar(&cfg.DeniedBaseImages, "denied-base-images", os.Getenv("INPUT_DENIED_BASE_IMAGES"), "Comma or newline separated glob patterns of the registries and repositories FROM and COPY --from images must not match")
+	flags.StringVar(&cfg.Policy, "policy", "", "Path to a YAML file of policy rules checked against the Dockerfile and the built image")
+	flags.StringVar(&cfg.Summary, "summary", "", "Path to write the build summary to as Markdown, also appended to $CLOUDBEES_STEP_SUMMARY or $GITHUB_STEP_SUMMARY when set")
+	flags.StringVar(&cfg.SummaryJSON, "summary-json", "", "Path to write the build summary to as JSON")
+	flags.StringVar(&cfg.OTelEndpoint, "otel-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP endpoint to export the traces and metrics of the build to, e.g. http://collector:4318")
+	flags.StringVar(&cfg.OTelFile, "otel-file", "", "Path to write the traces and metrics of the build to as OTLP JSON")
+	flags.BoolVar(&cfg.ImageDiff, "image-diff", false, "Compare the built image to the image previously published at the first destination")
+	flags.StringVar(&cfg.Destination, "destination", "", "Destination is the destination of the built image")
+	flags.StringVar(&cfg.RegistryMirrors, "registry-mirrors", "", "Registry mirrors to find images")
+	flags.BoolVar(&cfg.SkipDefaultRegistryFallback, "skip-default-registry-fallback", false, "Fail if image is not found on registry mirrors")
+	flags.BoolVar(&cfg.ProbeRegistryMirrors, "probe-registry-mirrors", false, "Drop unhealthy registry mirrors and order the others by latency before building")
+	addRegistryFlags(command, cfg)
+	flags.StringVar(&cfg.Verbosity, "verbosity", "debug", "Verbosity level of the Kaniko executor and of the action logs")
+	flags.StringVar(&cfg.LogFormat, "log-format", kaniko.LogFormatText, "Format of the action logs: text or json")
+	flags.StringVar(&cfg.LogFile, "log-file", "", "Path to also write the action logs to")
+	flags.StringVar(&cfg.Target, "target", "", "Target stage to build in a multi-stage Dockerfile")
+	flags.BoolVar(&cfg.CreatedLabel, "created-label", false, "Set the org.opencontainers.image.created label to the build time when SOURCE_DATE_EPOCH is not set")
+	flags.BoolVar(&cfg.AnnotateManifest, "annotate-manifest", false, "Rewrite the manifest pushed by the Kaniko executor with the OCI annotations, moving the destination tags to it")
+	flags.BoolVar(&cfg.Reproducible, "reproducible", false, "Build a reproducible image, with timestamps set from SOURCE_DATE_EPOCH or the commit timestamp")
+	flags.BoolVar(&cfg.VerifyReproducible, "verify-reproducible", false, "Build the image twice without pushing it and fail if the builds differ")
+	flags.StringVar(&cfg.TarPath, "tar-path", "", "Path to save the image tar file (optional). If set, the image will be saved as a tar file.")
+	flags.StringVar(&cfg.KanikoDir, "kaniko-dir", "", "Path to the Kaniko working directory (passed as --kaniko-dir to the executor), the executor default /kaniko when empty")
+	flags.BoolVar(&cfg.KeepKanikoDir, "keep-kaniko-dir", false, "Keep the Kaniko working directory created by the action, for debugging")
+	flags.StringVar(&cfg.MinFreeDisk, "min-free-disk", "1GiB", "Warn when the free disk space of the Kaniko working directory falls below this size before or during the build, empty to disable")
+	flags.BoolVar(&cfg.StrictExecutorFlags, "strict-executor-flags", false, "Fail if the Kaniko executor does not support a flag instead of dropping it with a warning")
+	flags.StringVar(&cfg.OutputFormat, "output-format", kaniko.OutputFormatCloudBees, "Format of the outputs: cloudbees (a file per output in $CLOUDBEES_OUTPUTS), json, dotenv or github ($GITHUB_OUTPUT)")
+	flags.StringVar(&cfg.OutputFile, "output-file", "", "File the json, dotenv and github output formats write to (defaults to outputs.json, outputs.env or $GITHUB_OUTPUT)")
+	flags.BoolVar(&cfg.Local, "local", false, "Run the executor image in a container and write the outputs into --local-outputs, for development outside CloudBees")
+	flags.StringVar(&cfg.LocalOutputs, "local-outputs", ".kaniko-outputs", "Directory the outputs are written to in local mode")
+	flags.StringVar(&cfg.ContainerRuntime, "container-runtime", kaniko.RuntimeDocker, "Container runtime running the executor image in local mode: docker or podman")
+	flags.StringVar(&cfg.ExecutorImage, "executor-image", kaniko.DefaultExecutorImage, "Kaniko executor image run in local mode")
+	flags.StringVar(&cfg.ExecutablePath, "executor-path", "", "Path to the Kaniko executor binary (defaults to $KANIKO_EXECUTOR or 'executor' from the PATH)")
+}
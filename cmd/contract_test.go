@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudbees-io/kaniko/internal/contract"
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the action contract tests")
+
+// contractCase is a run of the action with the given inputs, whose action arguments,
+// executor invocations and outputs are compared to testdata/contract/<name>.golden.
+// $WORKSPACE and $REGISTRY are replaced in the inputs by the build context and the host
+// of the registry.
+type contractCase struct {
+	name   string
+	inputs map[string]string
+	// env is the environment of the workflow.
+	env map[string]string
+	// files are written by the run, relative to the workspace.
+	files []string
+}
+
+var contractCases = []contractCase{
+	{
+		name:   "defaults",
+		inputs: map[string]string{"destination": "$REGISTRY/team/app:1.0"},
+	},
+	{
+		name: "build-args",
+		inputs: map[string]string{
+			"destination": "$REGISTRY/team/app:1.0,$REGISTRY/team/app:latest",
+			"build-args":  "VERSION=1.0,COMMIT=abc",
+			"labels":      "org.opencontainers.image.title=app",
+			"target":      "final",
+			"verbosity":   "debug",
+		},
+	},
+	{
+		name: "annotate-manifest",
+		inputs: map[string]string{
+			"destination":       "$REGISTRY/team/app:1.0",
+			"created-label":     "true",
+			"annotate-manifest": "true",
+		},
+	},
+	{
+		name: "registry-mirrors",
+		inputs: map[string]string{
+			"destination":                    "$REGISTRY/team/app:1.0",
+			"registry-mirrors":               "mirror.gcr.io",
+			"skip-default-registry-fallback": "true",
+		},
+	},
+	{
+		name: "tar-path",
+		inputs: map[string]string{
+			"destination":       "$REGISTRY/team/app:1.0",
+			"tar-path":          "$WORKSPACE/image.tar",
+			"kaniko-dir":        "$WORKSPACE/kaniko",
+			"image-size-report": "true",
+			"max-layers":        "3",
+		},
+		files: []string{"image.tar"},
+	},
+	{
+		name: "proxy",
+		inputs: map[string]string{
+			"destination": "$REGISTRY/team/app:1.0",
+			"http-proxy":  "http://proxy.example:3128",
+			"https-proxy": "http://proxy.example:3129",
+			"no-proxy":    "internal.example,127.0.0.1",
+		},
+	},
+	{
+		name: "reproducible",
+		inputs: map[string]string{
+			"destination":  "$REGISTRY/team/app:1.0",
+			"reproducible": "true",
+		},
+		env: map[string]string{"SOURCE_DATE_EPOCH": "1700000000"},
+	},
+	{
+		name: "reports",
+		inputs: map[string]string{
+			"destination":  "$REGISTRY/team/app:1.0",
+			"summary":      "$WORKSPACE/summary.md",
+			"summary-json": "$WORKSPACE/summary.json",
+			"otel-file":    "$WORKSPACE/telemetry.json",
+			"log-format":   "json",
+			"log-file":     "$WORKSPACE/build.log",
+		},
+		files: []string{"summary.md", "summary.json", "telemetry.json", "build.log"},
+	},
+}
+
+// resourceOutputs are measured, their values vary between runs.
+var resourceOutputs = []string{"peak-memory", "cpu-seconds", "peak-disk-usage", "min-free-disk"}
+
+// volatileValues matches the values which vary between runs: the directories created
+// for the builds and trace context IDs.
+var volatileValues = []struct {
+	regexp      *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(kaniko-context-)\d+`), "${1}*"},
+	{regexp.MustCompile(`(TRACEPARENT=)\S+`), "${1}<traceparent>"},
+}
+
+// buildTimeRegexp matches the creation time of images labeled with the build time,
+// and digestRegexp the digests of their manifests, annotated with that time.
+var (
+	buildTimeRegexp = regexp.MustCompile(`(image\.created=)\S+`)
+	digestRegexp    = regexp.MustCompile(`sha256:[0-9a-f]{64}`)
+)
+
+func Test_ActionContract(t *testing.T) {
+	action, err := contract.Load("../action.yml")
+	require.NoError(t, err)
+	for _, c := range contractCases {
+		t.Run(c.name, func(t *testing.T) {
+			runContractCase(t, action, c)
+		})
+	}
+}
+
+func runContractCase(t *testing.T, action *contract.Action, c contractCase) {
+	r := testharness.NewRegistry(t)
+	executor := testharness.NewExecutor(t, testharness.Scenario{
+		Config: image.ConfigFile{OS: "linux", Architecture: "amd64"},
+		Layers: [][]byte{contractLayer(t)},
+		Push:   true,
+	})
+	workspace, home, tmp, outputs := t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "Dockerfile"), []byte("FROM scratch AS base\nFROM base AS final\n"), 0644))
+	registries := filepath.Join(home, "registries.json")
+	require.NoError(t, os.WriteFile(registries, []byte(`{"registries":[{"prefix":"`+r.Host()+`","insecure":true}]}`), 0644))
+
+	expand := strings.NewReplacer("$WORKSPACE", workspace, "$REGISTRY", r.Host())
+	inputs := map[string]string{}
+	for name, value := range c.inputs {
+		inputs[name] = expand.Replace(value)
+	}
+	ctx := contract.Context{
+		Inputs: inputs,
+		Variables: map[string]string{
+			"cloudbees.workspace":         workspace,
+			"cloudbees.registries":        registries,
+			"cloudbees.home":              home,
+			"cloudbees.scm.sha":           "0123456789abcdef0123456789abcdef01234567",
+			"cloudbees.scm.repositoryUrl": "https://github.com/example/app.git",
+			"cloudbees.scm.ref":           "refs/heads/main",
+			"cloudbees.component.id":      "component",
+			"cloudbees.api.url":           "",
+			"cloudbees.api.token":         "",
+			"cloudbees.run_id":            "run",
+			"cloudbees.run_attempt":       "1",
+			"action.scm.sha":              "main",
+		},
+	}
+	step, err := action.Render("imgbuild", ctx)
+	require.NoError(t, err)
+	require.Equal(t, "/kaniko/cloudbees-kaniko-action", step.Entrypoint)
+
+	// The environment of the runner, which the action must not depend on, is cleared.
+	for _, name := range []string{
+		"CLOUDBEES_STEP_SUMMARY", "GITHUB_OUTPUT", "GITHUB_STEP_SUMMARY", "GITHUB_RUN_ID",
+		"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+		"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_RESOURCE_ATTRIBUTES", "OTEL_SERVICE_NAME",
+		"SOURCE_DATE_EPOCH", "SSL_CERT_DIR", "TRACEPARENT",
+	} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("TMPDIR", tmp)
+	t.Setenv("CLOUDBEES_OUTPUTS", outputs)
+	t.Setenv("KANIKO_EXECUTOR", executor.Path)
+	for name, value := range c.env {
+		t.Setenv(name, value)
+	}
+	for name, value := range step.Env {
+		t.Setenv(name, value)
+	}
+
+	root := NewRootCommand()
+	root.SetArgs(step.Args)
+	require.NoError(t, root.Execute())
+	for _, file := range c.files {
+		require.FileExists(t, filepath.Join(workspace, file))
+	}
+
+	// Every output of the step is used by the action.
+	stepOutputs := map[string]string{}
+	entries, err := os.ReadDir(outputs)
+	require.NoError(t, err)
+	refs := action.StepOutputRefs("imgbuild")
+	for _, entry := range entries {
+		require.Contains(t, refs, entry.Name(), "output of the step not used by action.yml")
+		b, err := os.ReadFile(filepath.Join(outputs, entry.Name()))
+		require.NoError(t, err)
+		stepOutputs[entry.Name()] = string(b)
+	}
+	actionOutputs, err := action.RenderOutputs(contract.Context{
+		Inputs:      inputs,
+		Variables:   ctx.Variables,
+		StepOutputs: map[string]map[string]string{"imgbuild": stepOutputs},
+	})
+	require.NoError(t, err)
+	for _, name := range resourceOutputs {
+		if _, ok := actionOutputs[name]; ok {
+			actionOutputs[name] = "<measured>"
+		}
+	}
+
+	environ := os.Environ()
+	var sb strings.Builder
+	sb.WriteString("# action arguments\n")
+	writeGoldenArgs(&sb, step.Args)
+	for i, build := range executor.Builds(t) {
+		fmt.Fprintf(&sb, "\n# executor arguments, build %d\n", i+1)
+		writeGoldenArgs(&sb, build.Args)
+		fmt.Fprintf(&sb, "\n# executor environment, build %d\n", i+1)
+		var env []string
+		for _, kv := range build.Env {
+			if !slices.Contains(environ, kv) {
+				env = append(env, kv)
+			}
+		}
+		sort.Strings(env)
+		writeGoldenArgs(&sb, env)
+	}
+	sb.WriteString("\n# action outputs\n")
+	var names []string
+	for name := range actionOutputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s=%s\n", name, actionOutputs[name])
+	}
+
+	// The tag outputs are parsed from the first colon of the destination, and start
+	// with the port of the registry.
+	_, port, _ := strings.Cut(r.Host(), ":")
+	got := strings.NewReplacer(workspace, "$WORKSPACE", home, "$HOME", tmp, "$TMPDIR", outputs, "$OUTPUTS", r.Host(), "$REGISTRY", "="+port+"/", "=$REGISTRY_PORT/").Replace(sb.String())
+	for _, v := range volatileValues {
+		got = v.regexp.ReplaceAllString(got, v.replacement)
+	}
+	if c.env["SOURCE_DATE_EPOCH"] == "" && c.inputs["created-label"] == "true" {
+		got = buildTimeRegexp.ReplaceAllString(got, "${1}<build time>")
+		got = digestRegexp.ReplaceAllString(got, "sha256:<annotated>")
+	}
+	golden := filepath.Join("testdata", "contract", c.name+".golden")
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(golden, []byte(got), 0644))
+	}
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err, "run go test ./cmd -run Test_ActionContract -update to create the golden file")
+	require.Equal(t, string(want), got)
+}
+
+// writeGoldenArgs writes an argument per line, quoted when empty or containing white space.
+func writeGoldenArgs(sb *strings.Builder, args []string) {
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"") {
+			arg = strconv.Quote(arg)
+		}
+		sb.WriteString(arg + "\n")
+	}
+}
+
+// contractLayer returns the layer of the images built by the fake executor.
+func contractLayer(t *testing.T) []byte {
+	var layer bytes.Buffer
+	tw := tar.NewWriter(&layer)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "app", Mode: 0755, Size: 3, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("app"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	return layer.Bytes()
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudbees-io/kaniko/internal/kaniko"
+)
+
+func newDiffCommand() *cobra.Command {
+	cfg := &kaniko.Config{}
+	var format string
+	command := &cobra.Command{
+		Use:   "diff BEFORE AFTER",
+		Short: "Compare two images",
+		Long: "Compare two images, each given as image reference or image tarball path: " +
+			"layers, configuration, OS packages and files",
+		Args: cobra.ExactArgs(2),
+		RunE: func(command *cobra.Command, args []string) error {
+			if format != "markdown" && format != "json" {
+				return fmt.Errorf("unknown format %q: must be markdown or json", format)
+			}
+			diff, err := cfg.DiffImages(commandContext(command), args[0], args[1])
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				return writeJSON(command, diff)
+			}
+			_, err = fmt.Fprint(command.OutOrStdout(), diff.Markdown())
+			return err
+		},
+	}
+	command.Flags().StringVar(&format, "format", "markdown", "Output format: markdown or json")
+	addRegistryFlags(command, cfg)
+	return command
+}
+
+func writeJSON(command *cobra.Command, v any) error {
+	enc := json.NewEncoder(command.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+)
+
+func writeTarball(t *testing.T, name, content string) string {
+	var layer bytes.Buffer
+	tw := tar.NewWriter(&layer)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	path := filepath.Join(t.TempDir(), "image.tar")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, image.WriteTarball(f, image.ConfigFile{}, nil, layer.Bytes()))
+	return path
+}
+
+func Test_Diff(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	before := writeTarball(t, "app/main", "v1")
+	after := writeTarball(t, "app/main", "v2")
+	var out bytes.Buffer
+	run := func(args ...string) error {
+		out.Reset()
+		root := NewRootCommand()
+		root.SetOut(&out)
+		root.SetArgs(append([]string{"diff"}, args...))
+		return root.Execute()
+	}
+
+	require.NoError(t, run("--format", "json", before, after))
+	var diff image.Diff
+	require.NoError(t, json.Unmarshal(out.Bytes(), &diff))
+	require.Equal(t, []image.FileChange{{Path: "app/main", Kind: image.FileModified, Fields: []string{"content"}}}, diff.Files)
+
+	require.NoError(t, run("--format", "markdown", before, after))
+	require.Contains(t, out.String(), "| ~ | `app/main` | content |")
+
+	require.ErrorContains(t, run("--format", "html", before, after), `unknown format "html"`)
+	require.ErrorContains(t, run(before), "accepts 2 arg(s)")
+}
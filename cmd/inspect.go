@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudbees-io/kaniko/internal/kaniko"
+)
+
+func newInspectCommand() *cobra.Command {
+	cfg := &kaniko.Config{}
+	var format string
+	command := &cobra.Command{
+		Use:   "inspect IMAGE",
+		Short: "Print the manifest, configuration and layers of an image",
+		Long:  "Read the manifest, configuration and layers of an image from its registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, args []string) error {
+			if format != "text" && format != "json" {
+				return fmt.Errorf("unknown format %q: must be text or json", format)
+			}
+			inspection, err := cfg.InspectImage(commandContext(command), args[0])
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				return writeJSON(command, inspection)
+			}
+			_, err = fmt.Fprint(command.OutOrStdout(), inspection.String())
+			return err
+		},
+	}
+	command.Flags().StringVar(&format, "format", "text", "Output format: text or json")
+	addRegistryFlags(command, cfg)
+	return command
+}
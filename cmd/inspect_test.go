@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Inspect(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	for _, c := range []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"inspect"}, wantErr: "accepts 1 arg(s)"},
+		{args: []string{"inspect", "--format", "yaml", "alpine"}, wantErr: `unknown format "yaml"`},
+		{args: []string{"inspect", "Invalid Reference"}, wantErr: "parse image reference"},
+	} {
+		root := NewRootCommand()
+		root.SetArgs(c.args)
+		require.ErrorContains(t, root.Execute(), c.wantErr)
+	}
+}
@@ -11,50 +11,56 @@ import (
 	"github.com/cloudbees-io/kaniko/internal/kaniko"
 )
 
-var (
-	cmd = &cobra.Command{
+func Execute() error {
+	return NewRootCommand().Execute()
+}
+
+// NewRootCommand returns the command tree. Without subcommand, the root command
+// builds the image like the build subcommand, as the action invokes it.
+func NewRootCommand() *cobra.Command {
+	cfg := &kaniko.Config{}
+	root := &cobra.Command{
 		Use:   "kaniko-action",
 		Short: "Build and push container images using Kaniko",
 		Long:  "Build and push container images using Kaniko",
-		RunE:  run,
+		// Arguments are rejected by runBuild rather than taken as unknown subcommands.
+		Args: cobra.ArbitraryArgs,
+		RunE: func(command *cobra.Command, args []string) error {
+			return runBuild(command, cfg, args)
+		},
 	}
-	cfg kaniko.Config
-)
+	addBuildFlags(root, cfg)
+	root.AddCommand(
+		newBuildCommand(),
+		newInspectCommand(),
+		newValidateCommand(),
+		newVersionCommand(),
+		newDiffCommand(),
+	)
+	return root
+}
 
-func Execute() error {
-	return cmd.Execute()
+// signalContext returns a context canceled on interrupt.
+func signalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(parent, os.Interrupt)
+}
+
+// addRegistryFlags defines the flags configuring the access to registries.
+// Certificates and proxies, which may span multiple lines or contain credentials, are also read from the environment.
+func addRegistryFlags(command *cobra.Command, cfg *kaniko.Config) {
+	flags := command.Flags()
+	flags.StringVar(&cfg.CACertificates, "ca-certificates", os.Getenv("INPUT_CA_CERTIFICATES"), "CA bundle to trust in addition to the system CAs, as file path or PEM content")
+	flags.StringVar(&cfg.ClientCertificate, "client-certificate", os.Getenv("INPUT_CLIENT_CERTIFICATE"), "Client certificate for mutual TLS with registries, as file path or PEM content")
+	flags.StringVar(&cfg.ClientKey, "client-key", os.Getenv("INPUT_CLIENT_KEY"), "Client key for mutual TLS with registries, as file path or PEM content")
+	flags.StringVar(&cfg.HTTPProxy, "http-proxy", os.Getenv("INPUT_HTTP_PROXY"), "Proxy for HTTP connections of the action and the build backend")
+	flags.StringVar(&cfg.HTTPSProxy, "https-proxy", os.Getenv("INPUT_HTTPS_PROXY"), "Proxy for HTTPS connections of the action and the build backend")
+	flags.StringVar(&cfg.NoProxy, "no-proxy", os.Getenv("INPUT_NO_PROXY"), "Comma-separated hosts, domains and CIDR ranges reached without proxy")
+	flags.StringVar(&cfg.RegistryConfig, "registry-config", "", "Path to the registry configuration (defaults to $CLOUDBEES_REGISTRY_CONFIG)")
 }
 
-func run(command *cobra.Command, args []string) error {
+func unknownArguments(args []string) error {
 	if len(args) > 0 {
 		return fmt.Errorf("unknown arguments: %v", args)
 	}
-
-	// Print the Kaniko directory if specified
-	if cfg.KanikoDir != "" {
-		fmt.Fprintf(os.Stderr, "Using kaniko directory: %s\n", cfg.KanikoDir)
-	}
-
-	newContext, cancel := context.WithCancel(context.Background())
-	osChannel := make(chan os.Signal, 1)
-	signal.Notify(osChannel, os.Interrupt)
-	go func() {
-		<-osChannel
-		cancel()
-	}()
-
-	return cfg.Run(newContext)
-}
-
-func init() {
-	// Define flags for configuring the Kaniko build
-	cmd.Flags().StringVar(&cfg.Dockerfile, "dockerfile", "", "Dockerfile is the path to the Dockerfile to build")
-	cmd.Flags().StringVar(&cfg.DockerContext, "context", "", "Context is the path to the build context")
-	cmd.Flags().StringVar(&cfg.Destination, "destination", "", "Destination is the destination of the built image")
-	cmd.Flags().StringVar(&cfg.RegistryMirrors, "registry-mirrors", "", "Registry mirrors to find images")
-	cmd.Flags().BoolVar(&cfg.SkipDefaultRegistryFallback, "skip-default-registry-fallback", false, "Fail if image is not found on registry mirrors")
-	cmd.Flags().StringVar(&cfg.Verbosity, "verbosity", "debug", "Verbosity level of the Kaniko executor")
-	cmd.Flags().StringVar(&cfg.Target, "target", "", "Target stage to build in a multi-stage Dockerfile")
-	cmd.Flags().StringVar(&cfg.TarPath, "tar-path", "", "Path to save the image tar file (optional). If set, the image will be saved as a tar file.")
-	cmd.Flags().StringVar(&cfg.KanikoDir, "kaniko-dir", "", "Path to the Kaniko working directory (passed as --kaniko-dir to the executor)")
+	return nil
 }
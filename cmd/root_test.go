@@ -1,30 +1,45 @@
 package cmd
 
 import (
-	"os"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
 func Test_UnknownArguments(t *testing.T) {
-	prevArgs := os.Args
-	defer func() {
-		os.Args = prevArgs
-	}()
-
 	t.Run("hanging boolean value", func(t *testing.T) {
-		os.Args = []string{"kaniko-action", "--skip-default-registry-fallback", "false"}
-		err := cmd.Execute()
+		root := NewRootCommand()
+		root.SetArgs([]string{"--skip-default-registry-fallback", "false"})
+		err := root.Execute()
 		require.Error(t, err, "boolean flag without =")
 		require.Contains(t, err.Error(), "unknown arguments: [false]", "boolean flag error message")
 	})
 
 	t.Run("unknown flag", func(t *testing.T) {
-		os.Args = []string{"asdf", "--not-an-arg"}
-		err := cmd.Execute()
+		root := NewRootCommand()
+		root.SetArgs([]string{"--not-an-arg"})
+		err := root.Execute()
 		require.Error(t, err, "not an argument")
 		require.Contains(t, err.Error(), "unknown flag: --not-an-arg", "unknown flag")
 	})
 
+	t.Run("build subcommand", func(t *testing.T) {
+		root := NewRootCommand()
+		root.SetArgs([]string{"build", "--skip-default-registry-fallback", "false"})
+		require.ErrorContains(t, root.Execute(), "unknown arguments: [false]")
+	})
+}
+
+func Test_NewRootCommand(t *testing.T) {
+	root := NewRootCommand()
+	var names []string
+	for _, c := range root.Commands() {
+		names = append(names, c.Name())
+	}
+	require.Subset(t, names, []string{"build", "diff", "inspect", "validate", "version"})
+
+	// Each tree has its own configuration.
+	a, b := NewRootCommand(), NewRootCommand()
+	require.NoError(t, a.Flags().Set("destination", "registry.example.com/a"))
+	require.Equal(t, "", b.Flags().Lookup("destination").Value.String())
 }
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudbees-io/kaniko/internal/kaniko"
+)
+
+func newValidateCommand() *cobra.Command {
+	cfg := &kaniko.Config{}
+	command := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the build configuration and Dockerfile without building",
+		Long: "Check the build flags, then parse the Dockerfile of a local build context and check " +
+			"its target stage, base image patterns and policy rules, without building",
+		Args: cobra.NoArgs,
+		RunE: func(command *cobra.Command, args []string) error {
+			if err := cfg.Validate(commandContext(command)); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintln(command.OutOrStdout(), "Configuration is valid")
+			return err
+		},
+	}
+	addBuildFlags(command, cfg)
+	return command
+}
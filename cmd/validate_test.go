@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Validate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine:3.20\n"), 0644))
+	t.Setenv("DOCKER_BUILD_ARGS", "")
+
+	var out bytes.Buffer
+	root := NewRootCommand()
+	root.SetOut(&out)
+	root.SetArgs([]string{"validate", "--context", dir, "--destination", "registry.example.com/app:1.0"})
+	require.NoError(t, root.Execute())
+	require.Equal(t, "Configuration is valid\n", out.String())
+
+	root = NewRootCommand()
+	root.SetArgs([]string{"validate", "--context", dir, "--destination", "registry.example.com/app:1.0", "--target", "test"})
+	require.ErrorContains(t, root.Execute(), "target stage test not found")
+}
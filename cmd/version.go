@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudbees-io/kaniko/internal/kaniko"
+)
+
+// version and commit identify the wrapper build, set with
+// -ldflags "-X github.com/cloudbees-io/kaniko/cmd.version=... -X github.com/cloudbees-io/kaniko/cmd.commit=...".
+// The Go build information is used when they are not set.
+var (
+	version string
+	commit  string
+)
+
+func buildVersion() (string, string) {
+	v, c := version, commit
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "" {
+			v = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			if c == "" && s.Key == "vcs.revision" {
+				c = s.Value
+			}
+		}
+	}
+	if v == "" {
+		v = "(devel)"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	return v, c
+}
+
+func newVersionCommand() *cobra.Command {
+	cfg := &kaniko.Config{}
+	command := &cobra.Command{
+		Use:   "version",
+		Short: "Print the version of the action and of the Kaniko executor",
+		Args:  cobra.NoArgs,
+		RunE: func(command *cobra.Command, args []string) error {
+			out := command.OutOrStdout()
+			v, c := buildVersion()
+			fmt.Fprintf(out, "kaniko-action %s, commit %s\n", v, c)
+
+			path, executorVersion, err := cfg.ExecutorVersion(commandContext(command))
+			switch {
+			case err != nil:
+				fmt.Fprintf(out, "kaniko executor: %v\n", err)
+			case executorVersion == "":
+				fmt.Fprintf(out, "kaniko executor: unknown version (%s)\n", path)
+			default:
+				fmt.Fprintf(out, "kaniko executor %s (%s)\n", executorVersion, path)
+			}
+			return nil
+		},
+	}
+	command.Flags().StringVar(&cfg.ExecutablePath, "executor-path", "", "Path to the Kaniko executor binary (defaults to $KANIKO_EXECUTOR or 'executor' from the PATH)")
+	return command
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Version(t *testing.T) {
+	executor := filepath.Join(t.TempDir(), "executor")
+	require.NoError(t, os.WriteFile(executor, []byte("#!/bin/sh\necho 'Kaniko version :  v1.25.16'\n"), 0755))
+	defer func(v, c string) { version, commit = v, c }(version, commit)
+	version, commit = "v1.2.3", "abc123"
+
+	var out bytes.Buffer
+	root := NewRootCommand()
+	root.SetOut(&out)
+	root.SetArgs([]string{"version", "--executor-path", executor})
+	require.NoError(t, root.Execute())
+	require.Equal(t, "kaniko-action v1.2.3, commit abc123\nkaniko executor v1.25.16 ("+executor+")\n", out.String())
+
+	out.Reset()
+	root = NewRootCommand()
+	root.SetOut(&out)
+	root.SetArgs([]string{"version", "--executor-path", filepath.Join(t.TempDir(), "missing")})
+	require.NoError(t, root.Execute())
+	require.Contains(t, out.String(), "kaniko executor: cannot find kaniko executor binary")
+}
@@ -0,0 +1,171 @@
+package buildcontext
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractTar unpacks a plain or gzipped tarball into dst, rejecting entries escaping it,
+// also through the symlinks of the tarball.
+func extractTar(r io.Reader, dst string) error {
+	dst, err := filepath.EvalSymlinks(dst)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar entry: %w", err)
+		}
+
+		target, err := securePath(dst, hdr.Name)
+		if err != nil {
+			return err
+		}
+		mode := hdr.FileInfo().Mode().Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err = writeFile(target, tr, mode); err != nil {
+				return err
+			}
+			if err = os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// Relative targets are resolved from the directory the link is created in.
+			if filepath.IsAbs(hdr.Linkname) {
+				_, err = securePath(dst, hdr.Linkname)
+			} else if !within(dst, filepath.Join(filepath.Dir(target), hdr.Linkname)) {
+				err = fmt.Errorf("path %q escapes the build context", hdr.Linkname)
+			}
+			if err != nil {
+				return fmt.Errorf("symlink %s: %w", hdr.Name, err)
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err = os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := securePath(dst, hdr.Linkname)
+			if err != nil {
+				return fmt.Errorf("hard link %s: %w", hdr.Name, err)
+			}
+			if err = os.Link(source, target); err != nil {
+				return err
+			}
+		default:
+			// Devices, fifos and extended headers are not needed in a build context.
+		}
+	}
+}
+
+// securePath joins name to dst and fails if the result is outside of dst, also once
+// the symlinks already extracted into its parent directories are followed. The
+// returned path has its parent directories resolved.
+func securePath(dst, name string) (string, error) {
+	dst, err := filepath.EvalSymlinks(dst)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(dst, filepath.FromSlash(strings.TrimPrefix(name, "/")))
+	if !within(dst, target) {
+		return "", fmt.Errorf("path %q escapes the build context", name)
+	}
+	if target == dst {
+		return target, nil
+	}
+	parent, err := resolveDir(filepath.Dir(target))
+	if err != nil {
+		return "", err
+	}
+	if !within(dst, parent) {
+		return "", fmt.Errorf("path %q escapes the build context through a symlink", name)
+	}
+	return filepath.Join(parent, filepath.Base(target)), nil
+}
+
+// within reports whether path is dst or below it.
+func within(dst, path string) bool {
+	rel, err := filepath.Rel(dst, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveDir follows the symlinks of the existing part of dir. The missing directories
+// are created later by the extraction, they cannot be symlinks.
+func resolveDir(dir string) (string, error) {
+	var missing []string
+	for {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+		dir = parent
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{resolved}, missing...)...), nil
+}
+
+// noSymlink fails if path is a symlink, which writing the file would follow.
+func noSymlink(path string) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("refusing to write %s through a symlink", path)
+	}
+	return nil
+}
+
+// writeFile creates or replaces the file at path, which must not be a symlink.
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := noSymlink(path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
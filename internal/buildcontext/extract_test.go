@@ -0,0 +1,86 @@
+package buildcontext
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_extractTar(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/", Mode: 0755, Typeflag: tar.TypeDir}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/file", Mode: 0600, Size: 2, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "link", Linkname: "dir/file", Typeflag: tar.TypeSymlink}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "hard", Linkname: "dir/file", Typeflag: tar.TypeLink}))
+	require.NoError(t, tw.Close())
+
+	dst := t.TempDir()
+	require.NoError(t, extractTar(&buf, dst))
+
+	b, err := os.ReadFile(filepath.Join(dst, "link"))
+	require.NoError(t, err)
+	require.Equal(t, "hi", string(b))
+	info, err := os.Stat(filepath.Join(dst, "dir", "file"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	require.FileExists(t, filepath.Join(dst, "hard"))
+}
+
+func Test_extractTarRejectsEscapes(t *testing.T) {
+	for name, hdr := range map[string]*tar.Header{
+		"parent path":     {Name: "../evil", Mode: 0644, Typeflag: tar.TypeReg},
+		"nested parent":   {Name: "a/../../evil", Mode: 0644, Typeflag: tar.TypeReg},
+		"symlink escape":  {Name: "link", Linkname: "../../etc/passwd", Typeflag: tar.TypeSymlink},
+		"hardlink escape": {Name: "hard", Linkname: "../outside", Typeflag: tar.TypeLink},
+	} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(hdr))
+		require.NoError(t, tw.Close())
+
+		err := extractTar(&buf, t.TempDir())
+		require.Error(t, err, name)
+		require.Contains(t, err.Error(), "escapes the build context", name)
+	}
+}
+
+func Test_extractTarRejectsSymlinkEscapes(t *testing.T) {
+	for name, entries := range map[string][]*tar.Header{
+		"symlink through symlinked parent": {
+			{Name: "a", Linkname: ".", Typeflag: tar.TypeSymlink},
+			{Name: "a/b", Linkname: "../outside", Typeflag: tar.TypeSymlink},
+			{Name: "b/evil", Mode: 0644, Typeflag: tar.TypeReg},
+		},
+		"file through absolute symlink": {
+			{Name: "root", Linkname: "/", Typeflag: tar.TypeSymlink},
+			{Name: "root/evil", Mode: 0644, Typeflag: tar.TypeReg},
+		},
+		"file written through symlink": {
+			{Name: "link", Linkname: "/tmp/evil", Typeflag: tar.TypeSymlink},
+			{Name: "link", Mode: 0644, Typeflag: tar.TypeReg},
+		},
+	} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range entries {
+			require.NoError(t, tw.WriteHeader(hdr))
+		}
+		require.NoError(t, tw.Close())
+
+		parent := t.TempDir()
+		dst := filepath.Join(parent, "context")
+		require.NoError(t, os.Mkdir(dst, 0755))
+		err := extractTar(&buf, dst)
+		require.Error(t, err, name)
+		require.NoFileExists(t, filepath.Join(parent, "outside", "evil"), name)
+		require.NoFileExists(t, filepath.Join(parent, "evil"), name)
+		require.NoFileExists(t, "/evil", name)
+	}
+}
@@ -0,0 +1,175 @@
+// Package buildcontext evaluates .dockerignore files and stages pruned build contexts.
+package buildcontext
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const dockerIgnoreFile = ".dockerignore"
+
+// pattern is a single .dockerignore rule.
+type pattern struct {
+	raw       string
+	exclusion bool
+	re        *regexp.Regexp
+	dirs      int
+}
+
+// Matcher decides whether a context path is ignored, following the .dockerignore
+// semantics of the docker CLI: the last matching rule wins, rules starting with
+// '!' re-include paths and a rule matching a directory matches everything below it.
+type Matcher struct {
+	patterns      []pattern
+	hasExclusions bool
+}
+
+// NewMatcher compiles .dockerignore rules. Empty rules and comments are skipped.
+func NewMatcher(rules []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" || strings.HasPrefix(rule, "#") {
+			continue
+		}
+		p := pattern{raw: rule}
+		if strings.HasPrefix(rule, "!") {
+			p.exclusion = true
+			rule = strings.TrimSpace(rule[1:])
+			m.hasExclusions = true
+		}
+		rule = strings.TrimPrefix(path.Clean(filepath.ToSlash(rule)), "/")
+		if rule == "" || rule == "." {
+			continue
+		}
+		re, err := compilePattern(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %w", p.raw, err)
+		}
+		p.re = re
+		p.dirs = strings.Count(rule, "/") + 1
+		m.patterns = append(m.patterns, p)
+	}
+	return m, nil
+}
+
+// ReadIgnoreFile parses the rules of a .dockerignore file.
+func ReadIgnoreFile(r io.Reader) ([]string, error) {
+	var rules []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rules = append(rules, scanner.Text())
+	}
+	return rules, scanner.Err()
+}
+
+// LoadMatcher finds the ignore file for a build, preferring <Dockerfile>.dockerignore
+// over <context>/.dockerignore. The returned path is empty when neither exists.
+func LoadMatcher(contextDir, dockerfile string) (*Matcher, string, error) {
+	candidates := []string{filepath.Join(contextDir, dockerIgnoreFile)}
+	if dockerfile != "" {
+		candidates = append([]string{dockerfile + dockerIgnoreFile}, candidates...)
+	}
+	for _, candidate := range candidates {
+		f, err := os.Open(candidate)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("open ignore file: %w", err)
+		}
+		rules, err := ReadIgnoreFile(f)
+		f.Close()
+		if err != nil {
+			return nil, "", fmt.Errorf("read ignore file %s: %w", candidate, err)
+		}
+		m, err := NewMatcher(rules)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", candidate, err)
+		}
+		return m, candidate, nil
+	}
+	m, err := NewMatcher(nil)
+	return m, "", err
+}
+
+// Matches reports whether the slash separated path, relative to the context root, is ignored.
+func (m *Matcher) Matches(rel string) bool {
+	rel = strings.TrimPrefix(path.Clean(filepath.ToSlash(rel)), "/")
+	segments := strings.Split(rel, "/")
+
+	matched := false
+	for _, p := range m.patterns {
+		// Only evaluate rules which could change the current result.
+		if p.exclusion != matched {
+			continue
+		}
+		match := p.re.MatchString(rel)
+		if !match && len(segments) > p.dirs {
+			// A rule matching a parent directory matches everything below it.
+			match = p.re.MatchString(strings.Join(segments[:p.dirs], "/"))
+		}
+		if match {
+			matched = !p.exclusion
+		}
+	}
+	return matched
+}
+
+// HasExclusions reports whether rules re-include paths, in which case
+// ignored directories still need to be descended into.
+func (m *Matcher) HasExclusions() bool {
+	return m.hasExclusions
+}
+
+func compilePattern(rule string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	runes := []rune(rule)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case ch == '*' && i+1 < len(runes) && runes[i+1] == '*':
+			i++
+			if i+1 < len(runes) && runes[i+1] == '/' {
+				i++
+			}
+			if i+1 >= len(runes) {
+				sb.WriteString(".*")
+			} else {
+				sb.WriteString("(.*/)?")
+			}
+		case ch == '*':
+			sb.WriteString("[^/]*")
+		case ch == '?':
+			sb.WriteString("[^/]")
+		case ch == '\\' && i+1 < len(runes):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case ch == '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := string(runes[i : end+1])
+			if strings.HasPrefix(class, "[!") {
+				class = "[^" + class[2:]
+			}
+			sb.WriteString(class)
+			i = end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
@@ -0,0 +1,94 @@
+package buildcontext
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Matcher(t *testing.T) {
+	m, err := NewMatcher([]string{
+		"# comment",
+		"",
+		"node_modules",
+		"/build",
+		"*.log",
+		"**/*.tmp",
+		"docs/**",
+		"!docs/README.md",
+		"src/[abc].go",
+		"src/[!x]y.go",
+		"cache?",
+	})
+	require.NoError(t, err)
+
+	for path, want := range map[string]bool{
+		"node_modules":            true,
+		"node_modules/pkg/a.js":   true,
+		"web/node_modules":        false,
+		"build/out.bin":           true,
+		"debug.log":               true,
+		"logs/debug.log":          false,
+		"a/b/c.tmp":               true,
+		"c.tmp":                   true,
+		"docs/guide.md":           true,
+		"docs/README.md":          false,
+		"src/a.go":                true,
+		"src/d.go":                false,
+		"src/zy.go":               true,
+		"src/xy.go":               false,
+		"cache1":                  true,
+		"cache12":                 false,
+		"main.go":                 false,
+		"./node_modules/x":        true,
+		"Dockerfile":              false,
+		"docs/README.md.template": true,
+	} {
+		require.Equal(t, want, m.Matches(path), path)
+	}
+	require.True(t, m.HasExclusions())
+}
+
+func Test_MatcherLastRuleWins(t *testing.T) {
+	m, err := NewMatcher([]string{"*.md", "!README.md", "README.md"})
+	require.NoError(t, err)
+	require.True(t, m.Matches("README.md"))
+	require.True(t, m.HasExclusions())
+}
+
+func Test_MatcherInvalidPattern(t *testing.T) {
+	_, err := NewMatcher([]string{"src/[abc"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unterminated character class")
+}
+
+func Test_ReadIgnoreFile(t *testing.T) {
+	rules, err := ReadIgnoreFile(strings.NewReader("a\n# b\n\n!c\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "# b", "", "!c"}, rules)
+}
+
+func Test_LoadMatcher(t *testing.T) {
+	dir := t.TempDir()
+
+	m, ignoreFile, err := LoadMatcher(dir, filepath.Join(dir, "Dockerfile"))
+	require.NoError(t, err)
+	require.Empty(t, ignoreFile)
+	require.False(t, m.Matches("anything"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("*.log\n"), 0644))
+	m, ignoreFile, err = LoadMatcher(dir, filepath.Join(dir, "Dockerfile"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, ".dockerignore"), ignoreFile)
+	require.True(t, m.Matches("a.log"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile.dockerignore"), []byte("*.txt\n"), 0644))
+	m, ignoreFile, err = LoadMatcher(dir, filepath.Join(dir, "Dockerfile"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "Dockerfile.dockerignore"), ignoreFile)
+	require.True(t, m.Matches("a.txt"))
+	require.False(t, m.Matches("a.log"))
+}
@@ -0,0 +1,277 @@
+package buildcontext
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// Kinds of remote build contexts.
+const (
+	RemoteGit     = "git"
+	RemoteArchive = "archive"
+	RemoteOCI     = "oci"
+)
+
+// Remote is a build context fetched by the wrapper instead of the executor.
+type Remote struct {
+	// Kind is one of RemoteGit, RemoteArchive or RemoteOCI.
+	Kind string
+	// Location is the repository URL, archive URL or path, or image reference.
+	Location string
+	// Ref is the git branch, tag or commit, empty for the remote HEAD.
+	Ref string
+	// Subdir is the directory within the git repository used as context.
+	Subdir string
+}
+
+// ParseRemote recognizes remote build contexts:
+//
+//	git://host/repo.git#ref:subdir, https://host/repo.git#ref:subdir, git@host:repo.git#ref:subdir
+//	tar://path/to/context.tar.gz, https://host/context.tar.gz
+//	oci://registry/repository:tag
+//
+// It returns false for local paths.
+func ParseRemote(s string) (*Remote, bool, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "oci://"):
+		return &Remote{Kind: RemoteOCI, Location: strings.TrimPrefix(s, "oci://")}, true, nil
+	case strings.HasPrefix(s, "tar://"):
+		return &Remote{Kind: RemoteArchive, Location: strings.TrimPrefix(s, "tar://")}, true, nil
+	case strings.HasPrefix(s, "git://"), strings.HasPrefix(s, "git@"):
+		remote, err := parseGitRemote(s)
+		return remote, true, err
+	case strings.HasPrefix(s, "https://"), strings.HasPrefix(s, "http://"):
+		location, _, _ := strings.Cut(s, "#")
+		switch {
+		case strings.HasSuffix(location, ".git"):
+			remote, err := parseGitRemote(s)
+			return remote, true, err
+		case isArchive(location):
+			return &Remote{Kind: RemoteArchive, Location: s}, true, nil
+		}
+		return nil, true, fmt.Errorf("unsupported remote build context %q: expected a .git repository or a .tar, .tar.gz or .tgz archive", s)
+	}
+	return nil, false, nil
+}
+
+// parseGitRemote parses a git URL with an optional #ref:subdir fragment. Refs starting
+// with a dash are rejected, git would parse them as options.
+func parseGitRemote(s string) (*Remote, error) {
+	location, fragment, _ := strings.Cut(s, "#")
+	ref, subdir, _ := strings.Cut(fragment, ":")
+	if strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid git ref %q in remote build context", ref)
+	}
+	return &Remote{Kind: RemoteGit, Location: location, Ref: ref, Subdir: subdir}, nil
+}
+
+func isArchive(location string) bool {
+	location, _, _ = strings.Cut(location, "?")
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(location, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchOptions configures how remote build contexts are fetched.
+type FetchOptions struct {
+	// HTTP downloads archive contexts.
+	HTTP registry.HTTPClient
+	// Registry pulls OCI artifact contexts, applying registry credentials and mirrors.
+	Registry *registry.Client
+	// Checksum is the expected "sha256:<hex>" digest of an archive context.
+	Checksum string
+	// Git is the git binary, defaults to git from the PATH.
+	Git string
+	// Env is added to the environment of git, e.g. proxy settings.
+	Env []string
+}
+
+// Fetch downloads the remote build context into the dst directory and returns
+// the directory to use as build context.
+func Fetch(ctx context.Context, remote *Remote, dst string, opts FetchOptions) (string, error) {
+	if opts.Checksum != "" && remote.Kind != RemoteArchive {
+		return "", fmt.Errorf("checksum verification is only supported for archive build contexts")
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return "", fmt.Errorf("create build context directory: %w", err)
+	}
+
+	switch remote.Kind {
+	case RemoteGit:
+		return fetchGit(ctx, remote, dst, opts)
+	case RemoteArchive:
+		return dst, fetchArchive(ctx, remote, dst, opts)
+	case RemoteOCI:
+		return dst, fetchOCI(ctx, remote, dst, opts)
+	default:
+		return "", fmt.Errorf("unknown remote build context kind: %s", remote.Kind)
+	}
+}
+
+func fetchGit(ctx context.Context, remote *Remote, dst string, opts FetchOptions) (string, error) {
+	gitBinary := opts.Git
+	if gitBinary == "" {
+		gitBinary = "git"
+	}
+	ref := remote.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	for _, step := range []struct {
+		name string
+		args []string
+	}{
+		{"init", []string{"init", "--quiet", dst}},
+		{"fetch", []string{"-C", dst, "fetch", "--quiet", "--depth", "1", "--", remote.Location, ref}},
+		{"checkout", []string{"-C", dst, "checkout", "--quiet", "FETCH_HEAD"}},
+	} {
+		var out bytes.Buffer
+		gitCmd := exec.CommandContext(ctx, gitBinary, step.args...)
+		gitCmd.Stdout = &out
+		gitCmd.Stderr = &out
+		gitCmd.Env = append(os.Environ(), opts.Env...)
+		if err := gitCmd.Run(); err != nil {
+			return "", fmt.Errorf("git %s: %w: %s", step.name, err, bytes.TrimSpace(out.Bytes()))
+		}
+	}
+	slog.Info("fetched git build context", "location", remote.Location, "ref", ref)
+
+	if remote.Subdir == "" {
+		return dst, nil
+	}
+	dir, err := securePath(dst, remote.Subdir)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("directory %q not found in git build context", remote.Subdir)
+	}
+	// The directory itself may be a symlink of the repository.
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if root, err := filepath.EvalSymlinks(dst); err != nil || !within(root, resolved) {
+		return "", fmt.Errorf("path %q escapes the build context through a symlink", remote.Subdir)
+	}
+	return dir, nil
+}
+
+func fetchArchive(ctx context.Context, remote *Remote, dst string, opts FetchOptions) error {
+	var body io.ReadCloser
+	if strings.HasPrefix(remote.Location, "https://") || strings.HasPrefix(remote.Location, "http://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, remote.Location, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := opts.HTTP.Do(req)
+		if err != nil {
+			return fmt.Errorf("download build context: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("download build context %s: unexpected status %s", remote.Location, resp.Status)
+		}
+		body = resp.Body
+	} else {
+		f, err := os.Open(remote.Location)
+		if err != nil {
+			return fmt.Errorf("open build context archive: %w", err)
+		}
+		body = f
+	}
+	defer body.Close()
+
+	// The archive is spooled to disk so that nothing is extracted before its checksum is verified.
+	archive, err := os.CreateTemp("", "kaniko-context-*.tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(archive, h), body); err != nil {
+		return fmt.Errorf("download build context: %w", err)
+	}
+	digest := "sha256:" + hex.EncodeToString(h.Sum(nil))
+	slog.Info("fetched build context archive", "location", remote.Location, "digest", digest)
+	if opts.Checksum != "" && !strings.EqualFold(opts.Checksum, digest) {
+		return fmt.Errorf("build context archive checksum mismatch: expected %s, got %s", opts.Checksum, digest)
+	}
+
+	if _, err = archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err = extractTar(archive, dst); err != nil {
+		return fmt.Errorf("extract build context archive: %w", err)
+	}
+	return nil
+}
+
+// fetchOCI extracts the layers of an OCI artifact. Tar layers are unpacked in order,
+// other layers are written as files named by their org.opencontainers.image.title annotation.
+func fetchOCI(ctx context.Context, remote *Remote, dst string, opts FetchOptions) error {
+	ref, err := registry.ParseReference(remote.Location)
+	if err != nil {
+		return err
+	}
+	manifest, desc, err := opts.Registry.ImageManifest(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("fetch build context manifest: %w", err)
+	}
+	slog.Info("fetching OCI build context", "reference", ref, "digest", desc.Digest)
+
+	for _, layer := range manifest.Layers {
+		if err := fetchOCILayer(ctx, opts.Registry, ref, layer, dst); err != nil {
+			return fmt.Errorf("fetch build context layer %s: %w", layer.Digest, err)
+		}
+	}
+	return nil
+}
+
+func fetchOCILayer(ctx context.Context, client *registry.Client, ref registry.Reference, layer registry.Descriptor, dst string) error {
+	blob, err := client.Blob(ctx, ref, layer)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	if strings.Contains(layer.MediaType, "tar") {
+		if err = extractTar(blob, dst); err != nil {
+			return err
+		}
+		// Drain the remaining padding so that the digest is verified.
+		_, err = io.Copy(io.Discard, blob)
+		return err
+	}
+
+	title := layer.Annotations["org.opencontainers.image.title"]
+	if title == "" {
+		return fmt.Errorf("layer of type %s has neither tar content nor a title annotation", layer.MediaType)
+	}
+	target, err := securePath(dst, title)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return writeFile(target, blob, 0644)
+}
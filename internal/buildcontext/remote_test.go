@@ -0,0 +1,191 @@
+package buildcontext
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+func Test_ParseRemote(t *testing.T) {
+	for in, want := range map[string]*Remote{
+		"git://github.com/org/repo.git#main:docker": {Kind: RemoteGit, Location: "git://github.com/org/repo.git", Ref: "main", Subdir: "docker"},
+		"https://github.com/org/repo.git#v1.0":      {Kind: RemoteGit, Location: "https://github.com/org/repo.git", Ref: "v1.0"},
+		"https://github.com/org/repo.git":           {Kind: RemoteGit, Location: "https://github.com/org/repo.git"},
+		"git@github.com:org/repo.git#:sub":          {Kind: RemoteGit, Location: "git@github.com:org/repo.git", Subdir: "sub"},
+		"tar:///tmp/context.tar.gz":                 {Kind: RemoteArchive, Location: "/tmp/context.tar.gz"},
+		"https://example.com/context.tar.gz":        {Kind: RemoteArchive, Location: "https://example.com/context.tar.gz"},
+		"https://example.com/context.tgz?sig=abc":   {Kind: RemoteArchive, Location: "https://example.com/context.tgz?sig=abc"},
+		"oci://my.registry/contexts/app:1.0":        {Kind: RemoteOCI, Location: "my.registry/contexts/app:1.0"},
+	} {
+		remote, ok, err := ParseRemote(in)
+		require.NoError(t, err, in)
+		require.True(t, ok, in)
+		require.Equal(t, want, remote, in)
+	}
+
+	for _, local := range []string{".", "/workspace", "src/app", ""} {
+		_, ok, err := ParseRemote(local)
+		require.NoError(t, err, local)
+		require.False(t, ok, local)
+	}
+
+	_, ok, err := ParseRemote("https://example.com/context.zip")
+	require.True(t, ok)
+	require.Error(t, err)
+
+	// Refs are not passed to git as options.
+	_, ok, err = ParseRemote("https://github.com/org/repo.git#--upload-pack=touch /tmp/pwned")
+	require.True(t, ok)
+	require.EqualError(t, err, `invalid git ref "--upload-pack=touch /tmp/pwned" in remote build context`)
+}
+
+// tarball builds a gzipped tarball from a map of paths to contents.
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func sha256Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func Test_FetchArchive(t *testing.T) {
+	archive := tarball(t, map[string]string{"Dockerfile": "FROM scratch\n", "src/main.go": "package main\n"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	t.Run("remote with checksum", func(t *testing.T) {
+		dst := t.TempDir()
+		remote := &Remote{Kind: RemoteArchive, Location: srv.URL + "/context.tar.gz"}
+		dir, err := Fetch(ctx, remote, dst, FetchOptions{HTTP: srv.Client(), Checksum: sha256Digest(archive)})
+		require.NoError(t, err)
+		require.Equal(t, dst, dir)
+		require.FileExists(t, filepath.Join(dst, "src", "main.go"))
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		dst := t.TempDir()
+		remote := &Remote{Kind: RemoteArchive, Location: srv.URL + "/context.tar.gz"}
+		_, err := Fetch(ctx, remote, dst, FetchOptions{HTTP: srv.Client(), Checksum: "sha256:" + strings.Repeat("0", 64)})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "checksum mismatch")
+		require.NoFileExists(t, filepath.Join(dst, "Dockerfile"))
+	})
+
+	t.Run("local tar", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "context.tar.gz")
+		require.NoError(t, os.WriteFile(path, archive, 0644))
+		dst := t.TempDir()
+		_, err := Fetch(ctx, &Remote{Kind: RemoteArchive, Location: path}, dst, FetchOptions{})
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(dst, "Dockerfile"))
+	})
+
+	t.Run("checksum for git", func(t *testing.T) {
+		_, err := Fetch(ctx, &Remote{Kind: RemoteGit}, t.TempDir(), FetchOptions{Checksum: "sha256:00"})
+		require.Error(t, err)
+	})
+}
+
+func Test_FetchOCI(t *testing.T) {
+	layer := tarball(t, map[string]string{"Dockerfile": "FROM scratch\n"})
+	file := []byte("extra content")
+	config := []byte("{}")
+	manifest, _ := json.Marshal(registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIManifest,
+		Config:        registry.Descriptor{MediaType: "application/vnd.oci.empty.v1+json", Digest: sha256Digest(config), Size: 2},
+		Layers: []registry.Descriptor{
+			{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: sha256Digest(layer), Size: int64(len(layer))},
+			{MediaType: "text/plain", Digest: sha256Digest(file), Size: int64(len(file)), Annotations: map[string]string{"org.opencontainers.image.title": "docs/extra.txt"}},
+		},
+	})
+	blobs := map[string][]byte{sha256Digest(layer): layer, sha256Digest(file): file, sha256Digest(config): config}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/contexts/app/manifests/1.0":
+			w.Write(manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/contexts/app/blobs/"):
+			w.Write(blobs[strings.TrimPrefix(r.URL.Path, "/v2/contexts/app/blobs/")])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	client := registry.NewClient(srv.Client(), nil)
+	client.PlainHTTP = map[string]bool{host: true}
+
+	dst := t.TempDir()
+	_, err := Fetch(context.Background(), &Remote{Kind: RemoteOCI, Location: host + "/contexts/app:1.0"}, dst, FetchOptions{Registry: client})
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(dst, "Dockerfile"))
+	b, err := os.ReadFile(filepath.Join(dst, "docs", "extra.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "extra content", string(b))
+}
+
+func Test_FetchGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet", "--initial-branch=main", repo},
+		{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "--allow-empty", "-m", "init"},
+	} {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, "docker"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "docker", "Dockerfile"), []byte("FROM scratch\n"), 0644))
+	for _, args := range [][]string{
+		{"-C", repo, "add", "."},
+		{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "dockerfile"},
+	} {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	dst := t.TempDir()
+	dir, err := Fetch(context.Background(), &Remote{Kind: RemoteGit, Location: repo, Ref: "main", Subdir: "docker"}, dst, FetchOptions{})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dst, "docker"), dir)
+	require.FileExists(t, filepath.Join(dir, "Dockerfile"))
+
+	_, err = Fetch(context.Background(), &Remote{Kind: RemoteGit, Location: repo, Ref: "main", Subdir: "missing"}, t.TempDir(), FetchOptions{})
+	require.Error(t, err)
+
+	_, err = Fetch(context.Background(), &Remote{Kind: RemoteGit, Location: repo, Ref: "no-such-branch"}, t.TempDir(), FetchOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "git fetch")
+}
@@ -0,0 +1,120 @@
+package buildcontext
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// largestPaths is the number of paths kept in the included and ignored top lists.
+const largestPaths = 10
+
+// PathSize is the size of a file, or of all files below an ignored directory.
+type PathSize struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Report summarises the content of a build context.
+type Report struct {
+	Root            string     `json:"root"`
+	IncludedFiles   int        `json:"includedFiles"`
+	IncludedSize    int64      `json:"includedSize"`
+	IgnoredFiles    int        `json:"ignoredFiles"`
+	IgnoredSize     int64      `json:"ignoredSize"`
+	LargestIncluded []PathSize `json:"largestIncluded,omitempty"`
+	LargestIgnored  []PathSize `json:"largestIgnored,omitempty"`
+}
+
+func (r *Report) include(path string, size int64) {
+	r.IncludedFiles++
+	r.IncludedSize += size
+	r.LargestIncluded = addLargest(r.LargestIncluded, PathSize{Path: path, Size: size})
+}
+
+func (r *Report) ignore(path string, size int64, files int) {
+	r.IgnoredFiles += files
+	r.IgnoredSize += size
+	r.LargestIgnored = addLargest(r.LargestIgnored, PathSize{Path: path, Size: size})
+}
+
+func addLargest(list []PathSize, p PathSize) []PathSize {
+	i := sort.Search(len(list), func(i int) bool { return list[i].Size < p.Size })
+	if i >= largestPaths {
+		return list
+	}
+	list = append(list, PathSize{})
+	copy(list[i+1:], list[i:])
+	list[i] = p
+	if len(list) > largestPaths {
+		list = list[:largestPaths]
+	}
+	return list
+}
+
+// String renders the report as a human readable table.
+func (r *Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Build context %s: %d files (%s) included, %d files (%s) ignored\n",
+		r.Root, r.IncludedFiles, FormatSize(r.IncludedSize), r.IgnoredFiles, FormatSize(r.IgnoredSize))
+	writeLargest(&sb, "Largest included paths", r.LargestIncluded)
+	writeLargest(&sb, "Largest ignored paths", r.LargestIgnored)
+	return sb.String()
+}
+
+func writeLargest(sb *strings.Builder, title string, list []PathSize) {
+	if len(list) == 0 {
+		return
+	}
+	fmt.Fprintf(sb, "%s:\n", title)
+	for _, p := range list {
+		fmt.Fprintf(sb, "  %10s  %s\n", FormatSize(p.Size), p.Path)
+	}
+}
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   1 << 10,
+	"KB":  1000,
+	"KIB": 1 << 10,
+	"M":   1 << 20,
+	"MB":  1000 * 1000,
+	"MIB": 1 << 20,
+	"G":   1 << 30,
+	"GB":  1000 * 1000 * 1000,
+	"GIB": 1 << 30,
+}
+
+// ParseSize parses sizes like "512", "200MB" or "1.5GiB" into bytes.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok || i == 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// FormatSize renders a byte count with a binary unit.
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,54 @@
+package buildcontext
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseSize(t *testing.T) {
+	for in, want := range map[string]int64{
+		"512":     512,
+		"512B":    512,
+		"1k":      1024,
+		"1KB":     1000,
+		"200MiB":  200 << 20,
+		"200 MB":  200 * 1000 * 1000,
+		"1.5GiB":  3 << 29,
+		" 2G ":    2 << 30,
+		"0.5 kib": 512,
+	} {
+		got, err := ParseSize(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"", "MB", "12XB", "1.2.3MB"} {
+		_, err := ParseSize(in)
+		require.Error(t, err, in)
+	}
+}
+
+func Test_FormatSize(t *testing.T) {
+	require.Equal(t, "512 B", FormatSize(512))
+	require.Equal(t, "1.5 KiB", FormatSize(1536))
+	require.Equal(t, "200.0 MiB", FormatSize(200<<20))
+	require.Equal(t, "2.0 GiB", FormatSize(2<<30))
+}
+
+func Test_ReportLargest(t *testing.T) {
+	r := &Report{Root: "/ctx"}
+	for i := 1; i <= largestPaths+5; i++ {
+		r.include(fmt.Sprintf("file%d", i), int64(i))
+	}
+	require.Len(t, r.LargestIncluded, largestPaths)
+	require.Equal(t, PathSize{Path: "file15", Size: 15}, r.LargestIncluded[0])
+	require.Equal(t, PathSize{Path: "file6", Size: 6}, r.LargestIncluded[largestPaths-1])
+	require.Equal(t, 15, r.IncludedFiles)
+
+	r.ignore("node_modules/", 2048, 3)
+	out := r.String()
+	require.Contains(t, out, "Build context /ctx: 15 files (120 B) included, 3 files (2.0 KiB) ignored")
+	require.Contains(t, out, "Largest ignored paths:\n     2.0 KiB  node_modules/\n")
+}
@@ -0,0 +1,328 @@
+package buildcontext
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Options controls how a build context is scanned and staged.
+type Options struct {
+	// Matcher decides which paths are ignored. Nothing is ignored when nil.
+	Matcher *Matcher
+	// Keep lists context relative paths which are staged even when ignored,
+	// such as the Dockerfile and the ignore file, as done by the docker CLI.
+	Keep []string
+	// ModTime, when set, replaces the modification time of every staged entry
+	// so that the staged context does not depend on when it was checked out.
+	ModTime time.Time
+}
+
+// fixedTimeInfo overrides the modification time of a file.
+type fixedTimeInfo struct {
+	fs.FileInfo
+	modTime time.Time
+}
+
+func (i fixedTimeInfo) ModTime() time.Time { return i.modTime }
+
+// sink receives the included entries of a build context.
+type sink interface {
+	Dir(rel string, info fs.FileInfo) error
+	File(rel, abs string, info fs.FileInfo) error
+	Symlink(rel, target string, info fs.FileInfo) error
+	Close() error
+}
+
+// Scan walks the build context and reports its size without staging it.
+func Scan(ctx context.Context, root string, opts Options) (*Report, error) {
+	return walk(ctx, root, opts, nil)
+}
+
+// StageDir copies the included entries of the build context into the dst directory.
+func StageDir(ctx context.Context, root, dst string, opts Options) (*Report, error) {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, fmt.Errorf("create staging directory: %w", err)
+	}
+	return walk(ctx, root, opts, &dirSink{root: dst, modTime: opts.ModTime})
+}
+
+// StageTar writes the included entries of the build context into a gzipped tarball.
+func StageTar(ctx context.Context, root, tarPath string, opts Options) (*Report, error) {
+	f, err := os.Create(tarPath)
+	if err != nil {
+		return nil, fmt.Errorf("create context tarball: %w", err)
+	}
+	gz := gzip.NewWriter(f)
+	// The sink closes the file once the walk is done.
+	return walk(ctx, root, opts, &tarSink{file: f, gz: gz, tw: tar.NewWriter(gz)})
+}
+
+func walk(ctx context.Context, root string, opts Options, s sink) (report *Report, err error) {
+	matcher := opts.Matcher
+	if matcher == nil {
+		matcher = &Matcher{}
+	}
+	keep := map[string]bool{}
+	for _, p := range opts.Keep {
+		keep[filepath.ToSlash(filepath.Clean(p))] = true
+	}
+
+	report = &Report{Root: root}
+	if s != nil {
+		defer func() {
+			if cerr := s.Close(); err == nil && cerr != nil {
+				err = fmt.Errorf("finish staged context: %w", cerr)
+			}
+		}()
+	}
+
+	err = filepath.WalkDir(root, func(abs string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		slashRel := filepath.ToSlash(rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if matcher.Matches(slashRel) && !keep[slashRel] {
+			if !d.IsDir() {
+				report.ignore(slashRel, info.Size(), 1)
+				return nil
+			}
+			if !matcher.HasExclusions() && !keepsBelow(keep, slashRel) {
+				size, files, err := dirSize(abs)
+				if err != nil {
+					return err
+				}
+				report.ignore(slashRel+"/", size, files)
+				return filepath.SkipDir
+			}
+			// Rules may re-include entries below an ignored directory.
+			return nil
+		}
+
+		if !opts.ModTime.IsZero() {
+			info = fixedTimeInfo{FileInfo: info, modTime: opts.ModTime}
+		}
+
+		if s == nil {
+			if d.Type().IsRegular() {
+				report.include(slashRel, info.Size())
+			}
+			return nil
+		}
+
+		switch {
+		case d.IsDir():
+			return s.Dir(rel, info)
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(abs)
+			if err != nil {
+				return err
+			}
+			report.include(slashRel, 0)
+			return s.Symlink(rel, target, info)
+		case d.Type().IsRegular():
+			report.include(slashRel, info.Size())
+			return s.File(rel, abs, info)
+		default:
+			// Devices, sockets and pipes cannot be used in a build context.
+			return nil
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk build context %s: %w", root, err)
+	}
+	return report, nil
+}
+
+func keepsBelow(keep map[string]bool, dir string) bool {
+	for p := range keep {
+		if len(p) > len(dir) && p[:len(dir)+1] == dir+"/" {
+			return true
+		}
+	}
+	return false
+}
+
+func dirSize(dir string) (size int64, files int, err error) {
+	err = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files, err
+}
+
+// dirSink copies entries into a directory, keeping modes and modification times.
+type dirSink struct {
+	root    string
+	modTime time.Time
+	dirs    []dirTimes
+}
+
+type dirTimes struct {
+	path string
+	info fs.FileInfo
+}
+
+func (s *dirSink) Dir(rel string, info fs.FileInfo) error {
+	dst := filepath.Join(s.root, rel)
+	if err := os.MkdirAll(dst, info.Mode().Perm()|0700); err != nil {
+		return err
+	}
+	// Directory times change while their content is copied, restore them at the end.
+	s.dirs = append(s.dirs, dirTimes{path: dst, info: info})
+	return nil
+}
+
+func (s *dirSink) File(rel, abs string, info fs.FileInfo) error {
+	dst := filepath.Join(s.root, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(abs)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+func (s *dirSink) Symlink(rel, target string, info fs.FileInfo) error {
+	dst := filepath.Join(s.root, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
+func (s *dirSink) Close() error {
+	for i := len(s.dirs) - 1; i >= 0; i-- {
+		d := s.dirs[i]
+		if err := os.Chmod(d.path, d.info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(d.path, d.info.ModTime(), d.info.ModTime()); err != nil {
+			return err
+		}
+	}
+	if s.modTime.IsZero() {
+		return nil
+	}
+	// Parents of re-included entries are created implicitly, normalize their times too.
+	return filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return os.Chtimes(path, s.modTime, s.modTime)
+	})
+}
+
+// tarSink writes entries into a gzipped tarball.
+type tarSink struct {
+	file *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+func (s *tarSink) header(rel, link string, info fs.FileInfo) (*tar.Header, error) {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = filepath.ToSlash(rel)
+	if _, ok := info.(fixedTimeInfo); ok {
+		// Access and change times are taken from the file system otherwise.
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	}
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	return hdr, nil
+}
+
+func (s *tarSink) Dir(rel string, info fs.FileInfo) error {
+	hdr, err := s.header(rel, "", info)
+	if err != nil {
+		return err
+	}
+	return s.tw.WriteHeader(hdr)
+}
+
+func (s *tarSink) File(rel, abs string, info fs.FileInfo) error {
+	hdr, err := s.header(rel, "", info)
+	if err != nil {
+		return err
+	}
+	if err = s.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	in, err := os.Open(abs)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(s.tw, in)
+	return err
+}
+
+func (s *tarSink) Symlink(rel, target string, info fs.FileInfo) error {
+	hdr, err := s.header(rel, target, info)
+	if err != nil {
+		return err
+	}
+	return s.tw.WriteHeader(hdr)
+}
+
+func (s *tarSink) Close() error {
+	if err := s.tw.Close(); err != nil {
+		return err
+	}
+	if err := s.gz.Close(); err != nil {
+		return err
+	}
+	return s.file.Close()
+}
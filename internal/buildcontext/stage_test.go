@@ -0,0 +1,190 @@
+package buildcontext
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeContext creates a build context from a map of relative paths to contents.
+func writeContext(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+func listFiles(t *testing.T, root string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(root, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(files)
+	return files
+}
+
+var testContext = map[string]string{
+	"Dockerfile":            "FROM scratch\n",
+	".dockerignore":         "node_modules\n*.log\ndocs\n!docs/keep.md\n",
+	"main.go":               "package main\n",
+	"debug.log":             "0123456789",
+	"node_modules/a/big.js": "0123456789012345678901234567890123456789",
+	"docs/drop.md":          "drop",
+	"docs/keep.md":          "keep",
+}
+
+func testOptions(t *testing.T, root string) Options {
+	m, _, err := LoadMatcher(root, filepath.Join(root, "Dockerfile"))
+	require.NoError(t, err)
+	return Options{Matcher: m, Keep: []string{"Dockerfile", ".dockerignore"}}
+}
+
+func Test_Scan(t *testing.T) {
+	root := writeContext(t, testContext)
+
+	report, err := Scan(context.Background(), root, testOptions(t, root))
+	require.NoError(t, err)
+	require.Equal(t, 4, report.IncludedFiles)
+	require.Equal(t, int64(len("FROM scratch\n")+len(testContext[".dockerignore"])+len("package main\n")+len("keep")), report.IncludedSize)
+	require.Equal(t, 3, report.IgnoredFiles)
+	require.Equal(t, int64(10+40+4), report.IgnoredSize)
+	require.Equal(t, PathSize{Path: "node_modules/a/big.js", Size: 40}, report.LargestIgnored[0])
+	require.Equal(t, ".dockerignore", report.LargestIncluded[0].Path)
+}
+
+func Test_ScanWithoutExclusionsSkipsIgnoredDirectories(t *testing.T) {
+	root := writeContext(t, map[string]string{
+		".dockerignore":         "node_modules\n",
+		"node_modules/a/big.js": "0123456789",
+		"node_modules/b.js":     "01234",
+	})
+
+	report, err := Scan(context.Background(), root, testOptions(t, root))
+	require.NoError(t, err)
+	require.Equal(t, []PathSize{{Path: "node_modules/", Size: 15}}, report.LargestIgnored)
+	require.Equal(t, 2, report.IgnoredFiles)
+}
+
+func Test_StageDir(t *testing.T) {
+	root := writeContext(t, testContext)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "main.go"), mtime, mtime))
+	require.NoError(t, os.Symlink("main.go", filepath.Join(root, "link.go")))
+
+	dst := filepath.Join(t.TempDir(), "staged")
+	report, err := StageDir(context.Background(), root, dst, testOptions(t, root))
+	require.NoError(t, err)
+	require.Equal(t, 5, report.IncludedFiles)
+
+	require.Equal(t, []string{".dockerignore", "Dockerfile", "docs/keep.md", "link.go", "main.go"}, listFiles(t, dst))
+	info, err := os.Stat(filepath.Join(dst, "main.go"))
+	require.NoError(t, err)
+	require.True(t, mtime.Equal(info.ModTime()))
+	target, err := os.Readlink(filepath.Join(dst, "link.go"))
+	require.NoError(t, err)
+	require.Equal(t, "main.go", target)
+}
+
+func Test_StageDirKeepsIgnoredDockerfile(t *testing.T) {
+	root := writeContext(t, map[string]string{
+		"Dockerfile":    "FROM scratch\n",
+		".dockerignore": "*\n",
+		"main.go":       "package main\n",
+	})
+
+	dst := t.TempDir()
+	_, err := StageDir(context.Background(), root, dst, testOptions(t, root))
+	require.NoError(t, err)
+	require.Equal(t, []string{".dockerignore", "Dockerfile"}, listFiles(t, dst))
+}
+
+func Test_StageTar(t *testing.T) {
+	root := writeContext(t, testContext)
+
+	tarPath := filepath.Join(t.TempDir(), "context.tar.gz")
+	_, err := StageTar(context.Background(), root, tarPath, testOptions(t, root))
+	require.NoError(t, err)
+
+	f, err := os.Open(tarPath)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+	require.Equal(t, []string{".dockerignore", "Dockerfile", "docs/keep.md", "main.go"}, names)
+}
+
+func Test_StageModTime(t *testing.T) {
+	root := writeContext(t, testContext)
+	epoch := time.Unix(1700000000, 0)
+	opts := testOptions(t, root)
+	opts.ModTime = epoch
+
+	dst := filepath.Join(t.TempDir(), "staged")
+	_, err := StageDir(context.Background(), root, dst, opts)
+	require.NoError(t, err)
+	for _, name := range []string{"main.go", "docs", "docs/keep.md"} {
+		info, err := os.Stat(filepath.Join(dst, name))
+		require.NoError(t, err)
+		require.True(t, epoch.Equal(info.ModTime()), name)
+	}
+
+	tarPath := filepath.Join(t.TempDir(), "context.tar.gz")
+	_, err = StageTar(context.Background(), root, tarPath, opts)
+	require.NoError(t, err)
+	f, err := os.Open(tarPath)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.True(t, epoch.Equal(hdr.ModTime), hdr.Name)
+		require.True(t, hdr.AccessTime.IsZero(), hdr.Name)
+	}
+}
+
+func Test_StageCanceled(t *testing.T) {
+	root := writeContext(t, testContext)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := StageDir(ctx, root, t.TempDir(), Options{})
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,220 @@
+// Package contract renders the steps of action.yml for given inputs as the workflow
+// engine does, so that the command line and environment the action passes to its
+// binary can be checked against the flags the binary defines.
+package contract
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Input is an input of the action.
+type Input struct {
+	Description string `yaml:"description"`
+	Default     string `yaml:"default"`
+	Required    bool   `yaml:"required"`
+}
+
+// Output is an output of the action, whose value is an expression.
+type Output struct {
+	Description string `yaml:"description"`
+	Value       string `yaml:"value"`
+}
+
+// Step is a step of a composite action.
+type Step struct {
+	ID   string            `yaml:"id"`
+	Name string            `yaml:"name"`
+	If   string            `yaml:"if"`
+	Uses string            `yaml:"uses"`
+	Run  string            `yaml:"run"`
+	With map[string]string `yaml:"with"`
+	Env  map[string]string `yaml:"env"`
+}
+
+// Action is the definition of a composite action.
+type Action struct {
+	APIVersion  string            `yaml:"apiVersion"`
+	Kind        string            `yaml:"kind"`
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Inputs      map[string]Input  `yaml:"inputs"`
+	Outputs     map[string]Output `yaml:"outputs"`
+	Runs        struct {
+		Using string `yaml:"using"`
+		Steps []Step `yaml:"steps"`
+	} `yaml:"runs"`
+}
+
+// Load reads an action definition.
+func Load(path string) (*Action, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read action: %w", err)
+	}
+	a := &Action{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err = dec.Decode(a); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return a, nil
+}
+
+// Step returns the step of the given id.
+func (a *Action) Step(id string) (*Step, error) {
+	for i := range a.Runs.Steps {
+		if a.Runs.Steps[i].ID == id {
+			return &a.Runs.Steps[i], nil
+		}
+	}
+	return nil, fmt.Errorf("action has no step %s", id)
+}
+
+// Context holds the values of the expressions of a run of the action.
+type Context struct {
+	// Inputs are the inputs set by the workflow, the others take their default.
+	Inputs map[string]string
+	// Variables are the other context variables by name, e.g. cloudbees.workspace.
+	Variables map[string]string
+	// StepOutputs are the outputs of the steps which ran by step id.
+	StepOutputs map[string]map[string]string
+}
+
+var stepOutputRegexp = regexp.MustCompile(`^steps\.([A-Za-z0-9_-]+)\.outputs\.([A-Za-z0-9_-]+)$`)
+
+// resolver returns the resolver of the variables of the context. Inputs must be
+// defined by the action and take their default, an expression of the other
+// variables, when not set; outputs of steps which did not set them are empty.
+func (a *Action) resolver(ctx Context) (Resolver, error) {
+	for name := range ctx.Inputs {
+		if _, ok := a.Inputs[name]; !ok {
+			return nil, fmt.Errorf("unknown input %s", name)
+		}
+	}
+	resolveVariable := func(name string) (string, bool) {
+		if v, ok := ctx.Variables[name]; ok {
+			return v, true
+		}
+		if m := stepOutputRegexp.FindStringSubmatch(name); m != nil {
+			return ctx.StepOutputs[m[1]][m[2]], true
+		}
+		return "", false
+	}
+
+	inputs := map[string]string{}
+	for name, input := range a.Inputs {
+		v, ok := ctx.Inputs[name]
+		if !ok {
+			var err error
+			if v, err = Interpolate(input.Default, resolveVariable); err != nil {
+				return nil, fmt.Errorf("default of input %s: %w", name, err)
+			}
+		}
+		if input.Required && v == "" {
+			return nil, fmt.Errorf("input %s is required", name)
+		}
+		inputs[name] = v
+	}
+	return func(name string) (string, bool) {
+		if input, ok := strings.CutPrefix(name, "inputs."); ok {
+			v, ok := inputs[input]
+			return v, ok
+		}
+		return resolveVariable(name)
+	}, nil
+}
+
+// Invocation is the command line and the environment of a rendered container step.
+type Invocation struct {
+	Entrypoint string
+	Args       []string
+	Env        map[string]string
+}
+
+// Render renders the container step of the given id.
+func (a *Action) Render(stepID string, ctx Context) (*Invocation, error) {
+	step, err := a.Step(stepID)
+	if err != nil {
+		return nil, err
+	}
+	resolve, err := a.resolver(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv := &Invocation{Env: map[string]string{}}
+	if inv.Entrypoint, err = Interpolate(step.With["entrypoint"], resolve); err != nil {
+		return nil, fmt.Errorf("step %s entrypoint: %w", stepID, err)
+	}
+	args, err := Interpolate(step.With["args"], resolve)
+	if err != nil {
+		return nil, fmt.Errorf("step %s args: %w", stepID, err)
+	}
+	if inv.Args, err = SplitArgs(args); err != nil {
+		return nil, fmt.Errorf("step %s args: %w", stepID, err)
+	}
+	for name, value := range step.Env {
+		if inv.Env[name], err = Interpolate(value, resolve); err != nil {
+			return nil, fmt.Errorf("step %s env %s: %w", stepID, name, err)
+		}
+	}
+	return inv, nil
+}
+
+// RenderOutputs renders the outputs of the action, the empty ones are omitted.
+func (a *Action) RenderOutputs(ctx Context) (map[string]string, error) {
+	resolve, err := a.resolver(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outputs := map[string]string{}
+	for name, output := range a.Outputs {
+		v, err := Interpolate(output.Value, resolve)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", name, err)
+		}
+		if v != "" {
+			outputs[name] = v
+		}
+	}
+	return outputs, nil
+}
+
+var stepOutputRefRegexp = regexp.MustCompile(`steps\.([A-Za-z0-9_-]+)\.outputs\.([A-Za-z0-9_-]+)`)
+
+// StepOutputRefs returns the names of the outputs of the step referenced by the
+// outputs and the other steps of the action.
+func (a *Action) StepOutputRefs(stepID string) []string {
+	var sources []string
+	for _, output := range a.Outputs {
+		sources = append(sources, output.Value)
+	}
+	for _, step := range a.Runs.Steps {
+		sources = append(sources, step.If, step.Run)
+		for _, v := range step.With {
+			sources = append(sources, v)
+		}
+		for _, v := range step.Env {
+			sources = append(sources, v)
+		}
+	}
+
+	seen := map[string]bool{}
+	var names []string
+	for _, source := range sources {
+		for _, m := range stepOutputRefRegexp.FindAllStringSubmatch(source, -1) {
+			if m[1] == stepID && !seen[m[2]] {
+				seen[m[2]] = true
+				names = append(names, m[2])
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,105 @@
+package contract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testAction = `apiVersion: automation.cloudbees.io/v1alpha1
+kind: action
+name: Test
+description: Test action
+inputs:
+  destination:
+    required: true
+  context:
+    default: ${{ cloudbees.workspace }}
+  tar-path:
+    required: false
+outputs:
+  digest:
+    value: ${{ steps.build.outputs.digest }}
+  ids:
+    value: ${{ steps.register.outputs.ids }}
+runs:
+  using: composite
+  steps:
+    - id: build
+      uses: docker://example/action:1
+      with:
+        entrypoint: /action
+        args: |
+          --destination "${{ inputs.destination }}"
+          --context "${{ inputs.context }}"
+          ${{ inputs.tar-path && format('--tar-path "{0}"', inputs.tar-path) || '' }}
+      env:
+        DOCKER_CONFIG: ${{ cloudbees.home }}/.docker
+    - id: register
+      if: ${{ steps.build.outputs.ref != '' }}
+      uses: docker://example/register:1
+      run: echo "${{ steps.build.outputs.ref }}"
+`
+
+func loadTestAction(t *testing.T, content string) *Action {
+	path := filepath.Join(t.TempDir(), "action.yml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	a, err := Load(path)
+	require.NoError(t, err)
+	return a
+}
+
+func Test_ActionRender(t *testing.T) {
+	a := loadTestAction(t, testAction)
+	ctx := Context{
+		Inputs:    map[string]string{"destination": "registry.example/app:1.0"},
+		Variables: map[string]string{"cloudbees.workspace": "/workspace", "cloudbees.home": "/home/user"},
+	}
+	inv, err := a.Render("build", ctx)
+	require.NoError(t, err)
+	require.Equal(t, &Invocation{
+		Entrypoint: "/action",
+		Args:       []string{"--destination", "registry.example/app:1.0", "--context", "/workspace"},
+		Env:        map[string]string{"DOCKER_CONFIG": "/home/user/.docker"},
+	}, inv)
+
+	ctx.Inputs["tar-path"] = "/tmp/my image.tar"
+	inv, err = a.Render("build", ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"--destination", "registry.example/app:1.0", "--context", "/workspace", "--tar-path", "/tmp/my image.tar"}, inv.Args)
+
+	_, err = a.Render("build", Context{Inputs: map[string]string{"destination": "app", "tar_path": "x"}, Variables: ctx.Variables})
+	require.ErrorContains(t, err, "unknown input tar_path")
+	_, err = a.Render("build", Context{Variables: ctx.Variables})
+	require.ErrorContains(t, err, "input destination is required")
+	_, err = a.Render("build", Context{Inputs: map[string]string{"destination": "app"}})
+	require.ErrorContains(t, err, "default of input context")
+	_, err = a.Render("push", ctx)
+	require.ErrorContains(t, err, "action has no step push")
+}
+
+func Test_ActionOutputs(t *testing.T) {
+	a := loadTestAction(t, testAction)
+	outputs, err := a.RenderOutputs(Context{
+		Inputs:      map[string]string{"destination": "app"},
+		Variables:   map[string]string{"cloudbees.workspace": "/workspace"},
+		StepOutputs: map[string]map[string]string{"build": {"digest": "sha256:0123", "ref": "{}"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"digest": "sha256:0123"}, outputs)
+
+	require.Equal(t, []string{"digest", "ref"}, a.StepOutputRefs("build"))
+	require.Equal(t, []string{"ids"}, a.StepOutputRefs("register"))
+}
+
+func Test_Load(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yml"))
+	require.ErrorContains(t, err, "read action")
+
+	path := filepath.Join(t.TempDir(), "action.yml")
+	require.NoError(t, os.WriteFile(path, []byte("name: Test\nimputs: {}\n"), 0644))
+	_, err = Load(path)
+	require.ErrorContains(t, err, "field imputs not found")
+}
@@ -0,0 +1,64 @@
+package contract
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SplitArgs splits the args of a container step into words like a POSIX shell,
+// without expansions: words are separated by white space, quotes group words and
+// backslashes escape the next character outside of quotes, and only ", \, $, `
+// and new lines in double quotes.
+func SplitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range s {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("\"\\$`\n", c) {
+				word.WriteRune('\\')
+			}
+			// A backslash before a new line continues the line.
+			if c != '\n' {
+				word.WriteRune(c)
+				inWord = true
+			}
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote, inWord = c, true
+		case unicode.IsSpace(c):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in args", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in args")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,29 @@
+package contract
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SplitArgs(t *testing.T) {
+	args, err := SplitArgs(`--dockerfile "Dockerfile"
+  --context "/work space"
+  --registry-mirrors ""
+  --verbose="true" --label 'a "b"' it\'s \
+  "a\b" "\"quoted\""
+`)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"--dockerfile", "Dockerfile",
+		"--context", "/work space",
+		"--registry-mirrors", "",
+		"--verbose=true", "--label", `a "b"`, "it's",
+		`a\b`, `"quoted"`,
+	}, args)
+
+	_, err = SplitArgs(`--context "unterminated`)
+	require.ErrorContains(t, err, `unterminated " quote`)
+	_, err = SplitArgs(`--context \`)
+	require.ErrorContains(t, err, "trailing backslash")
+}
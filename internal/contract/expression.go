@@ -0,0 +1,336 @@
+package contract
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Resolver returns the value of a context variable such as inputs.destination,
+// false when the variable is unknown.
+type Resolver func(name string) (string, bool)
+
+var expressionRegexp = regexp.MustCompile(`\$\{\{(.*?)\}\}`)
+
+// Interpolate replaces the ${{ expression }} placeholders of s by their values.
+func Interpolate(s string, resolve Resolver) (string, error) {
+	var firstErr error
+	result := expressionRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		v, err := Evaluate(expressionRegexp.FindStringSubmatch(m)[1], resolve)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", strings.TrimSpace(m), err)
+		}
+		return v
+	})
+	return result, firstErr
+}
+
+// Evaluate evaluates an expression of the workflow expression language.
+//
+// Expressions combine string literals in single quotes, a quote being doubled, true
+// and false, context variables (inputs.tar-path), the operators ! && || == and != and
+// the format function. Like in workflows, && and || return one of their operands, the
+// empty string and false being falsy.
+//
+// The expressions of the policy package are not reused: their && and || only take
+// booleans, their identifiers cannot contain dashes and their string literals escape
+// quotes with backslashes, so they cannot evaluate the ${{ }} of action.yml.
+func Evaluate(expr string, resolve Resolver) (string, error) {
+	p := &evaluator{source: expr, resolve: resolve}
+	if err := p.tokenize(); err != nil {
+		return "", err
+	}
+	v, err := p.parseOr()
+	if err != nil {
+		return "", err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return "", p.errorf(t, "unexpected %s", t)
+	}
+	return toString(v), nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// evaluator evaluates the expression while parsing it. Values are strings or booleans.
+type evaluator struct {
+	source  string
+	tokens  []token
+	pos     int
+	resolve Resolver
+}
+
+func (p *evaluator) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("invalid expression at position %d: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+var operators = []string{"&&", "||", "==", "!=", "!", "(", ")", ","}
+
+func (p *evaluator) tokenize() error {
+	s := p.source
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'':
+			// Quotes are escaped by doubling them.
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						j++
+					} else {
+						break
+					}
+				}
+				sb.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return p.errorf(token{pos: i}, "unterminated string")
+			}
+			p.tokens = append(p.tokens, token{kind: tokenString, text: sb.String(), pos: i})
+			i = j + 1
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (isIdentChar(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, token{kind: tokenIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return p.errorf(token{pos: i}, "unexpected character %q", c)
+			}
+			p.tokens = append(p.tokens, token{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokenEOF, pos: len(s)})
+	return nil
+}
+
+func isIdentChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '-'
+}
+
+func (p *evaluator) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *evaluator) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *evaluator) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *evaluator) expect(op string) error {
+	if !p.accept(op) {
+		return p.errorf(p.peek(), "expected %q, got %s", op, p.peek())
+	}
+	return nil
+}
+
+func (p *evaluator) parseOr() (any, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if !truthy(left) {
+			left = right
+		}
+	}
+	return left, nil
+}
+
+func (p *evaluator) parseAnd() (any, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		if truthy(left) {
+			left = right
+		}
+	}
+	return left, nil
+}
+
+func (p *evaluator) parseComparison() (any, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!="} {
+		if p.accept(op) {
+			right, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			// Strings are compared ignoring case, as in workflows.
+			equal := strings.EqualFold(toString(left), toString(right))
+			return equal == (op == "=="), nil
+		}
+	}
+	return left, nil
+}
+
+func (p *evaluator) parseUnary() (any, error) {
+	if p.accept("!") {
+		v, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return !truthy(v), nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *evaluator) parsePrimary() (any, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return t.text, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		if p.accept("(") {
+			return p.parseCall(t)
+		}
+		v, ok := p.resolve(t.text)
+		if !ok {
+			return nil, p.errorf(t, "unknown variable %s", t.text)
+		}
+		return v, nil
+	case tokenOp:
+		if t.text == "(" {
+			v, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return v, p.expect(")")
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", t)
+}
+
+func (p *evaluator) parseCall(name token) (any, error) {
+	var args []any
+	if !p.accept(")") {
+		for {
+			v, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+			if p.accept(")") {
+				break
+			}
+			if err = p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	switch name.text {
+	case "format":
+		if len(args) == 0 {
+			return nil, p.errorf(name, "format requires a format string")
+		}
+		return format(toString(args[0]), args[1:])
+	default:
+		return nil, p.errorf(name, "unknown function %s", name.text)
+	}
+}
+
+// format replaces the {N} placeholders of f by the arguments, {{ and }} by braces.
+func format(f string, args []any) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(f); i++ {
+		switch {
+		case strings.HasPrefix(f[i:], "{{"), strings.HasPrefix(f[i:], "}}"):
+			sb.WriteByte(f[i])
+			i++
+		case f[i] == '{':
+			end := strings.IndexByte(f[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("invalid format string %q", f)
+			}
+			n, err := strconv.Atoi(f[i+1 : i+end])
+			if err != nil || n < 0 || n >= len(args) {
+				return "", fmt.Errorf("invalid placeholder %s in format string %q", f[i:i+end+1], f)
+			}
+			sb.WriteString(toString(args[n]))
+			i += end
+		default:
+			sb.WriteByte(f[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+func truthy(v any) bool {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return v != ""
+}
+
+func toString(v any) string {
+	if b, ok := v.(bool); ok {
+		return strconv.FormatBool(b)
+	}
+	return v.(string)
+}
@@ -0,0 +1,65 @@
+package contract
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Evaluate(t *testing.T) {
+	vars := map[string]string{
+		"inputs.tar-path":      "/tmp/image.tar",
+		"inputs.empty":         "",
+		"inputs.skip-fallback": "false",
+	}
+	resolve := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	for _, c := range []struct {
+		expr string
+		want string
+	}{
+		{expr: "inputs.tar-path", want: "/tmp/image.tar"},
+		{expr: "'it''s'", want: "it's"},
+		{expr: "inputs.tar-path && format('--tar-path \"{0}\"', inputs.tar-path) || ''", want: `--tar-path "/tmp/image.tar"`},
+		{expr: "inputs.empty && format('--x {0}', inputs.empty) || ''", want: ""},
+		{expr: "inputs.empty || 'default'", want: "default"},
+		// Non empty strings are truthy, whatever their content.
+		{expr: "inputs.skip-fallback && 'set'", want: "set"},
+		{expr: "inputs.skip-fallback == 'FALSE'", want: "true"},
+		{expr: "inputs.empty != ''", want: "false"},
+		{expr: "!(inputs.empty) && true", want: "true"},
+		{expr: "format('{{{0}}} {1}', 'a', 'b')", want: "{a} b"},
+	} {
+		v, err := Evaluate(c.expr, resolve)
+		require.NoError(t, err, c.expr)
+		require.Equal(t, c.want, v, c.expr)
+	}
+
+	for expr, wantErr := range map[string]string{
+		"inputs.unknown":             "unknown variable inputs.unknown",
+		"'unterminated":              "unterminated string",
+		"inputs.tar-path inputs.tar": `unexpected "inputs.tar"`,
+		"lower('A')":                 "unknown function lower",
+		"format('{1}', 'a')":         "invalid placeholder {1}",
+		"(inputs.tar-path":           `expected ")"`,
+		"inputs.tar-path > 'a'":      "unexpected character '>'",
+	} {
+		_, err := Evaluate(expr, resolve)
+		require.ErrorContains(t, err, wantErr, expr)
+	}
+}
+
+func Test_Interpolate(t *testing.T) {
+	resolve := func(name string) (string, bool) {
+		return "value", name == "inputs.name"
+	}
+	v, err := Interpolate("--name ${{ inputs.name }} --other=${{inputs.name}}", resolve)
+	require.NoError(t, err)
+	require.Equal(t, "--name value --other=value", v)
+
+	_, err = Interpolate("--name ${{ inputs.nmae }}", resolve)
+	require.ErrorContains(t, err, "${{ inputs.nmae }}: invalid expression at position 2: unknown variable inputs.nmae")
+}
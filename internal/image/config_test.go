@@ -0,0 +1,22 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LayerHistory(t *testing.T) {
+	cfg := ConfigFile{
+		RootFS: RootFS{DiffIDs: []string{"sha256:a", "sha256:b"}},
+		History: []History{
+			{CreatedBy: "ADD rootfs.tar /"},
+			{CreatedBy: "ENV A=b", EmptyLayer: true},
+			{CreatedBy: "RUN make"},
+		},
+	}
+	require.Equal(t, []History{{CreatedBy: "ADD rootfs.tar /"}, {CreatedBy: "RUN make"}}, cfg.LayerHistory())
+
+	cfg.History = cfg.History[:1]
+	require.Equal(t, make([]History, 2), cfg.LayerHistory())
+}
@@ -0,0 +1,243 @@
+package image
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/buildcontext"
+)
+
+// maxMarkdownFiles bounds the file changes listed in Markdown reports.
+const maxMarkdownFiles = 100
+
+// LayerChange is a layer only present in one of two images.
+type LayerChange struct {
+	Kind      string `json:"kind"`
+	Digest    string `json:"digest"`
+	DiffID    string `json:"diffID,omitempty"`
+	Size      int64  `json:"size"`
+	CreatedBy string `json:"createdBy,omitempty"`
+}
+
+// ConfigChange is a runtime setting changed between two images.
+type ConfigChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// Diff lists the changes between two images.
+type Diff struct {
+	Before   string          `json:"before"`
+	After    string          `json:"after"`
+	Layers   []LayerChange   `json:"layers"`
+	Config   []ConfigChange  `json:"config"`
+	Packages []PackageChange `json:"packages"`
+	Files    []FileChange    `json:"files"`
+}
+
+// Empty reports whether both images have the same layers and settings.
+func (d *Diff) Empty() bool {
+	return len(d.Layers) == 0 && len(d.Config) == 0 && len(d.Packages) == 0 && len(d.Files) == 0
+}
+
+// Compare reads the file systems of both images and lists their differences.
+func Compare(before, after *Image) (*Diff, error) {
+	d := &Diff{
+		Before:   before.Name,
+		After:    after.Name,
+		Layers:   []LayerChange{},
+		Config:   diffConfig(before.Config.Config, after.Config.Config),
+		Packages: []PackageChange{},
+		Files:    []FileChange{},
+	}
+	d.Layers = append(layerChanges(FileRemoved, before, after), layerChanges(FileAdded, after, before)...)
+	if len(d.Layers) == 0 {
+		// Identical layers imply identical file systems.
+		return d, nil
+	}
+
+	fsBefore, err := ReadFilesystem(before)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", before.Name, err)
+	}
+	fsAfter, err := ReadFilesystem(after)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", after.Name, err)
+	}
+	if files := DiffFiles(fsBefore.Files, fsAfter.Files); files != nil {
+		d.Files = files
+	}
+	if packages := DiffPackages(fsBefore.Packages(), fsAfter.Packages()); packages != nil {
+		d.Packages = packages
+	}
+	return d, nil
+}
+
+// layerChanges returns the layers of img missing in other, as changes of the given kind.
+func layerChanges(kind string, img, other *Image) []LayerChange {
+	layerID := func(l Layer) string {
+		if l.DiffID != "" {
+			return l.DiffID
+		}
+		return l.Digest
+	}
+	present := map[string]bool{}
+	for _, l := range other.Layers {
+		present[layerID(l)] = true
+	}
+	history := img.Config.LayerHistory()
+	var changes []LayerChange
+	for i, l := range img.Layers {
+		if present[layerID(l)] {
+			continue
+		}
+		c := LayerChange{Kind: kind, Digest: l.Digest, DiffID: l.DiffID, Size: l.Size}
+		if i < len(history) {
+			c.CreatedBy = history[i].CreatedBy
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func diffConfig(before, after ContainerConfig) []ConfigChange {
+	changes := []ConfigChange{}
+	add := func(field, b, a string) {
+		if b != a {
+			changes = append(changes, ConfigChange{Field: field, Before: b, After: a})
+		}
+	}
+	add("User", before.User, after.User)
+	add("WorkingDir", before.WorkingDir, after.WorkingDir)
+	add("Entrypoint", formatCommand(before.Entrypoint), formatCommand(after.Entrypoint))
+	add("Cmd", formatCommand(before.Cmd), formatCommand(after.Cmd))
+	add("ExposedPorts", strings.Join(sortedKeys(before.ExposedPorts), " "), strings.Join(sortedKeys(after.ExposedPorts), " "))
+	add("Volumes", strings.Join(sortedKeys(before.Volumes), " "), strings.Join(sortedKeys(after.Volumes), " "))
+
+	envBefore, envAfter := envMap(before.Env), envMap(after.Env)
+	names := map[string]bool{}
+	for name := range envBefore {
+		names[name] = true
+	}
+	for name := range envAfter {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		add("Env "+name, envBefore[name], envAfter[name])
+	}
+	return changes
+}
+
+func formatCommand(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = fmt.Sprintf("%q", a)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func envMap(env []string) map[string]string {
+	m := map[string]string{}
+	for _, e := range env {
+		name, value, _ := strings.Cut(e, "=")
+		m[name] = value
+	}
+	return m
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Markdown renders the differences for a pull request comment.
+func (d *Diff) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("### Image changes\n\n")
+	fmt.Fprintf(&sb, "Comparing `%s` to `%s`.\n\n", d.Before, d.After)
+	if d.Empty() {
+		sb.WriteString("No changes.\n")
+		return sb.String()
+	}
+
+	if len(d.Layers) > 0 {
+		sb.WriteString("#### Layers\n\n| | Layer | Size | Created by |\n|---|---|---|---|\n")
+		for _, l := range d.Layers {
+			fmt.Fprintf(&sb, "| %s | `%s` | %s | %s |\n", changeSign(l.Kind), shortDigest(l.Digest), buildcontext.FormatSize(l.Size), markdownCode(l.CreatedBy))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(d.Config) > 0 {
+		sb.WriteString("#### Configuration\n\n| Setting | Before | After |\n|---|---|---|\n")
+		for _, c := range d.Config {
+			fmt.Fprintf(&sb, "| %s | %s | %s |\n", c.Field, markdownCode(c.Before), markdownCode(c.After))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(d.Packages) > 0 {
+		sb.WriteString("#### Packages\n\n| | Package | Before | After |\n|---|---|---|---|\n")
+		for _, p := range d.Packages {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", changeSign(p.Kind), p.Name, markdownCode(p.Before), markdownCode(p.After))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(d.Files) > 0 {
+		counts := map[string]int{}
+		for _, f := range d.Files {
+			counts[f.Kind]++
+		}
+		fmt.Fprintf(&sb, "#### Files\n\n<details>\n<summary>%d added, %d removed, %d modified</summary>\n\n| | Path | Changes |\n|---|---|---|\n",
+			counts[FileAdded], counts[FileRemoved], counts[FileModified])
+		for i, f := range d.Files {
+			if i == maxMarkdownFiles {
+				fmt.Fprintf(&sb, "\n%d more files changed.\n", len(d.Files)-maxMarkdownFiles)
+				break
+			}
+			fmt.Fprintf(&sb, "| %s | `%s` | %s |\n", changeSign(f.Kind), f.Path, strings.Join(f.Fields, ", "))
+		}
+		sb.WriteString("\n</details>\n")
+	}
+	return sb.String()
+}
+
+func changeSign(kind string) string {
+	switch kind {
+	case FileAdded:
+		return "+"
+	case FileRemoved:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+func shortDigest(digest string) string {
+	_, hex, _ := strings.Cut(digest, ":")
+	if len(hex) > 12 {
+		return hex[:12]
+	}
+	return digest
+}
+
+// markdownCode renders a value as inline code for a Markdown table.
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) > 80 {
+		s = s[:77] + "..."
+	}
+	return "`" + strings.ReplaceAll(strings.ReplaceAll(s, "`", "'"), "|", "\\|") + "`"
+}
@@ -0,0 +1,94 @@
+package image
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Compare(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	base := layerTar(t, mtime, map[string]string{
+		"etc/os-release":       "ID=test\n",
+		"lib/apk/db/installed": "P:musl\nV:1.2.4-r2\n\nP:curl\nV:8.5.0-r0\n",
+	})
+	openImage := func(name string, cfg ConfigFile, layers ...[]byte) *Image {
+		img, err := OpenTarball(writeTestTarball(t, cfg, layers...))
+		require.NoError(t, err)
+		i := img.Image()
+		i.Name = name
+		return i
+	}
+
+	before := openImage("app:1.0", ConfigFile{
+		Config: ContainerConfig{
+			User:         "root",
+			Env:          []string{"PATH=/bin", "APP_MODE=dev"},
+			Entrypoint:   []string{"/app/main"},
+			ExposedPorts: map[string]struct{}{"8080/tcp": {}},
+		},
+		History: []History{{CreatedBy: "ADD rootfs.tar /"}, {CreatedBy: "COPY main /app/main"}},
+	}, base, layerTar(t, mtime, map[string]string{"app/main": "v1", "app/debug": "x"}))
+	after := openImage("app:2.0", ConfigFile{
+		Config: ContainerConfig{
+			User:         "app",
+			Env:          []string{"PATH=/bin", "APP_PORT=9090"},
+			Entrypoint:   []string{"/app/main", "serve"},
+			ExposedPorts: map[string]struct{}{"9090/tcp": {}},
+		},
+		History: []History{{CreatedBy: "ADD rootfs.tar /"}, {CreatedBy: "RUN apk upgrade curl"}, {CreatedBy: "COPY main /app/main"}},
+	}, base,
+		layerTar(t, mtime, map[string]string{"lib/apk/db/installed": "P:musl\nV:1.2.4-r2\n\nP:curl\nV:8.6.0-r0\n\nP:tzdata\nV:2024a-r0\n"}),
+		layerTar(t, mtime, map[string]string{"app/main": "v2"}))
+
+	d, err := Compare(before, after)
+	require.NoError(t, err)
+	require.Equal(t, "app:1.0", d.Before)
+	require.Len(t, d.Layers, 3)
+	require.Equal(t, FileRemoved, d.Layers[0].Kind)
+	require.Equal(t, "COPY main /app/main", d.Layers[0].CreatedBy)
+	require.Equal(t, FileAdded, d.Layers[1].Kind)
+	require.Equal(t, "RUN apk upgrade curl", d.Layers[1].CreatedBy)
+	require.Equal(t, []ConfigChange{
+		{Field: "User", Before: "root", After: "app"},
+		{Field: "Entrypoint", Before: `["/app/main"]`, After: `["/app/main", "serve"]`},
+		{Field: "ExposedPorts", Before: "8080/tcp", After: "9090/tcp"},
+		{Field: "Env APP_MODE", Before: "dev"},
+		{Field: "Env APP_PORT", After: "9090"},
+	}, d.Config)
+	require.Equal(t, []PackageChange{
+		{Name: "curl", Kind: PackageUpdated, Before: "8.5.0-r0", After: "8.6.0-r0"},
+		{Name: "tzdata", Kind: FileAdded, After: "2024a-r0"},
+	}, d.Packages)
+	require.Equal(t, []FileChange{
+		{Path: "app/debug", Kind: FileRemoved},
+		{Path: "app/main", Kind: FileModified, Fields: []string{"content"}},
+		{Path: "lib/apk/db/installed", Kind: FileModified, Fields: []string{"content"}},
+	}, d.Files)
+
+	md := d.Markdown()
+	require.Contains(t, md, "Comparing `app:1.0` to `app:2.0`.")
+	require.Contains(t, md, "| + | `"+shortDigest(d.Layers[1].Digest)+"` | ")
+	require.Contains(t, md, "| User | `root` | `app` |\n")
+	require.Contains(t, md, "| ~ | curl | `8.5.0-r0` | `8.6.0-r0` |\n")
+	require.Contains(t, md, "<summary>0 added, 1 removed, 2 modified</summary>")
+	require.Contains(t, md, "| - | `app/debug` |  |\n")
+
+	same, err := Compare(before, before)
+	require.NoError(t, err)
+	require.True(t, same.Empty())
+	require.True(t, strings.HasSuffix(same.Markdown(), "No changes.\n"))
+}
+
+func Test_DiffMarkdownTruncatesFiles(t *testing.T) {
+	d := &Diff{Before: "a", After: "b", Layers: []LayerChange{{Kind: FileAdded, Digest: "sha256:0123456789abcdef", Size: 2048}}}
+	for i := 0; i < maxMarkdownFiles+5; i++ {
+		d.Files = append(d.Files, FileChange{Path: "f", Kind: FileAdded})
+	}
+	md := d.Markdown()
+	require.Contains(t, md, "| + | `0123456789ab` | 2.0 KiB |  |\n")
+	require.Contains(t, md, "\n5 more files changed.\n")
+	require.Equal(t, maxMarkdownFiles, strings.Count(md, "| + | `f` |"))
+}
@@ -0,0 +1,137 @@
+package image
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// File is an entry of a layer.
+type File struct {
+	Path     string
+	Type     byte
+	Mode     int64
+	UID, GID int
+	Size     int64
+	ModTime  time.Time
+	Linkname string
+	// Digest is the sha256 digest of the content of regular files.
+	Digest string
+}
+
+// ReadFiles lists the entries of an uncompressed layer, keyed by their cleaned path.
+func ReadFiles(r io.Reader) (map[string]File, error) {
+	files := map[string]File{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read layer: %w", err)
+		}
+		f, err := readFile(hdr, tr, nil)
+		if err != nil {
+			return nil, err
+		}
+		files[f.Path] = f
+	}
+}
+
+// readFile returns the entry of hdr, computing the digest of regular files from r.
+// The content is also copied to content when not nil.
+func readFile(hdr *tar.Header, r io.Reader, content io.Writer) (File, error) {
+	f := File{
+		Path:     cleanPath(hdr.Name),
+		Type:     hdr.Typeflag,
+		Mode:     hdr.Mode,
+		UID:      hdr.Uid,
+		GID:      hdr.Gid,
+		Size:     hdr.Size,
+		ModTime:  hdr.ModTime,
+		Linkname: hdr.Linkname,
+	}
+	if hdr.Typeflag == tar.TypeReg {
+		h := sha256.New()
+		w := io.Writer(h)
+		if content != nil {
+			w = io.MultiWriter(h, content)
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return File{}, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		f.Digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	}
+	return f, nil
+}
+
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// Kinds of file changes.
+const (
+	FileAdded    = "added"
+	FileRemoved  = "removed"
+	FileModified = "modified"
+)
+
+// FileChange is a difference between the files of two layers or images.
+type FileChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	// Fields lists what changed for modified files: type, content, mode, owner, link or mtime.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// DiffFiles compares two file listings, ordered by path.
+func DiffFiles(before, after map[string]File) []FileChange {
+	var changes []FileChange
+	for p, a := range after {
+		b, ok := before[p]
+		if !ok {
+			changes = append(changes, FileChange{Path: p, Kind: FileAdded})
+			continue
+		}
+		if fields := fileDiff(b, a); len(fields) > 0 {
+			changes = append(changes, FileChange{Path: p, Kind: FileModified, Fields: fields})
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			changes = append(changes, FileChange{Path: p, Kind: FileRemoved})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func fileDiff(a, b File) []string {
+	var fields []string
+	if a.Type != b.Type {
+		fields = append(fields, "type")
+	}
+	if a.Digest != b.Digest || a.Size != b.Size {
+		fields = append(fields, "content")
+	}
+	if a.Mode != b.Mode {
+		fields = append(fields, "mode")
+	}
+	if a.UID != b.UID || a.GID != b.GID {
+		fields = append(fields, "owner")
+	}
+	if a.Linkname != b.Linkname {
+		fields = append(fields, "link")
+	}
+	if !a.ModTime.Equal(b.ModTime) {
+		fields = append(fields, "mtime")
+	}
+	return fields
+}
@@ -0,0 +1,33 @@
+package image
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DiffFiles(t *testing.T) {
+	before, err := ReadFiles(bytes.NewReader(layerTar(t, time.Unix(1, 0), map[string]string{
+		"./app/main":  "v1",
+		"app/config":  "same",
+		"app/removed": "gone",
+	})))
+	require.NoError(t, err)
+	after, err := ReadFiles(bytes.NewReader(layerTar(t, time.Unix(2, 0), map[string]string{
+		"app/main":   "v2",
+		"app/config": "same",
+		"app/added":  "new",
+	})))
+	require.NoError(t, err)
+	require.Contains(t, before, "app/main")
+
+	require.Equal(t, []FileChange{
+		{Path: "app/added", Kind: FileAdded},
+		{Path: "app/config", Kind: FileModified, Fields: []string{"mtime"}},
+		{Path: "app/main", Kind: FileModified, Fields: []string{"content", "mtime"}},
+		{Path: "app/removed", Kind: FileRemoved},
+	}, DiffFiles(before, after))
+	require.Empty(t, DiffFiles(after, after))
+}
@@ -0,0 +1,112 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Image is an image whose layers can be read, saved as tarball or in a registry.
+type Image struct {
+	// Name identifies the image in reports, as reference or tarball path.
+	Name   string
+	Config *ConfigFile
+	Layers []Layer
+	// Open returns the uncompressed content of a layer.
+	Open func(Layer) (io.ReadCloser, error)
+}
+
+// Image returns the image of the tarball.
+func (t *Tarball) Image() *Image {
+	return &Image{Name: t.Path, Config: t.Config, Layers: t.Layers, Open: t.OpenLayer}
+}
+
+// Whiteout markers of the OCI layer format.
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// Filesystem is the file system of an image, with all layers applied in order.
+type Filesystem struct {
+	Files map[string]File
+	// contents holds the content of the package databases.
+	contents map[string][]byte
+}
+
+// ReadFilesystem applies the layers of the image, honouring whiteouts.
+func ReadFilesystem(img *Image) (*Filesystem, error) {
+	fs := &Filesystem{Files: map[string]File{}, contents: map[string][]byte{}}
+	for _, layer := range img.Layers {
+		r, err := img.Open(layer)
+		if err != nil {
+			return nil, err
+		}
+		err = fs.apply(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %w", layer.Digest, err)
+		}
+	}
+	return fs, nil
+}
+
+func (fs *Filesystem) apply(r io.Reader) error {
+	added := map[string]bool{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read layer: %w", err)
+		}
+		p := cleanPath(hdr.Name)
+		dir, base := path.Split(p)
+		switch {
+		case base == whiteoutOpaque:
+			// Entries of lower layers below the directory are hidden.
+			fs.remove(strings.TrimSuffix(dir, "/"), added, false)
+		case strings.HasPrefix(base, whiteoutPrefix):
+			fs.remove(dir+strings.TrimPrefix(base, whiteoutPrefix), added, true)
+		default:
+			var content *bytes.Buffer
+			if isPackageDatabase(p) && hdr.Typeflag == tar.TypeReg {
+				content = &bytes.Buffer{}
+			}
+			var w io.Writer
+			if content != nil {
+				w = content
+			}
+			f, err := readFile(hdr, tr, w)
+			if err != nil {
+				return err
+			}
+			fs.Files[f.Path] = f
+			added[f.Path] = true
+			if content != nil {
+				fs.contents[f.Path] = content.Bytes()
+			} else {
+				delete(fs.contents, f.Path)
+			}
+		}
+	}
+}
+
+// remove deletes the entries below p, and p itself when self is set,
+// except the ones added by the current layer.
+func (fs *Filesystem) remove(p string, added map[string]bool, self bool) {
+	for name := range fs.Files {
+		if added[name] {
+			continue
+		}
+		if (self && name == p) || strings.HasPrefix(name, p+"/") {
+			delete(fs.Files, name)
+			delete(fs.contents, name)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReadFilesystem(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	img, err := OpenTarball(writeTestTarball(t, ConfigFile{},
+		layerTar(t, mtime, map[string]string{
+			"etc/os-release":      "ID=test\n",
+			"var/cache/apt/a.deb": "deb",
+			"var/cache/apt/b.deb": "deb",
+			"app/old":             "old",
+			"app/keep":            "keep",
+			"var/lib/dpkg/status": "Package: libc6\nStatus: install ok installed\nVersion: 2.36\n",
+		}),
+		layerTar(t, mtime, map[string]string{
+			"app/.wh.old":                  "",
+			"var/cache/apt/.wh..wh..opq":   "",
+			"var/cache/apt/c.deb":          "new",
+			"etc/.wh.os-release":           "",
+			"etc/os-release":               "ID=other\n",
+			"var/lib/dpkg/status.d/.wh.x":  "",
+			"var/lib/dpkg/status.d/base":   "Package: base-files\nVersion: 12\n",
+			"var/lib/dpkg/.wh.status":      "",
+			"lib/apk/db/installed.ignored": "P:musl\n",
+		}),
+	))
+	require.NoError(t, err)
+
+	fs, err := ReadFilesystem(img.Image())
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		"app/keep",
+		"etc/os-release",
+		"var/cache/apt/c.deb",
+		"var/lib/dpkg/status.d/base",
+		"lib/apk/db/installed.ignored",
+	}, sortedKeys(fs.Files))
+	// The whiteout of the lower entry does not hide the entry of the same layer.
+	require.Equal(t, int64(len("ID=other\n")), fs.Files["etc/os-release"].Size)
+	require.Equal(t, map[string]string{"base-files": "12"}, fs.Packages())
+}
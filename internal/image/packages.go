@@ -0,0 +1,102 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Package databases read from image file systems.
+const (
+	dpkgStatus    = "var/lib/dpkg/status"
+	dpkgStatusDir = "var/lib/dpkg/status.d/"
+	apkInstalled  = "lib/apk/db/installed"
+)
+
+func isPackageDatabase(p string) bool {
+	return p == dpkgStatus || p == apkInstalled || strings.HasPrefix(p, dpkgStatusDir)
+}
+
+// Packages returns the versions of the installed dpkg and apk packages by name.
+func (fs *Filesystem) Packages() map[string]string {
+	packages := map[string]string{}
+	for p, content := range fs.contents {
+		if p == apkInstalled {
+			parseStanzas(content, ":", func(fields map[string]string) {
+				if fields["P"] != "" {
+					packages[fields["P"]] = fields["V"]
+				}
+			})
+			continue
+		}
+		parseStanzas(content, ": ", func(fields map[string]string) {
+			// Distroless images list packages in status.d without status.
+			status := fields["Status"]
+			if fields["Package"] != "" && (status == "" || strings.HasSuffix(status, " installed")) {
+				packages[fields["Package"]] = fields["Version"]
+			}
+		})
+	}
+	return packages
+}
+
+// parseStanzas calls fn with the fields of each blank line separated stanza.
+// Continuation lines are ignored.
+func parseStanzas(content []byte, sep string, fn func(map[string]string)) {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(fields) > 0 {
+				fn(fields)
+				fields = map[string]string{}
+			}
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, sep); ok {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	if len(fields) > 0 {
+		fn(fields)
+	}
+}
+
+// PackageUpdated is the kind of packages installed in another version.
+// Added and removed packages have the FileAdded and FileRemoved kinds.
+const PackageUpdated = "updated"
+
+// PackageChange is a package installed, removed or updated between two images.
+type PackageChange struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// DiffPackages compares two package listings, ordered by name.
+func DiffPackages(before, after map[string]string) []PackageChange {
+	var changes []PackageChange
+	for name, version := range after {
+		previous, ok := before[name]
+		switch {
+		case !ok:
+			changes = append(changes, PackageChange{Name: name, Kind: FileAdded, After: version})
+		case previous != version:
+			changes = append(changes, PackageChange{Name: name, Kind: PackageUpdated, Before: previous, After: version})
+		}
+	}
+	for name, version := range before {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, PackageChange{Name: name, Kind: FileRemoved, Before: version})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
@@ -0,0 +1,40 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Packages(t *testing.T) {
+	fs := &Filesystem{contents: map[string][]byte{
+		dpkgStatus: []byte(`Package: libc6
+Status: install ok installed
+Version: 2.36-9
+Description: GNU C Library
+ continuation: not a field
+
+Package: removed-pkg
+Status: deinstall ok config-files
+Version: 1.0
+`),
+		apkInstalled: []byte("C:Q1abc=\nP:musl\nV:1.2.4-r2\n\nP:busybox\nV:1.36.1-r5\n"),
+	}}
+	require.Equal(t, map[string]string{
+		"libc6":   "2.36-9",
+		"musl":    "1.2.4-r2",
+		"busybox": "1.36.1-r5",
+	}, fs.Packages())
+}
+
+func Test_DiffPackages(t *testing.T) {
+	require.Equal(t, []PackageChange{
+		{Name: "curl", Kind: FileAdded, After: "8.5.0"},
+		{Name: "libc6", Kind: PackageUpdated, Before: "2.36-8", After: "2.36-9"},
+		{Name: "wget", Kind: FileRemoved, Before: "1.21"},
+	}, DiffPackages(
+		map[string]string{"libc6": "2.36-8", "wget": "1.21", "zlib": "1.3"},
+		map[string]string{"libc6": "2.36-9", "curl": "8.5.0", "zlib": "1.3"},
+	))
+	require.Nil(t, DiffPackages(map[string]string{"a": "1"}, map[string]string{"a": "1"}))
+}
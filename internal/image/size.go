@@ -0,0 +1,56 @@
+package image
+
+import (
+	"fmt"
+	"io"
+)
+
+// LayerSize is the size of a layer and the instruction that created it.
+type LayerSize struct {
+	Digest string `json:"digest"`
+	// Compressed is the stored size of the layer.
+	Compressed int64 `json:"compressed"`
+	// Uncompressed is the size of the layer content, zero when not measured.
+	Uncompressed int64  `json:"uncompressed,omitempty"`
+	CreatedBy    string `json:"createdBy,omitempty"`
+}
+
+// Sizes summarizes the size of an image.
+type Sizes struct {
+	Compressed   int64       `json:"compressed"`
+	Uncompressed int64       `json:"uncompressed,omitempty"`
+	Layers       []LayerSize `json:"layers"`
+}
+
+// MeasureLayers returns the sizes of the layers of an image. The uncompressed sizes
+// are measured by reading the layers returned by open, and left zero when open is nil.
+func MeasureLayers(cfg *ConfigFile, layers []Layer, open func(Layer) (io.ReadCloser, error)) (*Sizes, error) {
+	history := cfg.LayerHistory()
+	sizes := &Sizes{}
+	for i, layer := range layers {
+		ls := LayerSize{Digest: layer.Digest, Compressed: layer.Size}
+		if i < len(history) {
+			ls.CreatedBy = history[i].CreatedBy
+		}
+		if open != nil {
+			r, err := open(layer)
+			if err != nil {
+				return nil, err
+			}
+			ls.Uncompressed, err = io.Copy(io.Discard, r)
+			r.Close()
+			if err != nil {
+				return nil, fmt.Errorf("read layer %s: %w", layer.Digest, err)
+			}
+		}
+		sizes.Compressed += ls.Compressed
+		sizes.Uncompressed += ls.Uncompressed
+		sizes.Layers = append(sizes.Layers, ls)
+	}
+	return sizes, nil
+}
+
+// Sizes measures the compressed and uncompressed sizes of the image.
+func (t *Tarball) Sizes() (*Sizes, error) {
+	return MeasureLayers(t.Config, t.Layers, t.OpenLayer)
+}
@@ -0,0 +1,39 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TarballSizes(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	base := layerTar(t, mtime, map[string]string{"etc/os-release": "ID=test\n"})
+	app := layerTar(t, mtime, map[string]string{"app/main": "binary"})
+	cfg := ConfigFile{History: []History{
+		{CreatedBy: "ADD rootfs.tar /"},
+		{CreatedBy: "ENV APP=1", EmptyLayer: true},
+		{CreatedBy: "COPY main /app/main"},
+	}}
+	img, err := OpenTarball(writeTestTarball(t, cfg, base, app))
+	require.NoError(t, err)
+
+	sizes, err := img.Sizes()
+	require.NoError(t, err)
+	require.Len(t, sizes.Layers, 2)
+	require.Equal(t, LayerSize{
+		Digest:       img.Layers[1].Digest,
+		Compressed:   img.Layers[1].Size,
+		Uncompressed: int64(len(app)),
+		CreatedBy:    "COPY main /app/main",
+	}, sizes.Layers[1])
+	require.Equal(t, "ADD rootfs.tar /", sizes.Layers[0].CreatedBy)
+	require.Equal(t, img.Layers[0].Size+img.Layers[1].Size, sizes.Compressed)
+	require.Equal(t, int64(len(base)+len(app)), sizes.Uncompressed)
+
+	compressedOnly, err := MeasureLayers(img.Config, img.Layers, nil)
+	require.NoError(t, err)
+	require.Equal(t, sizes.Compressed, compressedOnly.Compressed)
+	require.Zero(t, compressedOnly.Uncompressed)
+}
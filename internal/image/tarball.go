@@ -0,0 +1,224 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Layer is a layer of an image.
+type Layer struct {
+	// Digest is the digest of the layer as stored, usually compressed.
+	Digest string
+	// Size is the stored size of the layer.
+	Size int64
+	// DiffID is the digest of the uncompressed layer.
+	DiffID string
+
+	// path is the name of the layer in a tarball.
+	path string
+}
+
+// Tarball is an image saved in the docker archive format, as written by
+// `executor --tar-path` and `buildah push docker-archive:`.
+type Tarball struct {
+	Path         string
+	RepoTags     []string
+	ConfigDigest string
+	Config       *ConfigFile
+	Layers       []Layer
+}
+
+type tarballManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// OpenTarball reads the manifest and configuration of the first image of a docker archive.
+func OpenTarball(path string) (*Tarball, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open image tarball: %w", err)
+	}
+	defer f.Close()
+
+	// The manifest may come after the blobs, so all digests are computed in a single pass.
+	var manifests []tarballManifest
+	digests := map[string]string{}
+	sizes := map[string]int64{}
+	contents := map[string][]byte{}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read image tarball %s: %w", path, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Name == "manifest.json" {
+			if err = json.NewDecoder(tr).Decode(&manifests); err != nil {
+				return nil, fmt.Errorf("parse image tarball manifest: %w", err)
+			}
+			continue
+		}
+		h := sha256.New()
+		w := io.Writer(h)
+		// Only small blobs such as the configuration are kept in memory.
+		var small *bytes.Buffer
+		if hdr.Size <= maxConfigSize {
+			small = &bytes.Buffer{}
+			w = io.MultiWriter(h, small)
+		}
+		if _, err = io.Copy(w, tr); err != nil {
+			return nil, fmt.Errorf("read %s from image tarball: %w", hdr.Name, err)
+		}
+		digests[hdr.Name] = "sha256:" + hex.EncodeToString(h.Sum(nil))
+		sizes[hdr.Name] = hdr.Size
+		if small != nil {
+			contents[hdr.Name] = small.Bytes()
+		}
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("image tarball %s has no manifest.json", path)
+	}
+
+	m := manifests[0]
+	configBlob, ok := contents[m.Config]
+	if !ok {
+		return nil, fmt.Errorf("image tarball %s: config %s not found", path, m.Config)
+	}
+	t := &Tarball{Path: path, RepoTags: m.RepoTags, ConfigDigest: digests[m.Config], Config: &ConfigFile{}}
+	if err = json.Unmarshal(configBlob, t.Config); err != nil {
+		return nil, fmt.Errorf("parse image config: %w", err)
+	}
+	for i, name := range m.Layers {
+		digest, ok := digests[name]
+		if !ok {
+			return nil, fmt.Errorf("image tarball %s: layer %s not found", path, name)
+		}
+		layer := Layer{Digest: digest, Size: sizes[name], path: name}
+		if i < len(t.Config.RootFS.DiffIDs) {
+			layer.DiffID = t.Config.RootFS.DiffIDs[i]
+		}
+		t.Layers = append(t.Layers, layer)
+	}
+	return t, nil
+}
+
+// maxConfigSize bounds the size of blobs read into memory.
+const maxConfigSize = 4 << 20
+
+// OpenLayer returns the uncompressed content of a layer of the tarball.
+func (t *Tarball) OpenLayer(layer Layer) (io.ReadCloser, error) {
+	f, err := os.Open(t.Path)
+	if err != nil {
+		return nil, fmt.Errorf("open image tarball: %w", err)
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			f.Close()
+			return nil, fmt.Errorf("layer %s not found in image tarball", layer.Digest)
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("read image tarball %s: %w", t.Path, err)
+		}
+		if hdr.Name != layer.path {
+			continue
+		}
+		r, err := Uncompressed(tr)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: r, close: f.Close}, nil
+	}
+}
+
+// Uncompressed returns the content of r, decompressing it if it is gzipped.
+func Uncompressed(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip stream: %w", err)
+		}
+		return gz, nil
+	}
+	return br, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r *readCloser) Close() error {
+	return r.close()
+}
+
+// WriteTarball writes an image in the docker archive format. Layers are uncompressed
+// tarballs, which are stored gzipped; the diff IDs of the config are set accordingly.
+func WriteTarball(w io.Writer, cfg ConfigFile, tags []string, layers ...[]byte) error {
+	tw := tar.NewWriter(w)
+	add := func(name string, content []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+
+	m := tarballManifest{RepoTags: tags}
+	cfg.RootFS = RootFS{Type: "layers"}
+	for _, layer := range layers {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		if _, err := gz.Write(layer); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		digest := sha256.Sum256(compressed.Bytes())
+		name := hex.EncodeToString(digest[:]) + ".tar.gz"
+		if err := add(name, compressed.Bytes()); err != nil {
+			return err
+		}
+		diffID := sha256.Sum256(layer)
+		cfg.RootFS.DiffIDs = append(cfg.RootFS.DiffIDs, "sha256:"+hex.EncodeToString(diffID[:]))
+		m.Layers = append(m.Layers, name)
+	}
+
+	configBlob, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(configBlob)
+	m.Config = "sha256:" + hex.EncodeToString(digest[:])
+	if err = add(m.Config, configBlob); err != nil {
+		return err
+	}
+	manifest, err := json.Marshal([]tarballManifest{m})
+	if err != nil {
+		return err
+	}
+	if err = add("manifest.json", manifest); err != nil {
+		return err
+	}
+	return tw.Close()
+}
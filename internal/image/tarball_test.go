@@ -0,0 +1,73 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// layerTar builds an uncompressed layer from a map of paths to contents.
+func layerTar(t *testing.T, mtime time.Time, files map[string]string) []byte {
+	t.Helper()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), ModTime: mtime, Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func writeTestTarball(t *testing.T, cfg ConfigFile, layers ...[]byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "image.tar")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, WriteTarball(f, cfg, []string{"registry.example.com/app:1.0"}, layers...))
+	return path
+}
+
+func Test_Tarball(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	base := layerTar(t, mtime, map[string]string{"etc/os-release": "ID=test\n"})
+	app := layerTar(t, mtime, map[string]string{"app/main": "binary"})
+	path := writeTestTarball(t, ConfigFile{OS: "linux", Config: ContainerConfig{User: "app"}}, base, app)
+
+	img, err := OpenTarball(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"registry.example.com/app:1.0"}, img.RepoTags)
+	require.Equal(t, "app", img.Config.Config.User)
+	require.Len(t, img.Layers, 2)
+	require.Equal(t, img.Config.RootFS.DiffIDs[1], img.Layers[1].DiffID)
+	require.NotEqual(t, img.Layers[0].Digest, img.Layers[1].Digest)
+
+	r, err := img.OpenLayer(img.Layers[1])
+	require.NoError(t, err)
+	defer r.Close()
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, app, content)
+}
+
+func Test_TarballWithoutManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.tar")
+	require.NoError(t, os.WriteFile(path, layerTar(t, time.Now(), map[string]string{"a": "b"}), 0644))
+	_, err := OpenTarball(path)
+	require.ErrorContains(t, err, "has no manifest.json")
+}
@@ -0,0 +1,129 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// checksBaseImages reports whether the base images of the Dockerfile are restricted.
+func (k *Config) checksBaseImages() bool {
+	return strings.TrimSpace(k.AllowedBaseImages) != "" || strings.TrimSpace(k.DeniedBaseImages) != ""
+}
+
+// checkBaseImages fails when an image pulled by a FROM or COPY --from instruction
+// matches a denied pattern, or no allowed pattern when an allow-list is given.
+func (k *Config) checkBaseImages() error {
+	allowed, err := parseImagePatterns(k.AllowedBaseImages)
+	if err != nil {
+		return fmt.Errorf("invalid allowed-base-images: %w", err)
+	}
+	denied, err := parseImagePatterns(k.DeniedBaseImages)
+	if err != nil {
+		return fmt.Errorf("invalid denied-base-images: %w", err)
+	}
+
+	f, err := os.Open(k.resolveDockerfile())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stages, err := dockerfileStages(f, k.buildArgValues())
+	if err != nil {
+		return err
+	}
+
+	var violations []string
+	for _, img := range dockerfileImages(stages) {
+		ref, err := registry.ParseReference(img.image)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("%s: %v", img.source, err))
+			continue
+		}
+		name := ref.Registry + "/" + ref.Repository
+		if pattern, ok := matchImagePatterns(denied, name); ok {
+			violations = append(violations, fmt.Sprintf("%s: %s is denied by pattern %s", img.source, name, pattern))
+		} else if _, ok := matchImagePatterns(allowed, name); len(allowed) > 0 && !ok {
+			violations = append(violations, fmt.Sprintf("%s: %s is not allowed", img.source, name))
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("base images not allowed:\n  %s", strings.Join(violations, "\n  "))
+	}
+	return nil
+}
+
+// dockerfileImage is an image pulled by a Dockerfile instruction.
+type dockerfileImage struct {
+	image string
+	// source describes the instruction pulling the image.
+	source string
+}
+
+// dockerfileImages returns the images of FROM and COPY --from instructions of all
+// stages, leaving out scratch and references to other stages.
+func dockerfileImages(stages []dockerfileStage) []dockerfileImage {
+	isStage := func(current int, name string) bool {
+		if i, err := strconv.Atoi(name); err == nil {
+			return i >= 0 && i < current
+		}
+		for _, s := range stages[:current] {
+			if s.name != "" && s.name == strings.ToLower(name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var images []dockerfileImage
+	for i, s := range stages {
+		stage := strconv.Itoa(i + 1)
+		if s.name != "" {
+			stage = s.name
+		}
+		if !strings.EqualFold(s.image, "scratch") && !isStage(i, s.image) {
+			images = append(images, dockerfileImage{image: s.image, source: "FROM " + s.image + " in stage " + stage})
+		}
+		for _, from := range s.copyFrom {
+			if !isStage(i, from) {
+				images = append(images, dockerfileImage{image: from, source: "COPY --from=" + from + " in stage " + stage})
+			}
+		}
+	}
+	return images
+}
+
+// parseImagePatterns splits comma or newline separated glob patterns of image names.
+func parseImagePatterns(value string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		p = strings.TrimSuffix(strings.TrimSpace(p), "/")
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", p, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// matchImagePatterns returns the first pattern matching the image name or one of
+// its parent paths, so that registry.example.com or docker.io/library match all the
+// images below them. Within a path segment, * matches any characters.
+func matchImagePatterns(patterns []string, name string) (string, bool) {
+	segments := strings.Split(name, "/")
+	for _, pattern := range patterns {
+		for i := range segments {
+			if ok, _ := path.Match(pattern, strings.Join(segments[:i+1], "/")); ok {
+				return pattern, true
+			}
+		}
+	}
+	return "", false
+}
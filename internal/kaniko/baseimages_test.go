@@ -0,0 +1,137 @@
+package kaniko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+const baseImagesDockerfile = `ARG REGISTRY=docker.io
+FROM ${REGISTRY}/library/golang:1.26 AS build
+ARG TOOLS=gcr.io/tools/protoc:1.0
+COPY --from=${TOOLS} /protoc /usr/bin/protoc
+
+FROM scratch AS empty
+FROM gcr.io/distroless/static:nonroot
+COPY --from=build /app /app
+COPY --from=0 /etc/ssl /etc/ssl
+COPY --from=randomuser/image:latest /bin/tool /bin/tool
+`
+
+func Test_dockerfileImages(t *testing.T) {
+	stages, err := dockerfileStages(strings.NewReader(baseImagesDockerfile), map[string]string{"TOOLS": "quay.io/tools/protoc:2.0"})
+	require.NoError(t, err)
+	require.Equal(t, []dockerfileImage{
+		{image: "docker.io/library/golang:1.26", source: "FROM docker.io/library/golang:1.26 in stage build"},
+		{image: "quay.io/tools/protoc:2.0", source: "COPY --from=quay.io/tools/protoc:2.0 in stage build"},
+		{image: "gcr.io/distroless/static:nonroot", source: "FROM gcr.io/distroless/static:nonroot in stage 3"},
+		{image: "randomuser/image:latest", source: "COPY --from=randomuser/image:latest in stage 3"},
+	}, dockerfileImages(stages))
+}
+
+func Test_dockerfileStagesArgs(t *testing.T) {
+	stages, err := dockerfileStages(strings.NewReader(`ARG BASE=alpine
+ARG TOOL=tools:1
+FROM $BASE
+ARG TOOL
+ARG OTHER=other:${TOOL}
+COPY --from=$TOOL / /
+COPY --from=$OTHER / /
+COPY --from=$BASE / /
+`), nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ARG", "ARG", "COPY", "COPY", "COPY"}, stages[0].instructions)
+	// Global ARGs are only visible in stages when declared again.
+	require.Equal(t, []string{"tools:1", "other:tools:1", ""}, stages[0].copyFrom)
+}
+
+func Test_matchImagePatterns(t *testing.T) {
+	patterns, err := parseImagePatterns("docker.io/library, *.example.com\ngcr.io/distroless/*,\n")
+	require.NoError(t, err)
+	require.Equal(t, []string{"docker.io/library", "*.example.com", "gcr.io/distroless/*"}, patterns)
+
+	for name, want := range map[string]string{
+		"docker.io/library/alpine":       "docker.io/library",
+		"registry.example.com/team/app":  "*.example.com",
+		"gcr.io/distroless/static":       "gcr.io/distroless/*",
+		"gcr.io/distroless/base/nonroot": "gcr.io/distroless/*",
+		"docker.io/randomuser/image":     "",
+		"gcr.io/other/static":            "",
+	} {
+		got, ok := matchImagePatterns(patterns, name)
+		require.Equal(t, want != "", ok, name)
+		require.Equal(t, want, got, name)
+	}
+
+	_, err = parseImagePatterns("docker.io/[library")
+	require.ErrorContains(t, err, `pattern "docker.io/[library"`)
+}
+
+func Test_checkBaseImages(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(baseImagesDockerfile), 0644))
+	t.Setenv("DOCKER_BUILD_ARGS", "")
+
+	for _, c := range []struct {
+		name    string
+		allowed string
+		denied  string
+		wantErr string
+	}{
+		{
+			name:    "all allowed",
+			allowed: "docker.io, gcr.io",
+		},
+		{
+			name:    "not allowed",
+			allowed: "docker.io/library\ngcr.io/distroless",
+			wantErr: "base images not allowed:\n" +
+				"  COPY --from=gcr.io/tools/protoc:1.0 in stage build: gcr.io/tools/protoc is not allowed\n" +
+				"  COPY --from=randomuser/image:latest in stage 3: docker.io/randomuser/image is not allowed",
+		},
+		{
+			name:    "denied takes precedence",
+			allowed: "docker.io, gcr.io",
+			denied:  "docker.io/randomuser",
+			wantErr: "COPY --from=randomuser/image:latest in stage 3: docker.io/randomuser/image is denied by pattern docker.io/randomuser",
+		},
+		{
+			name:    "invalid pattern",
+			denied:  "[",
+			wantErr: "invalid denied-base-images",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			k := Config{DockerContext: dir, AllowedBaseImages: c.allowed, DeniedBaseImages: c.denied}
+			require.True(t, k.checksBaseImages())
+			err := k.checkBaseImages()
+			if c.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, c.wantErr)
+		})
+	}
+}
+
+func Test_RunBaseImages(t *testing.T) {
+	executor := testharness.NewExecutor(t, testharness.Scenario{})
+	dir := t.TempDir()
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM randomuser/image\n"), 0644))
+
+	c := Config{
+		ExecutablePath:    executor.Path,
+		DockerContext:     dir,
+		Destination:       "localhost:1/team/app:1.0",
+		AllowedBaseImages: "docker.io/library",
+	}
+	require.ErrorContains(t, c.Run(context.Background()), "docker.io/randomuser/image is not allowed")
+	require.Empty(t, executor.Builds(t))
+}
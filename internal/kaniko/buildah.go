@@ -0,0 +1,243 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+)
+
+const buildahBinary = "buildah"
+
+// buildahBuilder builds with `buildah bud` and pushes every destination with `buildah push`.
+type buildahBuilder struct {
+	config     *Config
+	digestFile string
+	binary     string
+}
+
+func (b *buildahBuilder) Prepare(ctx context.Context) error {
+	if b.localTag() == "" {
+		return fmt.Errorf("the buildah backend requires a destination to tag the image")
+	}
+	execPath, err := exec.LookPath(buildahBinary)
+	if err != nil {
+		return fmt.Errorf("cannot find buildah binary: %w", err)
+	}
+	slog.Debug("found buildah binary", "path", execPath)
+	b.binary = execPath
+
+	k := b.config
+	if k.RegistryMirrors != "" || k.SkipDefaultRegistryFallback {
+		slog.Warn("registry mirrors are not passed to buildah, configure them in registries.conf instead")
+	}
+	if k.KanikoDir != "" {
+		slog.Warn("kaniko-dir is ignored by the buildah backend")
+	}
+	settings, err := k.registrySettingsInConfig()
+	if err != nil {
+		return err
+	}
+	for _, s := range settings {
+		if s.Insecure || s.SkipTLSVerify || s.Certificate != "" || s.ClientCertificate != "" {
+			slog.Warn("TLS settings of registries are not passed to buildah, configure them in registries.conf and certs.d instead", "registry", s.Prefix)
+		}
+	}
+	return nil
+}
+
+func (b *buildahBuilder) Build(ctx context.Context) error {
+	budCmd, err := b.budCmd(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to build buildah command: %w", err)
+	}
+
+	logCommand("running command", budCmd)
+	b.config.recordBuildLog(budCmd)
+
+	if err = b.config.runMonitored(budCmd); err != nil {
+		return fmt.Errorf("run buildah bud: %w", err)
+	}
+	return nil
+}
+
+func (b *buildahBuilder) Push(ctx context.Context) error {
+	pushCmds, err := b.pushCmds(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to build buildah push command: %w", err)
+	}
+
+	for _, pushCmd := range pushCmds {
+		logCommand("running command", pushCmd)
+
+		if err = b.config.runMonitored(pushCmd); err != nil {
+			return fmt.Errorf("run buildah push: %w", err)
+		}
+	}
+	return nil
+}
+
+// ImageConfig reads the configuration of the committed image in the docker format,
+// since the OCI configuration drops the health check.
+func (b *buildahBuilder) ImageConfig(ctx context.Context) (*image.ConfigFile, error) {
+	cmdArgs, err := b.globalArgs()
+	if err != nil {
+		return nil, err
+	}
+	cmdArgs = append(cmdArgs, "inspect", "--type", "image", "--format", "{{json .Docker}}", b.localTag())
+	cmd := b.command(ctx, cmdArgs)
+	cmd.Stdout = nil
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("run buildah inspect: %w", err)
+	}
+	cfg := &image.ConfigFile{}
+	if err = json.Unmarshal(out, cfg); err != nil {
+		return nil, fmt.Errorf("parse buildah inspect output: %w", err)
+	}
+	return cfg, nil
+}
+
+func (b *buildahBuilder) Outputs() (*BuildOutputs, error) {
+	return readDigestFile(b.digestFile)
+}
+
+// localTag is the name the image is committed under before it is pushed.
+func (b *buildahBuilder) localTag() string {
+	for _, destination := range b.config.processDestinations() {
+		if destination = strings.TrimSpace(destination); destination != "" {
+			return destination
+		}
+	}
+	return ""
+}
+
+func (b *buildahBuilder) globalArgs() ([]string, error) {
+	k := b.config
+	if k.Verbosity == "" {
+		return nil, nil
+	}
+	k.Verbosity = strings.ToLower(k.Verbosity)
+	if err := validateVerbosity(k.Verbosity); err != nil {
+		return nil, err
+	}
+	return []string{"--log-level=" + k.Verbosity}, nil
+}
+
+func (b *buildahBuilder) budCmd(ctx context.Context) (*exec.Cmd, error) {
+	k := b.config
+	cmdArgs, err := b.globalArgs()
+	if err != nil {
+		return nil, err
+	}
+	cmdArgs = append(cmdArgs, "bud")
+
+	if k.Dockerfile != "" {
+		cmdArgs = append(cmdArgs, "--file", k.Dockerfile)
+	}
+
+	if tag := b.localTag(); tag != "" {
+		cmdArgs = append(cmdArgs, "--tag", tag)
+	}
+
+	for _, buildArg := range k.processBuildArgs() {
+		cmdArgs = append(cmdArgs, "--build-arg", buildArg)
+	}
+
+	for _, label := range k.processLabels() {
+		cmdArgs = append(cmdArgs, "--label", label)
+	}
+
+	for _, annotation := range k.processAnnotations() {
+		cmdArgs = append(cmdArgs, "--annotation", annotation)
+	}
+
+	if k.Target != "" {
+		cmdArgs = append(cmdArgs, "--target", k.Target)
+	}
+
+	if k.sourceDateEpoch != "" {
+		cmdArgs = append(cmdArgs, "--timestamp", k.sourceDateEpoch)
+	}
+
+	if authFile := k.buildahAuthFile(); authFile != "" {
+		cmdArgs = append(cmdArgs, "--authfile", authFile)
+	}
+
+	dockerContext := k.DockerContext
+	if dockerContext == "" {
+		dockerContext = "."
+	}
+	cmdArgs = append(cmdArgs, dockerContext)
+
+	return b.command(ctx, cmdArgs), nil
+}
+
+func (b *buildahBuilder) pushCmds(ctx context.Context) ([]*exec.Cmd, error) {
+	k := b.config
+	globalArgs, err := b.globalArgs()
+	if err != nil {
+		return nil, err
+	}
+	localTag := b.localTag()
+	authFile := k.buildahAuthFile()
+
+	var cmds []*exec.Cmd
+	for _, destination := range k.processDestinations() {
+		destination = strings.TrimSpace(destination)
+		if destination == "" {
+			continue
+		}
+		cmdArgs := append(append([]string{}, globalArgs...), "push")
+		if authFile != "" {
+			cmdArgs = append(cmdArgs, "--authfile", authFile)
+		}
+		// All destinations share the same image, the digest of the first push is reported.
+		if b.digestFile != "" && len(cmds) == 0 {
+			cmdArgs = append(cmdArgs, "--digestfile", b.digestFile)
+		}
+		cmdArgs = append(cmdArgs, localTag, "docker://"+destination)
+		cmds = append(cmds, b.command(ctx, cmdArgs))
+	}
+
+	if k.TarPath != "" {
+		cmdArgs := append(append([]string{}, globalArgs...), "push", localTag, "docker-archive:"+k.TarPath+":"+localTag)
+		cmds = append(cmds, b.command(ctx, cmdArgs))
+	}
+	return cmds, nil
+}
+
+func (b *buildahBuilder) command(ctx context.Context, args []string) *exec.Cmd {
+	binary := b.binary
+	if binary == "" {
+		binary = buildahBinary
+	}
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Env = append(os.Environ(), b.config.backendEnv()...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// buildahAuthFile returns the docker config prepared for the action, which
+// buildah does not pick up from DOCKER_CONFIG on its own.
+func (k *Config) buildahAuthFile() string {
+	dockerConfig := k.dockerConfig
+	if dockerConfig == "" {
+		dockerConfig = os.Getenv("DOCKER_CONFIG")
+	}
+	if dockerConfig == "" {
+		return ""
+	}
+	authFile := filepath.Join(dockerConfig, "config.json")
+	if _, err := os.Stat(authFile); err != nil {
+		return ""
+	}
+	return authFile
+}
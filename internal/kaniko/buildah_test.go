@@ -0,0 +1,86 @@
+package kaniko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_buildahBudCmd(t *testing.T) {
+	t.Setenv("DOCKER_BUILD_ARGS", "key1=value1")
+	t.Setenv("DOCKER_LABELS", "key_l1=l_value1")
+	dockerConfig := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dockerConfig, "config.json"), []byte("{}"), 0600))
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+
+	b := buildahBuilder{
+		config: &Config{
+			Dockerfile:    "Dockerfile",
+			DockerContext: "src",
+			Destination:   "my.registry/myimage:1.0.0, my.registry/myimage:latest",
+			Verbosity:     "DEBUG",
+			Target:        "final-stage",
+		},
+		binary: "/usr/bin/buildah",
+	}
+
+	cmd, err := b.budCmd(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"/usr/bin/buildah",
+		"--log-level=debug",
+		"bud",
+		"--file", "Dockerfile",
+		"--tag", "my.registry/myimage:1.0.0",
+		"--build-arg", "key1=value1",
+		"--label", "key_l1=l_value1",
+		"--target", "final-stage",
+		"--authfile", filepath.Join(dockerConfig, "config.json"),
+		"src",
+	}, cmd.Args)
+
+	b.config.Verbosity = "loud"
+	_, err = b.budCmd(context.Background())
+	require.Error(t, err)
+}
+
+func Test_buildahPushCmds(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", "")
+
+	b := buildahBuilder{
+		config: &Config{
+			Destination: "my.registry/myimage:1.0.0, my.registry/myimage:latest",
+			TarPath:     "/out/image.tar",
+		},
+		digestFile: "/tmp/buildah-image-digest",
+		binary:     "/usr/bin/buildah",
+	}
+
+	cmds, err := b.pushCmds(context.Background())
+	require.NoError(t, err)
+	require.Len(t, cmds, 3)
+	require.Equal(t, []string{
+		"/usr/bin/buildah", "push",
+		"--digestfile", "/tmp/buildah-image-digest",
+		"my.registry/myimage:1.0.0", "docker://my.registry/myimage:1.0.0",
+	}, cmds[0].Args)
+	require.Equal(t, []string{
+		"/usr/bin/buildah", "push",
+		"my.registry/myimage:1.0.0", "docker://my.registry/myimage:latest",
+	}, cmds[1].Args)
+	require.Equal(t, []string{
+		"/usr/bin/buildah", "push",
+		"my.registry/myimage:1.0.0", "docker-archive:/out/image.tar:my.registry/myimage:1.0.0",
+	}, cmds[2].Args)
+}
+
+func Test_buildahPrepareWithoutDestination(t *testing.T) {
+	b := buildahBuilder{config: &Config{Destination: " , ", TarPath: "/out/image.tar"}}
+	require.EqualError(t, b.Prepare(context.Background()), "the buildah backend requires a destination to tag the image")
+
+	b.config.Destination = ", my.registry/myimage:1.0.0"
+	require.Equal(t, "my.registry/myimage:1.0.0", b.localTag())
+}
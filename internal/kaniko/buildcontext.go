@@ -0,0 +1,208 @@
+package kaniko
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/buildcontext"
+)
+
+const (
+	// StageContextNone passes the build context to the backend as is.
+	StageContextNone = "none"
+	// StageContextDir copies the pruned build context into a temporary directory.
+	StageContextDir = "dir"
+	// StageContextTar packs the pruned build context into a temporary tarball.
+	StageContextTar = "tar"
+)
+
+// fetchRemoteContext downloads git, archive and OCI artifact build contexts into a
+// temporary directory used as build context instead. The returned function removes it.
+func (k *Config) fetchRemoteContext() (func(), error) {
+	noop := func() {}
+	remote, ok, err := buildcontext.ParseRemote(k.DockerContext)
+	if err != nil {
+		return noop, err
+	}
+	if !ok {
+		if k.ContextChecksum != "" {
+			return noop, fmt.Errorf("context checksum is only supported for archive build contexts")
+		}
+		return noop, nil
+	}
+
+	client, err := k.registryClient()
+	if err != nil {
+		return noop, err
+	}
+	dir, err := os.MkdirTemp("", "kaniko-remote-context-")
+	if err != nil {
+		return noop, fmt.Errorf("create remote build context directory: %w", err)
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("failed to remove remote build context", "error", err)
+		}
+	}
+
+	contextDir, err := buildcontext.Fetch(k.Context, remote, dir, buildcontext.FetchOptions{
+		HTTP:     k.client,
+		Registry: client,
+		Checksum: k.ContextChecksum,
+		Env:      k.backendEnv(),
+	})
+	if err != nil {
+		cleanup()
+		return noop, fmt.Errorf("fetch remote build context: %w", err)
+	}
+	slog.Info("using remote build context", "dir", contextDir, "context", k.DockerContext)
+	k.DockerContext = contextDir
+	return cleanup, nil
+}
+
+// prepareBuildContext evaluates the .dockerignore rules of a local build context,
+// reports its size and stages the pruned context when requested.
+// The returned function removes the staged context.
+func (k *Config) prepareBuildContext() (func(), error) {
+	noop := func() {}
+	mode := strings.ToLower(strings.TrimSpace(k.StageContext))
+	switch mode {
+	case "", StageContextNone:
+		mode = StageContextNone
+		if k.MaxContextSize == "" {
+			return noop, nil
+		}
+	case StageContextDir:
+	case StageContextTar:
+		if strings.EqualFold(strings.TrimSpace(k.Backend), BackendBuildah) {
+			return noop, fmt.Errorf("staging the build context as tarball is not supported by the buildah backend")
+		}
+	default:
+		return noop, fmt.Errorf("unknown build context staging mode: %s", k.StageContext)
+	}
+
+	var maxSize int64
+	if k.MaxContextSize != "" {
+		size, err := buildcontext.ParseSize(k.MaxContextSize)
+		if err != nil {
+			return noop, fmt.Errorf("max context size: %w", err)
+		}
+		maxSize = size
+	}
+
+	contextDir := k.DockerContext
+	if info, err := os.Stat(contextDir); contextDir == "" || err != nil || !info.IsDir() {
+		return noop, fmt.Errorf("build context %q is not a local directory", contextDir)
+	}
+
+	dockerfile := k.resolveDockerfile()
+	matcher, ignoreFile, err := buildcontext.LoadMatcher(contextDir, dockerfile)
+	if err != nil {
+		return noop, err
+	}
+	if ignoreFile != "" {
+		slog.Info("using ignore file", "path", ignoreFile)
+	}
+	opts := buildcontext.Options{
+		Matcher: matcher,
+		Keep:    contextRelativePaths(contextDir, dockerfile, ignoreFile),
+		ModTime: k.sourceDateEpochTime(),
+	}
+
+	var (
+		report     *buildcontext.Report
+		newContext string
+		cleanup    = noop
+	)
+	switch mode {
+	case StageContextDir, StageContextTar:
+		stagingDir, err := os.MkdirTemp("", "kaniko-context-")
+		if err != nil {
+			return noop, fmt.Errorf("create build context staging directory: %w", err)
+		}
+		cleanup = func() {
+			if err := os.RemoveAll(stagingDir); err != nil {
+				slog.Warn("failed to remove staged build context", "error", err)
+			}
+		}
+		if mode == StageContextDir {
+			newContext = stagingDir
+			report, err = buildcontext.StageDir(k.Context, contextDir, stagingDir, opts)
+		} else {
+			tarPath := filepath.Join(stagingDir, "context.tar.gz")
+			newContext = "tar://" + tarPath
+			report, err = buildcontext.StageTar(k.Context, contextDir, tarPath, opts)
+		}
+		if err != nil {
+			cleanup()
+			return noop, fmt.Errorf("stage build context: %w", err)
+		}
+	default:
+		report, err = buildcontext.Scan(k.Context, contextDir, opts)
+		if err != nil {
+			return noop, fmt.Errorf("scan build context: %w", err)
+		}
+	}
+
+	fmt.Print(report.String())
+	k.contextReport = report
+
+	if maxSize > 0 && report.IncludedSize > maxSize {
+		cleanup()
+		return noop, fmt.Errorf("build context size %s exceeds the maximum of %s",
+			buildcontext.FormatSize(report.IncludedSize), buildcontext.FormatSize(maxSize))
+	}
+
+	if newContext != "" {
+		slog.Info("using staged build context", "path", newContext)
+		k.DockerContext = newContext
+		k.Dockerfile = dockerfile
+	}
+	return cleanup, nil
+}
+
+// resolveDockerfile returns the absolute Dockerfile path the executor would use:
+// relative to the working directory when it exists there, otherwise relative to the context.
+func (k *Config) resolveDockerfile() string {
+	dockerfile := k.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	if filepath.IsAbs(dockerfile) {
+		return dockerfile
+	}
+	if _, err := os.Stat(dockerfile); err != nil {
+		dockerfile = filepath.Join(k.DockerContext, dockerfile)
+	}
+	if abs, err := filepath.Abs(dockerfile); err == nil {
+		return abs
+	}
+	return dockerfile
+}
+
+// contextRelativePaths returns the given paths located inside contextDir, relative to it.
+func contextRelativePaths(contextDir string, paths ...string) []string {
+	absContext, err := filepath.Abs(contextDir)
+	if err != nil {
+		return nil
+	}
+	var rels []string
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(absContext, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rels = append(rels, rel)
+	}
+	return rels
+}
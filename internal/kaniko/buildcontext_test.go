@@ -0,0 +1,172 @@
+package kaniko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudbees-io/kaniko/internal/buildcontext"
+)
+
+func writeBuildContext(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"Dockerfile":          "FROM scratch\nCOPY main.go /\n",
+		".dockerignore":       "node_modules\n",
+		"main.go":             "package main\n",
+		"node_modules/a.js":   strings.Repeat("x", 2048),
+		"node_modules/b/c.js": "c",
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func Test_prepareBuildContext(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("disabled", func(t *testing.T) {
+		c := Config{Context: ctx, DockerContext: "does-not-exist"}
+		cleanup, err := c.prepareBuildContext()
+		require.NoError(t, err)
+		cleanup()
+		require.Equal(t, "does-not-exist", c.DockerContext)
+		require.Nil(t, c.contextReport)
+	})
+
+	t.Run("report only", func(t *testing.T) {
+		dir := writeBuildContext(t)
+		c := Config{Context: ctx, DockerContext: dir, MaxContextSize: "1MiB"}
+		cleanup, err := c.prepareBuildContext()
+		require.NoError(t, err)
+		defer cleanup()
+		require.Equal(t, dir, c.DockerContext)
+		require.Equal(t, 3, c.contextReport.IncludedFiles)
+		require.Equal(t, 2, c.contextReport.IgnoredFiles)
+	})
+
+	t.Run("max size exceeded", func(t *testing.T) {
+		dir := writeBuildContext(t)
+		c := Config{Context: ctx, DockerContext: dir, MaxContextSize: "10B"}
+		_, err := c.prepareBuildContext()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "exceeds the maximum of 10 B")
+	})
+
+	t.Run("invalid max size", func(t *testing.T) {
+		c := Config{Context: ctx, DockerContext: t.TempDir(), MaxContextSize: "lots"}
+		_, err := c.prepareBuildContext()
+		require.Error(t, err)
+	})
+
+	t.Run("stage dir", func(t *testing.T) {
+		dir := writeBuildContext(t)
+		c := Config{Context: ctx, DockerContext: dir, StageContext: "dir"}
+		cleanup, err := c.prepareBuildContext()
+		require.NoError(t, err)
+
+		staged := c.DockerContext
+		require.NotEqual(t, dir, staged)
+		require.Equal(t, filepath.Join(dir, "Dockerfile"), c.Dockerfile)
+		require.FileExists(t, filepath.Join(staged, "main.go"))
+		require.NoDirExists(t, filepath.Join(staged, "node_modules"))
+
+		cleanup()
+		require.NoDirExists(t, staged)
+	})
+
+	t.Run("stage tar", func(t *testing.T) {
+		dir := writeBuildContext(t)
+		c := Config{Context: ctx, DockerContext: dir, StageContext: "TAR"}
+		cleanup, err := c.prepareBuildContext()
+		require.NoError(t, err)
+		defer cleanup()
+
+		require.True(t, strings.HasPrefix(c.DockerContext, "tar://"), c.DockerContext)
+		require.FileExists(t, strings.TrimPrefix(c.DockerContext, "tar://"))
+	})
+
+	t.Run("stage tar with buildah", func(t *testing.T) {
+		c := Config{Context: ctx, DockerContext: writeBuildContext(t), StageContext: "tar", Backend: "buildah"}
+		_, err := c.prepareBuildContext()
+		require.Error(t, err)
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		c := Config{Context: ctx, DockerContext: t.TempDir(), StageContext: "zip"}
+		_, err := c.prepareBuildContext()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unknown build context staging mode: zip")
+	})
+
+	t.Run("context is not a directory", func(t *testing.T) {
+		c := Config{Context: ctx, DockerContext: filepath.Join(t.TempDir(), "missing"), StageContext: "dir"}
+		_, err := c.prepareBuildContext()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "is not a local directory")
+	})
+}
+
+func Test_resolveDockerfile(t *testing.T) {
+	dir := t.TempDir()
+	c := Config{DockerContext: dir}
+	require.Equal(t, filepath.Join(dir, "Dockerfile"), c.resolveDockerfile())
+
+	c.Dockerfile = "/abs/Dockerfile"
+	require.Equal(t, "/abs/Dockerfile", c.resolveDockerfile())
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	c.Dockerfile = "buildcontext.go"
+	require.Equal(t, filepath.Join(wd, "buildcontext.go"), c.resolveDockerfile())
+}
+
+func Test_fetchRemoteContext(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("CLOUDBEES_REGISTRY_CONFIG", "")
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	t.Run("local context", func(t *testing.T) {
+		c := Config{Context: ctx, DockerContext: "."}
+		cleanup, err := c.fetchRemoteContext()
+		require.NoError(t, err)
+		cleanup()
+		require.Equal(t, ".", c.DockerContext)
+	})
+
+	t.Run("checksum for local context", func(t *testing.T) {
+		c := Config{Context: ctx, DockerContext: ".", ContextChecksum: "sha256:00"}
+		_, err := c.fetchRemoteContext()
+		require.Error(t, err)
+	})
+
+	t.Run("tar context", func(t *testing.T) {
+		src := writeBuildContext(t)
+		tarPath := filepath.Join(t.TempDir(), "context.tar.gz")
+		_, err := buildcontext.StageTar(ctx, src, tarPath, buildcontext.Options{})
+		require.NoError(t, err)
+
+		c := Config{Context: ctx, DockerContext: "tar://" + tarPath}
+		cleanup, err := c.fetchRemoteContext()
+		require.NoError(t, err)
+		fetched := c.DockerContext
+		require.FileExists(t, filepath.Join(fetched, "Dockerfile"))
+		require.FileExists(t, filepath.Join(fetched, "node_modules", "a.js"))
+
+		cleanup()
+		require.NoDirExists(t, fetched)
+	})
+
+	t.Run("unsupported remote", func(t *testing.T) {
+		c := Config{Context: ctx, DockerContext: "https://example.com/context.zip"}
+		_, err := c.fetchRemoteContext()
+		require.Error(t, err)
+	})
+}
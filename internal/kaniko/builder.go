@@ -0,0 +1,123 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+)
+
+const (
+	// BackendKaniko builds and pushes with the kaniko executor.
+	BackendKaniko = "kaniko"
+	// BackendBuildah builds with `buildah bud` and pushes with `buildah push`.
+	BackendBuildah = "buildah"
+)
+
+// Builder is a build backend turning the Dockerfile and context of a Config into published images.
+type Builder interface {
+	// Prepare resolves and verifies the backend tooling.
+	Prepare(ctx context.Context) error
+	// Build builds the image.
+	Build(ctx context.Context) error
+	// Push publishes the built image to all destinations.
+	// Backends building and pushing in a single step only complete the pushed manifests here.
+	Push(ctx context.Context) error
+	// Outputs returns information about the published image.
+	Outputs() (*BuildOutputs, error)
+}
+
+// imageInspector is implemented by backends building in two phases, which can read
+// the configuration of the built image before pushing it.
+type imageInspector interface {
+	ImageConfig(ctx context.Context) (*image.ConfigFile, error)
+}
+
+// BuildOutputs describes the image published by a Builder.
+type BuildOutputs struct {
+	// Digest is the digest of the published image manifest.
+	Digest string
+}
+
+// newBuilder returns the Builder for the configured backend.
+// The digest of the built image is only recorded when withDigest is set.
+func (k *Config) newBuilder(withDigest bool) (Builder, error) {
+	backend := strings.ToLower(strings.TrimSpace(k.Backend))
+	digestFile := ""
+	if backend == "" {
+		backend = BackendKaniko
+	}
+	if withDigest {
+		digestFile = filepath.Join(os.TempDir(), backend+"-image-digest")
+	}
+
+	switch backend {
+	case BackendKaniko:
+		return &kanikoBuilder{config: k, digestFile: digestFile}, nil
+	case BackendBuildah:
+		return &buildahBuilder{config: k, digestFile: digestFile}, nil
+	default:
+		return nil, fmt.Errorf("unknown build backend: %s", k.Backend)
+	}
+}
+
+// kanikoBuilder runs the kaniko executor, which builds and pushes in one step.
+type kanikoBuilder struct {
+	config     *Config
+	digestFile string
+	// annotatedDigest is the digest of the manifest once annotated by Push.
+	annotatedDigest string
+}
+
+func (b *kanikoBuilder) Prepare(ctx context.Context) error {
+	b.config.Context = ctx
+	if err := b.config.lookupBinary(); err != nil {
+		return fmt.Errorf("resolve kaniko executor: %w", err)
+	}
+	return nil
+}
+
+func (b *kanikoBuilder) Build(ctx context.Context) error {
+	b.config.Context = ctx
+	kanikoCmd, err := b.config.cmdBuilder(b.digestFile)
+	if err != nil {
+		return fmt.Errorf("failed to build kaniko command: %w", err)
+	}
+
+	logCommand("running command", kanikoCmd)
+	b.config.recordBuildLog(kanikoCmd)
+
+	err = b.config.runMonitored(kanikoCmd)
+	if err != nil {
+		return fmt.Errorf("run kaniko: %w", err)
+	}
+	return nil
+}
+
+// Push annotates the pushed manifest when asked, since the executor cannot.
+func (b *kanikoBuilder) Push(ctx context.Context) error {
+	digest, err := b.config.annotateManifests(ctx)
+	if err != nil {
+		return err
+	}
+	b.annotatedDigest = digest
+	return nil
+}
+
+func (b *kanikoBuilder) Outputs() (*BuildOutputs, error) {
+	if b.annotatedDigest != "" {
+		return &BuildOutputs{Digest: b.annotatedDigest}, nil
+	}
+	return readDigestFile(b.digestFile)
+}
+
+func readDigestFile(digestFile string) (*BuildOutputs, error) {
+	digest, err := os.ReadFile(digestFile)
+	if err != nil {
+		return nil, fmt.Errorf("read image digest: %w", err)
+	}
+	return &BuildOutputs{Digest: strings.TrimSpace(string(digest))}, nil
+}
@@ -0,0 +1,66 @@
+package kaniko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newBuilder(t *testing.T) {
+	for _, c := range []struct {
+		backend string
+		want    Builder
+	}{
+		{backend: "", want: &kanikoBuilder{}},
+		{backend: "kaniko", want: &kanikoBuilder{}},
+		{backend: "Buildah", want: &buildahBuilder{}},
+	} {
+		k := Config{Backend: c.backend}
+		b, err := k.newBuilder(false)
+		require.NoError(t, err, c.backend)
+		require.IsType(t, c.want, b, c.backend)
+	}
+
+	k := Config{Backend: "docker"}
+	_, err := k.newBuilder(false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown build backend: docker")
+}
+
+func Test_RunKanikoBuilder(t *testing.T) {
+	executor := testharness.NewExecutor(t, testharness.Scenario{Digest: "sha256:cafebabebeef"})
+	outDir := t.TempDir()
+	t.Setenv("CLOUDBEES_OUTPUTS", outDir)
+
+	c := Config{
+		ExecutablePath: executor.Path,
+		Destination:    "my.registry/myimage:sometag",
+	}
+	require.NoError(t, c.Run(context.Background()))
+
+	for name, want := range map[string]string{
+		"digest":     "sha256:cafebabebeef",
+		"tag":        "sometag",
+		"tag-digest": "sometag@sha256:cafebabebeef",
+		"image":      "my.registry/myimage:sometag@sha256:cafebabebeef",
+	} {
+		v, err := os.ReadFile(filepath.Join(outDir, name))
+		require.NoError(t, err, name)
+		require.Equal(t, want, string(v), name)
+	}
+}
+
+func Test_RunKanikoBuilderFailure(t *testing.T) {
+	executor := testharness.NewExecutor(t, testharness.Scenario{ExitCode: 3})
+	c := Config{
+		ExecutablePath: executor.Path,
+		Destination:    "my.registry/myimage:sometag",
+	}
+	err := c.Run(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "run kaniko")
+}
@@ -0,0 +1,139 @@
+package kaniko
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+var executorFlagRegexp = regexp.MustCompile(`(?m)^\s+(?:-\w, )?--([\w-]+)`)
+
+// flagCompat describes how an executor flag passed by cmdBuilder is handled
+// when the executor in use does not list it in its --help output.
+type flagCompat struct {
+	// Aliases are spellings of the same flag used by other executor releases.
+	Aliases []string
+	// HasValue is set when the flag takes its value as the following argument.
+	HasValue bool
+	// Required flags cannot be dropped without changing the build result.
+	Required bool
+	// Fallback explains what happens when the flag is dropped.
+	Fallback string
+}
+
+// executorFlags is the compatibility matrix for every flag cmdBuilder may pass.
+var executorFlags = map[string]flagCompat{
+	"ignore-path":                    {Fallback: "the /cloudbees/ directory may be included in snapshots"},
+	"verbosity":                      {Fallback: "the executor default log level is used"},
+	"dockerfile":                     {HasValue: true, Required: true},
+	"context":                        {HasValue: true, Required: true},
+	"destination":                    {HasValue: true, Required: true},
+	"build-arg":                      {HasValue: true, Required: true},
+	"label":                          {HasValue: true, Fallback: "the image is built without labels"},
+	"registry-mirror":                {HasValue: true, Fallback: "base images are pulled from their default registry"},
+	"registry-map":                   {HasValue: true, Fallback: "registry mirrors from the registry configuration are ignored"},
+	"insecure-registry":              {HasValue: true, Required: true},
+	"skip-tls-verify-registry":       {HasValue: true, Required: true},
+	"registry-certificate":           {HasValue: true, Required: true},
+	"registry-client-cert":           {HasValue: true, Required: true},
+	"digest-file":                    {HasValue: true, Required: true},
+	"skip-default-registry-fallback": {Fallback: "base images may be pulled from their default registry"},
+	"target":                         {HasValue: true, Required: true},
+	"tar-path":                       {Aliases: []string{"tarPath"}, HasValue: true, Required: true},
+	"reproducible":                   {Required: true},
+	"no-push":                        {Required: true},
+	"cleanup":                        {Fallback: "the file system is not cleaned up between verification builds"},
+	"kaniko-dir":                     {HasValue: true, Fallback: "the kaniko directory is only passed through the KANIKO_DIR environment variable"},
+}
+
+// executorCapabilities is the set of flag names an executor accepts.
+// A nil set means the capabilities are unknown and all flags are passed through.
+type executorCapabilities map[string]bool
+
+func parseExecutorCapabilities(help string) executorCapabilities {
+	caps := executorCapabilities{}
+	for _, m := range executorFlagRegexp.FindAllStringSubmatch(help, -1) {
+		caps[m[1]] = true
+	}
+	return caps
+}
+
+// probeCapabilities runs `executor --help` and collects the flags it lists.
+func (k *Config) probeCapabilities() (executorCapabilities, error) {
+	var out bytes.Buffer
+	helpCmd := k.executorCommand("--help")
+	helpCmd.Stdout = &out
+	helpCmd.Stderr = &out
+	if err := helpCmd.Run(); err != nil {
+		return nil, fmt.Errorf("run %s --help: %w", k.executorName(), err)
+	}
+
+	caps := parseExecutorCapabilities(out.String())
+	if len(caps) == 0 {
+		return nil, fmt.Errorf("no flags found in %s --help output", k.executorName())
+	}
+	return caps, nil
+}
+
+// adapt rewrites the executor arguments to the flags supported by the executor.
+// Flags known under another name are translated; unsupported optional flags are
+// dropped with a warning unless strict is set, in which case an error is returned.
+// Flags missing from executorFlags are optional.
+func (c executorCapabilities) adapt(args []string, strict bool) ([]string, error) {
+	if c == nil {
+		return args, nil
+	}
+
+	adapted := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			adapted = append(adapted, arg)
+			continue
+		}
+
+		name, value, inline := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if c[name] {
+			adapted = append(adapted, arg)
+			continue
+		}
+
+		compat, known := executorFlags[name]
+		if alias := c.alias(compat); alias != "" {
+			slog.Warn("kaniko executor does not support --" + name + ", using --" + alias + " instead")
+			if inline {
+				adapted = append(adapted, "--"+alias+"="+value)
+			} else {
+				adapted = append(adapted, "--"+alias)
+			}
+			continue
+		}
+
+		if compat.Required || strict {
+			return nil, fmt.Errorf("kaniko executor does not support --%s", name)
+		}
+		if !known {
+			// The value of a flag outside the matrix is recognized by not being a flag.
+			compat = flagCompat{
+				HasValue: i+1 < len(args) && !strings.HasPrefix(args[i+1], "--"),
+				Fallback: "the flag is unknown to the action",
+			}
+		}
+		slog.Warn("kaniko executor does not support --"+name+", dropping it", "fallback", compat.Fallback)
+		if compat.HasValue && !inline && i+1 < len(args) {
+			i++
+		}
+	}
+	return adapted, nil
+}
+
+func (c executorCapabilities) alias(compat flagCompat) string {
+	for _, alias := range compat.Aliases {
+		if c[alias] {
+			return alias
+		}
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+package kaniko
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+const fakeExecutorHelp = `Usage:
+  executor [flags]
+
+Flags:
+      --build-arg multi-arg type      This flag allows you to pass in ARG values at build time.
+  -c, --context string                Path to the dockerfile build context. (default "/workspace/")
+  -d, --destination multi-arg type    Registry the final image should be pushed to.
+      --digest-file string            Specify a file to save the digest of the built image to.
+  -f, --dockerfile string             Path to the dockerfile to be built. (default "Dockerfile")
+      --ignore-path multi-arg type    Ignore these paths when taking a snapshot.
+      --label multi-arg type          Set metadata for an image, see also --cache-repo.
+      --registry-mirror multi-arg type Registry mirror to use as pull-through cache.
+      --tarPath string                Path to save the image in as a tarball.
+      --target string                 Set the target build stage to build
+  -v, --verbosity string              Log level (trace, debug, info, warn, error, fatal, panic) (default "info")
+`
+
+func Test_parseExecutorCapabilities(t *testing.T) {
+	caps := parseExecutorCapabilities(fakeExecutorHelp)
+	require.True(t, caps["context"])
+	require.True(t, caps["tarPath"])
+	require.True(t, caps["verbosity"])
+	require.False(t, caps["kaniko-dir"])
+	require.False(t, caps["c"])
+	require.False(t, caps["cache-repo"])
+}
+
+func Test_adaptExecutorArgs(t *testing.T) {
+	caps := parseExecutorCapabilities(fakeExecutorHelp)
+
+	t.Run("unknown capabilities pass all flags", func(t *testing.T) {
+		args := []string{"--kaniko-dir", "/kaniko", "--skip-default-registry-fallback"}
+		adapted, err := executorCapabilities(nil).adapt(args, true)
+		require.NoError(t, err)
+		require.Equal(t, args, adapted)
+	})
+
+	t.Run("supported flags are kept", func(t *testing.T) {
+		args := []string{"--ignore-path=/cloudbees/", "--verbosity=debug", "--context", ".", "--target", "final-stage"}
+		adapted, err := caps.adapt(args, false)
+		require.NoError(t, err)
+		require.Equal(t, args, adapted)
+	})
+
+	t.Run("aliases are translated", func(t *testing.T) {
+		adapted, err := caps.adapt([]string{"--tar-path", "image.tar", "--tar-path=other.tar"}, true)
+		require.NoError(t, err)
+		require.Equal(t, []string{"--tarPath", "image.tar", "--tarPath=other.tar"}, adapted)
+	})
+
+	t.Run("unsupported optional flags are dropped", func(t *testing.T) {
+		args := []string{
+			"--context", ".",
+			"--registry-map", "docker.io=mirror.example.com",
+			"--skip-default-registry-fallback",
+			"--kaniko-dir", "/kaniko",
+		}
+		adapted, err := caps.adapt(args, false)
+		require.NoError(t, err)
+		require.Equal(t, []string{"--context", "."}, adapted)
+	})
+
+	t.Run("unsupported optional flags fail when strict", func(t *testing.T) {
+		_, err := caps.adapt([]string{"--kaniko-dir", "/kaniko"}, true)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not support --kaniko-dir")
+	})
+
+	t.Run("unknown flags are dropped unless strict", func(t *testing.T) {
+		args := []string{"--context", ".", "--cache-ttl", "6h", "--compressed-caching", "--cache-repo=cache"}
+		adapted, err := caps.adapt(args, false)
+		require.NoError(t, err)
+		require.Equal(t, []string{"--context", "."}, adapted)
+
+		_, err = caps.adapt(args, true)
+		require.EqualError(t, err, "kaniko executor does not support --cache-ttl")
+	})
+
+	t.Run("unsupported required flags always fail", func(t *testing.T) {
+		caps := executorCapabilities{"context": true}
+		_, err := caps.adapt([]string{"--context", ".", "--destination", "my.registry/myimage"}, false)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not support --destination")
+	})
+}
+
+func Test_cmdBuilderCapabilities(t *testing.T) {
+	t.Run("probed capabilities", func(t *testing.T) {
+		c := Config{
+			Context:                     context.Background(),
+			ExecutablePath:              testharness.NewExecutor(t, testharness.Scenario{Help: fakeExecutorHelp}).Path,
+			Dockerfile:                  "Dockerfile",
+			DockerContext:               ".",
+			Destination:                 "gcr.io/kaniko-project/executor:v1.6.0",
+			SkipDefaultRegistryFallback: true,
+			TarPath:                     "image.tar",
+			KanikoDir:                   "/kaniko-work",
+		}
+		require.NoError(t, c.lookupBinary())
+
+		cmd, err := c.cmdBuilder("/tmp/kaniko-test-digest-file")
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			c.ExecutablePath,
+			"--ignore-path=/cloudbees/",
+			"--dockerfile",
+			"Dockerfile",
+			"--context",
+			".",
+			"--destination",
+			"gcr.io/kaniko-project/executor:v1.6.0",
+			"--digest-file",
+			"/tmp/kaniko-test-digest-file",
+			"--tarPath",
+			"image.tar",
+		}, cmd.Args)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		c := Config{
+			Context:             context.Background(),
+			ExecutablePath:      testharness.NewExecutor(t, testharness.Scenario{Help: fakeExecutorHelp}).Path,
+			Destination:         "gcr.io/kaniko-project/executor:v1.6.0",
+			KanikoDir:           "/kaniko-work",
+			StrictExecutorFlags: true,
+		}
+		require.NoError(t, c.lookupBinary())
+
+		_, err := c.cmdBuilder("")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not support --kaniko-dir")
+	})
+
+	t.Run("strict without help output", func(t *testing.T) {
+		c := Config{
+			Context:             context.Background(),
+			ExecutablePath:      testharness.NewExecutor(t, testharness.Scenario{Help: "Usage:\n  executor [flags]\n"}).Path,
+			StrictExecutorFlags: true,
+		}
+		err := c.lookupBinary()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no flags found")
+	})
+}
@@ -0,0 +1,135 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+// e2eBuild prepares a build context and the environment of an end to end build
+// pushing to the registry.
+func e2eBuild(t *testing.T, r *testharness.Registry) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\nCOPY app /app\n"), 0644))
+	writeMirrorConfig(t, r.Host())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	t.Setenv("DOCKER_BUILD_ARGS", "")
+	return dir
+}
+
+func Test_RunEndToEnd(t *testing.T) {
+	r := testharness.NewRegistry(t)
+	e := testharness.NewExecutor(t, testharness.Scenario{
+		Log:    kanikoBuildLog,
+		Config: image.ConfigFile{OS: "linux", Architecture: "amd64"},
+		Layers: [][]byte{fileTar(t, "app", strings.Repeat("x", 4096), time.Unix(0, 0))},
+		Push:   true,
+	})
+	dir := e2eBuild(t, r)
+	outDir := t.TempDir()
+	t.Setenv("CLOUDBEES_OUTPUTS", outDir)
+
+	c := Config{
+		ExecutablePath:   e.Path,
+		DockerContext:    dir,
+		Destination:      r.Host() + "/team/app:1.0",
+		ImageSizeReport:  true,
+		MaxImageSize:     "1MiB",
+		CreatedLabel:     true,
+		AnnotateManifest: true,
+	}
+	require.NoError(t, c.Run(context.Background()))
+
+	digest, content, ok := r.Manifest("team/app", "1.0")
+	require.True(t, ok)
+	// The pushed manifest is annotated after the build.
+	var m registry.Manifest
+	require.NoError(t, json.Unmarshal(content, &m))
+	require.Equal(t, "1.0", m.Annotations["org.opencontainers.image.ref.name"])
+	require.NotEmpty(t, m.Annotations["org.opencontainers.image.created"])
+	// The tag outputs are not checked, they are parsed from the first colon of the
+	// destination, which is the port of the registry here.
+	for name, want := range map[string]string{
+		"digest": digest,
+		"image":  r.Host() + "/team/app:1.0@" + digest,
+	} {
+		v, err := os.ReadFile(filepath.Join(outDir, name))
+		require.NoError(t, err, name)
+		require.Equal(t, want, string(v), name)
+	}
+	// The image size is measured from the pushed manifest.
+	require.Contains(t, r.Requests(), testharness.Request{Method: http.MethodGet, Path: "/v2/team/app/manifests/" + digest})
+
+	// The executor is probed for its version and flags before building.
+	require.Len(t, e.Invocations(t), 3)
+	builds := e.Builds(t)
+	require.Len(t, builds, 1)
+	build := builds[0]
+	require.Equal(t, []string{r.Host() + "/team/app:1.0"}, build.Flag("destination"))
+	require.Equal(t, []string{dir}, build.Flag("context"))
+	require.Equal(t, []string{r.Host()}, build.Flag("insecure-registry"))
+	// The executor keeps its default kaniko directory.
+	require.Empty(t, build.Flag("kaniko-dir"))
+}
+
+func Test_RunEndToEndTarPath(t *testing.T) {
+	r := testharness.NewRegistry(t)
+	e := testharness.NewExecutor(t, testharness.Scenario{
+		Config: image.ConfigFile{OS: "linux"},
+		Layers: [][]byte{
+			fileTar(t, "etc/os-release", "ID=test\n", time.Unix(0, 0)),
+			fileTar(t, "app", "app", time.Unix(0, 0)),
+		},
+	})
+	dir := e2eBuild(t, r)
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	tarPath := filepath.Join(t.TempDir(), "image.tar")
+
+	c := Config{
+		ExecutablePath: e.Path,
+		DockerContext:  dir,
+		Destination:    r.Host() + "/team/app:1.0",
+		TarPath:        tarPath,
+		MaxLayers:      1,
+	}
+	require.ErrorContains(t, c.Run(context.Background()), "image has 2 layers, more than max-layers 1")
+
+	tarball, err := image.OpenTarball(tarPath)
+	require.NoError(t, err)
+	require.Equal(t, []string{r.Host() + "/team/app:1.0"}, tarball.RepoTags)
+	require.Equal(t, []string{tarPath}, e.Builds(t)[0].Flag("tar-path"))
+	_, _, ok := r.Manifest("team/app", "1.0")
+	require.False(t, ok)
+}
+
+func Test_RunEndToEndFailure(t *testing.T) {
+	r := testharness.NewRegistry(t)
+	e := testharness.NewExecutor(t, testharness.Scenario{
+		Log:      "error building image: parsing dockerfile: unknown instruction: COPPY\n",
+		ExitCode: 1,
+		Push:     true,
+	})
+	dir := e2eBuild(t, r)
+	outDir := t.TempDir()
+	t.Setenv("CLOUDBEES_OUTPUTS", outDir)
+
+	c := Config{
+		ExecutablePath: e.Path,
+		DockerContext:  dir,
+		Destination:    r.Host() + "/team/app:1.0",
+	}
+	require.ErrorContains(t, c.Run(context.Background()), "run kaniko")
+	_, _, ok := r.Manifest("team/app", "1.0")
+	require.False(t, ok)
+	require.NoFileExists(t, filepath.Join(outDir, "digest"))
+}
@@ -4,11 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 
 	"github.com/distribution/reference"
@@ -16,10 +15,6 @@ import (
 	"github.com/cloudbees-io/registry-config/pkg/registries"
 )
 
-const (
-	kanikoExecutorBinary = "executor"
-)
-
 // HTTPClient defines the methods that we need for our HTTP client.
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -35,75 +30,209 @@ func (r *HttpClient) Do(req *http.Request) (*http.Response, error) {
 
 func (k *Config) Run(ctx context.Context) (err error) {
 	k.Context = ctx
-	k.client = &HttpClient{
-		client: &http.Client{},
+
+	restoreLog, err := k.startLogging()
+	if err != nil {
+		return err
+	}
+	defer restoreLog()
+
+	out, err := k.newOutputWriter()
+	if err != nil {
+		return err
+	}
+	if out != nil && k.Local {
+		out = &recordedOutputs{outputWriter: out}
+	}
+	if k.summarizes() {
+		finish := k.startSummary()
+		defer func() { finish(err) }()
+	}
+	if k.tracesBuild() {
+		finish := k.startTelemetry()
+		defer func() { finish(err) }()
+	}
+	k.startPhase(phaseConfig)
+	builder, err := k.newBuilder(out != nil || k.summarizes())
+	if err != nil {
+		return err
+	}
+
+	k.startPhase(phaseRegistryConfig)
+	cleanupAccess, err := k.prepareRegistryAccess()
+	if err != nil {
+		return err
+	}
+	defer cleanupAccess()
+
+	k.startPhase(phasePreflight)
+	if k.ProbeRegistryMirrors {
+		if err = k.probeRegistryMirrors(); err != nil {
+			return err
+		}
+	}
+
+	if err = builder.Prepare(ctx); err != nil {
+		return err
 	}
-	k.lookupBinary()
 
-	outDir := os.Getenv("CLOUDBEES_OUTPUTS")
-	digestFile := ""
-	if outDir != "" {
-		digestFile = filepath.Join(os.TempDir(), "kaniko-image-digest")
+	cleanupKanikoDir, err := k.prepareKanikoDir()
+	if err != nil {
+		return err
+	}
+	defer cleanupKanikoDir()
+	if err = k.checkFreeDisk(); err != nil {
+		return err
 	}
 
-	kanikoCmd, err := k.cmdBuilder(digestFile)
+	cleanupRemote, err := k.fetchRemoteContext()
 	if err != nil {
-		return fmt.Errorf("failed to build kaniko command: %w", err)
+		return err
 	}
+	defer cleanupRemote()
 
-	fmt.Printf("Running command: %s\n", kanikoCmd.String())
+	if err = k.prepareReproducible(); err != nil {
+		return err
+	}
+	k.prepareOCILabels()
+	if k.checksBaseImages() {
+		if err = k.checkBaseImages(); err != nil {
+			return err
+		}
+	}
+	if k.Policy != "" {
+		if err = k.preparePolicy(); err != nil {
+			return err
+		}
+	}
 
-	err = kanikoCmd.Run()
+	cleanupContext, err := k.prepareBuildContext()
 	if err != nil {
-		return fmt.Errorf("run kaniko: %w", err)
+		return err
+	}
+	defer cleanupContext()
+
+	if k.VerifyReproducible {
+		return k.verifyReproducible()
 	}
 
-	if outDir != "" {
-		err = k.writeActionOutputs(outDir, digestFile)
+	if k.checksImageSize() {
+		if err = k.prepareImageSize(); err != nil {
+			return err
+		}
+	}
+	if k.ImageDiff {
+		k.prepareImageDiff()
+	}
+
+	k.startPhase(phaseExecutor)
+	outputsWritten := false
+	if out != nil {
+		defer func() {
+			if !outputsWritten {
+				k.writeFailedBuildOutputs(out)
+			}
+		}()
+	}
+	if err = builder.Build(ctx); err != nil {
+		return err
+	}
+
+	// Two-phase backends are checked before pushing, others once the image is pushed.
+	checkPolicyAfterPush := k.checksImagePolicy()
+	if inspector, ok := builder.(imageInspector); ok && checkPolicyAfterPush {
+		cfg, err := inspector.ImageConfig(ctx)
+		if err != nil {
+			return err
+		}
+		if err = k.checkImagePolicy(cfg); err != nil {
+			return err
+		}
+		checkPolicyAfterPush = false
+	}
+
+	k.startPhase(phasePush)
+	if err = builder.Push(ctx); err != nil {
+		return err
+	}
+
+	k.startPhase(phaseOutputs)
+	var digest string
+	if out != nil || k.summarizes() {
+		outputs, err := builder.Outputs()
+		if err != nil {
+			return err
+		}
+		digest = outputs.Digest
+		k.digest = digest
+	}
+	if out != nil {
+		outputsWritten = true
+		err = k.writeActionOutputs(out, digest)
 		if err != nil {
 			return err
 		}
 	}
+
+	if k.ImageDiff {
+		k.writeImageDiff(out, digest)
+	}
+	if out != nil {
+		if err = out.Close(); err != nil {
+			return fmt.Errorf("write outputs: %w", err)
+		}
+		if recorded, ok := out.(*recordedOutputs); ok {
+			defer printOutputs(os.Stdout, recorded)
+		}
+	}
+	if checkPolicyAfterPush {
+		cfg, err := k.builtImageConfig(digest)
+		if err != nil {
+			return fmt.Errorf("policy: %w", err)
+		}
+		if err = k.checkImagePolicy(cfg); err != nil {
+			return fmt.Errorf("pushed %w", err)
+		}
+	}
+	if k.checksImageSize() {
+		return k.checkImageSize(digest)
+	}
 	return nil
 }
 
-func (k *Config) writeActionOutputs(outDir, digestFile string) error {
+func (k *Config) writeActionOutputs(out outputWriter, digest string) error {
 	dest := k.processDestinations()[0]
 	tag := "latest"
 	if pos := strings.Index(dest, ":"); pos > 0 && pos < len(dest)-1 {
 		tag = dest[pos+1:]
 		dest = dest[:pos]
 	}
-	digest, err := os.ReadFile(digestFile)
-	if err != nil {
-		return fmt.Errorf("read kaniko image digest: %w", err)
-	}
-	err = os.WriteFile(filepath.Join(outDir, "digest"), digest, 0640)
+	err := out.WriteOutput("digest", digest)
 	if err != nil {
-		return fmt.Errorf("write digest output: %w", err)
+		return err
 	}
-	err = os.WriteFile(filepath.Join(outDir, "tag"), []byte(tag), 0640)
+	err = out.WriteOutput("tag", tag)
 	if err != nil {
-		return fmt.Errorf("write tag output: %w", err)
+		return err
 	}
-	tagDigest := fmt.Sprintf("%s@%s", tag, string(digest))
-	err = os.WriteFile(filepath.Join(outDir, "tag-digest"), []byte(tagDigest), 0640)
+	tagDigest := fmt.Sprintf("%s@%s", tag, digest)
+	err = out.WriteOutput("tag-digest", tagDigest)
 	if err != nil {
-		return fmt.Errorf("write tag-digest output: %w", err)
+		return err
 	}
-	imageRef := fmt.Sprintf("%s:%s@%s", dest, tag, string(digest))
-	err = os.WriteFile(filepath.Join(outDir, "image"), []byte(imageRef), 0640)
+	imageRef := fmt.Sprintf("%s:%s@%s", dest, tag, digest)
+	err = out.WriteOutput("image", imageRef)
 	if err != nil {
-		return fmt.Errorf("write image output: %w", err)
+		return err
 	}
-	err = k.writeArtifactMetadata(outDir, string(digest))
+	err = k.writeArtifactMetadata(out, digest)
 	if err != nil {
 		return fmt.Errorf("write artifact metadata: %w", err)
 	}
-	return nil
+	return k.writeResourceOutputs(out)
 }
 
-func (k *Config) writeArtifactMetadata(outDir string, digest string) error {
+func (k *Config) writeArtifactMetadata(out outputWriter, digest string) error {
 	destinations := k.processDestinations()
 	if len(destinations) == 0 {
 		return fmt.Errorf("no destinations found for artifact metadata")
@@ -150,13 +279,38 @@ func (k *Config) writeArtifactMetadata(outDir string, digest string) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal artifact metadata: %w", err)
 	}
-	if k.Verbosity == "debug" || k.Verbosity == "trace" {
-		log.Printf("Artifact metadata: %s\n", string(artifactData))
-	}
+	slog.Debug("artifact metadata", "artifacts", string(artifactData))
 
-	err = os.WriteFile(filepath.Join(outDir, "artifact-ref"), artifactData, 0640)
+	return out.WriteOutput("artifact-ref", string(artifactData))
+}
 
-	return nil
+// prepareRegistryAccess sets up the TLS settings, proxies, HTTP client and
+// registry credentials used by the wrapper and the build backend.
+func (k *Config) prepareRegistryAccess() (func(), error) {
+	noop := func() {}
+	cleanupTLS, err := k.prepareTLS()
+	if err != nil {
+		return noop, err
+	}
+	if k.registryTLS, err = k.registryTLSConfigs(); err != nil {
+		cleanupTLS()
+		return noop, err
+	}
+	if k.proxy, err = k.resolveProxy(); err != nil {
+		cleanupTLS()
+		return noop, err
+	}
+	k.client = k.newHTTPClient()
+
+	cleanupCredentials, err := k.prepareRegistryCredentials()
+	if err != nil {
+		cleanupTLS()
+		return noop, err
+	}
+	return func() {
+		cleanupCredentials()
+		cleanupTLS()
+	}, nil
 }
 
 func (k *Config) processDestinations() []string {
@@ -164,56 +318,54 @@ func (k *Config) processDestinations() []string {
 }
 
 func (k *Config) processBuildArgs() []string {
-	args := os.Getenv("DOCKER_BUILD_ARGS")
-	if args == "" {
-		return nil
+	var buildArgs []string
+	if args := os.Getenv("DOCKER_BUILD_ARGS"); args != "" {
+		buildArgs = strings.Split(args, ",")
+	}
+	if k.sourceDateEpoch != "" && !hasBuildArg(buildArgs, sourceDateEpochArg) {
+		buildArgs = append(buildArgs, sourceDateEpochArg+"="+k.sourceDateEpoch)
+	}
+	return buildArgs
+}
+
+func hasBuildArg(buildArgs []string, name string) bool {
+	for _, arg := range buildArgs {
+		if key, _, _ := strings.Cut(arg, "="); strings.TrimSpace(key) == name {
+			return true
+		}
 	}
-	return strings.Split(args, ",")
+	return false
 }
 
 func (k *Config) processLabels() []string {
-	labels := os.Getenv("DOCKER_LABELS")
-	if labels == "" {
-		return nil
+	var labels []string
+	if l := os.Getenv("DOCKER_LABELS"); l != "" {
+		labels = strings.Split(l, ",")
 	}
-	return strings.Split(labels, ",")
+	return mergeLabels(labels, k.ociLabels)
 }
 
 func (k *Config) processRegistryMirrors() []string {
+	return k.rankMirrors(k.configuredRegistryMirrors())
+}
+
+func (k *Config) configuredRegistryMirrors() []string {
 	if len(k.RegistryMirrors) == 0 {
 		return []string{}
 	}
 	return strings.Split(k.RegistryMirrors, ",")
 }
 
-func registryMapsInConfig() (string, error) {
-	regConfig := os.Getenv("CLOUDBEES_REGISTRY_CONFIG")
-	if regConfig == "" {
-		return "", nil
-	}
-
-	if _, err := os.Stat(regConfig); err != nil && os.IsNotExist(err) {
-		return "", nil
-	}
-
-	b, err := os.ReadFile(regConfig)
-	if err != nil {
-		return "", fmt.Errorf("failed to read registry config file: %w", err)
-	}
-
-	if len(b) == 0 {
-		return "", nil
-	}
-
-	var regs = registries.Config{}
-	if err := json.Unmarshal(b, &regs); err != nil {
-		return "", fmt.Errorf("failed to parse registry config file: %w", err)
+func (k *Config) registryMapsInConfig() (string, error) {
+	regs, err := k.registryConfig()
+	if err != nil || regs == nil {
+		return "", err
 	}
 
 	var regmaps []string
 	for _, registry := range regs.Registries {
 		prefix := registry.Prefix
-		for _, mirror := range registry.Mirrors {
+		for _, mirror := range k.rankMirrors(registry.Mirrors) {
 			regmaps = append(regmaps, fmt.Sprintf("%s=%s", prefix, mirror))
 		}
 	}
@@ -221,39 +373,50 @@ func registryMapsInConfig() (string, error) {
 	return strings.Join(regmaps, ";"), nil
 }
 
-func (k *Config) lookupBinary() {
-	// The kaniko binary which executes the docker build and publish is called 'executor',
-	// which is in the path '/kaniko/executor'.
-	// Ref: https://github.com/GoogleContainerTools/kaniko/blob/main/deploy/Dockerfile
-	execPath, err := exec.LookPath(kanikoExecutorBinary)
-	if err != nil {
-		log.Fatal("cannot find kaniko executor binary")
+// registryConfig reads the registries configured in CLOUDBEES_REGISTRY_CONFIG.
+// A nil config is returned when the file is not set, does not exist or is empty.
+func (k *Config) registryConfig() (*registries.Config, error) {
+	b, err := k.readRegistryConfig()
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	var regs = registries.Config{}
+	if err := json.Unmarshal(b, &regs); err != nil {
+		return nil, fmt.Errorf("failed to parse registry config file: %w", err)
 	}
-	log.Printf("found kaniko executor binary at %s", execPath)
-	k.ExecutablePath = execPath
+	return &regs, nil
 }
 
-func (k *Config) env() []string {
-	// If no KanikoDir was configured, just return the current environment.
-	if k.KanikoDir == "" {
-		return os.Environ()
+func (k *Config) readRegistryConfig() ([]byte, error) {
+	regConfig := k.RegistryConfig
+	if regConfig == "" {
+		regConfig = os.Getenv("CLOUDBEES_REGISTRY_CONFIG")
+	}
+	if regConfig == "" {
+		return nil, nil
+	}
+
+	// The file provided by CloudBees may be missing, an explicitly given one not.
+	if _, err := os.Stat(regConfig); err != nil && os.IsNotExist(err) && k.RegistryConfig == "" {
+		return nil, nil
 	}
 
-	// Trimmed value is used to detect whitespace-only input.
-	if strings.TrimSpace(k.KanikoDir) == "" {
-		// Flag was set but contains only whitespace.
-		// Do not set KANIKO_DIR, but warn the user.
-		log.Printf("warning: kaniko-dir value contains only whitespace; KANIKO_DIR environment variable will not be set")
-		return os.Environ()
+	b, err := os.ReadFile(regConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry config file: %w", err)
 	}
 
-	// If a KanikoDir was configured, KANIKO_DIR needs to be set.
-	// Due to chainguard limitation https://github.com/chainguard-forks/kaniko/blob/07ed3b190c5beb1df4ce043128942d07d5dcf9f8/pkg/config/init.go#L29
-	if err := os.Setenv("KANIKO_DIR", k.KanikoDir); err != nil {
-		log.Printf("warning: failed to set KANIKO_DIR environment variable: %v", err)
+	if len(b) == 0 {
+		return nil, nil
 	}
+	return b, nil
+}
 
-	return os.Environ()
+// env returns the environment of the executor.
+func (k *Config) env() []string {
+	env := append(os.Environ(), k.kanikoDirEnv()...)
+	return append(env, k.backendEnv()...)
 }
 
 func validateVerbosity(verbosity string) error {
@@ -303,7 +466,7 @@ func (k *Config) cmdBuilder(digestFile string) (*exec.Cmd, error) {
 		cmdArgs = append(cmdArgs, "--registry-mirror", mirror)
 	}
 
-	registryMaps, err := registryMapsInConfig()
+	registryMaps, err := k.registryMapsInConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -312,6 +475,17 @@ func (k *Config) cmdBuilder(digestFile string) (*exec.Cmd, error) {
 		cmdArgs = append(cmdArgs, "--registry-map", registryMaps)
 	}
 
+	settings, err := k.registrySettingsInConfig()
+	if err != nil {
+		return nil, err
+	}
+	registryArgs, err := registryFlags(settings, k.registryCertDir)
+	if err != nil {
+		return nil, err
+	}
+	cmdArgs = append(cmdArgs, registryArgs...)
+	cmdArgs = append(cmdArgs, k.clientCertFlags(settings)...)
+
 	if digestFile != "" {
 		cmdArgs = append(cmdArgs, "--digest-file", digestFile)
 	}
@@ -321,7 +495,7 @@ func (k *Config) cmdBuilder(digestFile string) (*exec.Cmd, error) {
 	}
 
 	if k.Target != "" {
-		fmt.Printf("Targeted stage:%v", k.Target)
+		slog.Info("targeting stage", "target", k.Target)
 		cmdArgs = append(cmdArgs, "--target", k.Target)
 	}
 
@@ -329,14 +503,23 @@ func (k *Config) cmdBuilder(digestFile string) (*exec.Cmd, error) {
 		cmdArgs = append(cmdArgs, "--tar-path", k.TarPath)
 	}
 
-	// If a KanikoDir was configured (via --kaniko-dir in our wrapper),
-	// propagate it to the kaniko executor.
-	if k.KanikoDir != "" {
-		cmdArgs = append(cmdArgs, "--kaniko-dir", k.KanikoDir)
+	if k.reproducible() {
+		cmdArgs = append(cmdArgs, "--reproducible")
+	}
+
+	if k.noPush {
+		// The file system is cleaned up so that builds can run one after the other.
+		cmdArgs = append(cmdArgs, "--no-push", "--cleanup")
+	}
+
+	cmdArgs = append(cmdArgs, k.kanikoDirArgs()...)
+
+	cmdArgs, err = k.capabilities.adapt(cmdArgs, k.StrictExecutorFlags)
+	if err != nil {
+		return nil, err
 	}
 
-	kanikoCmd := exec.CommandContext(k.Context, k.ExecutablePath, cmdArgs...)
-	kanikoCmd.Env = k.env()
+	kanikoCmd := k.executorCommand(cmdArgs...)
 
 	kanikoCmd.Stdout = os.Stdout
 	kanikoCmd.Stderr = os.Stderr
@@ -341,13 +341,7 @@ func Test_CmdRegistryMaps(t *testing.T) {
 }
 
 func Test_writeActionOutput(t *testing.T) {
-	tmpDir, err := os.MkdirTemp("", "kaniko-test-")
-	require.NoError(t, err)
-	defer os.RemoveAll(tmpDir)
 	fakeDigest := "sha256:cafebabebeef"
-	digestFile := filepath.Join(tmpDir, "digest-file")
-	err = os.WriteFile(digestFile, []byte(fakeDigest), 0640)
-	require.NoError(t, err)
 
 	for _, c := range []struct {
 		name          string
@@ -406,7 +400,7 @@ func Test_writeActionOutput(t *testing.T) {
 			require.NoError(t, err)
 			defer os.RemoveAll(outDir)
 
-			err = testee.writeActionOutputs(outDir, digestFile)
+			err = testee.writeActionOutputs(&dirOutputs{dir: outDir}, fakeDigest)
 			require.NoError(t, err, "write outputs")
 
 			outputNames := []string{"digest", "tag", "tag-digest", "image"}
@@ -433,7 +427,7 @@ func Test_writeArtifactMetadata(t *testing.T) {
 			Verbosity:   "debug",
 		}
 
-		err = c.writeArtifactMetadata(tmpDir, "sha256:cafebabebeef")
+		err = c.writeArtifactMetadata(&dirOutputs{dir: tmpDir}, "sha256:cafebabebeef")
 		require.NoError(t, err)
 
 		data, err := os.ReadFile(filepath.Join(tmpDir, "artifact-ref"))
@@ -459,7 +453,7 @@ func Test_writeArtifactMetadata(t *testing.T) {
 			Destination: "docker.io/library/nginx@sha256:invalid-digest",
 		}
 
-		err = c.writeArtifactMetadata(tmpDir, "sha256:cafebabebeef")
+		err = c.writeArtifactMetadata(&dirOutputs{dir: tmpDir}, "sha256:cafebabebeef")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "failed to parse image reference")
 	})
@@ -473,7 +467,7 @@ func Test_writeArtifactMetadata(t *testing.T) {
 			Destination: "",
 		}
 
-		err = c.writeArtifactMetadata(tmpDir, "sha256:cafebabebeef")
+		err = c.writeArtifactMetadata(&dirOutputs{dir: tmpDir}, "sha256:cafebabebeef")
 		require.NoError(t, err)
 
 		data, err := os.ReadFile(filepath.Join(tmpDir, "artifact-ref"))
@@ -495,7 +489,7 @@ func Test_writeArtifactMetadata(t *testing.T) {
 			Destination: "my.registry/myimage@sha256:invalid-digest",
 		}
 
-		err = c.writeArtifactMetadata(tmpDir, "sha256:cafebabebeef")
+		err = c.writeArtifactMetadata(&dirOutputs{dir: tmpDir}, "sha256:cafebabebeef")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "invalid reference format")
 	})
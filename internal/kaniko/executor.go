@@ -0,0 +1,154 @@
+package kaniko
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+const (
+	kanikoExecutorBinary = "executor"
+	// kanikoExecutorEnv overrides the executor binary when --executor-path is not set.
+	kanikoExecutorEnv = "KANIKO_EXECUTOR"
+)
+
+// minExecutorVersion is the oldest executor release supported by the wrapper.
+// Flags added in later releases are handled through the capability matrix in executorFlags.
+var minExecutorVersion = executorVersion{Major: 1, Minor: 14, Patch: 0}
+
+var executorVersionRegexp = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)`)
+
+// executorVersion is the semantic version reported by `executor version`.
+type executorVersion struct {
+	Major, Minor, Patch int
+}
+
+func (v executorVersion) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v is an older release than o.
+func (v executorVersion) Less(o executorVersion) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+func parseExecutorVersion(output string) (executorVersion, error) {
+	m := executorVersionRegexp.FindStringSubmatch(output)
+	if m == nil {
+		return executorVersion{}, fmt.Errorf("no version found in %q", output)
+	}
+	var v executorVersion
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	return v, nil
+}
+
+// lookupBinary resolves the kaniko executor from --executor-path, the KANIKO_EXECUTOR
+// environment variable or the PATH, in that order, verifies that it is executable
+// and recent enough, and probes the flags it supports. In local mode, the container
+// runtime running the executor image is resolved instead.
+func (k *Config) lookupBinary() error {
+	if err := k.resolveExecutor(); err != nil {
+		return err
+	}
+	if k.Local {
+		slog.Info("running kaniko executor image", "image", k.executorImage(), "runtime", k.containerRuntime)
+	} else {
+		slog.Debug("found kaniko executor binary", "path", k.ExecutablePath)
+	}
+
+	version, err := k.executorVersion()
+	if err != nil {
+		return err
+	}
+	if version != nil {
+		slog.Info("kaniko executor", "version", version.String())
+		if version.Less(minExecutorVersion) {
+			return fmt.Errorf("kaniko executor %s is not supported, %s or newer is required", version, minExecutorVersion)
+		}
+	}
+
+	k.capabilities, err = k.probeCapabilities()
+	if err != nil {
+		if k.StrictExecutorFlags {
+			return err
+		}
+		slog.Warn("cannot determine kaniko executor capabilities, passing all flags", "error", err)
+	}
+	return nil
+}
+
+// resolveExecutor resolves the executor binary, or the container runtime in local mode.
+func (k *Config) resolveExecutor() error {
+	if k.Local {
+		return k.resolveContainerRuntime()
+	}
+	return k.resolveExecutorPath()
+}
+
+// resolveExecutorPath sets ExecutablePath to the resolved executor binary.
+func (k *Config) resolveExecutorPath() error {
+	execPath := k.ExecutablePath
+	if execPath == "" {
+		execPath = os.Getenv(kanikoExecutorEnv)
+	}
+	if execPath == "" {
+		// The kaniko binary which executes the docker build and publish is called 'executor',
+		// which is in the path '/kaniko/executor'.
+		// Ref: https://github.com/GoogleContainerTools/kaniko/blob/main/deploy/Dockerfile
+		execPath = kanikoExecutorBinary
+	}
+
+	// LookPath searches the PATH for bare names and checks the executable bit for paths.
+	resolved, err := exec.LookPath(execPath)
+	if err != nil {
+		return fmt.Errorf("cannot find kaniko executor binary %q: %w", execPath, err)
+	}
+	k.ExecutablePath = resolved
+	return nil
+}
+
+// ExecutorVersion returns the path, or the image in local mode, and the version of the
+// kaniko executor, the version being empty when the executor does not report a parsable version.
+func (k *Config) ExecutorVersion(ctx context.Context) (string, string, error) {
+	k.Context = ctx
+	if err := k.resolveExecutor(); err != nil {
+		return "", "", err
+	}
+	version, err := k.executorVersion()
+	if err != nil || version == nil {
+		return k.executorName(), "", err
+	}
+	return k.executorName(), version.String(), nil
+}
+
+// executorVersion runs `executor version`. A nil version is returned when the executor
+// runs but does not report a parsable version, e.g. for development builds.
+func (k *Config) executorVersion() (*executorVersion, error) {
+	var out bytes.Buffer
+	versionCmd := k.executorCommand("version")
+	versionCmd.Stdout = &out
+	versionCmd.Stderr = &out
+	if err := versionCmd.Run(); err != nil {
+		return nil, fmt.Errorf("run %s version: %w: %s", k.executorName(), err, bytes.TrimSpace(out.Bytes()))
+	}
+
+	version, err := parseExecutorVersion(out.String())
+	if err != nil {
+		slog.Warn("cannot determine kaniko executor version", "error", err)
+		return nil, nil
+	}
+	return &version, nil
+}
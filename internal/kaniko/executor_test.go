@@ -0,0 +1,120 @@
+package kaniko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseExecutorVersion(t *testing.T) {
+	v, err := parseExecutorVersion("Kaniko version :  v1.25.16\n")
+	require.NoError(t, err)
+	require.Equal(t, executorVersion{Major: 1, Minor: 25, Patch: 16}, v)
+
+	_, err = parseExecutorVersion("Kaniko version :  dev")
+	require.Error(t, err)
+}
+
+func Test_executorVersionLess(t *testing.T) {
+	require.True(t, executorVersion{1, 9, 2}.Less(executorVersion{1, 14, 0}))
+	require.True(t, executorVersion{0, 99, 0}.Less(executorVersion{1, 0, 0}))
+	require.False(t, executorVersion{1, 14, 0}.Less(executorVersion{1, 14, 0}))
+	require.False(t, executorVersion{1, 14, 1}.Less(executorVersion{1, 14, 0}))
+}
+
+func Test_lookupBinary(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("explicit executor path", func(t *testing.T) {
+		path := testharness.NewExecutor(t, testharness.Scenario{}).Path
+		c := Config{Context: ctx, ExecutablePath: path}
+		require.NoError(t, c.lookupBinary())
+		require.Equal(t, path, c.ExecutablePath)
+	})
+
+	t.Run("executor path from environment", func(t *testing.T) {
+		path := testharness.NewExecutor(t, testharness.Scenario{}).Path
+		t.Setenv(kanikoExecutorEnv, path)
+		c := Config{Context: ctx}
+		require.NoError(t, c.lookupBinary())
+		require.Equal(t, path, c.ExecutablePath)
+	})
+
+	t.Run("executor from PATH", func(t *testing.T) {
+		path := testharness.NewExecutor(t, testharness.Scenario{}).Path
+		t.Setenv(kanikoExecutorEnv, "")
+		t.Setenv("PATH", filepath.Dir(path))
+		c := Config{Context: ctx}
+		require.NoError(t, c.lookupBinary())
+		require.Equal(t, path, c.ExecutablePath)
+	})
+
+	t.Run("executor not found", func(t *testing.T) {
+		t.Setenv(kanikoExecutorEnv, "")
+		t.Setenv("PATH", t.TempDir())
+		c := Config{Context: ctx}
+		err := c.lookupBinary()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "cannot find kaniko executor binary")
+	})
+
+	t.Run("executor not executable", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "executor")
+		require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), 0644))
+		c := Config{Context: ctx, ExecutablePath: path}
+		require.Error(t, c.lookupBinary())
+	})
+
+	t.Run("executor too old", func(t *testing.T) {
+		path := testharness.NewExecutor(t, testharness.Scenario{Version: "v1.9.2"}).Path
+		c := Config{Context: ctx, ExecutablePath: path}
+		err := c.lookupBinary()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "kaniko executor v1.9.2 is not supported")
+	})
+
+	t.Run("executor without parsable version", func(t *testing.T) {
+		path := testharness.NewExecutor(t, testharness.Scenario{Version: "dev"}).Path
+		c := Config{Context: ctx, ExecutablePath: path}
+		require.NoError(t, c.lookupBinary())
+	})
+
+	t.Run("executor version fails", func(t *testing.T) {
+		path := testharness.NewExecutor(t, testharness.Scenario{VersionError: "boom"}).Path
+		c := Config{Context: ctx, ExecutablePath: path}
+		err := c.lookupBinary()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "boom")
+	})
+}
+
+func Test_RunWithoutExecutor(t *testing.T) {
+	t.Setenv(kanikoExecutorEnv, "")
+	t.Setenv("PATH", t.TempDir())
+	c := Config{Destination: "my.registry/myimage:latest"}
+	err := c.Run(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "resolve kaniko executor")
+}
+
+func Test_ExecutorVersion(t *testing.T) {
+	ctx := context.Background()
+
+	path := testharness.NewExecutor(t, testharness.Scenario{}).Path
+	resolved, version, err := (&Config{ExecutablePath: path}).ExecutorVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, path, resolved)
+	require.Equal(t, "v1.25.16", version)
+
+	path = testharness.NewExecutor(t, testharness.Scenario{Version: "dev"}).Path
+	_, version, err = (&Config{ExecutablePath: path}).ExecutorVersion(ctx)
+	require.NoError(t, err)
+	require.Empty(t, version)
+
+	_, _, err = (&Config{ExecutablePath: filepath.Join(t.TempDir(), "missing")}).ExecutorVersion(ctx)
+	require.ErrorContains(t, err, "cannot find kaniko executor binary")
+}
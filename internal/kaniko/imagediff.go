@@ -0,0 +1,177 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// registryImage returns an image of a registry, resolving image indexes to the
+// manifest of the client platform. Layers are downloaded when opened.
+func registryImage(ctx context.Context, client *registry.Client, ref registry.Reference) (*image.Image, error) {
+	m, _, err := client.ImageManifest(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &image.ConfigFile{}
+	if m.Config.Digest != "" {
+		blob, err := client.ReadBlob(ctx, ref, m.Config)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(blob, cfg); err != nil {
+			return nil, fmt.Errorf("parse image config: %w", err)
+		}
+	}
+
+	img := &image.Image{Name: ref.String(), Config: cfg}
+	descriptors := map[string]registry.Descriptor{}
+	for i, d := range m.Layers {
+		layer := image.Layer{Digest: d.Digest, Size: d.Size}
+		if i < len(cfg.RootFS.DiffIDs) {
+			layer.DiffID = cfg.RootFS.DiffIDs[i]
+		}
+		img.Layers = append(img.Layers, layer)
+		descriptors[d.Digest] = d
+	}
+	img.Open = func(layer image.Layer) (io.ReadCloser, error) {
+		r, err := client.Blob(ctx, ref, descriptors[layer.Digest])
+		if err != nil {
+			return nil, err
+		}
+		content, err := image.Uncompressed(r)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: content, Closer: r}, nil
+	}
+	return img, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// loadImage returns the image saved as tarball at name when it exists, the image
+// referenced by name in a registry otherwise.
+func (k *Config) loadImage(name string) (*image.Image, error) {
+	if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+		t, err := image.OpenTarball(name)
+		if err != nil {
+			return nil, err
+		}
+		return t.Image(), nil
+	}
+	ref, err := registry.ParseReference(name)
+	if err != nil {
+		return nil, err
+	}
+	client, err := k.destinationClient()
+	if err != nil {
+		return nil, err
+	}
+	return registryImage(k.Context, client, ref)
+}
+
+// DiffImages compares two images, each given as image reference or tarball path.
+func (k *Config) DiffImages(ctx context.Context, before, after string) (*image.Diff, error) {
+	k.Context = ctx
+	cleanup, err := k.prepareRegistryAccess()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	return k.compareImages(before, after)
+}
+
+// prepareImageDiff records the digest of the image published at the first
+// destination, which the built image is compared to once pushed.
+func (k *Config) prepareImageDiff() {
+	ref, err := registry.ParseReference(k.processDestinations()[0])
+	if err != nil {
+		slog.Warn("cannot look up the previous image", "error", err)
+		return
+	}
+	client, err := k.destinationClient()
+	if err != nil {
+		slog.Warn("cannot look up the previous image", "image", ref, "error", err)
+		return
+	}
+	_, desc, err := client.Manifest(k.Context, ref)
+	var statusErr *registry.StatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		slog.Info("no previous image to compare the built image to", "image", ref)
+	case err != nil:
+		slog.Warn("cannot look up the previous image", "image", ref, "error", err)
+	default:
+		k.previousImageRef = ref.WithDigest(desc.Digest).String()
+	}
+}
+
+// writeImageDiff compares the built image, from the tarball when saved or else
+// from the first destination, to the previously published image. The Markdown
+// report is printed and both the Markdown and JSON reports are written as outputs.
+// Failures are only logged since the image is already pushed.
+func (k *Config) writeImageDiff(out outputWriter, digest string) {
+	if k.previousImageRef == "" {
+		return
+	}
+	built := k.TarPath
+	if built == "" {
+		ref, err := registry.ParseReference(k.processDestinations()[0])
+		if err != nil {
+			slog.Warn("cannot compare the built image", "error", err)
+			return
+		}
+		if digest != "" {
+			ref = ref.WithDigest(digest)
+		}
+		built = ref.String()
+	}
+
+	diff, err := k.compareImages(k.previousImageRef, built)
+	if err != nil {
+		slog.Warn("cannot compare the built image", "image", k.previousImageRef, "error", err)
+		return
+	}
+	markdown := diff.Markdown()
+	fmt.Print(markdown)
+	if out == nil {
+		return
+	}
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		slog.Warn("cannot write the image diff", "error", err)
+		return
+	}
+	if err := out.WriteOutput("image-diff", markdown); err != nil {
+		slog.Warn("cannot write the image diff", "error", err)
+	}
+	if err := out.WriteOutput("image-diff-json", string(diffJSON)); err != nil {
+		slog.Warn("cannot write the image diff", "error", err)
+	}
+}
+
+func (k *Config) compareImages(before, after string) (*image.Diff, error) {
+	imgBefore, err := k.loadImage(before)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", before, err)
+	}
+	imgAfter, err := k.loadImage(after)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", after, err)
+	}
+	return image.Compare(imgBefore, imgAfter)
+}
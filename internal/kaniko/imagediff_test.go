@@ -0,0 +1,67 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_writeImageDiff(t *testing.T) {
+	f, host := newImageRegistry(t)
+	addImage(t, f, "1.0", []string{"ADD rootfs.tar /"}, fileTar(t, "app/main", "v1", time.Unix(0, 0)))
+
+	t.Run("no previous image", func(t *testing.T) {
+		c := Config{Context: context.Background(), Destination: host + "/team/app:missing", client: http.DefaultClient}
+		c.prepareImageDiff()
+		require.Empty(t, c.previousImageRef)
+	})
+
+	t.Run("compared to the previous image", func(t *testing.T) {
+		outDir := t.TempDir()
+		c := Config{
+			Context:     context.Background(),
+			Destination: host + "/team/app:1.0",
+			TarPath:     writeImageTarball(t, t.TempDir(), "image.tar", fileTar(t, "app/main", "v2", time.Unix(0, 0))),
+			client:      http.DefaultClient,
+		}
+		c.prepareImageDiff()
+		require.True(t, strings.HasPrefix(c.previousImageRef, host+"/team/app:1.0@sha256:"), c.previousImageRef)
+
+		c.writeImageDiff(&dirOutputs{dir: outDir}, "")
+		md, err := os.ReadFile(filepath.Join(outDir, "image-diff"))
+		require.NoError(t, err)
+		require.Contains(t, string(md), "| ~ | `app/main` | content |")
+
+		b, err := os.ReadFile(filepath.Join(outDir, "image-diff-json"))
+		require.NoError(t, err)
+		var diff image.Diff
+		require.NoError(t, json.Unmarshal(b, &diff))
+		require.Equal(t, c.previousImageRef, diff.Before)
+		require.Equal(t, c.TarPath, diff.After)
+		require.Equal(t, []image.FileChange{{Path: "app/main", Kind: image.FileModified, Fields: []string{"content"}}}, diff.Files)
+		require.Len(t, diff.Layers, 2)
+	})
+}
+
+func Test_DiffImages(t *testing.T) {
+	f, host := newImageRegistry(t)
+	addImage(t, f, "1.0", []string{"ADD rootfs.tar /"}, fileTar(t, "app/main", "v1", time.Unix(0, 0)))
+	tarball := writeImageTarball(t, t.TempDir(), "image.tar", fileTar(t, "app/main", "v1", time.Unix(0, 0)))
+
+	c := Config{}
+	diff, err := c.DiffImages(context.Background(), host+"/team/app:1.0", tarball)
+	require.NoError(t, err)
+	require.Empty(t, diff.Layers)
+	require.Empty(t, diff.Files)
+
+	_, err = c.DiffImages(context.Background(), host+"/team/app:missing", tarball)
+	require.ErrorContains(t, err, "load "+host+"/team/app:missing")
+}
@@ -0,0 +1,224 @@
+package kaniko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/buildcontext"
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// checksImageSize reports whether the built image is measured after the build.
+func (k *Config) checksImageSize() bool {
+	return k.ImageSizeReport || k.MaxImageSize != "" || k.MaxImageGrowth != "" || k.MaxLayers > 0
+}
+
+// imageBudgets are the parsed size budgets of the built image.
+type imageBudgets struct {
+	maxSize int64
+	// maxGrowth is either a size in bytes or, when maxGrowthPercent is set, a percentage.
+	maxGrowth        float64
+	maxGrowthPercent bool
+	maxLayers        int
+}
+
+func (k *Config) imageBudgets() (imageBudgets, error) {
+	var b imageBudgets
+	var err error
+	if k.MaxImageSize != "" {
+		if b.maxSize, err = buildcontext.ParseSize(k.MaxImageSize); err != nil {
+			return b, fmt.Errorf("invalid max-image-size: %w", err)
+		}
+	}
+	if growth := strings.TrimSpace(k.MaxImageGrowth); growth != "" {
+		if percent, ok := strings.CutSuffix(growth, "%"); ok {
+			b.maxGrowthPercent = true
+			if b.maxGrowth, err = strconv.ParseFloat(strings.TrimSpace(percent), 64); err != nil || b.maxGrowth < 0 {
+				return b, fmt.Errorf("invalid max-image-growth: %q", growth)
+			}
+		} else {
+			size, err := buildcontext.ParseSize(growth)
+			if err != nil {
+				return b, fmt.Errorf("invalid max-image-growth: %w", err)
+			}
+			b.maxGrowth = float64(size)
+		}
+	}
+	if k.MaxLayers < 0 {
+		return b, fmt.Errorf("invalid max-layers: %d", k.MaxLayers)
+	}
+	b.maxLayers = k.MaxLayers
+	return b, nil
+}
+
+// prepareImageSize validates the image budgets and measures the image currently
+// published at the first destination, before it is replaced by the build.
+func (k *Config) prepareImageSize() error {
+	if _, err := k.imageBudgets(); err != nil {
+		return err
+	}
+	ref, err := registry.ParseReference(k.processDestinations()[0])
+	if err != nil {
+		return err
+	}
+	client, err := k.destinationClient()
+	if err != nil {
+		slog.Warn("cannot look up the previous image", "image", ref, "error", err)
+		return nil
+	}
+	k.previousImage, err = registryImageSizes(k.Context, client, ref, false)
+	var statusErr *registry.StatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		slog.Info("no previous image", "image", ref)
+	case err != nil:
+		slog.Warn("cannot look up the previous image", "image", ref, "error", err)
+	}
+	return nil
+}
+
+// destinationClient returns a registry client reaching the destination registries
+// directly, since mirrors may serve outdated tags.
+func (k *Config) destinationClient() (*registry.Client, error) {
+	client, err := k.registryClient()
+	if err != nil {
+		return nil, err
+	}
+	client.Mirrors = nil
+	return client, nil
+}
+
+// registryImageSizes measures an image of a registry. The layers are only
+// downloaded when measure is set, to compute their uncompressed sizes.
+func registryImageSizes(ctx context.Context, client *registry.Client, ref registry.Reference, measure bool) (*image.Sizes, error) {
+	img, err := registryImage(ctx, client, ref)
+	if err != nil {
+		return nil, err
+	}
+	open := img.Open
+	if !measure {
+		open = nil
+	}
+	return image.MeasureLayers(img.Config, img.Layers, open)
+}
+
+// checkImageSize measures the built image, from the tarball when saved or else from
+// the first destination, prints the size report and enforces the budgets. The image is
+// already pushed, since kaniko builds and pushes in a single step, which the error tells.
+func (k *Config) checkImageSize(digest string) error {
+	budgets, err := k.imageBudgets()
+	if err != nil {
+		return err
+	}
+
+	report := &imageSizeReport{Previous: k.previousImage}
+	if k.TarPath != "" {
+		img, err := image.OpenTarball(k.TarPath)
+		if err != nil {
+			return err
+		}
+		report.Image = k.TarPath
+		if report.Sizes, err = img.Sizes(); err != nil {
+			return err
+		}
+	} else {
+		ref, err := registry.ParseReference(k.processDestinations()[0])
+		if err != nil {
+			return err
+		}
+		if digest != "" {
+			ref = ref.WithDigest(digest)
+		}
+		client, err := k.destinationClient()
+		if err != nil {
+			return err
+		}
+		report.Image = ref.String()
+		if report.Sizes, err = registryImageSizes(k.Context, client, ref, true); err != nil {
+			return fmt.Errorf("measure image %s: %w", ref, err)
+		}
+	}
+
+	k.imageSizes = report.Sizes
+	report.Violations = budgets.check(report.Sizes, report.Previous)
+	fmt.Print(report.String())
+	if len(report.Violations) > 0 {
+		return fmt.Errorf("image budget exceeded, the image is already pushed to %s: %s",
+			strings.Join(k.processDestinations(), ", "), strings.Join(report.Violations, "; "))
+	}
+	return nil
+}
+
+func (b imageBudgets) check(sizes, previous *image.Sizes) []string {
+	var violations []string
+	if b.maxSize > 0 && sizes.Compressed > b.maxSize {
+		violations = append(violations, fmt.Sprintf("image size %s exceeds max-image-size %s",
+			buildcontext.FormatSize(sizes.Compressed), buildcontext.FormatSize(b.maxSize)))
+	}
+	if b.maxLayers > 0 && len(sizes.Layers) > b.maxLayers {
+		violations = append(violations, fmt.Sprintf("image has %d layers, more than max-layers %d", len(sizes.Layers), b.maxLayers))
+	}
+	if previous != nil && b.maxGrowth > 0 {
+		growth := sizes.Compressed - previous.Compressed
+		exceeded := float64(growth) > b.maxGrowth
+		limit := buildcontext.FormatSize(int64(b.maxGrowth))
+		if b.maxGrowthPercent {
+			exceeded = previous.Compressed > 0 && float64(growth)*100/float64(previous.Compressed) > b.maxGrowth
+			limit = strconv.FormatFloat(b.maxGrowth, 'f', -1, 64) + "%"
+		}
+		if exceeded {
+			violations = append(violations, fmt.Sprintf("image grew by %s since the previous image, more than max-image-growth %s",
+				formatGrowth(sizes.Compressed, previous.Compressed), limit))
+		}
+	}
+	return violations
+}
+
+// imageSizeReport describes the size of the built image and of the image previously published at its tag.
+type imageSizeReport struct {
+	Image      string
+	Sizes      *image.Sizes
+	Previous   *image.Sizes
+	Violations []string
+}
+
+func (r *imageSizeReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Image %s: %s compressed, %s uncompressed, %d layers\n", r.Image,
+		buildcontext.FormatSize(r.Sizes.Compressed), buildcontext.FormatSize(r.Sizes.Uncompressed), len(r.Sizes.Layers))
+	for i, l := range r.Sizes.Layers {
+		createdBy := l.CreatedBy
+		if len(createdBy) > 80 {
+			createdBy = createdBy[:77] + "..."
+		}
+		fmt.Fprintf(&sb, "  %3d  %10s  %10s  %s\n", i+1, buildcontext.FormatSize(l.Compressed), buildcontext.FormatSize(l.Uncompressed), createdBy)
+	}
+	if r.Previous != nil {
+		fmt.Fprintf(&sb, "Previous image: %s compressed, %d layers, growth %s\n",
+			buildcontext.FormatSize(r.Previous.Compressed), len(r.Previous.Layers), formatGrowth(r.Sizes.Compressed, r.Previous.Compressed))
+	}
+	for _, v := range r.Violations {
+		fmt.Fprintf(&sb, "Budget exceeded: %s\n", v)
+	}
+	return sb.String()
+}
+
+// formatGrowth renders the difference between two sizes, with its percentage when known.
+func formatGrowth(size, previous int64) string {
+	diff := size - previous
+	sign := "+"
+	if diff < 0 {
+		sign = "-"
+	}
+	s := sign + buildcontext.FormatSize(max(diff, -diff))
+	if previous > 0 {
+		s += fmt.Sprintf(" (%s%.1f%%)", sign, float64(max(diff, -diff))*100/float64(previous))
+	}
+	return s
+}
@@ -0,0 +1,150 @@
+package kaniko
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+// newImageRegistry starts a registry used as the mirror of the default registry.
+func newImageRegistry(t *testing.T) (*testharness.Registry, string) {
+	r := testharness.NewRegistry(t)
+	writeMirrorConfig(t, r.Host())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	return r, r.Host()
+}
+
+// addImage adds an image to the team/app repository of the registry, with the
+// layers created by the createdBy commands.
+func addImage(t *testing.T, r *testharness.Registry, tag string, createdBy []string, layers ...[]byte) {
+	cfg := image.ConfigFile{OS: "linux"}
+	for _, command := range createdBy {
+		cfg.History = append(cfg.History, image.History{CreatedBy: command})
+	}
+	r.AddImage(t, "team/app", tag, cfg, layers...)
+}
+
+func Test_imageBudgets(t *testing.T) {
+	b, err := (&Config{MaxImageSize: "1MiB", MaxImageGrowth: "20%", MaxLayers: 3}).imageBudgets()
+	require.NoError(t, err)
+	require.Equal(t, imageBudgets{maxSize: 1 << 20, maxGrowth: 20, maxGrowthPercent: true, maxLayers: 3}, b)
+
+	b, err = (&Config{MaxImageGrowth: "10KiB"}).imageBudgets()
+	require.NoError(t, err)
+	require.Equal(t, imageBudgets{maxGrowth: 10 << 10}, b)
+
+	_, err = (&Config{MaxImageSize: "huge"}).imageBudgets()
+	require.ErrorContains(t, err, "invalid max-image-size")
+	_, err = (&Config{MaxImageGrowth: "lots%"}).imageBudgets()
+	require.ErrorContains(t, err, "invalid max-image-growth")
+
+	sizes := &image.Sizes{Compressed: 1500, Layers: make([]image.LayerSize, 4)}
+	previous := &image.Sizes{Compressed: 1000}
+	require.Equal(t, []string{
+		"image size 1.5 KiB exceeds max-image-size 1.0 KiB",
+		"image has 4 layers, more than max-layers 3",
+		"image grew by +500 B (+50.0%) since the previous image, more than max-image-growth 20%",
+	}, imageBudgets{maxSize: 1024, maxLayers: 3, maxGrowth: 20, maxGrowthPercent: true}.check(sizes, previous))
+	require.Empty(t, imageBudgets{maxGrowth: 600}.check(sizes, previous))
+	require.Empty(t, imageBudgets{maxGrowth: 1}.check(sizes, nil))
+}
+
+func Test_checkImageSize(t *testing.T) {
+	f, host := newImageRegistry(t)
+	addImage(t, f, "1.0", []string{"ADD rootfs.tar /"}, fileTar(t, "etc/os-release", "ID=test\n", time.Unix(0, 0)))
+	addImage(t, f, "2.0", []string{"ADD rootfs.tar /", "COPY app /app"},
+		fileTar(t, "etc/os-release", "ID=test\n", time.Unix(0, 0)),
+		fileTar(t, "app", strings.Repeat("x", 4096), time.Unix(0, 0)))
+
+	newConfig := func(tag string) *Config {
+		return &Config{
+			Context:     context.Background(),
+			Destination: host + "/team/app:" + tag,
+			client:      http.DefaultClient,
+		}
+	}
+
+	t.Run("previous image", func(t *testing.T) {
+		c := newConfig("1.0")
+		require.NoError(t, c.prepareImageSize())
+		require.NotNil(t, c.previousImage)
+		require.Len(t, c.previousImage.Layers, 1)
+		require.Zero(t, c.previousImage.Uncompressed)
+	})
+
+	t.Run("no previous image", func(t *testing.T) {
+		c := newConfig("missing")
+		require.NoError(t, c.prepareImageSize())
+		require.Nil(t, c.previousImage)
+	})
+
+	t.Run("from the registry", func(t *testing.T) {
+		c := newConfig("1.0")
+		c.MaxImageGrowth = "10%"
+		require.NoError(t, c.prepareImageSize())
+		// The tag now points to the built image.
+		c.Destination = host + "/team/app:2.0"
+		err := c.checkImageSize("")
+		require.ErrorContains(t, err, "image budget exceeded, the image is already pushed to "+host+"/team/app:2.0: image grew by +")
+		require.ErrorContains(t, err, "more than max-image-growth 10%")
+
+		c.MaxImageGrowth = ""
+		c.MaxLayers = 2
+		require.NoError(t, c.checkImageSize(""))
+	})
+
+	t.Run("from the tarball", func(t *testing.T) {
+		dir := t.TempDir()
+		c := newConfig("1.0")
+		c.TarPath = writeImageTarball(t, dir, "image.tar",
+			fileTar(t, "a", "a", time.Unix(0, 0)), fileTar(t, "b", "b", time.Unix(0, 0)))
+		c.MaxLayers = 1
+		require.ErrorContains(t, c.checkImageSize(""), "image has 2 layers, more than max-layers 1")
+	})
+}
+
+func Test_imageSizeReport(t *testing.T) {
+	r := &imageSizeReport{
+		Image: "registry.example.com/app:1.0",
+		Sizes: &image.Sizes{Compressed: 3072, Uncompressed: 8192, Layers: []image.LayerSize{
+			{Compressed: 1024, Uncompressed: 4096, CreatedBy: "ADD rootfs.tar /"},
+			{Compressed: 2048, Uncompressed: 4096, CreatedBy: "RUN " + strings.Repeat("a", 100)},
+		}},
+		Previous:   &image.Sizes{Compressed: 4096, Layers: make([]image.LayerSize, 3)},
+		Violations: []string{"image has 2 layers, more than max-layers 1"},
+	}
+	require.Equal(t, `Image registry.example.com/app:1.0: 3.0 KiB compressed, 8.0 KiB uncompressed, 2 layers
+    1     1.0 KiB     4.0 KiB  ADD rootfs.tar /
+    2     2.0 KiB     4.0 KiB  RUN `+strings.Repeat("a", 73)+`...
+Previous image: 4.0 KiB compressed, 3 layers, growth -1.0 KiB (-25.0%)
+Budget exceeded: image has 2 layers, more than max-layers 1
+`, r.String())
+}
+
+func Test_RunImageSize(t *testing.T) {
+	executor := testharness.NewExecutor(t, testharness.Scenario{
+		Config: image.ConfigFile{OS: "linux"},
+		Layers: [][]byte{fileTar(t, "a", strings.Repeat("a", 4096), time.Unix(0, 0))},
+	})
+	dir := t.TempDir()
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644))
+
+	c := Config{
+		ExecutablePath: executor.Path,
+		DockerContext:  dir,
+		Destination:    "localhost:1/team/app:1.0",
+		TarPath:        filepath.Join(dir, "image.tar"),
+		MaxImageSize:   "64B",
+	}
+	require.ErrorContains(t, c.Run(context.Background()), "exceeds max-image-size 64 B")
+}
@@ -0,0 +1,112 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/buildcontext"
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// Inspection describes an image of a registry.
+type Inspection struct {
+	Reference string `json:"reference"`
+	// Digest and MediaType are the ones of the referenced manifest, which may be an index.
+	Digest    string             `json:"digest"`
+	MediaType string             `json:"mediaType,omitempty"`
+	Manifest  *registry.Manifest `json:"manifest"`
+	Config    *image.ConfigFile  `json:"config"`
+}
+
+// InspectImage reads the manifest and configuration of an image from its registry.
+// Image indexes are resolved to the manifest of the client platform.
+func (k *Config) InspectImage(ctx context.Context, name string) (*Inspection, error) {
+	k.Context = ctx
+	cleanup, err := k.prepareRegistryAccess()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	ref, err := registry.ParseReference(name)
+	if err != nil {
+		return nil, err
+	}
+	client, err := k.registryClient()
+	if err != nil {
+		return nil, err
+	}
+	m, desc, err := client.ImageManifest(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest of %s: %w", ref, err)
+	}
+	cfg := &image.ConfigFile{}
+	if m.Config.Digest != "" {
+		blob, err := client.ReadBlob(ctx, ref, m.Config)
+		if err != nil {
+			return nil, fmt.Errorf("read config of %s: %w", ref, err)
+		}
+		if err = json.Unmarshal(blob, cfg); err != nil {
+			return nil, fmt.Errorf("parse image config: %w", err)
+		}
+	}
+	return &Inspection{Reference: ref.String(), Digest: desc.Digest, MediaType: desc.MediaType, Manifest: m, Config: cfg}, nil
+}
+
+func (i *Inspection) String() string {
+	var sb strings.Builder
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&sb, "%-12s %s\n", name+":", value)
+		}
+	}
+	c := i.Config.Config
+	field("Image", i.Reference)
+	field("Digest", i.Digest)
+	field("Media type", i.MediaType)
+	if i.Config.OS != "" {
+		field("Platform", i.Config.OS+"/"+i.Config.Architecture)
+	}
+	if i.Config.Created != nil {
+		field("Created", i.Config.Created.UTC().Format(time.RFC3339))
+	}
+	field("User", c.User)
+	field("Workdir", c.WorkingDir)
+	field("Entrypoint", strings.Join(c.Entrypoint, " "))
+	field("Cmd", strings.Join(c.Cmd, " "))
+	field("Ports", strings.Join(sortedKeys(c.ExposedPorts), " "))
+	if len(c.Env) > 0 {
+		sb.WriteString("Env:\n")
+		for _, e := range c.Env {
+			fmt.Fprintf(&sb, "  %s\n", e)
+		}
+	}
+	if len(c.Labels) > 0 {
+		sb.WriteString("Labels:\n")
+		for _, key := range sortedKeys(c.Labels) {
+			fmt.Fprintf(&sb, "  %s=%s\n", key, c.Labels[key])
+		}
+	}
+
+	var total int64
+	for _, l := range i.Manifest.Layers {
+		total += l.Size
+	}
+	fmt.Fprintf(&sb, "Layers:      %d, %s compressed\n", len(i.Manifest.Layers), buildcontext.FormatSize(total))
+	history := i.Config.LayerHistory()
+	for n, l := range i.Manifest.Layers {
+		createdBy := ""
+		if n < len(history) {
+			createdBy = history[n].CreatedBy
+		}
+		if len(createdBy) > 80 {
+			createdBy = createdBy[:77] + "..."
+		}
+		fmt.Fprintf(&sb, "  %3d  %s  %10s  %s\n", n+1, l.Digest, buildcontext.FormatSize(l.Size), createdBy)
+	}
+	return sb.String()
+}
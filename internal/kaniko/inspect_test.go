@@ -0,0 +1,37 @@
+package kaniko
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+func Test_InspectImage(t *testing.T) {
+	f, host := newImageRegistry(t)
+	addImage(t, f, "1.0", []string{"ADD rootfs.tar /", "COPY app /app"},
+		fileTar(t, "etc/os-release", "ID=test\n", time.Unix(0, 0)),
+		fileTar(t, "app", "binary", time.Unix(0, 0)))
+
+	c := &Config{}
+	inspection, err := c.InspectImage(context.Background(), host+"/team/app:1.0")
+	require.NoError(t, err)
+	require.Equal(t, host+"/team/app:1.0", inspection.Reference)
+	require.True(t, strings.HasPrefix(inspection.Digest, "sha256:"))
+	require.Equal(t, registry.MediaTypeOCIManifest, inspection.MediaType)
+	require.Len(t, inspection.Manifest.Layers, 2)
+	require.Equal(t, "linux", inspection.Config.OS)
+
+	out := inspection.String()
+	require.Contains(t, out, "Image:       "+host+"/team/app:1.0\n")
+	require.Contains(t, out, "Layers:      2, ")
+	require.Contains(t, out, inspection.Manifest.Layers[1].Digest)
+	require.Contains(t, out, "COPY app /app\n")
+
+	_, err = c.InspectImage(context.Background(), host+"/team/app:2.0")
+	require.ErrorContains(t, err, "read manifest of "+host+"/team/app:2.0")
+}
@@ -0,0 +1,130 @@
+package kaniko
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// kanikoWorkDir returns the kaniko directory of the build: the one prepared for the
+// build, or the configured one. It is empty for the default directory of the executor.
+func (k *Config) kanikoWorkDir() string {
+	if k.kanikoDir != "" {
+		return k.kanikoDir
+	}
+	return strings.TrimSpace(k.KanikoDir)
+}
+
+// prepareKanikoDir prepares the kaniko directory asked for: it is created when missing
+// and checked to be writable. Without one, the executor keeps its default directory.
+// The returned function removes the directory when created, unless KeepKanikoDir is set.
+//
+// Executors copy their default directory to any other one, remove the default one and
+// read their docker config from <dir>/.docker, so the directory cannot be below the
+// default one and the docker config of the build is copied there.
+// Buildah has no kaniko directory.
+func (k *Config) prepareKanikoDir() (func(), error) {
+	noop := func() {}
+	if k.KanikoDir != "" && strings.TrimSpace(k.KanikoDir) == "" {
+		slog.Warn("kaniko-dir value contains only whitespace, it is ignored")
+	}
+	dir := strings.TrimSpace(k.KanikoDir)
+	if k.backendName() != BackendKaniko || dir == "" {
+		return noop, nil
+	}
+	if clean := filepath.Clean(dir); strings.HasPrefix(clean, defaultKanikoDir+"/") {
+		return nil, fmt.Errorf("kaniko-dir %s cannot be below %s, which the executor removes", dir, defaultKanikoDir)
+	}
+
+	created := false
+	if !isDir(dir) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("create kaniko-dir: %w", err)
+		}
+		created = true
+	}
+	if err := writable(dir); err != nil {
+		return nil, fmt.Errorf("kaniko-dir %s is not writable: %w", dir, err)
+	}
+	k.kanikoDir = dir
+	slog.Info("using kaniko directory", "dir", dir, "created", created)
+
+	dockerConfig := ""
+	if filepath.Clean(dir) != defaultKanikoDir {
+		var err error
+		if dockerConfig, err = k.copyDockerConfig(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() {
+		switch {
+		case !created:
+			if dockerConfig != "" {
+				if err := os.Remove(dockerConfig); err != nil {
+					slog.Warn("failed to remove docker config from kaniko directory", "path", dockerConfig, "error", err)
+				}
+			}
+		case k.KeepKanikoDir:
+			slog.Info("keeping kaniko directory", "dir", dir)
+		default:
+			if err := os.RemoveAll(dir); err != nil {
+				slog.Warn("failed to remove kaniko directory", "dir", dir, "error", err)
+			}
+		}
+	}, nil
+}
+
+// copyDockerConfig copies the docker config of the build into the .docker directory
+// of the kaniko directory, where the executor reads it from. It returns the path of
+// the copy, empty when there is no docker config.
+func (k *Config) copyDockerConfig(dir string) (string, error) {
+	configDir := k.dockerConfigDir()
+	if configDir == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("read docker config: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Join(dir, ".docker"), 0700); err != nil {
+		return "", fmt.Errorf("create docker config in kaniko-dir: %w", err)
+	}
+	path := filepath.Join(dir, ".docker", "config.json")
+	if err = os.WriteFile(path, b, 0600); err != nil {
+		return "", fmt.Errorf("write docker config in kaniko-dir: %w", err)
+	}
+	return path, nil
+}
+
+// writable checks that files can be created in dir.
+func writable(dir string) error {
+	f, err := os.CreateTemp(dir, ".write-test-")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// kanikoDirEnv returns the KANIKO_DIR environment variable of the executor, which
+// some releases only read from the environment, see
+// https://github.com/chainguard-forks/kaniko/blob/07ed3b190c5beb1df4ce043128942d07d5dcf9f8/pkg/config/init.go#L29
+func (k *Config) kanikoDirEnv() []string {
+	if dir := k.kanikoWorkDir(); dir != "" {
+		return []string{"KANIKO_DIR=" + dir}
+	}
+	return nil
+}
+
+// kanikoDirArgs returns the --kaniko-dir flag of the executor.
+func (k *Config) kanikoDirArgs() []string {
+	if dir := k.kanikoWorkDir(); dir != "" {
+		return []string{"--kaniko-dir", dir}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package kaniko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_prepareKanikoDir(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	t.Run("executor default", func(t *testing.T) {
+		c := &Config{KanikoDir: " "}
+		cleanup, err := c.prepareKanikoDir()
+		require.NoError(t, err)
+		cleanup()
+		require.Empty(t, c.kanikoWorkDir())
+		require.Empty(t, c.kanikoDirArgs())
+		require.Empty(t, c.kanikoDirEnv())
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		existing := t.TempDir()
+		c := &Config{KanikoDir: " " + existing + " "}
+		cleanup, err := c.prepareKanikoDir()
+		require.NoError(t, err)
+		require.Equal(t, existing, c.kanikoWorkDir())
+		cleanup()
+		require.DirExists(t, existing)
+
+		missing := filepath.Join(t.TempDir(), "kaniko")
+		c = &Config{KanikoDir: missing}
+		cleanup, err = c.prepareKanikoDir()
+		require.NoError(t, err)
+		require.DirExists(t, missing)
+		cleanup()
+		require.NoDirExists(t, missing)
+	})
+
+	t.Run("kept", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "kaniko")
+		c := &Config{KanikoDir: dir, KeepKanikoDir: true}
+		cleanup, err := c.prepareKanikoDir()
+		require.NoError(t, err)
+		cleanup()
+		require.DirExists(t, dir)
+	})
+
+	t.Run("docker config", func(t *testing.T) {
+		dockerConfig := t.TempDir()
+		t.Setenv("DOCKER_CONFIG", dockerConfig)
+		require.NoError(t, os.WriteFile(filepath.Join(dockerConfig, "config.json"), []byte(`{"auths":{}}`), 0600))
+		dir := t.TempDir()
+		c := &Config{KanikoDir: dir}
+		cleanup, err := c.prepareKanikoDir()
+		require.NoError(t, err)
+		b, err := os.ReadFile(filepath.Join(dir, ".docker", "config.json"))
+		require.NoError(t, err)
+		require.Equal(t, `{"auths":{}}`, string(b))
+		// The credentials are not left in a directory which is kept.
+		cleanup()
+		require.NoFileExists(t, filepath.Join(dir, ".docker", "config.json"))
+	})
+
+	t.Run("below the executor default", func(t *testing.T) {
+		c := &Config{KanikoDir: "/kaniko/cache"}
+		_, err := c.prepareKanikoDir()
+		require.EqualError(t, err, "kaniko-dir /kaniko/cache cannot be below /kaniko, which the executor removes")
+	})
+
+	t.Run("not a directory", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(file, nil, 0644))
+		c := &Config{KanikoDir: filepath.Join(file, "kaniko")}
+		_, err := c.prepareKanikoDir()
+		require.ErrorContains(t, err, "create kaniko-dir: ")
+	})
+
+	t.Run("not used", func(t *testing.T) {
+		c := &Config{Backend: BackendBuildah, KanikoDir: t.TempDir()}
+		_, err := c.prepareKanikoDir()
+		require.NoError(t, err)
+		require.Empty(t, c.kanikoDir)
+	})
+}
+
+func Test_kanikoDirArgs(t *testing.T) {
+	c := &Config{KanikoDir: "/cache/kaniko", capabilities: executorCapabilities{"destination": true}}
+	require.Equal(t, []string{"--kaniko-dir", "/cache/kaniko"}, c.kanikoDirArgs())
+	require.Equal(t, []string{"KANIKO_DIR=/cache/kaniko"}, c.kanikoDirEnv())
+
+	require.Empty(t, (&Config{}).kanikoDirArgs())
+	require.Empty(t, (&Config{}).kanikoDirEnv())
+}
+
+func Test_RunKanikoDir(t *testing.T) {
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	t.Setenv("KANIKO_DIR", "")
+	executor := testharness.NewExecutor(t, testharness.Scenario{})
+
+	c := Config{ExecutablePath: executor.Path, Destination: "my.registry/myimage:sometag"}
+	require.NoError(t, c.Run(context.Background()))
+	builds := executor.Builds(t)
+	require.Len(t, builds, 1)
+	require.Empty(t, builds[0].Flag("kaniko-dir"))
+	require.Empty(t, builds[0].Getenv("KANIKO_DIR"))
+
+	dir := filepath.Join(t.TempDir(), "kaniko")
+	c = Config{ExecutablePath: executor.Path, Destination: "my.registry/myimage:sometag", KanikoDir: dir}
+	require.NoError(t, c.Run(context.Background()))
+	builds = executor.Builds(t)
+	require.Len(t, builds, 2)
+	require.Equal(t, []string{dir}, builds[1].Flag("kaniko-dir"))
+	require.Equal(t, dir, builds[1].Getenv("KANIKO_DIR"))
+	require.NoDirExists(t, dir)
+}
@@ -0,0 +1,422 @@
+package kaniko
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// OCI pre-defined annotation keys, see https://github.com/opencontainers/image-spec/blob/main/annotations.md.
+const (
+	ociAnnotationPrefix = "org.opencontainers.image."
+	ociSource           = ociAnnotationPrefix + "source"
+	ociRevision         = ociAnnotationPrefix + "revision"
+	ociCreated          = ociAnnotationPrefix + "created"
+	ociVersion          = ociAnnotationPrefix + "version"
+	ociRefName          = ociAnnotationPrefix + "ref.name"
+	ociBaseName         = ociAnnotationPrefix + "base.name"
+	ociBaseDigest       = ociAnnotationPrefix + "base.digest"
+)
+
+// baseImageTimeout bounds the lookup of the base image digest.
+const baseImageTimeout = 10 * time.Second
+
+// prepareOCILabels computes the OCI standard labels of the image from the repository,
+// commit and ref inputs, the destination tag and the base image of the Dockerfile.
+func (k *Config) prepareOCILabels() {
+	labels := map[string]string{}
+	set := func(key, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			labels[key] = value
+		}
+	}
+
+	set(ociSource, redactURL(os.Getenv("INPUT_REPOSITORY_URL")))
+	set(ociRevision, os.Getenv("INPUT_COMMIT"))
+
+	// The build time makes every build differ, so it is only set when asked.
+	created := k.sourceDateEpochTime()
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(os.Getenv(sourceDateEpochArg)), 10, 64); created.IsZero() && err == nil {
+		created = time.Unix(seconds, 0)
+	}
+	if created.IsZero() && k.CreatedLabel {
+		created = time.Now()
+	}
+	if !created.IsZero() {
+		set(ociCreated, created.UTC().Format(time.RFC3339))
+	}
+
+	var tag string
+	if destinations := k.processDestinations(); len(destinations) > 0 {
+		if ref, err := registry.ParseReference(destinations[0]); err == nil {
+			tag = ref.Tag
+		}
+	}
+	set(ociRefName, tag)
+	if version, ok := strings.CutPrefix(strings.TrimSpace(os.Getenv("INPUT_REF")), "refs/tags/"); ok {
+		set(ociVersion, version)
+	} else {
+		set(ociVersion, tag)
+	}
+
+	if base, digest, err := k.resolveBaseImage(); err != nil {
+		slog.Warn("cannot resolve the base image", "error", err)
+	} else {
+		set(ociBaseName, base)
+		set(ociBaseDigest, digest)
+	}
+
+	k.ociLabels = labels
+}
+
+// redactURL removes the credentials of a URL, leaving other values untouched.
+func redactURL(value string) string {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || u.User == nil {
+		return value
+	}
+	u.User = nil
+	return u.String()
+}
+
+// resolveBaseImage returns the fully qualified base image of the built stage and
+// its digest, empty when the stage is built from scratch. The digest is looked up in
+// the registry unless pinned in the Dockerfile; lookup failures only leave it empty.
+func (k *Config) resolveBaseImage() (string, string, error) {
+	f, err := os.Open(k.resolveDockerfile())
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	base, err := dockerfileBaseImage(f, k.Target, k.buildArgValues())
+	if err != nil || base == "" {
+		return "", "", err
+	}
+
+	ref, err := registry.ParseReference(base)
+	if err != nil {
+		return "", "", err
+	}
+	if ref.Digest != "" {
+		return ref.String(), ref.Digest, nil
+	}
+
+	client, err := k.registryClient()
+	if err != nil {
+		slog.Warn("cannot look up the digest of the base image", "image", ref, "error", err)
+		return ref.String(), "", nil
+	}
+	ctx, cancel := context.WithTimeout(k.Context, baseImageTimeout)
+	defer cancel()
+	_, desc, err := client.Manifest(ctx, ref)
+	if err != nil {
+		slog.Warn("cannot look up the digest of the base image", "image", ref, "error", err)
+		return ref.String(), "", nil
+	}
+	return ref.String(), desc.Digest, nil
+}
+
+// buildArgValues returns the build args by name.
+func (k *Config) buildArgValues() map[string]string {
+	buildArgs := map[string]string{}
+	for _, arg := range k.processBuildArgs() {
+		if key, value, ok := strings.Cut(arg, "="); ok {
+			buildArgs[strings.TrimSpace(key)] = unquote(value)
+		}
+	}
+	return buildArgs
+}
+
+// dockerfileStage is a build stage of a Dockerfile.
+type dockerfileStage struct {
+	name string
+	// image is the operand of FROM, with the global ARGs expanded.
+	image string
+	// instructions are the upper-cased keywords of the stage instructions following FROM.
+	instructions []string
+	// copyFrom are the --from operands of COPY instructions, with the ARGs of the stage expanded.
+	copyFrom []string
+}
+
+// dockerfileStages returns the stages of a Dockerfile. ARGs are expanded in FROM
+// lines and COPY --from flags with their defaults overridden by the build args.
+func dockerfileStages(r io.Reader, buildArgs map[string]string) ([]dockerfileStage, error) {
+	var stages []dockerfileStage
+	globalArgs := map[string]string{}
+	args := globalArgs
+
+	instructions, err := dockerfileInstructions(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, fields := range instructions {
+		keyword := strings.ToUpper(fields[0])
+		if len(stages) > 0 && keyword != "FROM" {
+			stage := &stages[len(stages)-1]
+			stage.instructions = append(stage.instructions, keyword)
+			if keyword == "COPY" {
+				for _, f := range fields[1:] {
+					if from, ok := strings.CutPrefix(f, "--from="); ok {
+						stage.copyFrom = append(stage.copyFrom, expandArgs(unquote(from), args))
+					}
+				}
+			}
+		}
+
+		switch keyword {
+		case "FROM":
+			var operands []string
+			for _, f := range fields[1:] {
+				if !strings.HasPrefix(f, "--") {
+					operands = append(operands, f)
+				}
+			}
+			if len(operands) == 0 {
+				return nil, fmt.Errorf("FROM without image in Dockerfile")
+			}
+			s := dockerfileStage{image: expandArgs(operands[0], globalArgs)}
+			if len(operands) >= 3 && strings.EqualFold(operands[1], "AS") {
+				s.name = strings.ToLower(operands[2])
+			}
+			stages = append(stages, s)
+			// ARGs declared before the first FROM only apply to FROM lines,
+			// and in stages when declared again.
+			args = map[string]string{}
+		case "ARG":
+			for _, decl := range fields[1:] {
+				name, value, hasDefault := strings.Cut(decl, "=")
+				if override, ok := buildArgs[name]; ok {
+					value = override
+				} else if !hasDefault {
+					value = globalArgs[name]
+				}
+				args[name] = expandArgs(unquote(value), args)
+			}
+		}
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no FROM instruction in Dockerfile")
+	}
+	return stages, nil
+}
+
+// targetStage returns the index of the target stage, the last stage when target is empty.
+func targetStage(stages []dockerfileStage, target string) (int, error) {
+	if target == "" {
+		return len(stages) - 1, nil
+	}
+	for i, s := range stages {
+		if s.name == strings.ToLower(target) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("target stage %s not found in Dockerfile", target)
+}
+
+// parentStage returns the index of the earlier stage the stage is built from, -1
+// when it is built from an image.
+func parentStage(stages []dockerfileStage, current int) int {
+	image := strings.ToLower(stages[current].image)
+	previous := -1
+	for i := 0; i < current; i++ {
+		if stages[i].name == image {
+			previous = i
+		}
+	}
+	return previous
+}
+
+// dockerfileBaseImage returns the image the target stage, or the last stage when
+// target is empty, is built from, following stages built from other stages.
+// Global ARGs are expanded with their defaults overridden by the build args.
+// It returns an empty string for images built from scratch.
+func dockerfileBaseImage(r io.Reader, target string, buildArgs map[string]string) (string, error) {
+	stages, err := dockerfileStages(r, buildArgs)
+	if err != nil {
+		return "", err
+	}
+	current, err := targetStage(stages, target)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if strings.EqualFold(stages[current].image, "scratch") {
+			return "", nil
+		}
+		previous := parentStage(stages, current)
+		if previous < 0 {
+			return stages[current].image, nil
+		}
+		current = previous
+	}
+}
+
+// dockerfileInstructions splits a Dockerfile into the fields of its instructions,
+// joining continuation lines and dropping comments.
+func dockerfileInstructions(r io.Reader) ([][]string, error) {
+	var instructions [][]string
+	var current strings.Builder
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") || (line == "" && current.Len() > 0) {
+			continue
+		}
+		if continued, ok := strings.CutSuffix(line, `\`); ok {
+			current.WriteString(continued + " ")
+			continue
+		}
+		current.WriteString(line)
+		if fields := strings.Fields(current.String()); len(fields) > 0 {
+			instructions = append(instructions, fields)
+		}
+		current.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read Dockerfile: %w", err)
+	}
+	if fields := strings.Fields(current.String()); len(fields) > 0 {
+		instructions = append(instructions, fields)
+	}
+	return instructions, nil
+}
+
+// expandArgs substitutes $NAME, ${NAME}, ${NAME:-default} and ${NAME:+alternative}.
+func expandArgs(s string, args map[string]string) string {
+	return os.Expand(s, func(expr string) string {
+		if name, def, ok := strings.Cut(expr, ":-"); ok {
+			if v := args[name]; v != "" {
+				return v
+			}
+			return def
+		}
+		if name, alt, ok := strings.Cut(expr, ":+"); ok {
+			if args[name] != "" {
+				return alt
+			}
+			return ""
+		}
+		return args[expr]
+	})
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '"' {
+			if v, err := strconv.Unquote(s); err == nil {
+				return v
+			}
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// mergeLabels returns the user labels followed by the OCI labels they do not override.
+func mergeLabels(user []string, oci map[string]string) []string {
+	overridden := map[string]bool{}
+	for _, label := range user {
+		key, _, _ := strings.Cut(label, "=")
+		overridden[strings.TrimSpace(key)] = true
+	}
+	merged := append([]string{}, user...)
+	for _, key := range sortedKeys(oci) {
+		if !overridden[key] {
+			merged = append(merged, key+"="+oci[key])
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// processAnnotations returns the OCI labels of the image, including the ones set
+// by the user, which are also set as manifest annotations.
+// The kaniko executor has no flag for them, see annotateManifests.
+func (k *Config) processAnnotations() []string {
+	var annotations []string
+	for _, label := range k.processLabels() {
+		if key, _, _ := strings.Cut(label, "="); strings.HasPrefix(strings.TrimSpace(key), ociAnnotationPrefix) {
+			annotations = append(annotations, label)
+		}
+	}
+	return annotations
+}
+
+// annotateManifests sets the annotations on the manifest pushed by the kaniko executor
+// and tags the annotated manifest at every destination, when AnnotateManifest is set.
+// It returns the digest of the annotated manifest, empty when the image has no
+// annotations or is not pushed. The manifest pushed by the executor is left untagged.
+func (k *Config) annotateManifests(ctx context.Context) (string, error) {
+	if !k.AnnotateManifest || k.noPush {
+		return "", nil
+	}
+	annotations := map[string]string{}
+	for _, annotation := range k.processAnnotations() {
+		key, value, _ := strings.Cut(annotation, "=")
+		annotations[strings.TrimSpace(key)] = value
+	}
+	var refs []registry.Reference
+	for _, destination := range k.processDestinations() {
+		if destination = strings.TrimSpace(destination); destination == "" {
+			continue
+		}
+		ref, err := registry.ParseReference(destination)
+		if err != nil {
+			return "", fmt.Errorf("parse destination %s: %w", destination, err)
+		}
+		refs = append(refs, ref)
+	}
+	if len(annotations) == 0 || len(refs) == 0 {
+		return "", nil
+	}
+
+	client, err := k.destinationClient()
+	if err != nil {
+		return "", err
+	}
+	m, _, err := client.Manifest(ctx, refs[0])
+	if err != nil {
+		return "", fmt.Errorf("read pushed manifest of %s: %w", refs[0], err)
+	}
+	if m.Annotations == nil {
+		m.Annotations = map[string]string{}
+	}
+	for key, value := range annotations {
+		m.Annotations[key] = value
+	}
+	content, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	var digest string
+	var annotated []string
+	for _, ref := range refs {
+		desc, err := client.PutManifest(ctx, ref, m.MediaType, content)
+		if err != nil {
+			if len(annotated) > 0 {
+				return "", fmt.Errorf("push annotated manifest to %s, already tagged at %s: %w", ref, strings.Join(annotated, ", "), err)
+			}
+			return "", fmt.Errorf("push annotated manifest to %s: %w", ref, err)
+		}
+		digest = desc.Digest
+		annotated = append(annotated, ref.String())
+	}
+	slog.Info("annotated the pushed manifest", "digest", digest)
+	return digest, nil
+}
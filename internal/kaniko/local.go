@@ -0,0 +1,195 @@
+package kaniko
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Container runtimes running the kaniko executor image in local mode.
+const (
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+)
+
+// DefaultExecutorImage is the kaniko executor image run in local mode: the base image
+// of the action in the Dockerfile, so that local builds use the executor of CI.
+const DefaultExecutorImage = "020229604682.dkr.ecr.us-east-1.amazonaws.com/actions/chainguard-dev-kaniko-base:1.25.16-7872282270c360d3e60875c8b0795173a3207dfb-49"
+
+const (
+	// defaultLocalOutputs is the directory outputs are written to in local mode.
+	defaultLocalOutputs = ".kaniko-outputs"
+	// maxOutputWidth bounds the output values printed in local mode.
+	maxOutputWidth = 100
+)
+
+// outputsDir returns the directory the action outputs are written to, empty when
+// outputs are not collected. In local mode the directory is created.
+func (k *Config) outputsDir() (string, error) {
+	if !k.Local {
+		return os.Getenv("CLOUDBEES_OUTPUTS"), nil
+	}
+	dir := k.LocalOutputs
+	if dir == "" {
+		dir = defaultLocalOutputs
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return "", fmt.Errorf("create outputs directory: %w", err)
+	}
+	return dir, nil
+}
+
+// resolveContainerRuntime looks up the docker or podman CLI running the executor in local mode.
+func (k *Config) resolveContainerRuntime() error {
+	runtime := strings.ToLower(strings.TrimSpace(k.ContainerRuntime))
+	if runtime == "" {
+		runtime = RuntimeDocker
+	}
+	if runtime != RuntimeDocker && runtime != RuntimePodman {
+		return fmt.Errorf("unknown container runtime: %s", k.ContainerRuntime)
+	}
+	path, err := exec.LookPath(runtime)
+	if err != nil {
+		return fmt.Errorf("cannot find container runtime %s: %w", runtime, err)
+	}
+	k.containerRuntime = path
+	return nil
+}
+
+func (k *Config) executorImage() string {
+	if k.ExecutorImage != "" {
+		return k.ExecutorImage
+	}
+	return DefaultExecutorImage
+}
+
+// executorName describes the executor in messages.
+func (k *Config) executorName() string {
+	if k.Local {
+		return k.executorImage()
+	}
+	return k.ExecutablePath
+}
+
+// executorCommand returns the command running the executor with the given arguments.
+// In local mode, the executor image is run by the container runtime with the
+// directories of the build mounted at the same paths, so that arguments need no
+// translation. Environment variables are passed by name to keep their values,
+// which may hold credentials, out of the command line.
+func (k *Config) executorCommand(args ...string) *exec.Cmd {
+	if !k.Local {
+		cmd := exec.CommandContext(k.Context, k.ExecutablePath, args...)
+		cmd.Env = k.env()
+		return cmd
+	}
+
+	env := k.backendEnv()
+	dockerConfig := k.localDockerConfig()
+	if dockerConfig != "" && k.dockerConfig == "" {
+		env = append(env, "DOCKER_CONFIG="+dockerConfig)
+	}
+	env = append(env, k.kanikoDirEnv()...)
+
+	runArgs := []string{"run", "--rm", "--network", "host"}
+	if wd, err := os.Getwd(); err == nil {
+		runArgs = append(runArgs, "--workdir", wd)
+	}
+	for _, dir := range k.localMounts(dockerConfig) {
+		runArgs = append(runArgs, "--volume", dir+":"+dir)
+	}
+	for _, e := range env {
+		name, _, _ := strings.Cut(e, "=")
+		runArgs = append(runArgs, "--env", name)
+	}
+	runArgs = append(append(runArgs, k.executorImage()), args...)
+
+	cmd := exec.CommandContext(k.Context, k.containerRuntime, runArgs...)
+	cmd.Env = append(os.Environ(), env...)
+	return cmd
+}
+
+// localDockerConfig returns the docker config directory mounted in local mode.
+func (k *Config) localDockerConfig() string {
+	if k.dockerConfig != "" {
+		return k.dockerConfig
+	}
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if dir := filepath.Join(home, ".docker"); isDir(dir) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// localMounts returns the directories the executor reads or writes in local mode:
+// the working directory, build context, Dockerfile, tarball, docker config, kaniko
+// directory and the temporary directory holding the digest file and the prepared
+// certificates and contexts. Directories below another one are left out.
+func (k *Config) localMounts(dockerConfig string) []string {
+	var dirs []string
+	add := func(p string) {
+		if p == "" {
+			return
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			dirs = append(dirs, abs)
+		}
+	}
+	if wd, err := os.Getwd(); err == nil {
+		add(wd)
+	}
+	add(k.DockerContext)
+	add(filepath.Dir(k.resolveDockerfile()))
+	if k.TarPath != "" {
+		add(filepath.Dir(k.TarPath))
+	}
+	add(dockerConfig)
+	add(k.kanikoWorkDir())
+	add(os.TempDir())
+
+	sort.Strings(dirs)
+	var mounts []string
+	for _, dir := range dirs {
+		if n := len(mounts); n > 0 && (dir == mounts[n-1] || strings.HasPrefix(dir, mounts[n-1]+string(filepath.Separator))) {
+			continue
+		}
+		mounts = append(mounts, dir)
+	}
+	return mounts
+}
+
+func isDir(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
+
+// printOutputs prints the outputs written as a table. Long and multi-line values
+// are shortened, the outputs hold the full content.
+func printOutputs(w io.Writer, outputs *recordedOutputs) {
+	width := 0
+	for name := range outputs.values {
+		width = max(width, len(name))
+	}
+	fmt.Fprintf(w, "Outputs written to %s:\n", outputs)
+	for _, name := range sortedKeys(outputs.values) {
+		value := strings.TrimSpace(outputs.values[name])
+		if first, _, multiline := strings.Cut(value, "\n"); multiline || len(value) > maxOutputWidth {
+			if len(first) > maxOutputWidth {
+				first = first[:maxOutputWidth-3] + "..."
+			}
+			value = fmt.Sprintf("%s (%d bytes)", first, len(outputs.values[name]))
+		}
+		fmt.Fprintf(w, "  %-*s  %s\n", width, name, value)
+	}
+}
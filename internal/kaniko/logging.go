@@ -0,0 +1,174 @@
+package kaniko
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Log formats of the wrapper.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// logLevel returns the slog level of a verbosity level of the executor.
+func logLevel(verbosity string) slog.Level {
+	switch strings.ToLower(verbosity) {
+	case "panic", "fatal", "error":
+		return slog.LevelError
+	case "warn":
+		return slog.LevelWarn
+	case "debug":
+		return slog.LevelDebug
+	case "trace":
+		return slog.LevelDebug - 4
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func validateLogFormat(format string) error {
+	switch format {
+	case "", LogFormatText, LogFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown log format: %s", format)
+}
+
+// buildID identifies the build in the logs: the run of the CI system when known,
+// a random ID otherwise.
+func buildID() string {
+	for _, env := range [][2]string{
+		{"CLOUDBEES_RUN_ID", "CLOUDBEES_RUN_ATTEMPT"},
+		{"GITHUB_RUN_ID", "GITHUB_RUN_ATTEMPT"},
+	} {
+		if id := os.Getenv(env[0]); id != "" {
+			if attempt := os.Getenv(env[1]); attempt != "" {
+				return id + "-" + attempt
+			}
+			return id
+		}
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startLogging sets the default slog logger, and the log package, to log the
+// wrapper at the level of Verbosity in LogFormat, to stderr and LogFile.
+// The returned function restores the previous logger.
+func (k *Config) startLogging() (func(), error) {
+	format := strings.ToLower(k.LogFormat)
+	if err := validateLogFormat(format); err != nil {
+		return nil, err
+	}
+	var w io.Writer = os.Stderr
+	var file *os.File
+	if k.LogFile != "" {
+		var err error
+		if file, err = os.Create(k.LogFile); err != nil {
+			return nil, fmt.Errorf("log file: %w", err)
+		}
+		w = io.MultiWriter(os.Stderr, file)
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel(k.Verbosity)}
+	var handler slog.Handler = slog.NewTextHandler(w, opts)
+	if format == LogFormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	k.buildID = buildID()
+	k.logFields = &logFields{}
+	handler = &logHandler{
+		Handler: handler.WithAttrs([]slog.Attr{slog.String("build_id", k.buildID), slog.String("destination", k.Destination)}),
+		fields:  k.logFields,
+	}
+
+	previous, previousOutput, previousFlags := slog.Default(), log.Writer(), log.Flags()
+	slog.SetDefault(slog.New(handler))
+	return func() {
+		slog.SetDefault(previous)
+		// Restoring the initial slog logger does not restore the log package.
+		log.SetOutput(previousOutput)
+		log.SetFlags(previousFlags)
+		if file != nil {
+			_ = file.Close()
+		}
+	}, nil
+}
+
+// logFields holds the fields of the build changing while it runs.
+type logFields struct {
+	mu    sync.Mutex
+	phase string
+	// warnings receives the warnings of the wrapper, formatted as text.
+	warnings func(string)
+}
+
+// setPhase sets the phase of the build added to the log records.
+func (f *logFields) setPhase(phase string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.phase = phase
+}
+
+// onWarning calls warning with the warnings logged from now on.
+func (f *logFields) onWarning(warning func(string)) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.warnings = warning
+}
+
+// logHandler adds the phase of the build to the log records and passes on the warnings.
+type logHandler struct {
+	slog.Handler
+	fields *logFields
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.fields.mu.Lock()
+	phase, warnings := h.fields.phase, h.fields.warnings
+	h.fields.mu.Unlock()
+
+	if warnings != nil && r.Level >= slog.LevelWarn {
+		text := r.Message
+		r.Attrs(func(a slog.Attr) bool {
+			text += " " + a.String()
+			return true
+		})
+		warnings(text)
+	}
+	if phase != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String("phase", phase))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{Handler: h.Handler.WithAttrs(attrs), fields: h.fields}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{Handler: h.Handler.WithGroup(name), fields: h.fields}
+}
+
+// logCommand logs a command run for the build with its arguments.
+func logCommand(msg string, cmd *exec.Cmd, attrs ...any) {
+	slog.Info(msg, append(attrs, "command", cmd.Path, "args", cmd.Args[1:])...)
+}
@@ -0,0 +1,137 @@
+package kaniko
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_logLevel(t *testing.T) {
+	for verbosity, level := range map[string]slog.Level{
+		"panic": slog.LevelError,
+		"fatal": slog.LevelError,
+		"ERROR": slog.LevelError,
+		"warn":  slog.LevelWarn,
+		"info":  slog.LevelInfo,
+		"":      slog.LevelInfo,
+		"debug": slog.LevelDebug,
+		"trace": slog.LevelDebug - 4,
+	} {
+		require.Equal(t, level, logLevel(verbosity), verbosity)
+	}
+}
+
+func Test_buildID(t *testing.T) {
+	t.Setenv("CLOUDBEES_RUN_ID", "")
+	t.Setenv("GITHUB_RUN_ID", "1234")
+	t.Setenv("GITHUB_RUN_ATTEMPT", "2")
+	require.Equal(t, "1234-2", buildID())
+
+	t.Setenv("CLOUDBEES_RUN_ID", "3f2a")
+	t.Setenv("CLOUDBEES_RUN_ATTEMPT", "")
+	require.Equal(t, "3f2a", buildID())
+
+	t.Setenv("CLOUDBEES_RUN_ID", "")
+	t.Setenv("GITHUB_RUN_ID", "")
+	require.Len(t, buildID(), 16)
+	require.NotEqual(t, buildID(), buildID())
+}
+
+// readLogFile returns the records of a JSON log file.
+func readLogFile(t *testing.T, path string) []map[string]any {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var records []map[string]any
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record), scanner.Text())
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func Test_startLogging(t *testing.T) {
+	t.Setenv("CLOUDBEES_RUN_ID", "3f2a")
+	t.Setenv("CLOUDBEES_RUN_ATTEMPT", "1")
+	previous := slog.Default()
+	c := &Config{
+		Destination: "my.registry/myimage:sometag",
+		Verbosity:   "info",
+		LogFormat:   "JSON",
+		LogFile:     filepath.Join(t.TempDir(), "build.log"),
+	}
+	restore, err := c.startLogging()
+	require.NoError(t, err)
+
+	var warnings []string
+	c.logFields.onWarning(func(warning string) { warnings = append(warnings, warning) })
+	slog.Debug("not logged")
+	c.logFields.setPhase(phaseConfig)
+	slog.Info("using proxy", "proxy", "http://proxy:3128")
+	// The log package is redirected too.
+	log.Printf("from the log package")
+	slog.Warn("cannot look up the previous image", "image", "my.registry/myimage:sometag")
+	restore()
+
+	require.Same(t, previous, slog.Default())
+	require.Equal(t, []string{"cannot look up the previous image image=my.registry/myimage:sometag"}, warnings)
+	records := readLogFile(t, c.LogFile)
+	require.Len(t, records, 3)
+	for _, record := range records {
+		require.Equal(t, "3f2a-1", record["build_id"])
+		require.Equal(t, "my.registry/myimage:sometag", record["destination"])
+		require.Equal(t, phaseConfig, record["phase"])
+	}
+	require.Equal(t, "using proxy", records[0]["msg"])
+	require.Equal(t, "http://proxy:3128", records[0]["proxy"])
+	require.Equal(t, "from the log package", records[1]["msg"])
+	require.Equal(t, "WARN", records[2]["level"])
+
+	c.LogFormat = "xml"
+	_, err = c.startLogging()
+	require.EqualError(t, err, "unknown log format: xml")
+}
+
+func Test_RunLogFile(t *testing.T) {
+	executor := testharness.NewExecutor(t, testharness.Scenario{})
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	t.Setenv("CLOUDBEES_RUN_ID", "")
+	t.Setenv("GITHUB_RUN_ID", "")
+
+	c := Config{
+		ExecutablePath: executor.Path,
+		Destination:    "my.registry/myimage:sometag",
+		Target:         "build",
+		Verbosity:      "debug",
+		LogFormat:      LogFormatJSON,
+		LogFile:        filepath.Join(t.TempDir(), "build.log"),
+	}
+	require.NoError(t, c.Run(context.Background()))
+
+	phases := map[string]string{}
+	var command map[string]any
+	for _, record := range readLogFile(t, c.LogFile) {
+		require.Equal(t, c.buildID, record["build_id"])
+		phase, _ := record["phase"].(string)
+		phases[record["msg"].(string)] = phase
+		if record["msg"] == "running command" {
+			command = record
+		}
+	}
+	require.Equal(t, phasePreflight, phases["found kaniko executor binary"])
+	require.Equal(t, phaseExecutor, phases["targeting stage"])
+	require.Equal(t, phaseExecutor, phases["running command"])
+	require.Equal(t, executor.Path, command["command"])
+	require.Contains(t, command["args"], "my.registry/myimage:sometag")
+}
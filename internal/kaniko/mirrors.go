@@ -0,0 +1,159 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// mirrorProbeTimeout bounds the health probe of a single registry mirror.
+const mirrorProbeTimeout = 3 * time.Second
+
+// mirrorHealth is the probe result of a registry mirror.
+type mirrorHealth struct {
+	Latency time.Duration
+	Err     error
+}
+
+// rankLatency orders unknown mirrors after all mirrors that answered the probe.
+func (k *Config) rankLatency(mirror string) time.Duration {
+	h, ok := k.mirrorHealth[strings.TrimSpace(mirror)]
+	if !ok {
+		return mirrorProbeTimeout
+	}
+	return h.Latency
+}
+
+// probeRegistryMirrors probes the /v2/ endpoint of the registry mirrors and of the mirrors
+// of the registry configuration concurrently. Unhealthy mirrors are no longer passed to
+// the executor and the remaining ones are ordered by latency.
+// It fails when SkipDefaultRegistryFallback is set and a registry has no healthy mirror left.
+func (k *Config) probeRegistryMirrors() error {
+	groups, err := k.configuredMirrors()
+	if err != nil || len(groups) == 0 {
+		return err
+	}
+	client, err := k.registryClient()
+	if err != nil {
+		return err
+	}
+
+	health := map[string]*mirrorHealth{}
+	for _, mirrors := range groups {
+		for _, mirror := range mirrors {
+			health[mirror] = &mirrorHealth{}
+		}
+	}
+	var wg sync.WaitGroup
+	for mirror, h := range health {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(k.Context, mirrorProbeTimeout)
+			defer cancel()
+			start := time.Now()
+			h.Err = client.Ping(ctx, registry.NormalizeRegistry(mirror))
+			h.Latency = time.Since(start)
+		}()
+	}
+	wg.Wait()
+
+	k.mirrorHealth = make(map[string]mirrorHealth, len(health))
+	for mirror, h := range health {
+		k.mirrorHealth[mirror] = *h
+	}
+	fmt.Print(k.mirrorHealthTable(groups))
+	for _, prefix := range sortedKeys(groups) {
+		for _, mirror := range groups[prefix] {
+			if err := k.mirrorHealth[mirror].Err; err != nil {
+				slog.Warn("dropping unhealthy registry mirror", "registry", prefix, "mirror", mirror, "error", err)
+			}
+		}
+	}
+
+	if k.SkipDefaultRegistryFallback {
+		for _, prefix := range sortedKeys(groups) {
+			if len(k.rankMirrors(groups[prefix])) == 0 {
+				return fmt.Errorf("no healthy mirror for registry %s and the default registry fallback is disabled", prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// configuredMirrors returns the mirrors to probe by the registry they mirror.
+func (k *Config) configuredMirrors() (map[string][]string, error) {
+	groups := map[string][]string{}
+	for _, mirror := range k.configuredRegistryMirrors() {
+		if mirror = strings.TrimSpace(mirror); mirror != "" {
+			groups[registry.DockerHub] = append(groups[registry.DockerHub], mirror)
+		}
+	}
+	regs, err := k.registryConfig()
+	if err != nil {
+		return nil, err
+	}
+	if regs != nil {
+		for _, r := range regs.Registries {
+			for _, mirror := range r.Mirrors {
+				if mirror = strings.TrimSpace(mirror); mirror != "" {
+					groups[r.Prefix] = append(groups[r.Prefix], mirror)
+				}
+			}
+		}
+	}
+	return groups, nil
+}
+
+// rankMirrors drops the unhealthy mirrors and orders the remaining ones by latency.
+// Mirrors are returned unchanged when they were not probed.
+func (k *Config) rankMirrors(mirrors []string) []string {
+	if k.mirrorHealth == nil {
+		return mirrors
+	}
+	ranked := []string{}
+	for _, mirror := range mirrors {
+		if h, ok := k.mirrorHealth[strings.TrimSpace(mirror)]; !ok || h.Err == nil {
+			ranked = append(ranked, mirror)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return k.rankLatency(ranked[i]) < k.rankLatency(ranked[j])
+	})
+	return ranked
+}
+
+func (k *Config) mirrorHealthTable(groups map[string][]string) string {
+	var sb strings.Builder
+	sb.WriteString("Registry mirror health:\n")
+	w := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  REGISTRY\tMIRROR\tSTATUS\tLATENCY")
+	for _, prefix := range sortedKeys(groups) {
+		for _, mirror := range groups[prefix] {
+			h := k.mirrorHealth[strings.TrimSpace(mirror)]
+			status, latency := "healthy", h.Latency.Round(time.Millisecond).String()
+			if h.Err != nil {
+				status = "unhealthy: " + h.Err.Error()
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", prefix, mirror, status, latency)
+		}
+	}
+	w.Flush()
+	return sb.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
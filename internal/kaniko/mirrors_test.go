@@ -0,0 +1,76 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMirror starts a registry mirror answering /v2/ with status after delay and returns its host.
+func fakeMirror(t *testing.T, status int, delay time.Duration) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func writeMirrorConfig(t *testing.T, prefix string, mirrors ...string) {
+	b, err := json.Marshal(map[string]any{
+		"registries": []map[string]any{{"prefix": prefix, "mirrors": mirrors, "insecure": true}},
+	})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "registries.json")
+	require.NoError(t, os.WriteFile(path, b, 0600))
+	t.Setenv("CLOUDBEES_REGISTRY_CONFIG", path)
+}
+
+func Test_probeRegistryMirrors(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	slow := fakeMirror(t, http.StatusOK, 200*time.Millisecond)
+	fast := fakeMirror(t, http.StatusUnauthorized, 0)
+	down := fakeMirror(t, http.StatusInternalServerError, 0)
+	writeMirrorConfig(t, "quay.io", down+"/quay", slow+"/quay", fast+"/quay")
+
+	c := Config{Context: context.Background(), client: &HttpClient{client: &http.Client{}}}
+	require.NoError(t, c.probeRegistryMirrors())
+	require.Error(t, c.mirrorHealth[down+"/quay"].Err)
+
+	maps, err := c.registryMapsInConfig()
+	require.NoError(t, err)
+	require.Equal(t, "quay.io="+fast+"/quay;quay.io="+slow+"/quay", maps)
+	require.Contains(t, c.mirrorHealthTable(map[string][]string{"quay.io": {down + "/quay"}}), "unhealthy")
+
+	t.Run("no healthy mirror without default registry fallback", func(t *testing.T) {
+		writeMirrorConfig(t, "quay.io", down+"/quay")
+		c := Config{Context: context.Background(), client: &HttpClient{client: &http.Client{}}, SkipDefaultRegistryFallback: true}
+		require.ErrorContains(t, c.probeRegistryMirrors(), "no healthy mirror for registry quay.io")
+
+		c.SkipDefaultRegistryFallback = false
+		require.NoError(t, c.probeRegistryMirrors())
+		maps, err := c.registryMapsInConfig()
+		require.NoError(t, err)
+		require.Empty(t, maps)
+	})
+}
+
+func Test_rankMirrors(t *testing.T) {
+	c := Config{}
+	require.Equal(t, []string{"b", "a"}, c.rankMirrors([]string{"b", "a"}))
+
+	c.mirrorHealth = map[string]mirrorHealth{
+		"a": {Latency: 30 * time.Millisecond},
+		"b": {Latency: 10 * time.Millisecond},
+		"c": {Err: context.DeadlineExceeded},
+	}
+	require.Equal(t, []string{"b", "a", "unknown"}, c.rankMirrors([]string{"a", "c", "unknown", "b"}))
+}
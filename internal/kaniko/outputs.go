@@ -0,0 +1,212 @@
+package kaniko
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Formats of the action outputs.
+const (
+	// OutputFormatCloudBees writes a file per output into the CLOUDBEES_OUTPUTS directory.
+	OutputFormatCloudBees = "cloudbees"
+	// OutputFormatJSON writes all outputs into a single JSON object.
+	OutputFormatJSON = "json"
+	// OutputFormatDotenv writes all outputs as NAME=value lines, e.g. for GitLab CI dotenv reports.
+	OutputFormatDotenv = "dotenv"
+	// OutputFormatGitHub appends all outputs to the $GITHUB_OUTPUT file of GitHub Actions.
+	OutputFormatGitHub = "github"
+)
+
+// outputWriter writes the action outputs.
+type outputWriter interface {
+	// WriteOutput sets the value of the named output.
+	WriteOutput(name, value string) error
+	// Close writes the outputs of formats collecting them into a single file.
+	Close() error
+	// String describes where the outputs are written.
+	String() string
+}
+
+// outputFormat returns the normalized output format.
+func (k *Config) outputFormat() (string, error) {
+	format := strings.ToLower(strings.TrimSpace(k.OutputFormat))
+	switch format {
+	case "":
+		return OutputFormatCloudBees, nil
+	case OutputFormatCloudBees, OutputFormatJSON, OutputFormatDotenv, OutputFormatGitHub:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown output format: %s", k.OutputFormat)
+	}
+}
+
+// newOutputWriter returns the writer of the configured output format, nil when the
+// outputs are not collected, i.e. without CLOUDBEES_OUTPUTS outside local mode.
+func (k *Config) newOutputWriter() (outputWriter, error) {
+	format, err := k.outputFormat()
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case OutputFormatJSON:
+		path, err := k.outputFile("outputs.json")
+		return &jsonOutputs{path: path, values: map[string]string{}}, err
+	case OutputFormatDotenv:
+		path, err := k.outputFile("outputs.env")
+		return &fileOutputs{path: path, format: dotenvOutput}, err
+	case OutputFormatGitHub:
+		path := k.OutputFile
+		if path == "" {
+			path = os.Getenv("GITHUB_OUTPUT")
+		}
+		if path == "" {
+			return nil, fmt.Errorf("GITHUB_OUTPUT is not set")
+		}
+		return &fileOutputs{path: path, format: githubOutput, append: true}, nil
+	}
+
+	dir, err := k.outputsDir()
+	if err != nil || dir == "" {
+		return nil, err
+	}
+	return &dirOutputs{dir: dir}, nil
+}
+
+// outputFile returns OutputFile, or else the named file in the working directory,
+// or the outputs directory in local mode.
+func (k *Config) outputFile(name string) (string, error) {
+	if k.OutputFile != "" {
+		return k.OutputFile, nil
+	}
+	if !k.Local {
+		return name, nil
+	}
+	dir, err := k.outputsDir()
+	return filepath.Join(dir, name), err
+}
+
+// dirOutputs writes a file per output, as expected by CloudBees.
+type dirOutputs struct {
+	dir string
+}
+
+func (o *dirOutputs) WriteOutput(name, value string) error {
+	if err := os.WriteFile(filepath.Join(o.dir, name), []byte(value), 0640); err != nil {
+		return fmt.Errorf("write %s output: %w", name, err)
+	}
+	return nil
+}
+
+func (o *dirOutputs) Close() error {
+	return nil
+}
+
+func (o *dirOutputs) String() string {
+	return o.dir
+}
+
+// jsonOutputs writes the outputs as a JSON object of strings.
+type jsonOutputs struct {
+	path   string
+	values map[string]string
+}
+
+func (o *jsonOutputs) WriteOutput(name, value string) error {
+	o.values[name] = value
+	return nil
+}
+
+func (o *jsonOutputs) Close() error {
+	b, err := json.MarshalIndent(o.values, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(o.path, append(b, '\n'), 0640)
+}
+
+func (o *jsonOutputs) String() string {
+	return o.path
+}
+
+// fileOutputs writes the outputs formatted as text, replacing the file content or
+// appending to it when the file is shared with other steps.
+type fileOutputs struct {
+	path   string
+	format func(name, value string) string
+	append bool
+	buf    bytes.Buffer
+}
+
+func (o *fileOutputs) WriteOutput(name, value string) error {
+	o.buf.WriteString(o.format(name, value))
+	return nil
+}
+
+func (o *fileOutputs) Close() error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if o.append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(o.path, flags, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(o.buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (o *fileOutputs) String() string {
+	return o.path
+}
+
+// dotenvEscaper escapes the characters dotenv parsers unescape in double-quoted values,
+// and $ which readers interpolating variables would expand. Other characters, e.g.
+// non-ASCII ones, are written as is.
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+
+// dotenvOutput formats an output as a dotenv variable, the name in upper case with
+// underscores, e.g. TAG_DIGEST. Values are double-quoted with newlines escaped, as
+// dotenv files hold one variable per line.
+func dotenvOutput(name, value string) string {
+	name = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	return name + "=\"" + dotenvEscaper.Replace(value) + "\"\n"
+}
+
+// githubOutput formats an output with the multi-line syntax of $GITHUB_OUTPUT,
+// delimited by a random marker which cannot appear in the value.
+func githubOutput(name, value string) string {
+	delimiter := "ghadelimiter_" + randomHex()
+	for strings.Contains(value, delimiter) {
+		delimiter = "ghadelimiter_" + randomHex()
+	}
+	return name + "<<" + delimiter + "\n" + value + "\n" + delimiter + "\n"
+}
+
+func randomHex() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recordedOutputs keeps the values written, to print them once the build completed.
+type recordedOutputs struct {
+	outputWriter
+	values map[string]string
+}
+
+func (o *recordedOutputs) WriteOutput(name, value string) error {
+	if o.values == nil {
+		o.values = map[string]string{}
+	}
+	o.values[name] = value
+	return o.outputWriter.WriteOutput(name, value)
+}
@@ -0,0 +1,156 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newOutputWriter(t *testing.T) {
+	outDir := t.TempDir()
+	t.Setenv("CLOUDBEES_OUTPUTS", outDir)
+	t.Setenv("GITHUB_OUTPUT", "")
+
+	c := Config{}
+	out, err := c.newOutputWriter()
+	require.NoError(t, err)
+	require.Equal(t, &dirOutputs{dir: outDir}, out)
+
+	c = Config{OutputFormat: "JSON"}
+	out, err = c.newOutputWriter()
+	require.NoError(t, err)
+	require.Equal(t, "outputs.json", out.String())
+
+	c = Config{OutputFormat: OutputFormatDotenv, OutputFile: "build.env"}
+	out, err = c.newOutputWriter()
+	require.NoError(t, err)
+	require.Equal(t, "build.env", out.String())
+
+	c = Config{OutputFormat: OutputFormatGitHub}
+	_, err = c.newOutputWriter()
+	require.EqualError(t, err, "GITHUB_OUTPUT is not set")
+
+	c = Config{OutputFormat: "xml"}
+	_, err = c.newOutputWriter()
+	require.EqualError(t, err, "unknown output format: xml")
+
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	c = Config{}
+	out, err = c.newOutputWriter()
+	require.NoError(t, err)
+	require.Nil(t, out)
+}
+
+func Test_outputFormats(t *testing.T) {
+	write := func(t *testing.T, out outputWriter) {
+		require.NoError(t, out.WriteOutput("tag", "1.0"))
+		require.NoError(t, out.WriteOutput("tag-digest", "1.0@sha256:cafebabebeef"))
+		require.NoError(t, out.WriteOutput("image-diff", "### Image changes\n\"none\"\n"))
+		require.NoError(t, out.Close())
+	}
+
+	t.Run("json", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "outputs.json")
+		write(t, &jsonOutputs{path: path, values: map[string]string{}})
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var values map[string]string
+		require.NoError(t, json.Unmarshal(b, &values))
+		require.Equal(t, map[string]string{
+			"tag":        "1.0",
+			"tag-digest": "1.0@sha256:cafebabebeef",
+			"image-diff": "### Image changes\n\"none\"\n",
+		}, values)
+	})
+
+	t.Run("dotenv", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "outputs.env")
+		require.NoError(t, os.WriteFile(path, []byte("STALE=1\n"), 0644))
+		write(t, &fileOutputs{path: path, format: dotenvOutput})
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, `TAG="1.0"
+TAG_DIGEST="1.0@sha256:cafebabebeef"
+IMAGE_DIFF="### Image changes\n\"none\"\n"
+`, string(b))
+	})
+
+	t.Run("github", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "github_output")
+		require.NoError(t, os.WriteFile(path, []byte("other=1\n"), 0644))
+		write(t, &fileOutputs{path: path, format: githubOutput, append: true})
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"other":      "1",
+			"tag":        "1.0",
+			"tag-digest": "1.0@sha256:cafebabebeef",
+			"image-diff": "### Image changes\n\"none\"",
+		}, parseGitHubOutput(t, string(b)))
+	})
+}
+
+// parseGitHubOutput reads name=value and multi-line name<<delimiter entries.
+func parseGitHubOutput(t *testing.T, content string) map[string]string {
+	values := map[string]string{}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		if name, value, ok := strings.Cut(lines[i], "="); ok && !strings.Contains(name, "<<") {
+			values[name] = value
+			continue
+		}
+		name, delimiter, ok := strings.Cut(lines[i], "<<")
+		require.True(t, ok, lines[i])
+		var value []string
+		for i++; lines[i] != delimiter; i++ {
+			value = append(value, lines[i])
+		}
+		values[name] = strings.TrimSuffix(strings.Join(value, "\n"), "\n")
+	}
+	return values
+}
+
+func Test_RunOutputFormat(t *testing.T) {
+	executor := testharness.NewExecutor(t, testharness.Scenario{Digest: "sha256:cafebabebeef"})
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	path := filepath.Join(t.TempDir(), "github_output")
+	t.Setenv("GITHUB_OUTPUT", path)
+
+	c := Config{
+		ExecutablePath: executor.Path,
+		Destination:    "my.registry/myimage:sometag",
+		OutputFormat:   OutputFormatGitHub,
+	}
+	require.NoError(t, c.Run(context.Background()))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	values := parseGitHubOutput(t, string(b))
+	require.Equal(t, "sha256:cafebabebeef", values["digest"])
+	require.Equal(t, "my.registry/myimage:sometag@sha256:cafebabebeef", values["image"])
+	require.Contains(t, values, "artifact-ref")
+}
+
+func Test_dotenvOutput(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "plain", value: "1.0", want: `TAG="1.0"`},
+		{name: "non-ASCII", value: "Étape 1/2 ✓", want: `TAG="Étape 1/2 ✓"`},
+		{name: "backslash and quotes", value: `a\b "c"`, want: `TAG="a\\b \"c\""`},
+		{name: "newlines", value: "a\nb\r\n", want: `TAG="a\nb\r\n"`},
+		{name: "variable", value: "${HOME}/$USER", want: `TAG="\${HOME}/\$USER"`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.want+"\n", dotenvOutput("tag", c.value))
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package kaniko
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/policy"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// preparePolicy loads the policy and checks the Dockerfile rules before building.
+func (k *Config) preparePolicy() error {
+	p, err := policy.Load(k.Policy)
+	if err != nil {
+		return err
+	}
+	facts, err := k.dockerfileFacts()
+	if err != nil {
+		return fmt.Errorf("policy: %w", err)
+	}
+	k.policy = p
+	k.policyVars = map[string]any{"dockerfile": facts}
+	return k.reportPolicy(policy.PhaseDockerfile, "Dockerfile")
+}
+
+// checksImagePolicy reports whether the policy has rules on the built image.
+func (k *Config) checksImagePolicy() bool {
+	if k.policy == nil {
+		return false
+	}
+	for _, r := range k.policy.Rules {
+		if r.Phase() == policy.PhaseImage {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImagePolicy checks the image rules against the configuration of the built image.
+func (k *Config) checkImagePolicy(cfg *image.ConfigFile) error {
+	k.policyVars["image"] = imageFacts(cfg)
+	return k.reportPolicy(policy.PhaseImage, "image")
+}
+
+// builtImageConfig reads the configuration of the pushed image, from the tarball
+// when saved or else from the first destination.
+func (k *Config) builtImageConfig(digest string) (*image.ConfigFile, error) {
+	if k.TarPath != "" {
+		t, err := image.OpenTarball(k.TarPath)
+		if err != nil {
+			return nil, err
+		}
+		return t.Config, nil
+	}
+	ref, err := registry.ParseReference(k.processDestinations()[0])
+	if err != nil {
+		return nil, err
+	}
+	if digest != "" {
+		ref = ref.WithDigest(digest)
+	}
+	client, err := k.destinationClient()
+	if err != nil {
+		return nil, err
+	}
+	img, err := registryImage(k.Context, client, ref)
+	if err != nil {
+		return nil, fmt.Errorf("read image %s: %w", ref, err)
+	}
+	return img.Config, nil
+}
+
+// reportPolicy evaluates the rules of a phase, prints the violations and fails
+// when an error rule is violated.
+func (k *Config) reportPolicy(phase, subject string) error {
+	report := &policy.Report{Violations: k.policy.Evaluate(phase, k.policyVars)}
+	if len(report.Violations) > 0 {
+		fmt.Print(report.String())
+	}
+	if report.Failed() {
+		return fmt.Errorf("%s violates policy rules: %s", subject, strings.Join(report.Errors(), ", "))
+	}
+	return nil
+}
+
+// dockerfileFacts describes the Dockerfile to the policy rules:
+//
+//	stages: the stages with their name, image and instructions
+//	bases: the images the stages are built from, with their registry, repository, tag and digest
+//	base: the image the built stage is built from, null for scratch
+//	instructions: the instructions of the built stage and of the stages it is built from
+func (k *Config) dockerfileFacts() (map[string]any, error) {
+	f, err := os.Open(k.resolveDockerfile())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stages, err := dockerfileStages(f, k.buildArgValues())
+	if err != nil {
+		return nil, err
+	}
+	current, err := targetStage(stages, k.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	facts := map[string]any{"base": nil}
+	stageFacts := []any{}
+	bases := []any{}
+	baseFacts := map[int]map[string]any{}
+	for i, s := range stages {
+		stageFacts = append(stageFacts, map[string]any{
+			"name":         s.name,
+			"image":        s.image,
+			"instructions": toList(s.instructions),
+		})
+		if parentStage(stages, i) >= 0 || strings.EqualFold(s.image, "scratch") {
+			continue
+		}
+		base := map[string]any{"image": s.image, "stage": s.name}
+		if ref, err := registry.ParseReference(s.image); err != nil {
+			slog.Warn("policy: cannot parse the base image", "image", s.image, "error", err)
+		} else {
+			base["image"] = ref.String()
+			base["registry"] = ref.Registry
+			base["repository"] = ref.Repository
+			base["tag"] = ref.Tag
+			base["digest"] = ref.Digest
+		}
+		baseFacts[i] = base
+		bases = append(bases, base)
+	}
+	facts["stages"] = stageFacts
+	facts["bases"] = bases
+
+	var chain []int
+	for i := current; i >= 0; i = parentStage(stages, i) {
+		chain = append([]int{i}, chain...)
+	}
+	var instructions []string
+	for _, i := range chain {
+		instructions = append(instructions, stages[i].instructions...)
+	}
+	facts["instructions"] = toList(instructions)
+	if base, ok := baseFacts[chain[0]]; ok {
+		facts["base"] = base
+	}
+	return facts, nil
+}
+
+// imageFacts describes the configuration of the built image to the policy rules.
+func imageFacts(cfg *image.ConfigFile) map[string]any {
+	c := cfg.Config
+	env := map[string]any{}
+	for _, e := range c.Env {
+		name, value, _ := strings.Cut(e, "=")
+		env[name] = value
+	}
+	labels := map[string]any{}
+	for key, value := range c.Labels {
+		labels[key] = value
+	}
+	ports := []any{}
+	for _, p := range sortedKeys(c.ExposedPorts) {
+		number, _, _ := strings.Cut(p, "/")
+		if n, err := strconv.Atoi(number); err == nil {
+			ports = append(ports, float64(n))
+		}
+	}
+	healthcheck := c.Healthcheck != nil && len(c.Healthcheck.Test) > 0 && c.Healthcheck.Test[0] != "NONE"
+
+	return map[string]any{
+		"user":         c.User,
+		"workingDir":   c.WorkingDir,
+		"entrypoint":   toList(c.Entrypoint),
+		"cmd":          toList(c.Cmd),
+		"env":          env,
+		"labels":       labels,
+		"exposedPorts": toList(sortedKeys(c.ExposedPorts)),
+		"ports":        ports,
+		"volumes":      toList(sortedKeys(c.Volumes)),
+		"healthcheck":  healthcheck,
+		"stopSignal":   c.StopSignal,
+		"os":           cfg.OS,
+		"architecture": cfg.Architecture,
+		"layers":       float64(len(cfg.RootFS.DiffIDs)),
+	}
+}
+
+func toList(values []string) []any {
+	list := make([]any, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return list
+}
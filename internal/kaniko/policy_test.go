@@ -0,0 +1,151 @@
+package kaniko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+)
+
+func writePolicy(t *testing.T, policy string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(policy), 0644))
+	return path
+}
+
+func Test_dockerfileFacts(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(`ARG REGISTRY=docker.io
+FROM ${REGISTRY}/golang:1.26 AS build
+RUN go build ./...
+
+FROM gcr.io/distroless/static@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef AS runtime
+HEALTHCHECK CMD ["/app", "health"]
+
+FROM runtime
+COPY --from=build /app /app
+USER 65532
+`), 0644))
+
+	t.Setenv("DOCKER_BUILD_ARGS", "REGISTRY=mirror.example.com")
+	c := Config{DockerContext: dir}
+	facts, err := c.dockerfileFacts()
+	require.NoError(t, err)
+
+	runtime := map[string]any{
+		"image":      "gcr.io/distroless/static@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"stage":      "runtime",
+		"registry":   "gcr.io",
+		"repository": "distroless/static",
+		"tag":        "",
+		"digest":     "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	}
+	require.Equal(t, runtime, facts["base"])
+	require.Equal(t, []any{
+		map[string]any{
+			"image":      "mirror.example.com/golang:1.26",
+			"stage":      "build",
+			"registry":   "mirror.example.com",
+			"repository": "golang",
+			"tag":        "1.26",
+			"digest":     "",
+		},
+		runtime,
+	}, facts["bases"])
+	require.Equal(t, []any{"HEALTHCHECK", "COPY", "USER"}, facts["instructions"])
+	require.Len(t, facts["stages"], 3)
+
+	c.Target = "build"
+	facts, err = c.dockerfileFacts()
+	require.NoError(t, err)
+	require.Equal(t, []any{"RUN"}, facts["instructions"])
+}
+
+func Test_imageFacts(t *testing.T) {
+	facts := imageFacts(&image.ConfigFile{
+		OS: "linux",
+		Config: image.ContainerConfig{
+			User:         "app",
+			Env:          []string{"PATH=/usr/bin", "EMPTY="},
+			ExposedPorts: map[string]struct{}{"8080/tcp": {}, "53/udp": {}},
+			Healthcheck:  &image.Healthcheck{Test: []string{"NONE"}},
+			Labels:       map[string]string{"team": "platform"},
+		},
+		RootFS: image.RootFS{DiffIDs: []string{"sha256:a", "sha256:b"}},
+	})
+	require.Equal(t, "app", facts["user"])
+	require.Equal(t, map[string]any{"PATH": "/usr/bin", "EMPTY": ""}, facts["env"])
+	require.Equal(t, []any{"53/udp", "8080/tcp"}, facts["exposedPorts"])
+	require.Equal(t, []any{float64(53), float64(8080)}, facts["ports"])
+	require.Equal(t, false, facts["healthcheck"])
+	require.Equal(t, map[string]any{"team": "platform"}, facts["labels"])
+	require.Equal(t, float64(2), facts["layers"])
+	require.Equal(t, []any{}, facts["cmd"])
+}
+
+func Test_buildahImageConfig(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", "")
+	// A fake buildah printing the config of the image it inspects.
+	binary := filepath.Join(t.TempDir(), "buildah")
+	require.NoError(t, os.WriteFile(binary, []byte(`#!/bin/sh
+[ "$1 $2 $3" = "inspect --type image" ] || exit 1
+echo '{"os":"linux","config":{"User":"app","Healthcheck":{"Test":["CMD","true"]}},"rootfs":{"type":"layers","diff_ids":["sha256:a"]}}'
+`), 0755))
+	b := &buildahBuilder{config: &Config{Destination: "registry.example.com/app:1.0"}, binary: binary}
+
+	cfg, err := b.ImageConfig(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "app", cfg.Config.User)
+	require.Equal(t, []string{"CMD", "true"}, cfg.Config.Healthcheck.Test)
+	require.Equal(t, []string{"sha256:a"}, cfg.RootFS.DiffIDs)
+}
+
+func Test_RunPolicy(t *testing.T) {
+	executor := testharness.NewExecutor(t, testharness.Scenario{
+		Config: image.ConfigFile{OS: "linux"},
+		Layers: [][]byte{fileTar(t, "a", "a", time.Unix(0, 0))},
+	})
+	dir := t.TempDir()
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM docker.io/library/alpine:3.20\n"), 0644))
+
+	newConfig := func(policy string) Config {
+		return Config{
+			ExecutablePath: executor.Path,
+			DockerContext:  dir,
+			Destination:    "localhost:1/team/app:1.0",
+			TarPath:        filepath.Join(dir, "image.tar"),
+			Policy:         writePolicy(t, policy),
+		}
+	}
+
+	t.Run("Dockerfile violation fails before building", func(t *testing.T) {
+		c := newConfig("rules:\n  - name: approved-registries\n    assert: all(dockerfile.bases, it.registry == \"gcr.io\")\n")
+		require.EqualError(t, c.Run(context.Background()), "Dockerfile violates policy rules: approved-registries")
+		require.Empty(t, executor.Builds(t))
+	})
+
+	t.Run("image violation fails after pushing", func(t *testing.T) {
+		c := newConfig("rules:\n  - name: non-root\n    assert: image.user != \"\"\n  - name: healthcheck\n    severity: warning\n    assert: image.healthcheck\n")
+		require.EqualError(t, c.Run(context.Background()), "pushed image violates policy rules: non-root")
+		require.Len(t, executor.Builds(t), 1)
+	})
+
+	t.Run("warnings only", func(t *testing.T) {
+		c := newConfig("rules:\n  - name: healthcheck\n    severity: warning\n    assert: image.healthcheck\n")
+		require.NoError(t, c.Run(context.Background()))
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		c := newConfig("rules:\n  - name: broken\n    assert: image.user ==\n")
+		require.ErrorContains(t, c.Run(context.Background()), "rule broken: assert: invalid expression")
+	})
+}
@@ -0,0 +1,207 @@
+package kaniko
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// proxyConfig is the proxy configuration of the wrapper and the build backend.
+type proxyConfig struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+
+	httpURL  *url.URL
+	httpsURL *url.URL
+}
+
+// resolveProxy merges the proxy inputs with the proxy environment variables and adds the
+// internal registries of the registry configuration to the no-proxy list.
+// It returns nil when neither proxy inputs nor internal registries are configured,
+// in which case the environment is used as is.
+func (k *Config) resolveProxy() (*proxyConfig, error) {
+	settings, err := k.registrySettingsInConfig()
+	if err != nil {
+		return nil, err
+	}
+	var internal []string
+	for _, s := range settings {
+		if s.Internal {
+			internal = append(internal, s.hosts()...)
+		}
+	}
+	if k.HTTPProxy == "" && k.HTTPSProxy == "" && k.NoProxy == "" && len(internal) == 0 {
+		return nil, nil
+	}
+
+	p := &proxyConfig{
+		HTTPProxy:  firstNonEmpty(k.HTTPProxy, getenvAny("HTTP_PROXY", "http_proxy")),
+		HTTPSProxy: firstNonEmpty(k.HTTPSProxy, getenvAny("HTTPS_PROXY", "https_proxy")),
+		NoProxy:    firstNonEmpty(k.NoProxy, getenvAny("NO_PROXY", "no_proxy")),
+	}
+	if len(internal) > 0 {
+		p.NoProxy = strings.Join(append(splitList(p.NoProxy), internal...), ",")
+	}
+	if p.httpURL, err = parseProxyURL("HTTP", p.HTTPProxy); err != nil {
+		return nil, err
+	}
+	if p.httpsURL, err = parseProxyURL("HTTPS", p.HTTPSProxy); err != nil {
+		return nil, err
+	}
+
+	if p.httpURL != nil {
+		slog.Info("using HTTP proxy", "proxy", p.httpURL.Redacted())
+	}
+	if p.httpsURL != nil {
+		slog.Info("using HTTPS proxy", "proxy", p.httpsURL.Redacted())
+	}
+	if p.NoProxy != "" {
+		slog.Info("bypassing the proxy", "no_proxy", p.NoProxy)
+	}
+	return p, nil
+}
+
+// parseProxyURL parses a proxy URL, defaulting to the http scheme.
+// The URL is not part of the error since it may contain credentials.
+func parseProxyURL(name, proxy string) (*url.URL, error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s proxy URL", name)
+	}
+	return u, nil
+}
+
+// env returns the proxy environment variables for the build backend, in both cases
+// since tools disagree on which one they read.
+func (p *proxyConfig) env() []string {
+	var env []string
+	for _, v := range []struct{ name, value string }{
+		{"HTTP_PROXY", p.HTTPProxy},
+		{"HTTPS_PROXY", p.HTTPSProxy},
+		{"NO_PROXY", p.NoProxy},
+	} {
+		if v.value != "" {
+			env = append(env, v.name+"="+v.value, strings.ToLower(v.name)+"="+v.value)
+		}
+	}
+	return env
+}
+
+// proxyFunc selects the proxy of a request like http.ProxyFromEnvironment does.
+func (p *proxyConfig) proxyFunc(req *http.Request) (*url.URL, error) {
+	proxy := p.httpURL
+	if req.URL.Scheme == "https" {
+		proxy = p.httpsURL
+	}
+	if proxy == nil || !p.useProxy(req.URL) {
+		return nil, nil
+	}
+	return proxy, nil
+}
+
+// useProxy reports whether u is not excluded by the no-proxy list. Entries are host names,
+// which also match their subdomains, ".domain" suffixes, IP addresses, CIDR ranges,
+// optionally with a port, or "*" for all hosts. Loopback addresses are never proxied.
+func (p *proxyConfig) useProxy(u *url.URL) bool {
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if host == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		return false
+	}
+
+	for _, entry := range splitList(p.NoProxy) {
+		if entry == "*" {
+			return false
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return false
+			}
+			continue
+		}
+		entryHost, entryPort := entry, ""
+		if h, ep, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, ep
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		entryHost = strings.ToLower(entryHost)
+		switch {
+		case strings.HasPrefix(entryHost, "."):
+			if strings.HasSuffix(host, entryHost) {
+				return false
+			}
+		case host == entryHost || strings.HasSuffix(host, "."+entryHost):
+			return false
+		}
+	}
+	return true
+}
+
+// newHTTPClient returns the HTTP client of the wrapper, applying the TLS and proxy configuration,
+// and the TLS settings of the registry configuration to their registries.
+func (k *Config) newHTTPClient() *HttpClient {
+	newTransport := func(tlsConfig *tls.Config) *http.Transport {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if tlsConfig != nil {
+			transport.TLSClientConfig = tlsConfig
+		}
+		if k.proxy != nil {
+			transport.Proxy = k.proxy.proxyFunc
+		}
+		return transport
+	}
+	var transport http.RoundTripper = newTransport(k.tlsConfig)
+	if len(k.registryTLS) > 0 {
+		hosts := make(map[string]http.RoundTripper, len(k.registryTLS))
+		for host, tlsConfig := range k.registryTLS {
+			hosts[host] = newTransport(tlsConfig)
+		}
+		transport = &registryTransport{RoundTripper: transport, hosts: hosts}
+	}
+	return &HttpClient{client: &http.Client{Transport: transport}}
+}
+
+func getenvAny(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,50 @@
+package kaniko
+
+import (
+	"path/filepath"
+
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// registryClient returns a client for the wrapper's own registry calls, using the
+// credentials of the docker config, the insecure registries of the registry config and the mirrors passed to the executor.
+func (k *Config) registryClient() (*registry.Client, error) {
+	creds, err := registry.LoadDockerConfig()
+	if k.dockerConfig != "" {
+		creds, err = registry.ReadDockerConfig(filepath.Join(k.dockerConfig, "config.json"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	client := registry.NewClient(k.client, creds)
+
+	settings, err := k.registrySettingsInConfig()
+	if err != nil {
+		return nil, err
+	}
+	client.PlainHTTP = map[string]bool{}
+	for _, s := range settings {
+		if s.Insecure {
+			for _, host := range s.hosts() {
+				client.PlainHTTP[host] = true
+			}
+		}
+	}
+
+	regs, err := k.registryConfig()
+	if err != nil {
+		return nil, err
+	}
+	client.Mirrors = map[string][]string{}
+	if regs != nil {
+		for _, r := range regs.Registries {
+			prefix := registry.NormalizeRegistry(r.Prefix)
+			client.Mirrors[prefix] = append(client.Mirrors[prefix], k.rankMirrors(r.Mirrors)...)
+		}
+	}
+	// Like the executor, --registry-mirror only applies to Docker Hub images.
+	for _, mirror := range k.processRegistryMirrors() {
+		client.Mirrors[registry.DockerHub] = append(client.Mirrors[registry.DockerHub], mirror)
+	}
+	return client, nil
+}
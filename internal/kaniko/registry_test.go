@@ -0,0 +1,20 @@
+package kaniko
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_registryClient(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	t.Setenv("CLOUDBEES_REGISTRY_CONFIG", "testdata/registries.json")
+
+	c := Config{RegistryMirrors: "mirror.gcr.io"}
+	client, err := c.registryClient()
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"docker.io": {"mirror1.example.com/dockerhub", "mirror2.example.com/dockerhub", "mirror.gcr.io"},
+		"quay.io":   {"mirror1.example.com/quay", "mirror2.example.com/quay"},
+	}, client.Mirrors)
+}
@@ -0,0 +1,249 @@
+package kaniko
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// registrySettings holds the connection settings of a registry in CLOUDBEES_REGISTRY_CONFIG.
+// They apply to the registry prefix and all of its mirrors.
+type registrySettings struct {
+	Prefix  string   `json:"prefix"`
+	Mirrors []string `json:"mirrors,omitempty"`
+	// Insecure allows reaching the registry over plain HTTP.
+	Insecure bool `json:"insecure,omitempty"`
+	// SkipTLSVerify disables the verification of the registry TLS certificate.
+	SkipTLSVerify bool `json:"skipTlsVerify,omitempty"`
+	// Certificate is the CA certificate of the registry, as file path or PEM content.
+	Certificate string `json:"certificate,omitempty"`
+	// ClientCertificate and ClientKey authenticate to the registry with mutual TLS,
+	// as file paths or PEM content.
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	ClientKey         string `json:"clientKey,omitempty"`
+	// Internal registries are reached without the egress proxy.
+	Internal bool `json:"internal,omitempty"`
+	// Username and Password, or the base64 encoded Auth, are the registry credentials.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// hosts returns the registry hosts the settings apply to.
+func (s registrySettings) hosts() []string {
+	var hosts []string
+	seen := map[string]bool{}
+	for _, location := range append([]string{s.Prefix}, s.Mirrors...) {
+		host := registry.NormalizeRegistry(strings.TrimSpace(location))
+		if host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+func (s registrySettings) hasCredentials() bool {
+	return s.Auth != "" || s.Username != "" || s.Password != ""
+}
+
+// registrySettingsInConfig reads the connection settings of all registries in the registry configuration.
+func (k *Config) registrySettingsInConfig() ([]registrySettings, error) {
+	b, err := k.readRegistryConfig()
+	if err != nil || b == nil {
+		return nil, err
+	}
+	var cfg struct {
+		Registries []registrySettings `json:"registries"`
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse registry config file: %w", err)
+	}
+	return cfg.Registries, nil
+}
+
+// registryFlags translates the registry settings into executor flags.
+// Certificates given as PEM content are written into certDir.
+func registryFlags(settings []registrySettings, certDir string) ([]string, error) {
+	var args []string
+	for i, s := range settings {
+		for _, host := range s.hosts() {
+			if s.Insecure {
+				args = append(args, "--insecure-registry", host)
+			}
+			if s.SkipTLSVerify {
+				args = append(args, "--skip-tls-verify-registry", host)
+			}
+		}
+
+		if s.Certificate != "" {
+			cert, err := materializePEM(s.Certificate, certDir, fmt.Sprintf("registry-%d-ca.pem", i))
+			if err != nil {
+				return nil, fmt.Errorf("registry %s certificate: %w", s.Prefix, err)
+			}
+			for _, host := range s.hosts() {
+				args = append(args, "--registry-certificate", host+"="+cert)
+			}
+		}
+
+		if s.ClientCertificate != "" || s.ClientKey != "" {
+			if s.ClientCertificate == "" || s.ClientKey == "" {
+				return nil, fmt.Errorf("registry %s: client certificate and key must be set together", s.Prefix)
+			}
+			cert, err := materializePEM(s.ClientCertificate, certDir, fmt.Sprintf("registry-%d-client.pem", i))
+			if err != nil {
+				return nil, fmt.Errorf("registry %s client certificate: %w", s.Prefix, err)
+			}
+			key, err := materializePEM(s.ClientKey, certDir, fmt.Sprintf("registry-%d-client-key.pem", i))
+			if err != nil {
+				return nil, fmt.Errorf("registry %s client key: %w", s.Prefix, err)
+			}
+			for _, host := range s.hosts() {
+				args = append(args, "--registry-client-cert", host+"="+cert+","+key)
+			}
+		}
+	}
+	return args, nil
+}
+
+// materializePEM returns the path of a PEM file, writing inline PEM content into dir first.
+func materializePEM(value, dir, name string) (string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return value, nil
+	}
+	if dir == "" {
+		return "", fmt.Errorf("inline PEM content requires a directory to write it to")
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// prepareRegistryCredentials writes a docker config merging the current docker config
+// with the credentials of CLOUDBEES_REGISTRY_CONFIG, which is then passed to the build
+// backend through DOCKER_CONFIG. Credentials from the current docker config take precedence.
+// It also prepares the directory holding inline registry certificates.
+// The returned function removes the generated files.
+func (k *Config) prepareRegistryCredentials() (func(), error) {
+	noop := func() {}
+	settings, err := k.registrySettingsInConfig()
+	if err != nil || len(settings) == 0 {
+		return noop, err
+	}
+
+	dir, err := os.MkdirTemp("", "kaniko-registry-config-")
+	if err != nil {
+		return noop, fmt.Errorf("create registry config directory: %w", err)
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("failed to remove generated registry config", "error", err)
+		}
+	}
+	k.registryCertDir = dir
+
+	auths := map[string]map[string]string{}
+	for _, s := range settings {
+		if !s.hasCredentials() {
+			continue
+		}
+		auth := s.Auth
+		if auth == "" {
+			auth = base64.StdEncoding.EncodeToString([]byte(s.Username + ":" + s.Password))
+		}
+		for _, host := range s.hosts() {
+			auths[host] = map[string]string{"auth": auth}
+		}
+	}
+	if len(auths) == 0 {
+		return cleanup, nil
+	}
+
+	dockerConfig, err := mergeDockerConfig(filepath.Join(k.dockerConfigDir(), "config.json"), auths)
+	if err != nil {
+		cleanup()
+		return noop, err
+	}
+	if err = os.WriteFile(filepath.Join(dir, "config.json"), dockerConfig, 0600); err != nil {
+		cleanup()
+		return noop, fmt.Errorf("write docker config: %w", err)
+	}
+
+	hosts := make([]string, 0, len(auths))
+	for host := range auths {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	slog.Info("using credentials from the registry configuration", "registries", strings.Join(hosts, ", "))
+	k.dockerConfig = dir
+	return cleanup, nil
+}
+
+// mergeDockerConfig adds auths to the docker config file at path, keeping all of its other settings.
+func mergeDockerConfig(path string, auths map[string]map[string]string) ([]byte, error) {
+	cfg := map[string]json.RawMessage{}
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read docker config: %w", err)
+	}
+	if len(b) > 0 {
+		if err = json.Unmarshal(b, &cfg); err != nil {
+			return nil, fmt.Errorf("parse docker config %s: %w", path, err)
+		}
+	}
+
+	existing := map[string]json.RawMessage{}
+	if raw, ok := cfg["auths"]; ok {
+		if err = json.Unmarshal(raw, &existing); err != nil {
+			return nil, fmt.Errorf("parse docker config auths: %w", err)
+		}
+	}
+	configured := map[string]bool{}
+	for registryName := range existing {
+		configured[registry.NormalizeRegistry(registryName)] = true
+	}
+	for host, auth := range auths {
+		if configured[host] {
+			continue
+		}
+		raw, err := json.Marshal(auth)
+		if err != nil {
+			return nil, err
+		}
+		if host == registry.DockerHub {
+			// Docker Hub credentials are looked up by their legacy index address.
+			host = dockerHubAuthKey
+		}
+		existing[host] = raw
+	}
+
+	if cfg["auths"], err = json.Marshal(existing); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(cfg, "", "  ")
+}
+
+// dockerConfigDir returns the docker config directory used by the build backend.
+func (k *Config) dockerConfigDir() string {
+	if k.dockerConfig != "" {
+		return k.dockerConfig
+	}
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".docker")
+	}
+	return ""
+}
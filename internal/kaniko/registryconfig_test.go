@@ -0,0 +1,95 @@
+package kaniko
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_registryFlags(t *testing.T) {
+	t.Setenv("CLOUDBEES_REGISTRY_CONFIG", "testdata/registries-tls.json")
+
+	settings, err := (&Config{}).registrySettingsInConfig()
+	require.NoError(t, err)
+	args, err := registryFlags(settings, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"--insecure-registry", "registry.example.com",
+		"--insecure-registry", "mirror.example.com",
+		"--skip-tls-verify-registry", "secure.example.com",
+		"--registry-certificate", "secure.example.com=/certs/ca.pem",
+		"--registry-client-cert", "secure.example.com=/certs/client.pem,/certs/client-key.pem",
+	}, args)
+
+	t.Run("inline PEM content", func(t *testing.T) {
+		dir := t.TempDir()
+		pem := "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+		args, err := registryFlags([]registrySettings{{Prefix: "registry.example.com", Certificate: pem}}, dir)
+		require.NoError(t, err)
+		certFile := filepath.Join(dir, "registry-0-ca.pem")
+		require.Equal(t, []string{"--registry-certificate", "registry.example.com=" + certFile}, args)
+		b, err := os.ReadFile(certFile)
+		require.NoError(t, err)
+		require.Equal(t, pem, string(b))
+	})
+
+	t.Run("client certificate without key", func(t *testing.T) {
+		_, err := registryFlags([]registrySettings{{Prefix: "registry.example.com", ClientCertificate: "/certs/client.pem"}}, "")
+		require.ErrorContains(t, err, "client certificate and key must be set together")
+	})
+}
+
+func Test_prepareRegistryCredentials(t *testing.T) {
+	dockerDir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dockerDir)
+	t.Setenv("CLOUDBEES_REGISTRY_CONFIG", "testdata/registries-tls.json")
+	require.NoError(t, os.WriteFile(filepath.Join(dockerDir, "config.json"), []byte(`{
+		"auths": {"https://secure.example.com": {"auth": "b3duOmNyZWRz"}},
+		"credHelpers": {"gcr.io": "gcloud"}
+	}`), 0600))
+
+	c := Config{}
+	cleanup, err := c.prepareRegistryCredentials()
+	require.NoError(t, err)
+	require.NotEmpty(t, c.dockerConfig)
+	require.Equal(t, c.dockerConfig, c.registryCertDir)
+	require.Contains(t, c.env(), "DOCKER_CONFIG="+c.dockerConfig)
+	require.Equal(t, filepath.Join(c.dockerConfig, "config.json"), c.buildahAuthFile())
+
+	b, err := os.ReadFile(filepath.Join(c.dockerConfig, "config.json"))
+	require.NoError(t, err)
+	var generated struct {
+		Auths       map[string]map[string]string `json:"auths"`
+		CredHelpers map[string]string            `json:"credHelpers"`
+	}
+	require.NoError(t, json.Unmarshal(b, &generated))
+	require.Equal(t, map[string]map[string]string{
+		// Existing credentials take precedence over the registry configuration.
+		"https://secure.example.com": {"auth": "b3duOmNyZWRz"},
+		"registry.example.com":       {"auth": "YnVpbGRlcjpzZWNyZXQ="},
+		"mirror.example.com":         {"auth": "YnVpbGRlcjpzZWNyZXQ="},
+	}, generated.Auths)
+	require.Equal(t, map[string]string{"gcr.io": "gcloud"}, generated.CredHelpers)
+
+	client, err := c.registryClient()
+	require.NoError(t, err)
+	require.Equal(t, "builder", client.Credentials["registry.example.com"].Username)
+	require.True(t, client.PlainHTTP["mirror.example.com"])
+
+	cleanup()
+	_, err = os.Stat(c.dockerConfig)
+	require.True(t, os.IsNotExist(err))
+
+	t.Run("without registry config", func(t *testing.T) {
+		t.Setenv("CLOUDBEES_REGISTRY_CONFIG", "")
+		c := Config{}
+		cleanup, err := c.prepareRegistryCredentials()
+		require.NoError(t, err)
+		defer cleanup()
+		require.Empty(t, c.dockerConfig)
+		require.NotContains(t, c.env(), "DOCKER_CONFIG=")
+	})
+}
@@ -0,0 +1,213 @@
+package kaniko
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+)
+
+const sourceDateEpochArg = "SOURCE_DATE_EPOCH"
+
+// reproducible reports whether the image should be built reproducibly.
+func (k *Config) reproducible() bool {
+	return k.Reproducible || k.VerifyReproducible
+}
+
+// prepareReproducible resolves SOURCE_DATE_EPOCH for reproducible builds, from the
+// environment or else from the timestamp of the built commit, and stages the build
+// context unless configured otherwise so that its modification times are normalized.
+func (k *Config) prepareReproducible() error {
+	if !k.reproducible() {
+		return nil
+	}
+	if k.VerifyReproducible && strings.EqualFold(strings.TrimSpace(k.Backend), BackendBuildah) {
+		return fmt.Errorf("verifying reproducible builds is not supported by the buildah backend")
+	}
+
+	epoch := strings.TrimSpace(os.Getenv(sourceDateEpochArg))
+	if epoch == "" {
+		var err error
+		if epoch, err = k.commitTimestamp(); err != nil || epoch == "" {
+			// Without an epoch the timestamps would be the build time, so fall back to
+			// a fixed one.
+			slog.Warn("cannot determine "+sourceDateEpochArg+" from the commit timestamp, using 0", "error", err)
+			epoch = "0"
+		}
+	}
+	if _, err := strconv.ParseInt(epoch, 10, 64); err != nil {
+		return fmt.Errorf("invalid %s %q: must be a unix timestamp", sourceDateEpochArg, epoch)
+	}
+	slog.Info("building reproducibly", sourceDateEpochArg, epoch)
+	k.sourceDateEpoch = epoch
+
+	if k.StageContext == "" {
+		k.StageContext = StageContextDir
+	}
+	return nil
+}
+
+// commitTimestamp returns the committer timestamp of INPUT_COMMIT, or HEAD when not set,
+// in the git checkout holding the build context.
+func (k *Config) commitTimestamp() (string, error) {
+	commit := strings.TrimSpace(os.Getenv("INPUT_COMMIT"))
+	if commit == "" {
+		commit = "HEAD"
+	}
+	dir := k.DockerContext
+	if info, err := os.Stat(dir); dir == "" || err != nil || !info.IsDir() {
+		dir = "."
+	}
+
+	var out, stderr bytes.Buffer
+	gitCmd := exec.CommandContext(k.Context, "git", "-C", dir, "log", "-1", "--format=%ct", commit, "--")
+	gitCmd.Stdout = &out
+	gitCmd.Stderr = &stderr
+	if err := gitCmd.Run(); err != nil {
+		return "", fmt.Errorf("git log %s: %w: %s", commit, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// sourceDateEpochTime returns SOURCE_DATE_EPOCH as time, zero when not set.
+func (k *Config) sourceDateEpochTime() time.Time {
+	seconds, err := strconv.ParseInt(k.sourceDateEpoch, 10, 64)
+	if k.sourceDateEpoch == "" || err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// verifyReproducible builds the image twice into tarballs without pushing it and
+// fails when the layers of both builds differ, reporting the differing files.
+func (k *Config) verifyReproducible() error {
+	dir, err := os.MkdirTemp("", "kaniko-reproducible-")
+	if err != nil {
+		return fmt.Errorf("create verification directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("failed to remove verification builds", "error", err)
+		}
+	}()
+
+	var builds []*image.Tarball
+	for i := 1; i <= 2; i++ {
+		build := *k
+		build.TarPath = filepath.Join(dir, fmt.Sprintf("build-%d.tar", i))
+		build.noPush = true
+		kanikoCmd, err := build.cmdBuilder("")
+		if err != nil {
+			return fmt.Errorf("failed to build kaniko command: %w", err)
+		}
+		logCommand("running verification build", kanikoCmd, "build", i)
+		if err = kanikoCmd.Run(); err != nil {
+			return fmt.Errorf("run kaniko verification build %d: %w", i, err)
+		}
+		img, err := image.OpenTarball(build.TarPath)
+		if err != nil {
+			return err
+		}
+		builds = append(builds, img)
+	}
+
+	report, err := compareBuilds(builds[0], builds[1])
+	if err != nil {
+		return err
+	}
+	fmt.Print(report.String())
+	if !report.Reproducible() {
+		return fmt.Errorf("the build is not reproducible")
+	}
+	return nil
+}
+
+// reproducibilityReport lists the differences between two builds of the same image.
+type reproducibilityReport struct {
+	ConfigDigests [2]string
+	LayerCounts   [2]int
+	Layers        []layerDifference
+}
+
+type layerDifference struct {
+	Index   int
+	Digests [2]string
+	Changes []image.FileChange
+}
+
+func (r *reproducibilityReport) Reproducible() bool {
+	return r.ConfigDigests[0] == r.ConfigDigests[1] && r.LayerCounts[0] == r.LayerCounts[1] && len(r.Layers) == 0
+}
+
+func compareBuilds(a, b *image.Tarball) (*reproducibilityReport, error) {
+	report := &reproducibilityReport{
+		ConfigDigests: [2]string{a.ConfigDigest, b.ConfigDigest},
+		LayerCounts:   [2]int{len(a.Layers), len(b.Layers)},
+	}
+	for i := 0; i < len(a.Layers) && i < len(b.Layers); i++ {
+		la, lb := a.Layers[i], b.Layers[i]
+		if la.Digest == lb.Digest {
+			continue
+		}
+		filesA, err := layerFiles(a, la)
+		if err != nil {
+			return nil, err
+		}
+		filesB, err := layerFiles(b, lb)
+		if err != nil {
+			return nil, err
+		}
+		report.Layers = append(report.Layers, layerDifference{
+			Index:   i,
+			Digests: [2]string{la.Digest, lb.Digest},
+			Changes: image.DiffFiles(filesA, filesB),
+		})
+	}
+	return report, nil
+}
+
+func layerFiles(img *image.Tarball, layer image.Layer) (map[string]image.File, error) {
+	r, err := img.OpenLayer(layer)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	files, err := image.ReadFiles(r)
+	if err != nil {
+		return nil, fmt.Errorf("layer %s: %w", layer.Digest, err)
+	}
+	return files, nil
+}
+
+func (r *reproducibilityReport) String() string {
+	var sb strings.Builder
+	if r.Reproducible() {
+		fmt.Fprintf(&sb, "Reproducible build verified: both builds produced config %s and %d identical layers\n", r.ConfigDigests[0], r.LayerCounts[0])
+		return sb.String()
+	}
+	sb.WriteString("Reproducible build verification failed:\n")
+	if r.ConfigDigests[0] != r.ConfigDigests[1] {
+		fmt.Fprintf(&sb, "  config: %s != %s\n", r.ConfigDigests[0], r.ConfigDigests[1])
+	}
+	if r.LayerCounts[0] != r.LayerCounts[1] {
+		fmt.Fprintf(&sb, "  layer count: %d != %d\n", r.LayerCounts[0], r.LayerCounts[1])
+	}
+	for _, l := range r.Layers {
+		fmt.Fprintf(&sb, "  layer %d: %s != %s\n", l.Index+1, l.Digests[0], l.Digests[1])
+		for _, c := range l.Changes {
+			if c.Kind == image.FileModified {
+				fmt.Fprintf(&sb, "    %s %s (%s)\n", c.Kind, c.Path, strings.Join(c.Fields, ", "))
+			} else {
+				fmt.Fprintf(&sb, "    %s %s\n", c.Kind, c.Path)
+			}
+		}
+	}
+	return sb.String()
+}
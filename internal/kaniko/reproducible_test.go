@@ -0,0 +1,228 @@
+package kaniko
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_prepareReproducible(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		c := Config{Context: context.Background()}
+		require.NoError(t, c.prepareReproducible())
+		require.Empty(t, c.sourceDateEpoch)
+		require.Empty(t, c.StageContext)
+	})
+
+	t.Run("from the environment", func(t *testing.T) {
+		t.Setenv(sourceDateEpochArg, "1700000000")
+		c := Config{Context: context.Background(), Reproducible: true, StageContext: StageContextTar}
+		require.NoError(t, c.prepareReproducible())
+		require.Equal(t, "1700000000", c.sourceDateEpoch)
+		require.Equal(t, time.Unix(1700000000, 0), c.sourceDateEpochTime())
+		require.Equal(t, StageContextTar, c.StageContext)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv(sourceDateEpochArg, "yesterday")
+		c := Config{Context: context.Background(), Reproducible: true}
+		err := c.prepareReproducible()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `invalid SOURCE_DATE_EPOCH "yesterday"`)
+	})
+
+	t.Run("from the commit", func(t *testing.T) {
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git is not installed")
+		}
+		t.Setenv(sourceDateEpochArg, "")
+		t.Setenv("INPUT_COMMIT", "")
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644))
+		for _, args := range [][]string{
+			{"init", "-q"},
+			{"add", "Dockerfile"},
+			{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+		} {
+			git := exec.Command("git", args...)
+			git.Dir = dir
+			git.Env = append(os.Environ(), "GIT_COMMITTER_DATE=1600000000 +0000", "GIT_AUTHOR_DATE=1600000000 +0000")
+			out, err := git.CombinedOutput()
+			require.NoError(t, err, string(out))
+		}
+
+		c := Config{Context: context.Background(), VerifyReproducible: true, DockerContext: dir}
+		require.NoError(t, c.prepareReproducible())
+		require.Equal(t, "1600000000", c.sourceDateEpoch)
+		require.Equal(t, StageContextDir, c.StageContext)
+	})
+
+	t.Run("without commit", func(t *testing.T) {
+		t.Setenv(sourceDateEpochArg, "")
+		t.Setenv("INPUT_COMMIT", "")
+		c := Config{Context: context.Background(), Reproducible: true, DockerContext: t.TempDir()}
+		t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(c.DockerContext))
+		require.NoError(t, c.prepareReproducible())
+		require.Equal(t, "0", c.sourceDateEpoch)
+		require.Equal(t, time.Unix(0, 0), c.sourceDateEpochTime())
+	})
+
+	t.Run("verification with buildah", func(t *testing.T) {
+		c := Config{Context: context.Background(), VerifyReproducible: true, Backend: BackendBuildah}
+		err := c.prepareReproducible()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not supported by the buildah backend")
+	})
+}
+
+func Test_cmdBuilderReproducible(t *testing.T) {
+	t.Setenv("DOCKER_BUILD_ARGS", "key1=value1")
+	c := Config{
+		Context:         context.Background(),
+		ExecutablePath:  "/kaniko/executor",
+		Dockerfile:      "Dockerfile",
+		DockerContext:   ".",
+		Destination:     "my.registry/myimage:sometag",
+		TarPath:         "image.tar",
+		Reproducible:    true,
+		sourceDateEpoch: "1700000000",
+		noPush:          true,
+	}
+	cmd, err := c.cmdBuilder("")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"/kaniko/executor",
+		"--ignore-path=/cloudbees/",
+		"--dockerfile",
+		"Dockerfile",
+		"--context",
+		".",
+		"--destination",
+		"my.registry/myimage:sometag",
+		"--build-arg",
+		"key1=value1",
+		"--build-arg",
+		"SOURCE_DATE_EPOCH=1700000000",
+		"--tar-path",
+		"image.tar",
+		"--reproducible",
+		"--no-push",
+		"--cleanup",
+	}, cmd.Args)
+	require.Contains(t, cmd.Env, "SOURCE_DATE_EPOCH=1700000000")
+
+	t.Setenv("DOCKER_BUILD_ARGS", "SOURCE_DATE_EPOCH=1")
+	require.Equal(t, []string{"SOURCE_DATE_EPOCH=1"}, c.processBuildArgs())
+}
+
+// fileTar returns an uncompressed layer holding a single file.
+func fileTar(t *testing.T, name, content string, modTime time.Time) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: modTime, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+// writeImageTarball writes an image tarball with the given layers into dir.
+func writeImageTarball(t *testing.T, dir, name string, layers ...[]byte) string {
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, image.WriteTarball(f, image.ConfigFile{OS: "linux", Architecture: "amd64"}, []string{"my.registry/myimage:sometag"}, layers...))
+	return path
+}
+
+func Test_compareBuilds(t *testing.T) {
+	dir := t.TempDir()
+	epoch := time.Unix(1700000000, 0)
+	base := fileTar(t, "etc/os-release", "ID=test\n", epoch)
+
+	open := func(path string) *image.Tarball {
+		img, err := image.OpenTarball(path)
+		require.NoError(t, err)
+		return img
+	}
+
+	t.Run("identical", func(t *testing.T) {
+		a := open(writeImageTarball(t, dir, "a.tar", base, fileTar(t, "app/bin", "binary", epoch)))
+		b := open(writeImageTarball(t, dir, "b.tar", base, fileTar(t, "app/bin", "binary", epoch)))
+		report, err := compareBuilds(a, b)
+		require.NoError(t, err)
+		require.True(t, report.Reproducible())
+		require.Contains(t, report.String(), "Reproducible build verified")
+	})
+
+	t.Run("differing timestamps", func(t *testing.T) {
+		a := open(writeImageTarball(t, dir, "a.tar", base, fileTar(t, "app/bin", "binary", epoch)))
+		b := open(writeImageTarball(t, dir, "b.tar", base, fileTar(t, "app/bin", "binary", time.Now())))
+		report, err := compareBuilds(a, b)
+		require.NoError(t, err)
+		require.False(t, report.Reproducible())
+		require.Len(t, report.Layers, 1)
+		require.Equal(t, 1, report.Layers[0].Index)
+		require.Equal(t, []image.FileChange{{Path: "app/bin", Kind: image.FileModified, Fields: []string{"mtime"}}}, report.Layers[0].Changes)
+		require.Contains(t, report.String(), "    modified app/bin (mtime)\n")
+		require.Contains(t, report.String(), "  layer 2: ")
+	})
+
+	t.Run("differing layer count", func(t *testing.T) {
+		a := open(writeImageTarball(t, dir, "a.tar", base))
+		b := open(writeImageTarball(t, dir, "b.tar", base, fileTar(t, "app/bin", "binary", epoch)))
+		report, err := compareBuilds(a, b)
+		require.NoError(t, err)
+		require.False(t, report.Reproducible())
+		require.Empty(t, report.Layers)
+		require.Contains(t, report.String(), "  layer count: 1 != 2\n")
+	})
+}
+
+func Test_verifyReproducible(t *testing.T) {
+	epoch := time.Unix(1700000000, 0)
+	first := fileTar(t, "app/bin", "binary", epoch)
+	second := fileTar(t, "app/bin", "binary", epoch.Add(time.Second))
+
+	// The fake executor builds the layers in turn as the built image.
+	executor := func(builds ...[]byte) string {
+		var layers [][][]byte
+		for _, layer := range builds {
+			layers = append(layers, [][]byte{layer})
+		}
+		return testharness.NewExecutor(t, testharness.Scenario{LayersByBuild: layers}).Path
+	}
+
+	t.Run("reproducible", func(t *testing.T) {
+		c := Config{
+			Context:            context.Background(),
+			ExecutablePath:     executor(first, first),
+			Destination:        "my.registry/myimage:sometag",
+			VerifyReproducible: true,
+		}
+		require.NoError(t, c.verifyReproducible())
+		require.Empty(t, c.TarPath)
+	})
+
+	t.Run("not reproducible", func(t *testing.T) {
+		c := Config{
+			Context:            context.Background(),
+			ExecutablePath:     executor(first, second),
+			Destination:        "my.registry/myimage:sometag",
+			VerifyReproducible: true,
+		}
+		err := c.verifyReproducible()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the build is not reproducible")
+	})
+}
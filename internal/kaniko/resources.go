@@ -0,0 +1,150 @@
+package kaniko
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/buildcontext"
+	"github.com/cloudbees-io/kaniko/internal/resources"
+)
+
+// defaultKanikoDir is the working directory of the executor when kaniko-dir is not set.
+const defaultKanikoDir = "/kaniko"
+
+// resourceDir returns the directory whose disk usage is sampled: kaniko-dir, or the
+// default directory of the executor when it runs in this container.
+func (k *Config) resourceDir() string {
+	if dir := k.kanikoWorkDir(); dir != "" {
+		return dir
+	}
+	if !k.Local && k.backendName() == BackendKaniko && isDir(defaultKanikoDir) {
+		return defaultKanikoDir
+	}
+	return ""
+}
+
+// minFreeDisk returns the free disk space of the resource directory below which a
+// warning is logged, 0 to disable the warning.
+func (k *Config) minFreeDisk() (int64, error) {
+	if strings.TrimSpace(k.MinFreeDisk) == "" {
+		return 0, nil
+	}
+	size, err := buildcontext.ParseSize(k.MinFreeDisk)
+	if err != nil {
+		return 0, fmt.Errorf("invalid min-free-disk: %w", err)
+	}
+	return size, nil
+}
+
+// checkFreeDisk warns when the free disk space of the resource directory is already
+// below the threshold before building.
+func (k *Config) checkFreeDisk() error {
+	threshold, err := k.minFreeDisk()
+	if err != nil {
+		return err
+	}
+	dir := k.resourceDir()
+	if threshold == 0 || dir == "" {
+		return nil
+	}
+	free, err := resources.FreeSpace(dir)
+	if err != nil {
+		slog.Debug("cannot determine the free disk space", "error", err)
+		return nil
+	}
+	if free < threshold {
+		warnLowDisk(dir, free, threshold)
+	}
+	return nil
+}
+
+func warnLowDisk(dir string, free, threshold int64) {
+	slog.Warn("low free disk space, the build may fail",
+		"dir", dir, "free", buildcontext.FormatSize(free), "min_free_disk", buildcontext.FormatSize(threshold))
+}
+
+// runMonitored runs the build backend command, sampling the resources used by its
+// process tree. Containers run in local mode are not sampled, since they are not
+// children of the command.
+func (k *Config) runMonitored(cmd *exec.Cmd) error {
+	if k.Local {
+		return cmd.Run()
+	}
+	threshold, err := k.minFreeDisk()
+	if err != nil {
+		return err
+	}
+	dir := k.resourceDir()
+	monitor := &resources.Monitor{
+		Dir:         dir,
+		MinFreeDisk: threshold,
+		LowDisk: func(free int64) {
+			warnLowDisk(dir, free, threshold)
+		},
+	}
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	monitor.Start(cmd.Process.Pid)
+	err = cmd.Wait()
+	usage := monitor.Stop(cmd.ProcessState)
+
+	if k.resourceUsage == nil {
+		k.resourceUsage = &resources.Usage{}
+	}
+	k.resourceUsage.Add(usage)
+	if err != nil && (usage.OOMKills > 0 || strings.Contains(err.Error(), "signal: killed")) {
+		slog.Error("the build was killed, it probably ran out of memory",
+			"peak_memory", buildcontext.FormatSize(usage.PeakRSS), "memory_limit", formatLimit(usage.CgroupMemoryLimit))
+	}
+	return err
+}
+
+func formatLimit(limit int64) string {
+	if limit == 0 {
+		return "none"
+	}
+	return buildcontext.FormatSize(limit)
+}
+
+// writeFailedBuildOutputs sets the resource usage of a build which failed before its
+// outputs were written, since it explains builds running out of memory or disk space.
+func (k *Config) writeFailedBuildOutputs(out outputWriter) {
+	if k.resourceUsage == nil {
+		return
+	}
+	if err := k.writeResourceOutputs(out); err != nil {
+		slog.Warn("failed to write the resource usage outputs", "error", err)
+		return
+	}
+	if err := out.Close(); err != nil {
+		slog.Warn("failed to write the resource usage outputs", "error", err)
+	}
+}
+
+// writeResourceOutputs sets the peak resource usage of the build as outputs.
+func (k *Config) writeResourceOutputs(out outputWriter) error {
+	u := k.resourceUsage
+	if u == nil {
+		return nil
+	}
+	values := [][2]string{
+		{"peak-memory", strconv.FormatInt(u.PeakRSS, 10)},
+		{"cpu-seconds", strconv.FormatFloat(u.CPUSeconds, 'f', 2, 64)},
+	}
+	if u.Dir != "" {
+		values = append(values,
+			[2]string{"peak-disk-usage", strconv.FormatInt(u.PeakDirSize, 10)},
+			[2]string{"min-free-disk", strconv.FormatInt(u.MinFreeDisk, 10)})
+	}
+	for _, v := range values {
+		if err := out.WriteOutput(v[0], v[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/resources"
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_minFreeDisk(t *testing.T) {
+	size, err := (&Config{MinFreeDisk: "2GiB"}).minFreeDisk()
+	require.NoError(t, err)
+	require.Equal(t, int64(2<<30), size)
+
+	size, err = (&Config{}).minFreeDisk()
+	require.NoError(t, err)
+	require.Zero(t, size)
+
+	_, err = (&Config{MinFreeDisk: "lots"}).minFreeDisk()
+	require.EqualError(t, err, `invalid min-free-disk: invalid size: "lots"`)
+}
+
+func Test_resourceDir(t *testing.T) {
+	require.Equal(t, "/cache/kaniko", (&Config{KanikoDir: " /cache/kaniko "}).resourceDir())
+	require.Empty(t, (&Config{Backend: BackendBuildah}).resourceDir())
+	require.Empty(t, (&Config{Local: true}).resourceDir())
+}
+
+func Test_resourcesMarkdown(t *testing.T) {
+	s := &buildSummary{Status: "failed", Resources: &resources.Usage{
+		PeakRSS: 3 << 30, CPUSeconds: 42.5, CgroupMemoryLimit: 4 << 30, OOMKills: 1,
+		Dir: "/kaniko", PeakDirSize: 5 << 30, MinFreeDisk: 512 << 20,
+	}}
+	md := s.Markdown()
+	require.Contains(t, md, "Resources: 3.0 GiB peak memory of 4.0 GiB, 42.5s CPU time, `/kaniko` peaked at 5.0 GiB with 512.0 MiB free\n\n")
+	require.Contains(t, md, "> [!WARNING]\n> 1 processes were killed for running out of memory\n")
+}
+
+func Test_RunResources(t *testing.T) {
+	kanikoDir := t.TempDir()
+	executor := testharness.NewExecutor(t, testharness.Scenario{
+		Digest:         "sha256:cafebabebeef",
+		KanikoDirFiles: map[string]string{"layer.tar": "layer"},
+	})
+	outDir := t.TempDir()
+	t.Setenv("CLOUDBEES_OUTPUTS", outDir)
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	t.Setenv("CLOUDBEES_STEP_SUMMARY", "")
+
+	c := Config{
+		ExecutablePath: executor.Path,
+		Destination:    "my.registry/myimage:sometag",
+		KanikoDir:      kanikoDir,
+		// Larger than any disk, to warn before and during the build.
+		MinFreeDisk: "1000000GiB",
+		SummaryJSON: filepath.Join(t.TempDir(), "summary.json"),
+	}
+	require.NoError(t, c.Run(context.Background()))
+
+	outputs := map[string]int64{}
+	for _, name := range []string{"peak-memory", "peak-disk-usage", "min-free-disk"} {
+		v, err := os.ReadFile(filepath.Join(outDir, name))
+		require.NoError(t, err, name)
+		outputs[name], err = strconv.ParseInt(string(v), 10, 64)
+		require.NoError(t, err, name)
+	}
+	require.Positive(t, outputs["peak-memory"])
+	require.Equal(t, int64(len("layer")), outputs["peak-disk-usage"])
+	require.Positive(t, outputs["min-free-disk"])
+	cpu, err := os.ReadFile(filepath.Join(outDir, "cpu-seconds"))
+	require.NoError(t, err)
+	_, err = strconv.ParseFloat(string(cpu), 64)
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(c.SummaryJSON)
+	require.NoError(t, err)
+	var s buildSummary
+	require.NoError(t, json.Unmarshal(b, &s))
+	require.NotNil(t, s.Resources)
+	require.Equal(t, kanikoDir, s.Resources.Dir)
+	require.Equal(t, outputs["peak-memory"], s.Resources.PeakRSS)
+	// Warned before and during the build.
+	low := 0
+	for _, w := range s.Warnings {
+		if strings.HasPrefix(w, "low free disk space, the build may fail") {
+			low++
+		}
+	}
+	require.Equal(t, 2, low, s.Warnings)
+}
+
+func Test_RunResourcesKilled(t *testing.T) {
+	executor := testharness.NewExecutor(t, testharness.Scenario{Killed: true})
+	outDir := t.TempDir()
+	t.Setenv("CLOUDBEES_OUTPUTS", outDir)
+	logFile := filepath.Join(t.TempDir(), "build.log")
+
+	c := Config{
+		ExecutablePath: executor.Path,
+		Destination:    "my.registry/myimage:sometag",
+		LogFormat:      LogFormatJSON,
+		LogFile:        logFile,
+	}
+	require.EqualError(t, c.Run(context.Background()), "run kaniko: signal: killed")
+
+	var killed map[string]any
+	for _, record := range readLogFile(t, logFile) {
+		if record["level"] == "ERROR" {
+			killed = record
+		}
+	}
+	require.NotNil(t, killed)
+	require.Equal(t, "the build was killed, it probably ran out of memory", killed["msg"])
+	require.Contains(t, killed, "peak_memory")
+
+	// The resource usage is set for failed builds too.
+	for _, name := range []string{"peak-memory", "cpu-seconds"} {
+		require.FileExists(t, filepath.Join(outDir, name))
+	}
+	require.NoFileExists(t, filepath.Join(outDir, "digest"))
+}
@@ -0,0 +1,400 @@
+package kaniko
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/buildcontext"
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/resources"
+)
+
+// stepSummaryEnv name the step summary files of CI systems the Markdown summary is appended to.
+var stepSummaryEnv = []string{"CLOUDBEES_STEP_SUMMARY", "GITHUB_STEP_SUMMARY"}
+
+var (
+	ansiEscapeRegexp = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	// kanikoStageRegexp matches e.g. "Building stage 'golang:1.26' [idx: '0', base-idx: '-1']".
+	kanikoStageRegexp = regexp.MustCompile(`Building stage '([^']*)' \[idx: '(\d+)'`)
+	// buildahStageRegexp matches e.g. "[1/2] STEP 1/4: FROM golang:1.26 AS build".
+	buildahStageRegexp = regexp.MustCompile(`STEP \d+(?:/\d+)?: FROM (\S+)(?:\s+(?i:AS)\s+(\S+))?`)
+	// warningRegexp matches the warnings logged by the executor and buildah.
+	warningRegexp = regexp.MustCompile(`^(?:WARN|WARNING)\[[^\]]*\]\s*(.*)$`)
+	// retryRegexp matches the operations retried by the executor and buildah.
+	retryRegexp = regexp.MustCompile(`(?i)\bretrying\b`)
+)
+
+// summarizes reports whether a build summary is written.
+func (k *Config) summarizes() bool {
+	if k.Summary != "" || k.SummaryJSON != "" {
+		return true
+	}
+	for _, name := range stepSummaryEnv {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// buildSummary describes a build for humans, as Markdown, and machines, as JSON.
+type buildSummary struct {
+	Status          string               `json:"status"`
+	Error           string               `json:"error,omitempty"`
+	Destinations    []summaryDestination `json:"destinations"`
+	Target          string               `json:"target,omitempty"`
+	BaseImages      []string             `json:"baseImages,omitempty"`
+	DurationSeconds float64              `json:"durationSeconds"`
+	Stages          []stageSummary       `json:"stages,omitempty"`
+	CacheHits       int                  `json:"cacheHits"`
+	CacheMisses     int                  `json:"cacheMisses"`
+	Image           *image.Sizes         `json:"image,omitempty"`
+	Resources       *resources.Usage     `json:"resources,omitempty"`
+	Warnings        []string             `json:"warnings,omitempty"`
+}
+
+type summaryDestination struct {
+	Reference string `json:"reference"`
+	Digest    string `json:"digest,omitempty"`
+}
+
+// stageSummary describes a Dockerfile stage built by the backend.
+type stageSummary struct {
+	Name            string  `json:"name"`
+	Base            string  `json:"base"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	CacheHits       int     `json:"cacheHits"`
+	CacheMisses     int     `json:"cacheMisses"`
+
+	started, ended time.Time
+}
+
+// startSummary records the build log and the warnings of the wrapper until the
+// returned function writes the summary of the build ending with err.
+func (k *Config) startSummary() func(err error) {
+	started := time.Now()
+	k.buildLog = &buildLog{now: time.Now}
+	k.logFields.onWarning(k.buildLog.addWarning)
+
+	return func(err error) {
+		k.logFields.onWarning(nil)
+		summary := k.buildSummary(time.Since(started), err)
+		if err := k.writeSummary(summary); err != nil {
+			slog.Warn("cannot write the build summary", "error", err)
+		}
+	}
+}
+
+// buildSummary collects the summary of the build from the configuration, the build
+// log and the measured image.
+func (k *Config) buildSummary(duration time.Duration, err error) *buildSummary {
+	s := &buildSummary{Status: "succeeded", DurationSeconds: duration.Seconds(), Image: k.imageSizes, Resources: k.resourceUsage}
+	if err != nil {
+		s.Status = "failed"
+		s.Error = err.Error()
+	}
+	for _, destination := range k.processDestinations() {
+		s.Destinations = append(s.Destinations, summaryDestination{Reference: destination, Digest: k.digest})
+	}
+
+	stages := k.summaryStages()
+	if k.buildLog != nil && k.buildLog.dockerfile != nil {
+		stages = k.buildLog.dockerfile
+	}
+	if len(stages) > 0 {
+		s.Target = k.Target
+		if s.Target == "" {
+			if s.Target = stages[len(stages)-1].name; s.Target == "" {
+				s.Target = strconv.Itoa(len(stages) - 1)
+			}
+		}
+		for _, img := range dockerfileImages(stages) {
+			s.BaseImages = append(s.BaseImages, img.image)
+		}
+	}
+
+	if k.buildLog != nil {
+		s.Stages, s.Warnings = k.buildLog.result()
+		for _, stage := range s.Stages {
+			s.CacheHits += stage.CacheHits
+			s.CacheMisses += stage.CacheMisses
+		}
+	}
+	return s
+}
+
+// summaryStages parses the Dockerfile, nil when it is not readable, e.g. for remote contexts.
+func (k *Config) summaryStages() []dockerfileStage {
+	f, err := os.Open(k.resolveDockerfile())
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	stages, err := dockerfileStages(f, k.buildArgValues())
+	if err != nil {
+		return nil
+	}
+	return stages
+}
+
+// writeSummary writes the Markdown and JSON summaries and appends the Markdown summary
+// to the step summaries of the CI system.
+func (k *Config) writeSummary(s *buildSummary) error {
+	markdown := s.Markdown()
+	if k.Summary != "" {
+		if err := os.WriteFile(k.Summary, []byte(markdown), 0640); err != nil {
+			return err
+		}
+	}
+	if k.SummaryJSON != "" {
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(k.SummaryJSON, append(b, '\n'), 0640); err != nil {
+			return err
+		}
+	}
+	for _, name := range stepSummaryEnv {
+		if path := os.Getenv(name); path != "" {
+			if err := appendFile(path, markdown); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func appendFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Markdown renders the summary.
+func (s *buildSummary) Markdown() string {
+	var sb strings.Builder
+	status := "✅ Image built"
+	if s.Status != "succeeded" {
+		status = "❌ Build failed"
+	}
+	fmt.Fprintf(&sb, "### %s in %s\n\n", status, formatSeconds(s.DurationSeconds))
+	if s.Error != "" {
+		fmt.Fprintf(&sb, "```\n%s\n```\n\n", s.Error)
+	}
+
+	sb.WriteString("| Destination | Digest |\n|---|---|\n")
+	for _, d := range s.Destinations {
+		digest := "-"
+		if d.Digest != "" {
+			digest = "`" + d.Digest + "`"
+		}
+		fmt.Fprintf(&sb, "| `%s` | %s |\n", d.Reference, digest)
+	}
+	sb.WriteString("\n")
+
+	if s.Target != "" {
+		fmt.Fprintf(&sb, "Target stage: `%s`\n\n", s.Target)
+	}
+	if len(s.BaseImages) > 0 {
+		sb.WriteString("Base images:\n\n")
+		for _, img := range s.BaseImages {
+			fmt.Fprintf(&sb, "- `%s`\n", img)
+		}
+		sb.WriteString("\n")
+	}
+	if s.Image != nil {
+		fmt.Fprintf(&sb, "Image size: %s compressed", buildcontext.FormatSize(s.Image.Compressed))
+		if s.Image.Uncompressed > 0 {
+			fmt.Fprintf(&sb, ", %s uncompressed", buildcontext.FormatSize(s.Image.Uncompressed))
+		}
+		fmt.Fprintf(&sb, ", %d layers\n\n", len(s.Image.Layers))
+	}
+	if r := s.Resources; r != nil {
+		fmt.Fprintf(&sb, "Resources: %s peak memory", buildcontext.FormatSize(r.PeakRSS))
+		if r.CgroupMemoryLimit > 0 {
+			fmt.Fprintf(&sb, " of %s", buildcontext.FormatSize(r.CgroupMemoryLimit))
+		}
+		fmt.Fprintf(&sb, ", %s CPU time", formatSeconds(r.CPUSeconds))
+		if r.Dir != "" {
+			fmt.Fprintf(&sb, ", `%s` peaked at %s with %s free", r.Dir, buildcontext.FormatSize(r.PeakDirSize), buildcontext.FormatSize(r.MinFreeDisk))
+		}
+		sb.WriteString("\n\n")
+		if r.OOMKills > 0 {
+			fmt.Fprintf(&sb, "> [!WARNING]\n> %d processes were killed for running out of memory\n\n", r.OOMKills)
+		}
+	}
+
+	if len(s.Stages) > 0 {
+		fmt.Fprintf(&sb, "| Stage | Base | Duration | Cache hits | Cache misses |\n|---|---|---|---|---|\n")
+		for _, stage := range s.Stages {
+			fmt.Fprintf(&sb, "| %s | `%s` | %s | %d | %d |\n", stage.Name, stage.Base, formatSeconds(stage.DurationSeconds), stage.CacheHits, stage.CacheMisses)
+		}
+		fmt.Fprintf(&sb, "\nCache: %d hits, %d misses\n\n", s.CacheHits, s.CacheMisses)
+	}
+
+	if len(s.Warnings) > 0 {
+		fmt.Fprintf(&sb, "<details>\n<summary>%d warnings</summary>\n\n", len(s.Warnings))
+		for _, w := range s.Warnings {
+			fmt.Fprintf(&sb, "- %s\n", w)
+		}
+		sb.WriteString("\n</details>\n")
+	}
+	return sb.String()
+}
+
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(100 * time.Millisecond).String()
+}
+
+// buildLog parses the output of the build backend for the stages built, their
+// cache hits and the warnings.
+type buildLog struct {
+	now func() time.Time
+	// dockerfile holds the stages of the Dockerfile built, which is removed with
+	// remote contexts once the build completed.
+	dockerfile []dockerfileStage
+
+	mu       sync.Mutex
+	stages   []stageSummary
+	warnings []string
+	froms    int
+	retries  int
+}
+
+// recordBuildLog tees the output of the build backend into the build log, when a
+// summary is written.
+func (k *Config) recordBuildLog(cmd *exec.Cmd) {
+	if k.buildLog == nil {
+		return
+	}
+	k.buildLog.mu.Lock()
+	k.buildLog.dockerfile = k.summaryStages()
+	k.buildLog.mu.Unlock()
+	k.buildLog.record(cmd)
+}
+
+// record tees the output of cmd into the build log.
+func (l *buildLog) record(cmd *exec.Cmd) {
+	cmd.Stdout = io.MultiWriter(cmd.Stdout, &lineWriter{line: l.line})
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, &lineWriter{line: l.line})
+}
+
+func (l *buildLog) line(line string) {
+	line = strings.TrimSpace(ansiEscapeRegexp.ReplaceAllString(line, ""))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if retryRegexp.MatchString(line) {
+		l.retries++
+	}
+	if m := warningRegexp.FindStringSubmatch(line); m != nil {
+		l.warnings = append(l.warnings, m[1])
+		return
+	}
+	if m := kanikoStageRegexp.FindStringSubmatch(line); m != nil {
+		idx, _ := strconv.Atoi(m[2])
+		l.startStage(l.stageName(idx), m[1])
+		return
+	}
+	if m := buildahStageRegexp.FindStringSubmatch(line); m != nil {
+		name := m[2]
+		if name == "" {
+			name = l.stageName(l.froms)
+		}
+		l.froms++
+		l.startStage(name, m[1])
+		return
+	}
+	if strings.Contains(line, "Pushing image to ") {
+		l.endStage()
+		return
+	}
+
+	if len(l.stages) == 0 {
+		return
+	}
+	current := &l.stages[len(l.stages)-1]
+	switch {
+	case strings.Contains(line, "Using caching version of cmd:"), strings.HasPrefix(line, "--> Using cache "):
+		current.CacheHits++
+	case strings.Contains(line, "No cached layer found for cmd"):
+		current.CacheMisses++
+	}
+}
+
+func (l *buildLog) stageName(idx int) string {
+	if idx < len(l.dockerfile) && l.dockerfile[idx].name != "" {
+		return l.dockerfile[idx].name
+	}
+	return strconv.Itoa(idx)
+}
+
+func (l *buildLog) startStage(name, base string) {
+	l.endStage()
+	l.stages = append(l.stages, stageSummary{Name: name, Base: base, started: l.now()})
+}
+
+// endStage sets the duration of the stage being built.
+func (l *buildLog) endStage() {
+	if n := len(l.stages); n > 0 && l.stages[n-1].ended.IsZero() {
+		l.stages[n-1].ended = l.now()
+		l.stages[n-1].DurationSeconds = l.stages[n-1].ended.Sub(l.stages[n-1].started).Seconds()
+	}
+}
+
+func (l *buildLog) addWarning(warning string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, warning)
+}
+
+// retryCount returns the number of retried operations.
+func (l *buildLog) retryCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.retries
+}
+
+// result ends the stage being built and returns the stages and warnings.
+func (l *buildLog) result() ([]stageSummary, []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.endStage()
+	return l.stages, l.warnings
+}
+
+// lineWriter calls line for every complete line written.
+type lineWriter struct {
+	line    func(string)
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
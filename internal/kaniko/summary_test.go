@@ -0,0 +1,170 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+const kanikoBuildLog = "\x1b[36mINFO\x1b[0m[0000] Resolved base name golang:1.26 to build\n" +
+	"INFO[0000] Building stage 'golang:1.26' [idx: '0', base-idx: '-1']\n" +
+	"INFO[0001] Using caching version of cmd: RUN go mod download\n" +
+	"INFO[0002] No cached layer found for cmd RUN go build -o /app\n" +
+	"WARN[0003] Error while retrieving image from cache: unauthorized\n" +
+	"INFO[0009] Building stage 'gcr.io/distroless/static' [idx: '1', base-idx: '-1']\n" +
+	"INFO[0010] Using caching version of cmd: COPY --from=build /app /app\n" +
+	"INFO[0011] Pushing image to my.registry/myimage:sometag\n"
+
+// fakeClock returns times advancing by a second on every call.
+func fakeClock() func() time.Time {
+	now := fakeTime(0)
+	return func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+// fakeTime returns the time of the nth call of a fakeClock.
+func fakeTime(n int) time.Time {
+	return time.Unix(1700000000+int64(n), 0)
+}
+
+func Test_buildLog(t *testing.T) {
+	t.Run("kaniko", func(t *testing.T) {
+		l := &buildLog{now: fakeClock(), dockerfile: []dockerfileStage{{name: "build"}, {}}}
+		w := &lineWriter{line: l.line}
+		// Lines may be split across writes.
+		_, err := w.Write([]byte(kanikoBuildLog[:100]))
+		require.NoError(t, err)
+		_, err = w.Write([]byte(kanikoBuildLog[100:]))
+		require.NoError(t, err)
+
+		stages, warnings := l.result()
+		require.Equal(t, []stageSummary{
+			{Name: "build", Base: "golang:1.26", DurationSeconds: 1, CacheHits: 1, CacheMisses: 1, started: fakeTime(1), ended: fakeTime(2)},
+			{Name: "1", Base: "gcr.io/distroless/static", DurationSeconds: 1, CacheHits: 1, started: fakeTime(3), ended: fakeTime(4)},
+		}, stages)
+		require.Equal(t, []string{"Error while retrieving image from cache: unauthorized"}, warnings)
+	})
+
+	t.Run("buildah", func(t *testing.T) {
+		l := &buildLog{now: fakeClock(), dockerfile: []dockerfileStage{{name: "build"}, {}}}
+		for _, line := range []string{
+			"[1/2] STEP 1/3: FROM golang:1.26 AS build",
+			"[1/2] STEP 2/3: RUN go mod download",
+			"--> Using cache 4a1b2c3d",
+			"[2/2] STEP 1/2: FROM gcr.io/distroless/static",
+			"WARN[0005] missing \"TOOL\" build argument",
+		} {
+			l.line(line)
+		}
+		stages, warnings := l.result()
+		require.Equal(t, []stageSummary{
+			{Name: "build", Base: "golang:1.26", DurationSeconds: 1, CacheHits: 1, started: fakeTime(1), ended: fakeTime(2)},
+			{Name: "1", Base: "gcr.io/distroless/static", DurationSeconds: 1, started: fakeTime(3), ended: fakeTime(4)},
+		}, stages)
+		require.Equal(t, []string{`missing "TOOL" build argument`}, warnings)
+	})
+}
+
+func Test_buildSummaryMarkdown(t *testing.T) {
+	s := &buildSummary{
+		Status:          "succeeded",
+		DurationSeconds: 12.34,
+		Destinations: []summaryDestination{
+			{Reference: "my.registry/myimage:sometag", Digest: "sha256:cafebabebeef"},
+		},
+		Target:     "build",
+		BaseImages: []string{"golang:1.26"},
+		Stages:     []stageSummary{{Name: "build", Base: "golang:1.26", DurationSeconds: 10, CacheHits: 2, CacheMisses: 1}},
+		CacheHits:  2, CacheMisses: 1,
+		Image:    &image.Sizes{Compressed: 2 << 20, Layers: []image.LayerSize{{}, {}}},
+		Warnings: []string{"registry mirrors are ignored"},
+	}
+	require.Equal(t, "### ✅ Image built in 12.3s\n\n"+
+		"| Destination | Digest |\n|---|---|\n"+
+		"| `my.registry/myimage:sometag` | `sha256:cafebabebeef` |\n\n"+
+		"Target stage: `build`\n\n"+
+		"Base images:\n\n- `golang:1.26`\n\n"+
+		"Image size: 2.0 MiB compressed, 2 layers\n\n"+
+		"| Stage | Base | Duration | Cache hits | Cache misses |\n|---|---|---|---|---|\n"+
+		"| build | `golang:1.26` | 10s | 2 | 1 |\n\n"+
+		"Cache: 2 hits, 1 misses\n\n"+
+		"<details>\n<summary>1 warnings</summary>\n\n- registry mirrors are ignored\n\n</details>\n", s.Markdown())
+
+	s = &buildSummary{Status: "failed", Error: "run kaniko: exit status 1", Destinations: []summaryDestination{{Reference: "my.registry/myimage:sometag"}}}
+	md := s.Markdown()
+	require.Contains(t, md, "### ❌ Build failed in 0s\n\n```\nrun kaniko: exit status 1\n```\n")
+	require.Contains(t, md, "| `my.registry/myimage:sometag` | - |\n")
+}
+
+func Test_RunSummary(t *testing.T) {
+	dir := t.TempDir()
+	executor := testharness.NewExecutor(t, testharness.Scenario{Log: kanikoBuildLog, Digest: "sha256:cafebabebeef"})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM golang:1.26 AS build\nFROM gcr.io/distroless/static\nCOPY --from=build /app /app\n"), 0644))
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	t.Setenv("DOCKER_BUILD_ARGS", "")
+	stepSummary := filepath.Join(t.TempDir(), "step-summary")
+	t.Setenv("GITHUB_STEP_SUMMARY", stepSummary)
+	t.Setenv("CLOUDBEES_STEP_SUMMARY", "")
+
+	c := Config{
+		ExecutablePath: executor.Path,
+		DockerContext:  dir,
+		Destination:    "my.registry/myimage:sometag",
+		Summary:        filepath.Join(dir, "summary.md"),
+		SummaryJSON:    filepath.Join(dir, "summary.json"),
+	}
+	require.NoError(t, c.Run(context.Background()))
+
+	b, err := os.ReadFile(c.SummaryJSON)
+	require.NoError(t, err)
+	var s buildSummary
+	require.NoError(t, json.Unmarshal(b, &s))
+	require.Equal(t, "succeeded", s.Status)
+	require.Equal(t, []summaryDestination{{Reference: "my.registry/myimage:sometag", Digest: "sha256:cafebabebeef"}}, s.Destinations)
+	require.Equal(t, "1", s.Target)
+	require.Equal(t, []string{"golang:1.26", "gcr.io/distroless/static"}, s.BaseImages)
+	require.Len(t, s.Stages, 2)
+	require.Equal(t, "build", s.Stages[0].Name)
+	require.Equal(t, 2, s.CacheHits)
+	require.Equal(t, 1, s.CacheMisses)
+	require.Contains(t, s.Warnings, "Error while retrieving image from cache: unauthorized")
+
+	md, err := os.ReadFile(c.Summary)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(md), "### ✅ Image built in "), string(md))
+	step, err := os.ReadFile(stepSummary)
+	require.NoError(t, err)
+	require.Equal(t, string(md), string(step))
+}
+
+func Test_RunSummaryFailure(t *testing.T) {
+	executor := testharness.NewExecutor(t, testharness.Scenario{ExitCode: 3})
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	t.Setenv("CLOUDBEES_STEP_SUMMARY", "")
+	summary := filepath.Join(t.TempDir(), "summary.json")
+
+	c := Config{
+		ExecutablePath: executor.Path,
+		Destination:    "my.registry/myimage:sometag",
+		SummaryJSON:    summary,
+	}
+	require.Error(t, c.Run(context.Background()))
+
+	b, err := os.ReadFile(summary)
+	require.NoError(t, err)
+	var s buildSummary
+	require.NoError(t, json.Unmarshal(b, &s))
+	require.Equal(t, "failed", s.Status)
+	require.Equal(t, "run kaniko: exit status 3", s.Error)
+}
@@ -0,0 +1,166 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudbees-io/kaniko/internal/telemetry"
+)
+
+const (
+	// telemetryService is the service name of the exported spans and metrics.
+	telemetryService = "kaniko-action"
+	// telemetryExportTimeout bounds the export, which runs after the build was cancelled too.
+	telemetryExportTimeout = 10 * time.Second
+)
+
+// tracesBuild reports whether spans and metrics of the build are exported.
+func (k *Config) tracesBuild() bool {
+	return k.OTelEndpoint != "" || k.OTelFile != ""
+}
+
+// startTelemetry starts the span of the build. The returned function ends the
+// build ending with err, records its metrics and exports them.
+func (k *Config) startTelemetry() func(err error) {
+	k.telemetry = telemetry.New(telemetryService, k.Version)
+	k.buildSpan = k.telemetry.Start(nil, "build")
+	k.buildSpan.SetAttribute("kaniko.backend", k.backendName())
+	k.buildSpan.SetAttribute("kaniko.destination", k.Destination)
+	if k.buildID != "" {
+		k.buildSpan.SetAttribute("kaniko.build_id", k.buildID)
+	}
+	if k.Target != "" {
+		k.buildSpan.SetAttribute("kaniko.target", k.Target)
+	}
+	if k.buildLog == nil {
+		k.buildLog = &buildLog{now: time.Now}
+	}
+
+	return func(err error) {
+		// The build failed in its current phase.
+		k.phaseSpan.End(err)
+		k.traceStages()
+		k.buildSpan.End(err)
+		k.recordMetrics(err)
+		k.exportTelemetry()
+	}
+}
+
+// startPhase ends the current phase of the build and traces the next one.
+func (k *Config) startPhase(name string) {
+	k.logFields.setPhase(name)
+	k.phaseSpan.End(nil)
+	k.phaseSpan = k.telemetry.Start(k.buildSpan, name)
+	if name == phaseExecutor {
+		k.executorSpan = k.phaseSpan
+	}
+}
+
+// Phases of the build traced as spans.
+const (
+	phaseConfig         = "resolve configuration"
+	phaseRegistryConfig = "parse registry configuration"
+	phasePreflight      = "pre-flight checks"
+	phaseExecutor       = "run executor"
+	phasePush           = "push"
+	phaseOutputs        = "write outputs"
+)
+
+// traceparentEnv propagates the trace context to the build backend, as the
+// TRACEPARENT environment variable of the OpenTelemetry specification.
+func (k *Config) traceparentEnv() []string {
+	if tp := k.phaseSpan.Traceparent(); tp != "" {
+		return []string{"TRACEPARENT=" + tp}
+	}
+	return nil
+}
+
+// traceStages adds the stages parsed from the build log as spans below the executor span.
+func (k *Config) traceStages() {
+	if k.executorSpan == nil || k.buildLog == nil {
+		return
+	}
+	stages, _ := k.buildLog.result()
+	for _, stage := range stages {
+		span := k.telemetry.StartAt(k.executorSpan, "stage "+stage.Name, stage.started)
+		span.SetAttribute("kaniko.stage.base", stage.Base)
+		span.SetAttribute("kaniko.stage.cache_hits", stage.CacheHits)
+		span.SetAttribute("kaniko.stage.cache_misses", stage.CacheMisses)
+		span.EndAt(stage.ended, nil)
+	}
+}
+
+// recordMetrics records the duration, image size, cache hit ratio and retries of the build.
+func (k *Config) recordMetrics(err error) {
+	if k.telemetry == nil {
+		return
+	}
+	status := "succeeded"
+	if err != nil {
+		status = "failed"
+	}
+	attrs := map[string]any{"kaniko.backend": k.backendName(), "kaniko.status": status}
+	k.telemetry.Record("kaniko.build.duration", "s", k.buildSpan.EndTime.Sub(k.buildSpan.StartTime).Seconds(), attrs)
+
+	if k.buildLog != nil {
+		stages, _ := k.buildLog.result()
+		hits, misses := 0, 0
+		for _, stage := range stages {
+			hits += stage.CacheHits
+			misses += stage.CacheMisses
+			k.telemetry.Record("kaniko.stage.duration", "s", stage.DurationSeconds, map[string]any{"kaniko.stage": stage.Name})
+		}
+		if hits+misses > 0 {
+			k.telemetry.Record("kaniko.cache.hit_ratio", "1", float64(hits)/float64(hits+misses), attrs)
+		}
+		k.telemetry.Record("kaniko.build.retries", "{retry}", float64(k.buildLog.retryCount()), attrs)
+	}
+	if u := k.resourceUsage; u != nil {
+		k.telemetry.Record("kaniko.executor.memory.peak", "By", float64(u.PeakRSS), attrs)
+		k.telemetry.Record("kaniko.executor.cpu.time", "s", u.CPUSeconds, attrs)
+	}
+	if k.imageSizes != nil {
+		k.telemetry.Record("kaniko.image.size", "By", float64(k.imageSizes.Compressed), attrs)
+	}
+}
+
+// exportTelemetry writes the spans and metrics to OTelFile and sends them to
+// OTelEndpoint. Failures are only logged.
+func (k *Config) exportTelemetry() {
+	if k.OTelFile != "" {
+		if err := k.telemetry.WriteFile(k.OTelFile); err != nil {
+			slog.Warn("cannot write telemetry", "error", err)
+		}
+	}
+	if k.OTelEndpoint == "" {
+		return
+	}
+	headers, err := telemetry.ParseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		slog.Warn("cannot export telemetry", "error", fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %w", err))
+		return
+	}
+	var client telemetry.HTTPClient = http.DefaultClient
+	if k.client != nil {
+		client = k.client
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryExportTimeout)
+	defer cancel()
+	if err = k.telemetry.Export(ctx, client, k.OTelEndpoint, headers); err != nil {
+		slog.Warn("cannot export telemetry", "error", err)
+		return
+	}
+	slog.Info("exported telemetry", "trace_id", k.buildSpan.TraceID(), "endpoint", k.OTelEndpoint)
+}
+
+func (k *Config) backendName() string {
+	if backend := strings.ToLower(strings.TrimSpace(k.Backend)); backend != "" {
+		return backend
+	}
+	return BackendKaniko
+}
@@ -0,0 +1,149 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+// otlpFile is the part of the OTLP JSON lines of the telemetry file checked by the tests.
+type otlpFile struct {
+	ResourceSpans []struct {
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID      string `json:"traceId"`
+				SpanID       string `json:"spanId"`
+				ParentSpanID string `json:"parentSpanId"`
+				Name         string `json:"name"`
+				Status       struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"status"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+	ResourceMetrics []struct {
+		ScopeMetrics []struct {
+			Metrics []struct {
+				Name  string `json:"name"`
+				Gauge struct {
+					DataPoints []struct {
+						AsDouble float64 `json:"asDouble"`
+					} `json:"dataPoints"`
+				} `json:"gauge"`
+			} `json:"metrics"`
+		} `json:"scopeMetrics"`
+	} `json:"resourceMetrics"`
+}
+
+func readOTLPFile(t *testing.T, path string) (traces, metrics otlpFile) {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 2)
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &traces))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &metrics))
+	return traces, metrics
+}
+
+func Test_RunTelemetry(t *testing.T) {
+	dir := t.TempDir()
+	executor := testharness.NewExecutor(t, testharness.Scenario{
+		Log: kanikoBuildLog + "WARN[0012] Failed to push layer, retrying: connection reset by peer\n",
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM golang:1.26 AS build\nFROM gcr.io/distroless/static\nCOPY --from=build /app /app\n"), 0644))
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	t.Setenv("DOCKER_BUILD_ARGS", "")
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20s3cr3t")
+
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "Bearer s3cr3t", req.Header.Get("Authorization"))
+		paths = append(paths, req.URL.Path)
+	}))
+	defer srv.Close()
+
+	c := Config{
+		ExecutablePath: executor.Path,
+		DockerContext:  dir,
+		Destination:    "my.registry/myimage:sometag",
+		OTelEndpoint:   srv.URL,
+		OTelFile:       filepath.Join(dir, "telemetry.json"),
+		Version:        "v1.2.3",
+	}
+	require.NoError(t, c.Run(context.Background()))
+	require.Equal(t, []string{"/v1/traces", "/v1/metrics"}, paths)
+
+	traces, metrics := readOTLPFile(t, c.OTelFile)
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	names := map[string]string{}
+	ids := map[string]string{}
+	for _, span := range spans {
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID)
+		require.Equal(t, 1, span.Status.Code, span.Name)
+		names[span.Name] = span.ParentSpanID
+		ids[span.Name] = span.SpanID
+	}
+	require.Equal(t, map[string]string{
+		"build":             "00f067aa0ba902b7",
+		phaseConfig:         ids["build"],
+		phaseRegistryConfig: ids["build"],
+		phasePreflight:      ids["build"],
+		phaseExecutor:       ids["build"],
+		phasePush:           ids["build"],
+		phaseOutputs:        ids["build"],
+		"stage build":       ids[phaseExecutor],
+		"stage 1":           ids[phaseExecutor],
+	}, names)
+
+	builds := executor.Builds(t)
+	require.Len(t, builds, 1)
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+ids[phaseExecutor]+"-01", builds[0].Getenv("TRACEPARENT"))
+
+	values := map[string][]float64{}
+	for _, m := range metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		for _, p := range m.Gauge.DataPoints {
+			values[m.Name] = append(values[m.Name], p.AsDouble)
+		}
+	}
+	require.Len(t, values["kaniko.build.duration"], 1)
+	require.Len(t, values["kaniko.stage.duration"], 2)
+	require.InDelta(t, 2.0/3, values["kaniko.cache.hit_ratio"][0], 1e-9)
+	require.Equal(t, []float64{1}, values["kaniko.build.retries"])
+	require.NotContains(t, values, "kaniko.image.size")
+}
+
+func Test_RunTelemetryFailure(t *testing.T) {
+	executor := testharness.NewExecutor(t, testharness.Scenario{ExitCode: 3})
+	t.Setenv("CLOUDBEES_OUTPUTS", "")
+	t.Setenv("TRACEPARENT", "")
+
+	c := Config{
+		ExecutablePath: executor.Path,
+		Destination:    "my.registry/myimage:sometag",
+		OTelFile:       filepath.Join(t.TempDir(), "telemetry.json"),
+	}
+	require.Error(t, c.Run(context.Background()))
+
+	traces, _ := readOTLPFile(t, c.OTelFile)
+	status := map[string]int{}
+	for _, span := range traces.ResourceSpans[0].ScopeSpans[0].Spans {
+		status[span.Name] = span.Status.Code
+		if span.Name == "build" {
+			require.Equal(t, "run kaniko: exit status 3", span.Status.Message)
+		}
+	}
+	require.Equal(t, 2, status["build"])
+	require.Equal(t, 2, status[phaseExecutor])
+	require.Equal(t, 1, status[phasePreflight])
+	require.NotContains(t, status, phasePush)
+}
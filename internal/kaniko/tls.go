@@ -0,0 +1,258 @@
+package kaniko
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// defaultSSLCertDirs are the certificate directories used when SSL_CERT_DIR is not set:
+// the one of the kaniko image followed by the usual system location.
+const defaultSSLCertDirs = "/kaniko/ssl/certs:/etc/ssl/certs"
+
+// prepareTLS installs the CA bundle and the client certificate for the build backend
+// and prepares the TLS configuration of the wrapper's own HTTP client.
+// The returned function removes the generated files.
+func (k *Config) prepareTLS() (func(), error) {
+	noop := func() {}
+	if k.CACertificates == "" && k.ClientCertificate == "" && k.ClientKey == "" {
+		return noop, nil
+	}
+	if (k.ClientCertificate == "") != (k.ClientKey == "") {
+		return noop, fmt.Errorf("client certificate and client key must be set together")
+	}
+
+	dir, err := os.MkdirTemp("", "kaniko-tls-")
+	if err != nil {
+		return noop, fmt.Errorf("create certificate directory: %w", err)
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("failed to remove generated certificates", "error", err)
+		}
+	}
+
+	tlsConfig := &tls.Config{}
+	if k.CACertificates != "" {
+		pool, err := k.installCACertificates(dir)
+		if err != nil {
+			cleanup()
+			return noop, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if k.ClientCertificate != "" {
+		cert, err := k.installClientCertificate(dir)
+		if err != nil {
+			cleanup()
+			return noop, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	k.tlsConfig = tlsConfig
+	return cleanup, nil
+}
+
+// registryTLSConfigs returns the TLS configurations of the wrapper's HTTP client for the
+// registries with TLS settings in the registry configuration, by host, so that the
+// wrapper reaches the registries the executor reaches with the flags of registryFlags.
+func (k *Config) registryTLSConfigs() (map[string]*tls.Config, error) {
+	settings, err := k.registrySettingsInConfig()
+	if err != nil {
+		return nil, err
+	}
+	configs := map[string]*tls.Config{}
+	for _, s := range settings {
+		if !s.SkipTLSVerify && s.Certificate == "" && s.ClientCertificate == "" && s.ClientKey == "" {
+			continue
+		}
+		cfg := &tls.Config{}
+		if k.tlsConfig != nil {
+			cfg = k.tlsConfig.Clone()
+		}
+		cfg.InsecureSkipVerify = s.SkipTLSVerify
+
+		if s.Certificate != "" {
+			ca, err := readPEM(s.Certificate)
+			if err != nil {
+				return nil, fmt.Errorf("registry %s certificate: %w", s.Prefix, err)
+			}
+			pool := cfg.RootCAs
+			if pool != nil {
+				pool = pool.Clone()
+			} else if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("registry %s certificate does not contain any PEM encoded certificate", s.Prefix)
+			}
+			cfg.RootCAs = pool
+		}
+
+		if s.ClientCertificate != "" || s.ClientKey != "" {
+			if s.ClientCertificate == "" || s.ClientKey == "" {
+				return nil, fmt.Errorf("registry %s: client certificate and key must be set together", s.Prefix)
+			}
+			certPEM, err := readPEM(s.ClientCertificate)
+			if err != nil {
+				return nil, fmt.Errorf("registry %s client certificate: %w", s.Prefix, err)
+			}
+			keyPEM, err := readPEM(s.ClientKey)
+			if err != nil {
+				return nil, fmt.Errorf("registry %s client key: %w", s.Prefix, err)
+			}
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				return nil, fmt.Errorf("registry %s client certificate: %w", s.Prefix, err)
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+
+		for _, host := range s.hosts() {
+			configs[host] = cfg
+		}
+	}
+	return configs, nil
+}
+
+// registryTransport sends the requests to the registries with their own TLS settings
+// through their own transport.
+type registryTransport struct {
+	http.RoundTripper
+	hosts map[string]http.RoundTripper
+}
+
+func (t *registryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := t.hosts[req.URL.Host]; ok {
+		return transport.RoundTrip(req)
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// installCACertificates writes the CA bundle into its own certificate directory,
+// which is added to the SSL_CERT_DIR of the build backend.
+func (k *Config) installCACertificates(dir string) (*x509.CertPool, error) {
+	bundle, err := readPEM(k.CACertificates)
+	if err != nil {
+		return nil, fmt.Errorf("read CA certificates: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("CA certificates do not contain any PEM encoded certificate")
+	}
+
+	certDir := filepath.Join(dir, "certs")
+	if err = os.Mkdir(certDir, 0700); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(filepath.Join(certDir, "ca-bundle.crt"), bundle, 0600); err != nil {
+		return nil, fmt.Errorf("write CA certificates: %w", err)
+	}
+	k.caCertDir = certDir
+	slog.Info("using custom CA certificates", "source", describePEM(k.CACertificates))
+	return pool, nil
+}
+
+// installClientCertificate materializes the client certificate and key into dir
+// so that they can be passed to the executor.
+func (k *Config) installClientCertificate(dir string) (tls.Certificate, error) {
+	certFile, err := materializePEM(k.ClientCertificate, dir, "client.pem")
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("client certificate: %w", err)
+	}
+	keyFile, err := materializePEM(k.ClientKey, dir, "client-key.pem")
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("client key: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("load client certificate: %w", err)
+	}
+	k.clientCertFile, k.clientKeyFile = certFile, keyFile
+	slog.Info("using client certificate", "source", describePEM(k.ClientCertificate))
+	return cert, nil
+}
+
+// clientCertFlags passes the client certificate to the executor for the destination registries
+// and the registries of the registry configuration without a client certificate of their own.
+func (k *Config) clientCertFlags(settings []registrySettings) []string {
+	if k.clientCertFile == "" {
+		return nil
+	}
+	var hosts []string
+	seen := map[string]bool{}
+	for _, s := range settings {
+		for _, host := range s.hosts() {
+			if seen[host] {
+				continue
+			}
+			seen[host] = true
+			// Registries with their own client certificate already got a flag.
+			if s.ClientCertificate == "" {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	for _, destination := range k.processDestinations() {
+		ref, err := registry.ParseReference(strings.TrimSpace(destination))
+		if err != nil || seen[ref.Registry] {
+			continue
+		}
+		seen[ref.Registry] = true
+		hosts = append(hosts, ref.Registry)
+	}
+
+	var args []string
+	for _, host := range hosts {
+		args = append(args, "--registry-client-cert", host+"="+k.clientCertFile+","+k.clientKeyFile)
+	}
+	return args
+}
+
+// backendEnv returns the environment generated for the build backend.
+func (k *Config) backendEnv() []string {
+	var env []string
+	if k.dockerConfig != "" {
+		env = append(env, "DOCKER_CONFIG="+k.dockerConfig)
+	}
+	if k.caCertDir != "" {
+		certDirs := os.Getenv("SSL_CERT_DIR")
+		if certDirs == "" {
+			certDirs = defaultSSLCertDirs
+		}
+		env = append(env, "SSL_CERT_DIR="+certDirs+":"+k.caCertDir)
+	}
+	if k.proxy != nil {
+		env = append(env, k.proxy.env()...)
+	}
+	if k.sourceDateEpoch != "" {
+		env = append(env, sourceDateEpochArg+"="+k.sourceDateEpoch)
+	}
+	return append(env, k.traceparentEnv()...)
+}
+
+// readPEM returns PEM content given either inline or as file path.
+func readPEM(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
+}
+
+func describePEM(value string) string {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return "inline PEM content"
+	}
+	return value
+}
@@ -0,0 +1,169 @@
+package kaniko
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// generateClientCertificate returns a self-signed client certificate and its key as PEM.
+func generateClientCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "builder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func serverCA(srv *httptest.Server) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+}
+
+func Test_prepareTLS(t *testing.T) {
+	t.Run("nothing configured", func(t *testing.T) {
+		c := Config{}
+		cleanup, err := c.prepareTLS()
+		require.NoError(t, err)
+		defer cleanup()
+		require.Nil(t, c.tlsConfig)
+		require.Empty(t, c.backendEnv())
+	})
+
+	t.Run("CA bundle from file", func(t *testing.T) {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer srv.Close()
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(caFile, []byte(serverCA(srv)), 0600))
+		t.Setenv("SSL_CERT_DIR", "/etc/ssl/certs")
+
+		c := Config{CACertificates: caFile}
+		cleanup, err := c.prepareTLS()
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		resp, err := c.newHTTPClient().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		require.Equal(t, []string{"SSL_CERT_DIR=/etc/ssl/certs:" + c.caCertDir}, c.backendEnv())
+		require.FileExists(t, filepath.Join(c.caCertDir, "ca-bundle.crt"))
+		cleanup()
+		require.NoDirExists(t, c.caCertDir)
+	})
+
+	t.Run("client certificate as PEM content", func(t *testing.T) {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.PeerCertificates) == 0 {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+		srv.StartTLS()
+		defer srv.Close()
+
+		cert, key := generateClientCertificate(t)
+		c := Config{
+			CACertificates:    serverCA(srv),
+			ClientCertificate: cert,
+			ClientKey:         key,
+			Destination:       "registry.example.com/team/app:1.0,docker.io/team/app:1.0",
+		}
+		cleanup, err := c.prepareTLS()
+		require.NoError(t, err)
+		defer cleanup()
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		resp, err := c.newHTTPClient().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		clientCert := c.clientCertFile + "," + c.clientKeyFile
+		require.Equal(t, []string{
+			"--registry-client-cert", "registry.example.com=" + clientCert,
+			"--registry-client-cert", "docker.io=" + clientCert,
+		}, c.clientCertFlags(nil))
+		require.Equal(t, []string{
+			"--registry-client-cert", "mirror.example.com=" + clientCert,
+			"--registry-client-cert", "docker.io=" + clientCert,
+		}, c.clientCertFlags([]registrySettings{
+			{Prefix: "registry.example.com", ClientCertificate: "/certs/own.pem", ClientKey: "/certs/own-key.pem"},
+			{Prefix: "mirror.example.com"},
+		}))
+	})
+
+	t.Run("registry settings", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		trusted := httptest.NewTLSServer(handler)
+		defer trusted.Close()
+		unverified := httptest.NewTLSServer(handler)
+		defer unverified.Close()
+		other := httptest.NewTLSServer(handler)
+		defer other.Close()
+		b, err := json.Marshal(map[string]any{"registries": []map[string]any{
+			{"prefix": strings.TrimPrefix(trusted.URL, "https://"), "certificate": serverCA(trusted)},
+			{"prefix": strings.TrimPrefix(unverified.URL, "https://"), "skipTlsVerify": true},
+		}})
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "registries.json")
+		require.NoError(t, os.WriteFile(path, b, 0600))
+		t.Setenv("CLOUDBEES_REGISTRY_CONFIG", path)
+
+		c := Config{}
+		c.registryTLS, err = c.registryTLSConfigs()
+		require.NoError(t, err)
+		client := c.newHTTPClient()
+		for _, srv := range []*httptest.Server{trusted, unverified} {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/v2/", nil)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err, srv.URL)
+			resp.Body.Close()
+		}
+		req, err := http.NewRequest(http.MethodGet, other.URL+"/v2/", nil)
+		require.NoError(t, err)
+		_, err = client.Do(req)
+		require.ErrorContains(t, err, "certificate")
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		cert, _ := generateClientCertificate(t)
+		_, err := (&Config{ClientCertificate: cert}).prepareTLS()
+		require.ErrorContains(t, err, "client certificate and client key must be set together")
+
+		_, err = (&Config{CACertificates: "-----BEGIN CERTIFICATE-----\nnot a certificate\n-----END CERTIFICATE-----\n"}).prepareTLS()
+		require.ErrorContains(t, err, "do not contain any PEM encoded certificate")
+
+		_, err = (&Config{CACertificates: filepath.Join(t.TempDir(), "missing.pem")}).prepareTLS()
+		require.Error(t, err)
+		require.True(t, strings.HasPrefix(err.Error(), "read CA certificates"))
+	})
+}
@@ -1,23 +1,44 @@
 package kaniko
 
-import "context"
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/cloudbees-io/kaniko/internal/buildcontext"
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/policy"
+	"github.com/cloudbees-io/kaniko/internal/resources"
+	"github.com/cloudbees-io/kaniko/internal/telemetry"
+)
 
 type Config struct {
 	context.Context
+	// Backend selects the Builder used to build and push the image, defaults to kaniko.
+	Backend string `json:"backend,omitempty"`
 	// ExecutablePath is the path to the Kaniko executor binary.
+	// Optional: if empty, KANIKO_EXECUTOR or the executor found in the PATH is used.
 	ExecutablePath string
 	// Dockerfile is the path to the Dockerfile to build.
 	Dockerfile string `json:"dockerfile,omitempty"`
 	// Context is the path to the build context.
+	// Remote git, archive and OCI artifact contexts are fetched into a temporary directory first.
 	DockerContext string `json:"context,omitempty"`
+	// ContextChecksum is the expected sha256:<hex> digest of an archive build context.
+	ContextChecksum string `json:"context-checksum,omitempty"`
 	// Destination is the destination of the built image.
 	Destination string `json:"destination,omitempty"`
 	// RegistryMirrors contains registries used to pull images.
 	RegistryMirrors string `json:"registryMirrors,omitempty"`
 	// SkipDefaultRegistryFallback sets whether to use fallback if image isn't found in mirrors.
 	SkipDefaultRegistryFallback bool `json:"skipDefaultRegistryFallback,omitempty"`
-	// Verbosity is the verbosity level of the Kaniko executor.
+	// ProbeRegistryMirrors drops unhealthy registry mirrors and orders the others by latency before building.
+	ProbeRegistryMirrors bool `json:"probe-registry-mirrors,omitempty"`
+	// Verbosity is the verbosity level of the Kaniko executor and of the logs of the wrapper.
 	Verbosity string `json:"verbosity,omitempty"`
+	// LogFormat is the format of the logs of the wrapper: text or json.
+	LogFormat string `json:"log-format,omitempty"`
+	// LogFile is the path the logs of the wrapper are also written to.
+	LogFile string `json:"log-file,omitempty"`
 	// Target field allows you to build a particular stage in multistage docker files.
 	Target string `json:"target,omitempty"`
 	// TarPath is an optional path to save the image as a tar file.
@@ -25,8 +46,136 @@ type Config struct {
 	// KanikoDir is the working directory to be passed as --kaniko-dir to executor.
 	// Optional: if empty, executor default is used
 	KanikoDir string `json:"kaniko-dir,omitempty"`
+	// KeepKanikoDir keeps the kaniko directory created for the build, for debugging.
+	KeepKanikoDir bool `json:"keep-kaniko-dir,omitempty"`
+	// MinFreeDisk is the free disk space of the kaniko directory, e.g. 1GiB, below which
+	// a warning is logged before and during the build.
+	MinFreeDisk string `json:"min-free-disk,omitempty"`
+	// StageContext selects how the build context pruned by .dockerignore is staged: none, dir or tar.
+	// Optional: if empty, the context is passed to the backend as is.
+	StageContext string `json:"stage-context,omitempty"`
+	// MaxContextSize fails the build when the included build context exceeds this size, e.g. 500MiB.
+	MaxContextSize string `json:"max-context-size,omitempty"`
+	// ImageSizeReport prints the compressed and uncompressed sizes of the built image and its layers.
+	ImageSizeReport bool `json:"image-size-report,omitempty"`
+	// MaxImageSize fails the build when the compressed image exceeds this size, e.g. 1GiB.
+	MaxImageSize string `json:"max-image-size,omitempty"`
+	// MaxImageGrowth fails the build when the compressed image grew by more than this size
+	// or percentage, e.g. 100MiB or 20%, since the image previously published at the same tag.
+	MaxImageGrowth string `json:"max-image-growth,omitempty"`
+	// MaxLayers fails the build when the image has more layers.
+	MaxLayers int `json:"max-layers,omitempty"`
+	// AllowedBaseImages and DeniedBaseImages are comma or newline separated glob patterns of
+	// registries and repositories, e.g. docker.io/library or *.example.com, the images of
+	// FROM and COPY --from instructions are checked against before building.
+	AllowedBaseImages string `json:"allowed-base-images,omitempty"`
+	DeniedBaseImages  string `json:"denied-base-images,omitempty"`
+	// Policy is the path to a YAML file of policy rules checked against the Dockerfile and the built image.
+	Policy string `json:"policy,omitempty"`
+	// ImageDiff compares the built image to the image previously published at the first destination.
+	ImageDiff bool `json:"image-diff,omitempty"`
+	// StrictExecutorFlags fails the build instead of dropping flags the executor does not support.
+	StrictExecutorFlags bool `json:"strict-executor-flags,omitempty"`
+	// CACertificates is a CA bundle trusted in addition to the system CAs, as file path or PEM content.
+	CACertificates string `json:"ca-certificates,omitempty"`
+	// ClientCertificate and ClientKey authenticate to registries with mutual TLS, as file paths or PEM content.
+	ClientCertificate string `json:"client-certificate,omitempty"`
+	ClientKey         string `json:"client-key,omitempty"`
+	// HTTPProxy, HTTPSProxy and NoProxy configure the egress proxy of the wrapper and the build backend.
+	HTTPProxy  string `json:"http-proxy,omitempty"`
+	HTTPSProxy string `json:"https-proxy,omitempty"`
+	NoProxy    string `json:"no-proxy,omitempty"`
+	// CreatedLabel sets the org.opencontainers.image.created label to the build time when
+	// SOURCE_DATE_EPOCH is not set.
+	CreatedLabel bool `json:"created-label,omitempty"`
+	// AnnotateManifest rewrites the manifest pushed by the kaniko executor with the OCI
+	// annotations, which moves the destination tags to the annotated manifest.
+	AnnotateManifest bool `json:"annotate-manifest,omitempty"`
+	// Reproducible builds byte-identical images for the same sources and base images.
+	Reproducible bool `json:"reproducible,omitempty"`
+	// VerifyReproducible builds the image twice without pushing it and fails when the builds differ.
+	VerifyReproducible bool `json:"verify-reproducible,omitempty"`
+	// OutputFormat selects how the outputs are written: cloudbees, json, dotenv or github.
+	// Optional: if empty, a file per output is written into CLOUDBEES_OUTPUTS.
+	OutputFormat string `json:"output-format,omitempty"`
+	// OutputFile is the file the json, dotenv and github output formats write to.
+	// Optional: if empty, outputs.json, outputs.env or GITHUB_OUTPUT is used.
+	OutputFile string `json:"output-file,omitempty"`
+	// Summary and SummaryJSON are the paths the build summary is written to as Markdown and JSON.
+	Summary     string `json:"summary,omitempty"`
+	SummaryJSON string `json:"summary-json,omitempty"`
+	// OTelEndpoint is the OTLP/HTTP endpoint the spans and metrics of the build are exported to,
+	// e.g. http://collector:4318, and OTelFile the file they are written to as OTLP JSON.
+	OTelEndpoint string `json:"otel-endpoint,omitempty"`
+	OTelFile     string `json:"otel-file,omitempty"`
+	// Version is the version of the action reported in the telemetry.
+	Version string `json:"-"`
+	// RegistryConfig is the path to the registry configuration.
+	// Optional: if empty, CLOUDBEES_REGISTRY_CONFIG is used.
+	RegistryConfig string `json:"registry-config,omitempty"`
+	// Local runs the executor image in a container for development outside CloudBees,
+	// writing the outputs into LocalOutputs instead of CLOUDBEES_OUTPUTS.
+	Local bool `json:"local,omitempty"`
+	// LocalOutputs is the outputs directory of local mode, defaults to .kaniko-outputs.
+	LocalOutputs string `json:"local-outputs,omitempty"`
+	// ContainerRuntime is the docker or podman CLI running the executor in local mode, defaults to docker.
+	ContainerRuntime string `json:"container-runtime,omitempty"`
+	// ExecutorImage is the kaniko executor image run in local mode.
+	ExecutorImage string `json:"executor-image,omitempty"`
 
-	client HTTPClient
+	client        HTTPClient
+	capabilities  executorCapabilities
+	contextReport *buildcontext.Report
+	// dockerConfig is the generated docker config directory holding registry config credentials.
+	dockerConfig string
+	// registryCertDir holds registry certificates given as PEM content in the registry config.
+	registryCertDir string
+	// tlsConfig is the TLS configuration of the wrapper's HTTP client, nil for the defaults.
+	tlsConfig *tls.Config
+	// registryTLS is the TLS configuration of the wrapper's HTTP client for the registries
+	// with TLS settings in the registry configuration, by host.
+	registryTLS map[string]*tls.Config
+	// proxy is the resolved proxy configuration, nil to use the environment as is.
+	proxy *proxyConfig
+	// caCertDir holds the CA bundle added to SSL_CERT_DIR of the build backend.
+	caCertDir string
+	// clientCertFile and clientKeyFile are the client certificate files passed to the executor.
+	clientCertFile string
+	clientKeyFile  string
+	// sourceDateEpoch is the SOURCE_DATE_EPOCH of reproducible builds.
+	sourceDateEpoch string
+	// noPush builds the image into TarPath only, used by the reproducibility verification.
+	noPush bool
+	// previousImage holds the sizes of the image published at the first destination before the build.
+	previousImage *image.Sizes
+	// previousImageRef pins the image published at the first destination before the build to its digest.
+	previousImageRef string
+	// ociLabels are the OCI standard labels added to the user labels.
+	ociLabels map[string]string
+	// policy holds the loaded policy rules and policyVars the facts they are evaluated against.
+	policy     *policy.Policy
+	policyVars map[string]any
+	// buildLog collects the stages, cache hits and warnings of the build summary.
+	buildLog *buildLog
+	// digest is the digest of the pushed image and imageSizes its measured sizes.
+	digest     string
+	imageSizes *image.Sizes
+	// kanikoDir is the kaniko directory prepared for the build.
+	kanikoDir string
+	// resourceUsage is the peak resource usage of the build backend.
+	resourceUsage *resources.Usage
+	// buildID identifies the build in the logs, and logFields holds the phase of the build.
+	buildID   string
+	logFields *logFields
+	// telemetry records the spans of the build, its current phase and the executor run.
+	telemetry    *telemetry.Recorder
+	buildSpan    *telemetry.Span
+	phaseSpan    *telemetry.Span
+	executorSpan *telemetry.Span
+	// containerRuntime is the resolved container runtime binary of local mode.
+	containerRuntime string
+	// mirrorHealth holds the probe results of the registry mirrors, nil when they were not probed.
+	mirrorHealth map[string]mirrorHealth
 }
 
 type Auth struct {
@@ -0,0 +1,96 @@
+package kaniko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/buildcontext"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// Validate checks the configuration and, for local build contexts, the Dockerfile
+// against the target, base image patterns and policy, without building. All the
+// problems found are returned.
+func (k *Config) Validate(ctx context.Context) error {
+	k.Context = ctx
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if strings.TrimSpace(k.Destination) == "" {
+		check(fmt.Errorf("no destination"))
+	}
+	for _, destination := range k.processDestinations() {
+		if _, err := registry.ParseReference(destination); err != nil {
+			check(fmt.Errorf("invalid destination: %w", err))
+		}
+	}
+	_, err := k.newBuilder(false)
+	check(err)
+	if k.Local {
+		check(k.resolveContainerRuntime())
+	}
+	_, err = k.outputFormat()
+	check(err)
+	if k.Verbosity != "" {
+		check(validateVerbosity(strings.ToLower(k.Verbosity)))
+	}
+	check(validateLogFormat(strings.ToLower(k.LogFormat)))
+	switch strings.ToLower(strings.TrimSpace(k.StageContext)) {
+	case "", StageContextNone, StageContextDir, StageContextTar:
+	default:
+		check(fmt.Errorf("unknown build context staging mode: %s", k.StageContext))
+	}
+	if k.MaxContextSize != "" {
+		if _, err := buildcontext.ParseSize(k.MaxContextSize); err != nil {
+			check(fmt.Errorf("max context size: %w", err))
+		}
+	}
+	_, err = k.imageBudgets()
+	check(err)
+	_, err = k.minFreeDisk()
+	check(err)
+
+	_, remote, err := buildcontext.ParseRemote(k.DockerContext)
+	switch {
+	case err != nil:
+		check(err)
+	case remote:
+		slog.Info("the Dockerfile of a remote build context is not validated", "context", k.DockerContext)
+	default:
+		check(k.validateDockerfile())
+	}
+	return errors.Join(errs...)
+}
+
+// validateDockerfile parses the Dockerfile and checks its base images and policy rules.
+func (k *Config) validateDockerfile() error {
+	f, err := os.Open(k.resolveDockerfile())
+	if err != nil {
+		return err
+	}
+	stages, err := dockerfileStages(f, k.buildArgValues())
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if _, err = targetStage(stages, k.Target); err != nil {
+		return err
+	}
+	if k.checksBaseImages() {
+		if err = k.checkBaseImages(); err != nil {
+			return err
+		}
+	}
+	if k.Policy != "" {
+		return k.preparePolicy()
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package kaniko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Validate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM docker.io/library/alpine:3.20 AS base\nFROM base\n"), 0644))
+	t.Setenv("DOCKER_BUILD_ARGS", "")
+
+	t.Run("valid", func(t *testing.T) {
+		c := &Config{DockerContext: dir, Destination: "registry.example.com/app:1.0", Verbosity: "INFO", Target: "base"}
+		require.NoError(t, c.Validate(context.Background()))
+	})
+
+	t.Run("all problems are reported", func(t *testing.T) {
+		c := &Config{
+			DockerContext:     dir,
+			Backend:           "docker",
+			Verbosity:         "loud",
+			LogFormat:         "xml",
+			StageContext:      "zip",
+			MaxImageSize:      "huge",
+			Target:            "test",
+			AllowedBaseImages: "gcr.io",
+		}
+		err := c.Validate(context.Background())
+		require.ErrorContains(t, err, "no destination")
+		require.ErrorContains(t, err, "unknown build backend: docker")
+		require.ErrorContains(t, err, "unknown verbosity level: loud")
+		require.ErrorContains(t, err, "unknown log format: xml")
+		require.ErrorContains(t, err, "unknown build context staging mode: zip")
+		require.ErrorContains(t, err, "invalid max-image-size")
+		require.ErrorContains(t, err, "target stage test not found")
+	})
+
+	t.Run("base images and policy", func(t *testing.T) {
+		c := &Config{DockerContext: dir, Destination: "registry.example.com/app:1.0", AllowedBaseImages: "gcr.io"}
+		require.ErrorContains(t, c.Validate(context.Background()), "docker.io/library/alpine is not allowed")
+
+		c = &Config{
+			DockerContext: dir,
+			Destination:   "registry.example.com/app:1.0",
+			Policy:        writePolicy(t, "rules:\n  - name: pinned\n    assert: dockerfile.base.digest != \"\"\n"),
+		}
+		require.EqualError(t, c.Validate(context.Background()), "Dockerfile violates policy rules: pinned")
+	})
+
+	t.Run("remote context", func(t *testing.T) {
+		c := &Config{DockerContext: "git://example.com/repo.git", Destination: "registry.example.com/app:1.0"}
+		require.NoError(t, c.Validate(context.Background()))
+	})
+}
@@ -0,0 +1,649 @@
+package policy
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled rule expression.
+//
+// Expressions combine literals (strings, numbers, true, false, null and [lists]),
+// variables with member access (image.user, image.labels["key"]), the operators
+// ! && || == != < <= > >= and in, and the functions len, lower, upper, startsWith,
+// endsWith, contains and matches. all(list, expr) and any(list, expr) evaluate expr
+// for every element of list, which is bound to it.
+type Expr struct {
+	source string
+	root   node
+	// variables are the names of the variables the expression reads.
+	variables map[string]bool
+}
+
+// Compile parses an expression.
+func Compile(source string) (*Expr, error) {
+	p := &parser{source: source, variables: map[string]bool{}}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return &Expr{source: source, root: root, variables: p.variables}, nil
+}
+
+// uses reports whether the expression reads the variable.
+func (e *Expr) uses(name string) bool {
+	return e.variables[name]
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression with the given variables.
+func (e *Expr) Eval(vars map[string]any) (any, error) {
+	return e.root.eval(vars)
+}
+
+// EvalBool evaluates an expression which must return a boolean.
+func (e *Expr) EvalBool(vars map[string]any) (bool, error) {
+	v, err := e.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s instead of a boolean", typeName(v))
+	}
+	return b, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value any
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+type parser struct {
+	source    string
+	tokens    []token
+	pos       int
+	variables map[string]bool
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("invalid expression at position %d: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+var comparisons = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+func (p *parser) tokenize() error {
+	s := p.source
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(s) && rune(s[j]) != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				sb.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return p.errorf(token{pos: i}, "unterminated string")
+			}
+			p.tokens = append(p.tokens, token{kind: tokenString, text: s[i : j+1], value: sb.String(), pos: i})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return p.errorf(token{pos: i}, "invalid number %q", s[i:j])
+			}
+			p.tokens = append(p.tokens, token{kind: tokenNumber, text: s[i:j], value: n, pos: i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			p.tokens = append(p.tokens, token{kind: tokenIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, token{kind: tokenOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return p.errorf(token{pos: i}, "unexpected character %q", c)
+			}
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokenEOF, pos: len(s)})
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(text string) bool {
+	if t := p.peek(); (t.kind == tokenOp || t.kind == tokenIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf(p.peek(), "expected %q but found %s", text, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var right node
+		if right, err = p.parseAnd(); err == nil {
+			left = &logicalNode{or: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	for err == nil && p.accept("&&") {
+		var right node
+		if right, err = p.parseNot(); err == nil {
+			left = &logicalNode{left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tokenOp && comparisons[t.text]:
+	case t.kind == tokenIdent && t.text == "in":
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	return &compareNode{op: t.text, left: left, right: right}, nil
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	for err == nil {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, p.errorf(t, "expected a field name after \".\"")
+			}
+			n = &indexNode{target: n, index: &literalNode{value: t.text}}
+		case p.accept("["):
+			var index node
+			if index, err = p.parseOr(); err == nil {
+				err = p.expect("]")
+			}
+			n = &indexNode{target: n, index: index}
+		default:
+			return n, nil
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString, tokenNumber:
+		return &literalNode{value: t.value}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if p.accept("(") {
+			return p.parseCall(t)
+		}
+		p.variables[t.text] = true
+		return &variableNode{name: t.text}, nil
+	case tokenOp:
+		switch t.text {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			list := &listNode{}
+			for !p.accept("]") {
+				if len(list.items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+			}
+			return list, nil
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", t)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	call := &callNode{name: name.text}
+	for !p.accept(")") {
+		if len(call.args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+	arity, ok := functionArity[call.name]
+	if !ok {
+		return nil, p.errorf(name, "unknown function %s", call.name)
+	}
+	if len(call.args) != arity {
+		return nil, p.errorf(name, "%s expects %d arguments, got %d", call.name, arity, len(call.args))
+	}
+	return call, nil
+}
+
+var functionArity = map[string]int{
+	"len":        1,
+	"lower":      1,
+	"upper":      1,
+	"startsWith": 2,
+	"endsWith":   2,
+	"contains":   2,
+	"matches":    2,
+	"all":        2,
+	"any":        2,
+}
+
+type node interface {
+	eval(vars map[string]any) (any, error)
+}
+
+type literalNode struct{ value any }
+
+func (n *literalNode) eval(map[string]any) (any, error) { return n.value, nil }
+
+type variableNode struct{ name string }
+
+func (n *variableNode) eval(vars map[string]any) (any, error) {
+	v, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %s", n.name)
+	}
+	return v, nil
+}
+
+type listNode struct{ items []node }
+
+func (n *listNode) eval(vars map[string]any) (any, error) {
+	list := make([]any, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// indexNode reads a map entry or a list element. Missing entries are null.
+type indexNode struct{ target, index node }
+
+func (n *indexNode) eval(vars map[string]any) (any, error) {
+	target, err := n.target.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch t := target.(type) {
+	case nil:
+		return nil, nil
+	case map[string]any:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot index a map with %s", typeName(index))
+		}
+		return t[key], nil
+	case []any:
+		i, ok := index.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot index a list with %s", typeName(index))
+		}
+		if i < 0 || int(i) >= len(t) {
+			return nil, nil
+		}
+		return t[int(i)], nil
+	default:
+		return nil, fmt.Errorf("cannot index %s", typeName(target))
+	}
+}
+
+type notNode struct{ operand node }
+
+func (n *notNode) eval(vars map[string]any) (any, error) {
+	v, err := evalBool(n.operand, vars)
+	return !v, err
+}
+
+type logicalNode struct {
+	or          bool
+	left, right node
+}
+
+func (n *logicalNode) eval(vars map[string]any) (any, error) {
+	left, err := evalBool(n.left, vars)
+	if err != nil || left == n.or {
+		return left, err
+	}
+	return evalBool(n.right, vars)
+}
+
+func evalBool(n node, vars map[string]any) (bool, error) {
+	v, err := n.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean but got %s", typeName(v))
+	}
+	return b, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(vars map[string]any) (any, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return contains(right, left)
+	}
+
+	switch l := left.(type) {
+	case float64:
+		if r, ok := right.(float64); ok {
+			return compareOrdered(n.op, l, r), nil
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return compareOrdered(n.op, l, r), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot compare %s %s %s", typeName(left), n.op, typeName(right))
+}
+
+func compareOrdered[T float64 | string](op string, l, r T) bool {
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	default:
+		return l >= r
+	}
+}
+
+func equal(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// contains reports whether a list holds the value, a map has the key or a string the substring.
+func contains(container, value any) (bool, error) {
+	switch c := container.(type) {
+	case nil:
+		return false, nil
+	case []any:
+		for _, item := range c {
+			if equal(item, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]any:
+		key, ok := value.(string)
+		if !ok {
+			return false, fmt.Errorf("map keys are strings, not %s", typeName(value))
+		}
+		_, found := c[key]
+		return found, nil
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot look up %s in a string", typeName(value))
+		}
+		return strings.Contains(c, s), nil
+	default:
+		return false, fmt.Errorf("cannot look up values in %s", typeName(container))
+	}
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n *callNode) eval(vars map[string]any) (any, error) {
+	if n.name == "all" || n.name == "any" {
+		return n.evalQuantifier(vars)
+	}
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch n.name {
+	case "len":
+		switch v := args[0].(type) {
+		case nil:
+			return float64(0), nil
+		case string:
+			return float64(len(v)), nil
+		case []any:
+			return float64(len(v)), nil
+		case map[string]any:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("len: unsupported %s", typeName(args[0]))
+	case "contains":
+		return contains(args[0], args[1])
+	}
+
+	// The other functions operate on strings; null is the empty string.
+	strs := make([]string, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case nil:
+		case string:
+			strs[i] = v
+		default:
+			return nil, fmt.Errorf("%s: expected a string but got %s", n.name, typeName(a))
+		}
+	}
+	switch n.name {
+	case "lower":
+		return strings.ToLower(strs[0]), nil
+	case "upper":
+		return strings.ToUpper(strs[0]), nil
+	case "startsWith":
+		return strings.HasPrefix(strs[0], strs[1]), nil
+	case "endsWith":
+		return strings.HasSuffix(strs[0], strs[1]), nil
+	default: // matches
+		re, err := regexp.Compile(strs[1])
+		if err != nil {
+			return nil, fmt.Errorf("matches: %w", err)
+		}
+		return re.MatchString(strs[0]), nil
+	}
+}
+
+func (n *callNode) evalQuantifier(vars map[string]any) (any, error) {
+	v, err := n.args[0].eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	var list []any
+	switch l := v.(type) {
+	case nil:
+	case []any:
+		list = l
+	default:
+		return nil, fmt.Errorf("%s: expected a list but got %s", n.name, typeName(v))
+	}
+
+	scope := make(map[string]any, len(vars)+1)
+	for k, v := range vars {
+		scope[k] = v
+	}
+	for _, item := range list {
+		scope["it"] = item
+		ok, err := evalBool(n.args[1], scope)
+		if err != nil {
+			return nil, err
+		}
+		if n.name == "any" && ok {
+			return true, nil
+		}
+		if n.name == "all" && !ok {
+			return false, nil
+		}
+	}
+	return n.name == "all", nil
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "a map"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
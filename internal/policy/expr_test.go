@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Eval(t *testing.T) {
+	vars := map[string]any{
+		"image": map[string]any{
+			"user":   "app",
+			"ports":  []any{float64(80), float64(8080)},
+			"labels": map[string]any{"team": "platform"},
+		},
+		"dockerfile": map[string]any{
+			"bases": []any{
+				map[string]any{"registry": "docker.io", "repository": "library/golang"},
+				map[string]any{"registry": "gcr.io", "repository": "distroless/static"},
+			},
+		},
+	}
+
+	for _, c := range []struct {
+		expr string
+		want any
+	}{
+		{expr: `image.user == "app"`, want: true},
+		{expr: `image.user != 'app'`, want: false},
+		{expr: `!(image.user == "root") && image.user != ""`, want: true},
+		{expr: `image.user == "root" || len(image.ports) == 2`, want: true},
+		{expr: `image.ports[1] >= 1024`, want: true},
+		{expr: `image.ports[5]`, want: nil},
+		{expr: `all(image.ports, it >= 1024)`, want: false},
+		{expr: `any(image.ports, it >= 1024)`, want: true},
+		{expr: `all(image.missing, it > 0)`, want: true},
+		{expr: `image.labels["team"]`, want: "platform"},
+		{expr: `image.labels.owner == null`, want: true},
+		{expr: `"team" in image.labels`, want: true},
+		{expr: `80 in image.ports`, want: true},
+		{expr: `"pp" in image.user`, want: true},
+		{expr: `contains(image.labels, "owner")`, want: false},
+		{expr: `all(dockerfile.bases, it.registry in ["docker.io", "gcr.io"])`, want: true},
+		{expr: `any(dockerfile.bases, startsWith(it.repository, "library/"))`, want: true},
+		{expr: `endsWith(upper(image.user), "PP") && lower("A") == "a"`, want: true},
+		{expr: `matches(image.user, "^[a-z]+$")`, want: true},
+		{expr: `"a" < "b" && 1.5 <= 2 && 3 > 2`, want: true},
+	} {
+		t.Run(c.expr, func(t *testing.T) {
+			e, err := Compile(c.expr)
+			require.NoError(t, err)
+			got, err := e.Eval(vars)
+			require.NoError(t, err)
+			require.Equal(t, c.want, got)
+		})
+	}
+}
+
+func Test_EvalErrors(t *testing.T) {
+	vars := map[string]any{"image": map[string]any{"user": "app"}}
+	for _, c := range []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: `unknown == 1`, wantErr: "unknown variable unknown"},
+		{expr: `image.user < 1`, wantErr: "cannot compare a string < a number"},
+		{expr: `image.user && true`, wantErr: "expected a boolean but got a string"},
+		{expr: `all(image.user, true)`, wantErr: "all: expected a list but got a string"},
+		{expr: `matches(image.user, "[")`, wantErr: "matches:"},
+	} {
+		t.Run(c.expr, func(t *testing.T) {
+			e, err := Compile(c.expr)
+			require.NoError(t, err)
+			_, err = e.Eval(vars)
+			require.ErrorContains(t, err, c.wantErr)
+		})
+	}
+
+	e, err := Compile(`image.user`)
+	require.NoError(t, err)
+	_, err = e.EvalBool(vars)
+	require.ErrorContains(t, err, "expression returned a string instead of a boolean")
+}
+
+func Test_CompileErrors(t *testing.T) {
+	for _, c := range []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: `image.user ==`, wantErr: "position 14: unexpected end of expression"},
+		{expr: `"unterminated`, wantErr: "unterminated string"},
+		{expr: `image.user # 1`, wantErr: "unexpected character '#'"},
+		{expr: `size(image)`, wantErr: "unknown function size"},
+		{expr: `len(a, b)`, wantErr: "len expects 1 arguments, got 2"},
+		{expr: `(true`, wantErr: `expected ")"`},
+		{expr: `true true`, wantErr: `unexpected "true"`},
+		{expr: `image.1`, wantErr: `expected a field name`},
+	} {
+		t.Run(c.expr, func(t *testing.T) {
+			_, err := Compile(c.expr)
+			require.ErrorContains(t, err, c.wantErr)
+		})
+	}
+}
+
+func Test_uses(t *testing.T) {
+	e, err := Compile(`all(dockerfile.bases, it.registry == "gcr.io") && len(image.ports) == 0`)
+	require.NoError(t, err)
+	require.True(t, e.uses("image"))
+	require.True(t, e.uses("dockerfile"))
+	require.False(t, e.uses("base"))
+}
@@ -0,0 +1,204 @@
+// Package policy evaluates policy-as-code rules against the facts of an image build.
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule severities. Violations of error rules fail the build.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Phase names select the facts a rule is evaluated against.
+const (
+	// PhaseDockerfile rules only use the dockerfile variable and run before building.
+	PhaseDockerfile = "dockerfile"
+	// PhaseImage rules use the image variable and run once the image is built.
+	PhaseImage = "image"
+)
+
+// Rule is a policy rule. The rule is violated when Assert evaluates to false.
+type Rule struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Severity is error, warning or info, defaults to error.
+	Severity string `yaml:"severity"`
+	// When is an optional condition under which the rule applies.
+	When   string `yaml:"when"`
+	Assert string `yaml:"assert"`
+
+	when   *Expr
+	assert *Expr
+	phase  string
+}
+
+// Phase returns the phase the rule is evaluated in.
+func (r *Rule) Phase() string {
+	return r.phase
+}
+
+// Policy is a set of rules.
+type Policy struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Load reads a policy file.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse reads a YAML policy and compiles its rules.
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if len(p.Rules) == 0 {
+		return nil, fmt.Errorf("policy has no rules")
+	}
+
+	names := map[string]bool{}
+	for i, r := range p.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate rule %s", r.Name)
+		}
+		names[r.Name] = true
+
+		switch r.Severity {
+		case "":
+			r.Severity = SeverityError
+		case SeverityError, SeverityWarning, SeverityInfo:
+		default:
+			return nil, fmt.Errorf("rule %s: invalid severity %q", r.Name, r.Severity)
+		}
+		if strings.TrimSpace(r.Assert) == "" {
+			return nil, fmt.Errorf("rule %s has no assert expression", r.Name)
+		}
+		var err error
+		if r.assert, err = Compile(r.Assert); err != nil {
+			return nil, fmt.Errorf("rule %s: assert: %w", r.Name, err)
+		}
+		if strings.TrimSpace(r.When) != "" {
+			if r.when, err = Compile(r.When); err != nil {
+				return nil, fmt.Errorf("rule %s: when: %w", r.Name, err)
+			}
+		}
+
+		r.phase = PhaseDockerfile
+		if r.assert.uses(PhaseImage) || r.when != nil && r.when.uses(PhaseImage) {
+			r.phase = PhaseImage
+		}
+	}
+	return p, nil
+}
+
+// Violation is a rule which is not satisfied or cannot be evaluated.
+type Violation struct {
+	Rule        string `json:"rule"`
+	Severity    string `json:"severity"`
+	Description string `json:"description,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (v Violation) String() string {
+	s := v.Rule
+	if v.Description != "" {
+		s += ": " + v.Description
+	}
+	if v.Error != "" {
+		s += " (" + v.Error + ")"
+	}
+	return s
+}
+
+// Evaluate checks the rules of the phase against the variables.
+func (p *Policy) Evaluate(phase string, vars map[string]any) []Violation {
+	var violations []Violation
+	for _, r := range p.Rules {
+		if r.phase != phase {
+			continue
+		}
+		ok, err := r.evaluate(vars)
+		if ok {
+			continue
+		}
+		v := Violation{Rule: r.Name, Severity: r.Severity, Description: r.Description}
+		if err != nil {
+			v.Error = err.Error()
+		}
+		violations = append(violations, v)
+	}
+	return violations
+}
+
+func (r *Rule) evaluate(vars map[string]any) (bool, error) {
+	if r.when != nil {
+		applies, err := r.when.EvalBool(vars)
+		if err != nil {
+			return false, err
+		}
+		if !applies {
+			return true, nil
+		}
+	}
+	return r.assert.EvalBool(vars)
+}
+
+// Report lists the violations of a policy.
+type Report struct {
+	Violations []Violation `json:"violations"`
+}
+
+// Failed reports whether an error rule is violated.
+func (r *Report) Failed() bool {
+	for _, v := range r.Violations {
+		if v.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns the violated error rules.
+func (r *Report) Errors() []string {
+	var names []string
+	for _, v := range r.Violations {
+		if v.Severity == SeverityError {
+			names = append(names, v.Rule)
+		}
+	}
+	return names
+}
+
+func (r *Report) String() string {
+	if len(r.Violations) == 0 {
+		return "Policy: all rules passed\n"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Policy: %d rules violated\n", len(r.Violations))
+	for _, v := range r.Violations {
+		fmt.Fprintf(&sb, "  %-7s  %s\n", v.Severity, v)
+	}
+	return sb.String()
+}
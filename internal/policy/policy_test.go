@@ -0,0 +1,100 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `rules:
+  - name: non-root
+    description: Images must not run as root
+    assert: image.user != "" && image.user != "root"
+  - name: healthcheck
+    severity: warning
+    assert: image.healthcheck
+  - name: approved-registries
+    severity: info
+    assert: all(dockerfile.bases, it.registry == "gcr.io")
+  - name: pinned-base
+    when: dockerfile.base != null
+    assert: dockerfile.base.digest != ""
+`
+
+func Test_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testPolicy), 0644))
+
+	p, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, p.Rules, 4)
+	require.Equal(t, SeverityError, p.Rules[0].Severity)
+	require.Equal(t, PhaseImage, p.Rules[0].Phase())
+	require.Equal(t, PhaseImage, p.Rules[1].Phase())
+	require.Equal(t, PhaseDockerfile, p.Rules[2].Phase())
+	require.Equal(t, PhaseDockerfile, p.Rules[3].Phase())
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorContains(t, err, "read policy")
+}
+
+func Test_ParseErrors(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{name: "no rules", policy: "rules: []\n", wantErr: "policy has no rules"},
+		{name: "unknown field", policy: "rules:\n  - name: a\n    assert: true\n    level: error\n", wantErr: "field level not found"},
+		{name: "missing name", policy: "rules:\n  - assert: true\n", wantErr: "rule 1 has no name"},
+		{name: "duplicate", policy: "rules:\n  - name: a\n    assert: true\n  - name: a\n    assert: true\n", wantErr: "duplicate rule a"},
+		{name: "severity", policy: "rules:\n  - name: a\n    severity: fatal\n    assert: true\n", wantErr: `rule a: invalid severity "fatal"`},
+		{name: "missing assert", policy: "rules:\n  - name: a\n", wantErr: "rule a has no assert expression"},
+		{name: "invalid assert", policy: "rules:\n  - name: a\n    assert: 'a =='\n", wantErr: "rule a: assert: invalid expression"},
+		{name: "invalid when", policy: "rules:\n  - name: a\n    when: (\n    assert: true\n", wantErr: "rule a: when: invalid expression"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Parse([]byte(c.policy))
+			require.ErrorContains(t, err, c.wantErr)
+		})
+	}
+}
+
+func Test_Evaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+
+	vars := map[string]any{
+		"dockerfile": map[string]any{
+			"bases": []any{map[string]any{"registry": "docker.io", "digest": ""}},
+			"base":  map[string]any{"registry": "docker.io", "digest": ""},
+		},
+	}
+	report := &Report{Violations: p.Evaluate(PhaseDockerfile, vars)}
+	require.Equal(t, []Violation{
+		{Rule: "approved-registries", Severity: SeverityInfo},
+		{Rule: "pinned-base", Severity: SeverityError},
+	}, report.Violations)
+	require.True(t, report.Failed())
+	require.Equal(t, []string{"pinned-base"}, report.Errors())
+
+	vars["dockerfile"] = map[string]any{"bases": []any{}, "base": nil}
+	require.Empty(t, p.Evaluate(PhaseDockerfile, vars))
+
+	vars["image"] = map[string]any{"user": "root", "healthcheck": false}
+	report = &Report{Violations: p.Evaluate(PhaseImage, vars)}
+	require.Equal(t, "Policy: 2 rules violated\n"+
+		"  error    non-root: Images must not run as root\n"+
+		"  warning  healthcheck\n", report.String())
+
+	vars["image"] = map[string]any{"user": "app"}
+	report = &Report{Violations: p.Evaluate(PhaseImage, vars)}
+	require.Equal(t, []Violation{
+		{Rule: "healthcheck", Severity: SeverityWarning, Error: "expression returned null instead of a boolean"},
+	}, report.Violations)
+	require.False(t, report.Failed())
+
+	require.Equal(t, "Policy: all rules passed\n", (&Report{}).String())
+}
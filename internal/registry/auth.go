@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credential is the username and password used for a registry.
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Credentials maps normalized registry names to their credential.
+type Credentials map[string]Credential
+
+// dockerConfig is the subset of ~/.docker/config.json holding static credentials.
+type dockerConfig struct {
+	Auths map[string]struct {
+		// Auth is the base64 encoded credentials for the registry.
+		Auth     string `json:"auth,omitempty"`
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty"`
+	} `json:"auths"`
+}
+
+// LoadDockerConfig reads the credentials of $DOCKER_CONFIG/config.json, falling back
+// to ~/.docker/config.json. Missing files result in empty credentials.
+func LoadDockerConfig() (Credentials, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credentials{}, nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	return ReadDockerConfig(filepath.Join(dir, "config.json"))
+}
+
+// ReadDockerConfig reads the static credentials of a docker config file.
+func ReadDockerConfig(path string) (Credentials, error) {
+	creds := Credentials{}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return creds, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read docker config: %w", err)
+	}
+
+	var cfg dockerConfig
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse docker config %s: %w", path, err)
+	}
+	for registry, auth := range cfg.Auths {
+		cred := Credential{Username: auth.Username, Password: auth.Password}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("decode docker config credentials for %s: %w", registry, err)
+			}
+			cred.Username, cred.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		creds[NormalizeRegistry(registry)] = cred
+	}
+	return creds, nil
+}
+
+// challenge is a parsed WWW-Authenticate header.
+type challenge struct {
+	Scheme string
+	Params map[string]string
+}
+
+func parseChallenge(header string) challenge {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	c := challenge{Scheme: strings.ToLower(scheme), Params: map[string]string{}}
+	for rest != "" {
+		var kv string
+		rest = strings.TrimSpace(rest)
+		if i := indexUnquoted(rest, ','); i >= 0 {
+			kv, rest = rest[:i], rest[i+1:]
+		} else {
+			kv, rest = rest, ""
+		}
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			continue
+		}
+		c.Params[strings.ToLower(k)] = strings.Trim(v, `"`)
+	}
+	return c
+}
+
+func indexUnquoted(s string, sep byte) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// tokenRequest builds the request for a bearer token answering the challenge.
+func tokenRequest(c challenge, scope string, cred Credential) (*http.Request, error) {
+	realm := c.Params["realm"]
+	if realm == "" {
+		return nil, fmt.Errorf("bearer challenge without realm")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return nil, fmt.Errorf("parse token realm: %w", err)
+	}
+	q := u.Query()
+	if service := c.Params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	if c.Params["scope"] != "" {
+		scope = c.Params["scope"]
+	}
+	if scope != "" {
+		q.Set("scope", scope)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Username != "" || cred.Password != "" {
+		req.SetBasicAuth(cred.Username, cred.Password)
+	}
+	return req, nil
+}
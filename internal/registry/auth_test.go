@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReadDockerConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+  "auths": {
+    "https://index.docker.io/v1/": {"auth": "dXNlcjpzZWNyZXQ="},
+    "my.registry": {"username": "robot", "password": "p4ss"}
+  }
+}`), 0600))
+
+	creds, err := ReadDockerConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, Credentials{
+		"docker.io":   {Username: "user", Password: "secret"},
+		"my.registry": {Username: "robot", Password: "p4ss"},
+	}, creds)
+
+	creds, err = ReadDockerConfig(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+	require.Empty(t, creds)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"auths": {"x": {"auth": "%%%"}}}`), 0600))
+	_, err = ReadDockerConfig(path)
+	require.Error(t, err)
+}
+
+func Test_LoadDockerConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"auths": {"gcr.io": {"username": "a", "password": "b"}}}`), 0600))
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	creds, err := LoadDockerConfig()
+	require.NoError(t, err)
+	require.Equal(t, Credential{Username: "a", Password: "b"}, creds["gcr.io"])
+}
+
+func Test_parseChallenge(t *testing.T) {
+	c := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull,push"`)
+	require.Equal(t, "bearer", c.Scheme)
+	require.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/alpine:pull,push",
+	}, c.Params)
+
+	c = parseChallenge(`Basic realm="registry"`)
+	require.Equal(t, "basic", c.Scheme)
+}
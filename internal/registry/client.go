@@ -0,0 +1,412 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Media types of the manifests understood by the client.
+const (
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifestV2   = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// maxManifestSize bounds the manifests read into memory.
+const maxManifestSize = 4 << 20
+
+var manifestAccept = strings.Join([]string{
+	MediaTypeOCIIndex,
+	MediaTypeOCIManifest,
+	MediaTypeDockerManifestList,
+	MediaTypeDockerManifestV2,
+}, ", ")
+
+// HTTPClient defines the methods that we need for our HTTP client.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Platform identifies the operating system and architecture of an image.
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Descriptor references a manifest or blob by digest.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *Platform         `json:"platform,omitempty"`
+}
+
+// Manifest is an image manifest or an image index.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers,omitempty"`
+	Manifests     []Descriptor      `json:"manifests,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// IsIndex reports whether the manifest lists platform specific manifests.
+func (m *Manifest) IsIndex() bool {
+	return m.MediaType == MediaTypeOCIIndex || m.MediaType == MediaTypeDockerManifestList || len(m.Manifests) > 0
+}
+
+// Client talks to OCI distribution API compatible registries.
+type Client struct {
+	// HTTP performs the requests.
+	HTTP HTTPClient
+	// Credentials are used to answer authentication challenges.
+	Credentials Credentials
+	// Mirrors maps a registry name to mirror locations ("host[/path]") which are tried before it.
+	Mirrors map[string][]string
+	// PlainHTTP lists registry hosts reached over plain HTTP instead of HTTPS.
+	PlainHTTP map[string]bool
+	// Platform selects the manifest used from an image index, defaults to linux and the current architecture.
+	Platform Platform
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient returns a client using the given HTTP client and credentials.
+func NewClient(httpClient HTTPClient, creds Credentials) *Client {
+	return &Client{HTTP: httpClient, Credentials: creds}
+}
+
+// endpoint is a registry host and the repository path used on it.
+type endpoint struct {
+	host       string
+	repository string
+}
+
+func (c *Client) endpoints(ref Reference) []endpoint {
+	var eps []endpoint
+	for _, mirror := range c.Mirrors[ref.Registry] {
+		host, prefix, _ := strings.Cut(strings.TrimSuffix(mirror, "/"), "/")
+		repository := ref.Repository
+		if prefix != "" {
+			repository = prefix + "/" + repository
+		}
+		eps = append(eps, endpoint{host: host, repository: repository})
+	}
+	return append(eps, endpoint{host: apiHost(ref.Registry), repository: ref.Repository})
+}
+
+func (c *Client) baseURL(host string) string {
+	if c.PlainHTTP[host] || c.PlainHTTP[NormalizeRegistry(host)] {
+		return "http://" + host
+	}
+	return "https://" + host
+}
+
+// Ping checks that host serves the registry API without authenticating.
+// Unauthorized responses count as available.
+func (c *Client) Ping(ctx context.Context, host string) error {
+	u := c.baseURL(host) + "/v2/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return &StatusError{Method: http.MethodGet, URL: u, StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(body))}
+	}
+	return nil
+}
+
+// Manifest fetches the manifest or index referenced by ref.
+func (c *Client) Manifest(ctx context.Context, ref Reference) (*Manifest, Descriptor, error) {
+	var lastErr error
+	for _, ep := range c.endpoints(ref) {
+		m, desc, err := c.manifest(ctx, ep, ref.Identifier())
+		if err == nil {
+			if ref.Digest != "" && desc.Digest != ref.Digest {
+				return nil, Descriptor{}, fmt.Errorf("manifest %s has digest %s", ref, desc.Digest)
+			}
+			return m, desc, nil
+		}
+		lastErr = err
+	}
+	return nil, Descriptor{}, lastErr
+}
+
+// ImageManifest fetches the image manifest referenced by ref, resolving image indexes
+// to the manifest matching the client platform. The returned descriptor is the one of ref itself.
+func (c *Client) ImageManifest(ctx context.Context, ref Reference) (*Manifest, Descriptor, error) {
+	m, desc, err := c.Manifest(ctx, ref)
+	if err != nil || !m.IsIndex() {
+		return m, desc, err
+	}
+
+	platform := c.platform()
+	var selected *Descriptor
+	for i, d := range m.Manifests {
+		if d.Platform != nil && d.Platform.OS == platform.OS && d.Platform.Architecture == platform.Architecture &&
+			(platform.Variant == "" || d.Platform.Variant == platform.Variant) {
+			selected = &m.Manifests[i]
+			break
+		}
+	}
+	if selected == nil {
+		return nil, Descriptor{}, fmt.Errorf("no manifest for platform %s/%s in %s", platform.OS, platform.Architecture, ref)
+	}
+	image, _, err := c.Manifest(ctx, ref.WithDigest(selected.Digest))
+	return image, desc, err
+}
+
+func (c *Client) platform() Platform {
+	if c.Platform.OS != "" {
+		return c.Platform
+	}
+	return Platform{OS: "linux", Architecture: runtime.GOARCH}
+}
+
+func (c *Client) manifest(ctx context.Context, ep endpoint, identifier string) (*Manifest, Descriptor, error) {
+	header := http.Header{"Accept": []string{manifestAccept}}
+	resp, err := c.do(ctx, http.MethodGet, ep, "/manifests/"+identifier, header)
+	if err != nil {
+		return nil, Descriptor{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, Descriptor{}, fmt.Errorf("read manifest: %w", err)
+	}
+	if len(body) > maxManifestSize {
+		return nil, Descriptor{}, fmt.Errorf("manifest exceeds %d bytes", maxManifestSize)
+	}
+
+	var m Manifest
+	if err = json.Unmarshal(body, &m); err != nil {
+		return nil, Descriptor{}, fmt.Errorf("parse manifest: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	desc := Descriptor{
+		MediaType: m.MediaType,
+		Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+		Size:      int64(len(body)),
+	}
+	if desc.MediaType == "" {
+		desc.MediaType = strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+		m.MediaType = desc.MediaType
+	}
+	return &m, desc, nil
+}
+
+// PutManifest uploads the manifest to the repository of ref under its tag, or its digest
+// when not tagged, and returns its descriptor. Mirrors are not used.
+func (c *Client) PutManifest(ctx context.Context, ref Reference, mediaType string, content []byte) (Descriptor, error) {
+	host := apiHost(ref.Registry)
+	identifier := ref.Tag
+	if identifier == "" {
+		identifier = ref.Digest
+	}
+	u := c.baseURL(host) + "/v2/" + ref.Repository + "/manifests/" + identifier
+	scope := "repository:" + ref.Repository + ":pull,push"
+	resp, err := c.request(ctx, http.MethodPut, host, u, scope, http.Header{"Content-Type": []string{mediaType}}, content)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	resp.Body.Close()
+	sum := sha256.Sum256(content)
+	return Descriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: int64(len(content))}, nil
+}
+
+// Blob opens the blob described by desc. The content is verified against the
+// descriptor digest when the returned reader reaches EOF.
+func (c *Client) Blob(ctx context.Context, ref Reference, desc Descriptor) (io.ReadCloser, error) {
+	var lastErr error
+	for _, ep := range c.endpoints(ref) {
+		resp, err := c.do(ctx, http.MethodGet, ep, "/blobs/"+desc.Digest, nil)
+		if err == nil {
+			return newVerifyingReader(resp.Body, desc.Digest)
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// ReadBlob reads a small blob, such as an image configuration, into memory.
+func (c *Client) ReadBlob(ctx context.Context, ref Reference, desc Descriptor) ([]byte, error) {
+	r, err := c.Blob(ctx, ref, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(io.LimitReader(r, maxManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read blob %s: %w", desc.Digest, err)
+	}
+	if len(b) > maxManifestSize {
+		return nil, fmt.Errorf("blob %s exceeds %d bytes", desc.Digest, maxManifestSize)
+	}
+	return b, nil
+}
+
+// do performs an API request for the repository of ep, answering authentication challenges.
+func (c *Client) do(ctx context.Context, method string, ep endpoint, path string, header http.Header) (*http.Response, error) {
+	u := c.baseURL(ep.host) + "/v2/" + ep.repository + path
+	scope := "repository:" + ep.repository + ":pull"
+	return c.request(ctx, method, ep.host, u, scope, header, nil)
+}
+
+func (c *Client) request(ctx context.Context, method, host, u, scope string, header http.Header, body []byte) (*http.Response, error) {
+	newRequest := func(authorization string) (*http.Request, error) {
+		var content io.Reader
+		if body != nil {
+			content = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u, content)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return req, nil
+	}
+
+	tokenKey := host + " " + scope
+	c.mu.Lock()
+	authorization := c.tokens[tokenKey]
+	c.mu.Unlock()
+
+	req, err := newRequest(authorization)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, u, err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challengeHeader := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authorization, err = c.authorize(ctx, host, scope, parseChallenge(challengeHeader))
+		if err != nil {
+			return nil, fmt.Errorf("authenticate to %s: %w", host, err)
+		}
+		c.mu.Lock()
+		if c.tokens == nil {
+			c.tokens = map[string]string{}
+		}
+		c.tokens[tokenKey] = authorization
+		c.mu.Unlock()
+
+		if req, err = newRequest(authorization); err != nil {
+			return nil, err
+		}
+		if resp, err = c.HTTP.Do(req); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", method, u, err)
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, &StatusError{Method: method, URL: u, StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(body))}
+	}
+	return resp, nil
+}
+
+// authorize answers a WWW-Authenticate challenge and returns the Authorization header value.
+func (c *Client) authorize(ctx context.Context, host, scope string, ch challenge) (string, error) {
+	cred := c.Credentials[NormalizeRegistry(host)]
+	switch ch.Scheme {
+	case "basic":
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(cred.Username, cred.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		req, err := tokenRequest(ch, scope, cred)
+		if err != nil {
+			return "", err
+		}
+		resp, err := c.HTTP.Do(req.WithContext(ctx))
+		if err != nil {
+			return "", fmt.Errorf("request token: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("request token: unexpected status %s", resp.Status)
+		}
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return "", fmt.Errorf("parse token: %w", err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		return "Bearer " + token.Token, nil
+	default:
+		return "", fmt.Errorf("unsupported authentication scheme %q", ch.Scheme)
+	}
+}
+
+// StatusError is returned for unexpected registry responses.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// verifyingReader checks the digest of the content once it was read completely.
+type verifyingReader struct {
+	io.ReadCloser
+	hash   hash.Hash
+	digest string
+}
+
+func newVerifyingReader(rc io.ReadCloser, digest string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(digest, "sha256:") {
+		rc.Close()
+		return nil, fmt.Errorf("unsupported digest algorithm: %s", digest)
+	}
+	return &verifyingReader{ReadCloser: rc, hash: sha256.New(), digest: digest}, nil
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := "sha256:" + hex.EncodeToString(r.hash.Sum(nil)); actual != r.digest {
+			return n, fmt.Errorf("blob digest mismatch: expected %s, got %s", r.digest, actual)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,192 @@
+package registry_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(r *testharness.Registry) *registry.Client {
+	c := registry.NewClient(http.DefaultClient, registry.Credentials{r.Host(): {Username: "user", Password: "secret"}})
+	c.PlainHTTP = map[string]bool{r.Host(): true}
+	return c
+}
+
+// storedManifest returns the manifest stored in the registry.
+func storedManifest(t *testing.T, r *testharness.Registry, repository, ref string) registry.Manifest {
+	_, content, ok := r.Manifest(repository, ref)
+	require.True(t, ok)
+	var m registry.Manifest
+	require.NoError(t, json.Unmarshal(content, &m))
+	return m
+}
+
+// requestPaths returns the paths requested from the registry.
+func requestPaths(r *testharness.Registry) []string {
+	var paths []string
+	for _, req := range r.Requests() {
+		paths = append(paths, req.Path)
+	}
+	return paths
+}
+
+func Test_ClientManifestAndBlob(t *testing.T) {
+	r := testharness.NewRegistry(t)
+	r.RequireToken("user", "secret", "t0k3n")
+	digest := r.AddImage(t, "team/app", "1.0", image.ConfigFile{OS: "linux"}, []byte("layer-content"))
+	want := storedManifest(t, r, "team/app", "1.0")
+	c := newTestClient(r)
+	ctx := context.Background()
+
+	ref, err := registry.ParseReference(r.Host() + "/team/app:1.0")
+	require.NoError(t, err)
+	m, desc, err := c.Manifest(ctx, ref)
+	require.NoError(t, err)
+	require.Equal(t, want.Layers, m.Layers)
+	require.Equal(t, digest, desc.Digest)
+	require.Equal(t, registry.MediaTypeOCIManifest, desc.MediaType)
+
+	config, err := c.ReadBlob(ctx, ref, m.Config)
+	require.NoError(t, err)
+	var cfg image.ConfigFile
+	require.NoError(t, json.Unmarshal(config, &cfg))
+	require.Equal(t, "linux", cfg.OS)
+
+	// The token is cached for the repository scope.
+	tokenRequests := 0
+	for _, path := range requestPaths(r) {
+		if path == "/token" {
+			tokenRequests++
+		}
+	}
+	require.Equal(t, 1, tokenRequests)
+
+	_, _, err = c.Manifest(ctx, ref.WithDigest("sha256:0000"))
+	require.Error(t, err)
+}
+
+func Test_ClientAuthenticationFailure(t *testing.T) {
+	r := testharness.NewRegistry(t)
+	r.RequireToken("user", "secret", "t0k3n")
+	r.AddImage(t, "team/app", "1.0", image.ConfigFile{})
+	c := newTestClient(r)
+	c.Credentials = nil
+
+	ref, err := registry.ParseReference(r.Host() + "/team/app:1.0")
+	require.NoError(t, err)
+	_, _, err = c.Manifest(context.Background(), ref)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "authenticate to")
+}
+
+func Test_ClientBlobDigestMismatch(t *testing.T) {
+	r := testharness.NewRegistry(t)
+	r.AddImage(t, "team/app", "1.0", image.ConfigFile{}, []byte("layer"))
+	m := storedManifest(t, r, "team/app", "1.0")
+	r.SetBlob(m.Layers[0].Digest, []byte("tampered"))
+	c := newTestClient(r)
+
+	ref, err := registry.ParseReference(r.Host() + "/team/app:1.0")
+	require.NoError(t, err)
+	blob, err := c.Blob(context.Background(), ref, m.Layers[0])
+	require.NoError(t, err)
+	defer blob.Close()
+	_, err = io.ReadAll(blob)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "blob digest mismatch")
+}
+
+func Test_ClientMirrors(t *testing.T) {
+	mirror := testharness.NewRegistry(t)
+	mirror.AddImage(t, "dockerhub/library/alpine", "3", image.ConfigFile{OS: "linux"})
+	c := newTestClient(mirror)
+	c.Mirrors = map[string][]string{registry.DockerHub: {"127.0.0.1:1/unreachable", mirror.Host() + "/dockerhub"}}
+	c.PlainHTTP["127.0.0.1:1"] = true
+
+	ref, err := registry.ParseReference("alpine:3")
+	require.NoError(t, err)
+	m, _, err := c.Manifest(context.Background(), ref)
+	require.NoError(t, err)
+	require.NotEmpty(t, m.Config.Digest)
+	require.Contains(t, requestPaths(mirror), "/v2/dockerhub/library/alpine/manifests/3")
+}
+
+func Test_ClientImageManifestIndex(t *testing.T) {
+	r := testharness.NewRegistry(t)
+	amd64Digest := r.AddImage(t, "team/app", "amd64", image.ConfigFile{Architecture: "amd64"})
+	arm64Digest := r.AddImage(t, "team/app", "arm64", image.ConfigFile{Architecture: "arm64"})
+	index := registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIIndex,
+		Manifests: []registry.Descriptor{
+			{MediaType: registry.MediaTypeOCIManifest, Digest: amd64Digest, Platform: &registry.Platform{OS: "linux", Architecture: "amd64"}},
+			{MediaType: registry.MediaTypeOCIManifest, Digest: arm64Digest, Platform: &registry.Platform{OS: "linux", Architecture: "arm64"}},
+		},
+	}
+	b, err := json.Marshal(index)
+	require.NoError(t, err)
+	indexDigest := r.PutManifest("team/app", "multi", registry.MediaTypeOCIIndex, b)
+	c := newTestClient(r)
+	c.Platform = registry.Platform{OS: "linux", Architecture: "arm64"}
+
+	ref, err := registry.ParseReference(r.Host() + "/team/app:multi")
+	require.NoError(t, err)
+	m, desc, err := c.ImageManifest(context.Background(), ref)
+	require.NoError(t, err)
+	require.Equal(t, indexDigest, desc.Digest)
+	config, err := c.ReadBlob(context.Background(), ref, m.Config)
+	require.NoError(t, err)
+	var cfg image.ConfigFile
+	require.NoError(t, json.Unmarshal(config, &cfg))
+	require.Equal(t, "arm64", cfg.Architecture)
+
+	c.Platform = registry.Platform{OS: "windows", Architecture: "amd64"}
+	_, _, err = c.ImageManifest(context.Background(), ref)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no manifest for platform windows/amd64")
+}
+
+func Test_ClientPutManifest(t *testing.T) {
+	r := testharness.NewRegistry(t)
+	r.RequireToken("user", "secret", "t0k3n")
+	r.AddImage(t, "team/app", "1.0", image.ConfigFile{OS: "linux"})
+	m := storedManifest(t, r, "team/app", "1.0")
+	m.Annotations = map[string]string{"org.opencontainers.image.revision": "0123"}
+	content, err := json.Marshal(m)
+	require.NoError(t, err)
+	c := newTestClient(r)
+
+	ref, err := registry.ParseReference(r.Host() + "/team/app:1.0")
+	require.NoError(t, err)
+	desc, err := c.PutManifest(context.Background(), ref, registry.MediaTypeOCIManifest, content)
+	require.NoError(t, err)
+	require.Equal(t, testharness.Digest(content), desc.Digest)
+	digest, stored, ok := r.Manifest("team/app", "1.0")
+	require.True(t, ok)
+	require.Equal(t, desc.Digest, digest)
+	require.Equal(t, content, stored)
+}
+
+func Test_ClientPing(t *testing.T) {
+	r := testharness.NewRegistry(t)
+	r.RequireToken("user", "secret", "t0k3n")
+	c := newTestClient(r)
+	require.NoError(t, c.Ping(context.Background(), r.Host()))
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+	down := strings.TrimPrefix(srv.URL, "http://")
+	c.PlainHTTP[down] = true
+	var statusErr *registry.StatusError
+	require.ErrorAs(t, c.Ping(context.Background(), down), &statusErr)
+	require.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+}
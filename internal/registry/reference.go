@@ -0,0 +1,104 @@
+// Package registry is a minimal client for the OCI distribution API, used for the
+// pre-flight and post-push registry calls of the wrapper.
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+const (
+	// DockerHub is the registry name used in image references for Docker Hub.
+	DockerHub = "docker.io"
+	// dockerHubAPI is the host serving the Docker Hub distribution API.
+	dockerHubAPI = "registry-1.docker.io"
+)
+
+// Reference identifies an image manifest in a registry.
+type Reference struct {
+	// Registry is the registry name, e.g. docker.io or gcr.io.
+	Registry string
+	// Repository is the repository path within the registry, e.g. library/alpine.
+	Repository string
+	// Tag is the image tag, empty when only a digest is given.
+	Tag string
+	// Digest is the manifest digest, if any.
+	Digest string
+}
+
+// ParseReference parses a docker style image reference, defaulting to the latest tag.
+func ParseReference(s string) (Reference, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(s))
+	if err != nil {
+		return Reference{}, fmt.Errorf("parse image reference %q: %w", s, err)
+	}
+	ref := Reference{
+		Registry:   reference.Domain(named),
+		Repository: reference.Path(named),
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		ref.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		ref.Digest = digested.Digest().String()
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+// Identifier returns the digest when set, the tag otherwise.
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// Name returns the registry and repository of the reference.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// WithDigest returns the reference pinned to the given digest.
+func (r Reference) WithDigest(digest string) Reference {
+	r.Digest = digest
+	return r
+}
+
+// apiHost returns the host serving the distribution API of a registry.
+func apiHost(registry string) string {
+	if registry == DockerHub || registry == "index.docker.io" {
+		return dockerHubAPI
+	}
+	return registry
+}
+
+// NormalizeRegistry maps the spellings used for Docker Hub in docker config
+// files and registry maps to DockerHub and strips schemes and paths.
+func NormalizeRegistry(registry string) string {
+	registry = strings.TrimPrefix(registry, "https://")
+	registry = strings.TrimPrefix(registry, "http://")
+	if i := strings.Index(registry, "/"); i >= 0 {
+		registry = registry[:i]
+	}
+	switch registry {
+	case "index.docker.io", dockerHubAPI:
+		return DockerHub
+	}
+	return registry
+}
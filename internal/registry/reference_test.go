@@ -0,0 +1,44 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseReference(t *testing.T) {
+	for in, want := range map[string]Reference{
+		"alpine":                             {Registry: "docker.io", Repository: "library/alpine", Tag: "latest"},
+		"alpine:3.20":                        {Registry: "docker.io", Repository: "library/alpine", Tag: "3.20"},
+		"my.registry:5000/team/app:1.0":      {Registry: "my.registry:5000", Repository: "team/app", Tag: "1.0"},
+		"gcr.io/project/app@sha256:" + zeros: {Registry: "gcr.io", Repository: "project/app", Digest: "sha256:" + zeros},
+	} {
+		ref, err := ParseReference(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, ref, in)
+	}
+
+	_, err := ParseReference("Invalid:Reference:Format")
+	require.Error(t, err)
+}
+
+const zeros = "0000000000000000000000000000000000000000000000000000000000000000"
+
+func Test_ReferenceString(t *testing.T) {
+	ref := Reference{Registry: "docker.io", Repository: "library/alpine", Tag: "3"}
+	require.Equal(t, "docker.io/library/alpine:3", ref.String())
+	require.Equal(t, "3", ref.Identifier())
+
+	ref = ref.WithDigest("sha256:abc")
+	require.Equal(t, "docker.io/library/alpine:3@sha256:abc", ref.String())
+	require.Equal(t, "sha256:abc", ref.Identifier())
+	require.Equal(t, "docker.io/library/alpine", ref.Name())
+}
+
+func Test_NormalizeRegistry(t *testing.T) {
+	require.Equal(t, "docker.io", NormalizeRegistry("https://index.docker.io/v1/"))
+	require.Equal(t, "docker.io", NormalizeRegistry("registry-1.docker.io"))
+	require.Equal(t, "my.registry:5000", NormalizeRegistry("http://my.registry:5000/path"))
+	require.Equal(t, "registry-1.docker.io", apiHost("docker.io"))
+	require.Equal(t, "gcr.io", apiHost("gcr.io"))
+}
@@ -0,0 +1,340 @@
+// Package resources samples the memory and CPU time of a process tree from /proc,
+// the memory of its cgroup and the disk usage of a directory while the process runs.
+package resources
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultInterval is the default sampling interval.
+	DefaultInterval = 2 * time.Second
+	// clockTicks is the USER_HZ unit of the CPU times in /proc, 100 on all Linux platforms.
+	clockTicks = 100
+)
+
+// Usage is the peak resource usage of a process tree.
+type Usage struct {
+	// PeakRSS is the highest resident memory of the process tree, in bytes.
+	PeakRSS int64 `json:"peakRss"`
+	// CPUSeconds is the user and system CPU time of the process tree.
+	CPUSeconds float64 `json:"cpuSeconds"`
+	// CgroupPeakMemory and CgroupMemoryLimit are the peak memory and the memory limit of
+	// the cgroup, in bytes, when known. OOMKills counts the processes of the cgroup
+	// killed by the OOM killer while the process ran.
+	CgroupPeakMemory  int64 `json:"cgroupPeakMemory,omitempty"`
+	CgroupMemoryLimit int64 `json:"cgroupMemoryLimit,omitempty"`
+	OOMKills          int   `json:"oomKills,omitempty"`
+	// Dir is the directory whose size and free disk space were sampled, PeakDirSize its
+	// highest size and MinFreeDisk the lowest free space of its file system, in bytes.
+	Dir         string `json:"dir,omitempty"`
+	PeakDirSize int64  `json:"peakDirSize,omitempty"`
+	MinFreeDisk int64  `json:"minFreeDisk,omitempty"`
+}
+
+// Add merges the usage of a process that ran after u.
+func (u *Usage) Add(other *Usage) {
+	u.PeakRSS = max(u.PeakRSS, other.PeakRSS)
+	u.CPUSeconds += other.CPUSeconds
+	u.CgroupPeakMemory = max(u.CgroupPeakMemory, other.CgroupPeakMemory)
+	u.CgroupMemoryLimit = max(u.CgroupMemoryLimit, other.CgroupMemoryLimit)
+	u.OOMKills += other.OOMKills
+	if other.Dir != "" {
+		if u.Dir == "" || other.MinFreeDisk < u.MinFreeDisk {
+			u.MinFreeDisk = other.MinFreeDisk
+		}
+		u.Dir = other.Dir
+		u.PeakDirSize = max(u.PeakDirSize, other.PeakDirSize)
+	}
+}
+
+// Monitor samples the resource usage of a process tree until it is stopped.
+type Monitor struct {
+	// ProcDir and CgroupDir are the mount points of procfs and cgroupfs,
+	// /proc and /sys/fs/cgroup by default.
+	ProcDir   string
+	CgroupDir string
+	// Dir is the directory whose size and free disk space are sampled, if any.
+	Dir string
+	// Interval is the sampling interval, DefaultInterval by default.
+	Interval time.Duration
+	// LowDisk is called once when the free disk space of Dir falls below MinFreeDisk.
+	MinFreeDisk int64
+	LowDisk     func(free int64)
+
+	mu       sync.Mutex
+	pid      int
+	usage    Usage
+	oomKills int
+	lowDisk  bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Start samples the process tree of pid until Stop is called.
+func (m *Monitor) Start(pid int) {
+	if m.ProcDir == "" {
+		m.ProcDir = "/proc"
+	}
+	if m.CgroupDir == "" {
+		m.CgroupDir = "/sys/fs/cgroup"
+	}
+	if m.Interval <= 0 {
+		m.Interval = DefaultInterval
+	}
+	m.pid = pid
+	m.usage = Usage{Dir: m.Dir, MinFreeDisk: -1}
+	m.oomKills = m.cgroupOOMKills()
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	m.Sample()
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.Sample()
+			}
+		}
+	}()
+}
+
+// Stop stops sampling and returns the usage. The CPU time and peak memory are
+// completed from the state of the exited process, if any.
+func (m *Monitor) Stop(state *os.ProcessState) *Usage {
+	close(m.stop)
+	<-m.done
+	m.Sample()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.usage
+	if state != nil {
+		// The rusage of the process includes its waited for children.
+		u.CPUSeconds = max(u.CPUSeconds, (state.UserTime() + state.SystemTime()).Seconds())
+		u.PeakRSS = max(u.PeakRSS, maxRSS(state))
+	}
+	u.CgroupPeakMemory = max(u.CgroupPeakMemory, m.cgroupPeakMemory())
+	u.CgroupMemoryLimit = m.cgroupMemoryLimit()
+	u.OOMKills = max(0, m.cgroupOOMKills()-m.oomKills)
+	if u.MinFreeDisk < 0 {
+		u.Dir, u.MinFreeDisk = "", 0
+	}
+	return &u
+}
+
+// Sample samples the process tree and the directory once.
+func (m *Monitor) Sample() {
+	rss, cpu := m.processTree()
+	var size, free int64 = -1, -1
+	if m.Dir != "" {
+		size = DirSize(m.Dir)
+		if f, err := FreeSpace(m.Dir); err == nil {
+			free = f
+		}
+	}
+
+	m.mu.Lock()
+	m.usage.PeakRSS = max(m.usage.PeakRSS, rss)
+	m.usage.CPUSeconds = max(m.usage.CPUSeconds, cpu)
+	m.usage.CgroupPeakMemory = max(m.usage.CgroupPeakMemory, m.cgroupCurrentMemory())
+	m.usage.PeakDirSize = max(m.usage.PeakDirSize, size)
+	lowDisk := false
+	if free >= 0 {
+		if m.usage.MinFreeDisk < 0 || free < m.usage.MinFreeDisk {
+			m.usage.MinFreeDisk = free
+		}
+		lowDisk = !m.lowDisk && free < m.MinFreeDisk
+		m.lowDisk = m.lowDisk || lowDisk
+	}
+	m.mu.Unlock()
+
+	if lowDisk && m.LowDisk != nil {
+		m.LowDisk(free)
+	}
+}
+
+// processStat is the part of /proc/<pid>/stat used to sample a process.
+type processStat struct {
+	ppid int
+	// cpuTicks is the CPU time of the process and of its waited for children.
+	cpuTicks int64
+	rssPages int64
+}
+
+// readStat parses /proc/<pid>/stat. The fields are counted after the command name,
+// which may contain spaces and parentheses.
+func readStat(path string) (processStat, bool) {
+	var s processStat
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return s, false
+	}
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return s, false
+	}
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 22 {
+		return s, false
+	}
+	num := func(i int) int64 {
+		n, _ := strconv.ParseInt(fields[i], 10, 64)
+		return n
+	}
+	s.ppid = int(num(1))
+	s.cpuTicks = num(11) + num(12) + num(13) + num(14)
+	s.rssPages = num(21)
+	return s, true
+}
+
+// processTree returns the resident memory in bytes and the CPU time of the process
+// tree of m.pid.
+func (m *Monitor) processTree() (rss int64, cpu float64) {
+	entries, err := os.ReadDir(m.ProcDir)
+	if err != nil {
+		return 0, 0
+	}
+	stats := map[int]processStat{}
+	children := map[int][]int{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if s, ok := readStat(filepath.Join(m.ProcDir, e.Name(), "stat")); ok {
+			stats[pid] = s
+			children[s.ppid] = append(children[s.ppid], pid)
+		}
+	}
+
+	var ticks int64
+	pending := []int{m.pid}
+	seen := map[int]bool{}
+	for len(pending) > 0 {
+		pid := pending[0]
+		pending = pending[1:]
+		s, ok := stats[pid]
+		if !ok || seen[pid] {
+			continue
+		}
+		seen[pid] = true
+		rss += s.rssPages * int64(os.Getpagesize())
+		ticks += s.cpuTicks
+		pending = append(pending, children[pid]...)
+	}
+	return rss, float64(ticks) / clockTicks
+}
+
+// cgroupPath returns the directory of the cgroup v2 of the current process, or the
+// memory controller directory of cgroup v1.
+func (m *Monitor) cgroupPath() string {
+	f, err := os.Open(filepath.Join(m.ProcDir, "self", "cgroup"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	// Hybrid hierarchies list the unified cgroup without memory controller too.
+	var unified string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			unified = filepath.Join(m.CgroupDir, parts[2])
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				return filepath.Join(m.CgroupDir, "memory", parts[2])
+			}
+		}
+	}
+	return unified
+}
+
+// readCgroupFile returns the first of the files of the cgroup found, as a number.
+// Unlimited values are returned as 0.
+func (m *Monitor) readCgroupFile(names ...string) int64 {
+	dir := m.cgroupPath()
+	if dir == "" {
+		return 0
+	}
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		n, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		// cgroup v1 reports no limit as a huge page aligned value.
+		if n >= 1<<62 {
+			return 0
+		}
+		return n
+	}
+	return 0
+}
+
+func (m *Monitor) cgroupCurrentMemory() int64 {
+	return m.readCgroupFile("memory.current", "memory.usage_in_bytes")
+}
+
+func (m *Monitor) cgroupPeakMemory() int64 {
+	return m.readCgroupFile("memory.peak", "memory.max_usage_in_bytes")
+}
+
+func (m *Monitor) cgroupMemoryLimit() int64 {
+	return m.readCgroupFile("memory.max", "memory.limit_in_bytes")
+}
+
+// cgroupOOMKills returns the number of processes of the cgroup killed by the OOM killer.
+func (m *Monitor) cgroupOOMKills() int {
+	dir := m.cgroupPath()
+	if dir == "" {
+		return 0
+	}
+	for _, name := range []string{"memory.events", "memory.oom_control"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if count, ok := strings.CutPrefix(line, "oom_kill "); ok {
+				n, _ := strconv.Atoi(strings.TrimSpace(count))
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// DirSize returns the size of the regular files below dir, 0 when it does not exist.
+func DirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		// Files may be removed while walking.
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,127 @@
+package resources
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeStat writes a /proc/<pid>/stat file with the given parent, CPU ticks and resident pages.
+func writeStat(t *testing.T, proc string, pid, ppid int, ticks, pages int64) {
+	fields := make([]string, 50)
+	for i := range fields {
+		fields[i] = "0"
+	}
+	fields[0] = strconv.Itoa(pid)
+	fields[1] = "(kaniko (exec))"
+	fields[2] = "S"
+	fields[3] = strconv.Itoa(ppid)
+	fields[13] = strconv.FormatInt(ticks, 10)
+	fields[23] = strconv.FormatInt(pages, 10)
+	dir := filepath.Join(proc, strconv.Itoa(pid))
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stat"), []byte(strings.Join(fields, " ")+"\n"), 0644))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func Test_readStat(t *testing.T) {
+	proc := t.TempDir()
+	writeStat(t, proc, 42, 1, 250, 10)
+	s, ok := readStat(filepath.Join(proc, "42", "stat"))
+	require.True(t, ok)
+	require.Equal(t, processStat{ppid: 1, cpuTicks: 250, rssPages: 10}, s)
+
+	writeFile(t, filepath.Join(proc, "43", "stat"), "43 (truncated")
+	_, ok = readStat(filepath.Join(proc, "43", "stat"))
+	require.False(t, ok)
+}
+
+func Test_Monitor(t *testing.T) {
+	proc := t.TempDir()
+	// 10 is the executor, 11 and 12 its descendants, 20 an unrelated process.
+	writeStat(t, proc, 10, 1, 100, 100)
+	writeStat(t, proc, 11, 10, 50, 200)
+	writeStat(t, proc, 12, 11, 30, 300)
+	writeStat(t, proc, 20, 1, 1000, 1000)
+	writeFile(t, filepath.Join(proc, "self", "cgroup"), "0::/build\n")
+	cgroup := t.TempDir()
+	writeFile(t, filepath.Join(cgroup, "build", "memory.current"), "1048576\n")
+	writeFile(t, filepath.Join(cgroup, "build", "memory.max"), "2147483648\n")
+	writeFile(t, filepath.Join(cgroup, "build", "memory.events"), "low 0\noom 1\noom_kill 1\n")
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "layers", "a"), "12345")
+
+	var lowDisk []int64
+	m := &Monitor{ProcDir: proc, CgroupDir: cgroup, Dir: dir, MinFreeDisk: 1 << 62, LowDisk: func(free int64) {
+		lowDisk = append(lowDisk, free)
+	}}
+	m.Start(10)
+	// The executor exits once a child was OOM killed and the directory grew.
+	writeStat(t, proc, 12, 11, 30, 900)
+	writeFile(t, filepath.Join(cgroup, "build", "memory.events"), "low 0\noom 2\noom_kill 3\n")
+	writeFile(t, filepath.Join(cgroup, "build", "memory.peak"), "4194304\n")
+	writeFile(t, filepath.Join(dir, "layers", "b"), "67890")
+	usage := m.Stop(nil)
+
+	page := int64(os.Getpagesize())
+	require.Equal(t, 1200*page, usage.PeakRSS)
+	require.Equal(t, 1.8, usage.CPUSeconds)
+	require.Equal(t, int64(4194304), usage.CgroupPeakMemory)
+	require.Equal(t, int64(2147483648), usage.CgroupMemoryLimit)
+	require.Equal(t, 2, usage.OOMKills)
+	require.Equal(t, dir, usage.Dir)
+	require.Equal(t, int64(10), usage.PeakDirSize)
+	require.Positive(t, usage.MinFreeDisk)
+	// The low disk space is reported once.
+	require.Len(t, lowDisk, 1)
+}
+
+func Test_MonitorCgroupV1(t *testing.T) {
+	proc := t.TempDir()
+	writeFile(t, filepath.Join(proc, "self", "cgroup"), "4:memory:/docker/abc\n0::/\n")
+	cgroup := t.TempDir()
+	writeFile(t, filepath.Join(cgroup, "memory", "docker", "abc", "memory.max_usage_in_bytes"), "8192\n")
+	writeFile(t, filepath.Join(cgroup, "memory", "docker", "abc", "memory.limit_in_bytes"), "9223372036854771712\n")
+
+	m := &Monitor{ProcDir: proc, CgroupDir: cgroup}
+	m.Start(10)
+	usage := m.Stop(nil)
+	require.Equal(t, &Usage{CgroupPeakMemory: 8192}, usage)
+}
+
+func Test_MonitorProcess(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done")
+	require.NoError(t, cmd.Start())
+	m := &Monitor{}
+	m.Start(cmd.Process.Pid)
+	require.NoError(t, cmd.Wait())
+	usage := m.Stop(cmd.ProcessState)
+	require.Positive(t, usage.PeakRSS)
+	require.Positive(t, usage.CPUSeconds)
+}
+
+func Test_UsageAdd(t *testing.T) {
+	u := &Usage{}
+	u.Add(&Usage{PeakRSS: 100, CPUSeconds: 1.5, Dir: "/kaniko", PeakDirSize: 10, MinFreeDisk: 500})
+	u.Add(&Usage{PeakRSS: 50, CPUSeconds: 0.5, OOMKills: 1, Dir: "/kaniko", PeakDirSize: 20, MinFreeDisk: 700})
+	u.Add(&Usage{PeakRSS: 70})
+	require.Equal(t, &Usage{PeakRSS: 100, CPUSeconds: 2, OOMKills: 1, Dir: "/kaniko", PeakDirSize: 20, MinFreeDisk: 500}, u)
+}
+
+func Test_DirSize(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), "123")
+	writeFile(t, filepath.Join(dir, "sub", "b"), "4567")
+	require.NoError(t, os.Symlink("a", filepath.Join(dir, "link")))
+	require.Equal(t, int64(7), DirSize(dir))
+	require.Zero(t, DirSize(filepath.Join(dir, "missing")))
+}
@@ -0,0 +1,26 @@
+package resources
+
+import (
+	"os"
+	"syscall"
+)
+
+// FreeSpace returns the disk space available to unprivileged users in the file
+// system of path, in bytes.
+func FreeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// maxRSS returns the peak resident memory of the exited process and of its waited
+// for children, in bytes.
+func maxRSS(state *os.ProcessState) int64 {
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		// Linux reports kilobytes.
+		return rusage.Maxrss * 1024
+	}
+	return 0
+}
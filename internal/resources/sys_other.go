@@ -0,0 +1,17 @@
+//go:build !linux
+
+package resources
+
+import (
+	"errors"
+	"os"
+)
+
+// FreeSpace is only supported on Linux.
+func FreeSpace(path string) (int64, error) {
+	return 0, &os.PathError{Op: "statfs", Path: path, Err: errors.ErrUnsupported}
+}
+
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,274 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scopeName is the instrumentation scope of the exported spans and metrics.
+const scopeName = "github.com/cloudbees-io/kaniko"
+
+// HTTPClient sends the export requests.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// The OTLP/HTTP JSON encoding of the trace and metrics export requests.
+type (
+	keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+	anyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+	resource struct {
+		Attributes []keyValue `json:"attributes"`
+	}
+	scope struct {
+		Name string `json:"name"`
+	}
+	status struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Status            status     `json:"status"`
+	}
+	scopeSpans struct {
+		Scope scope      `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	tracesRequest struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}
+	dataPoint struct {
+		TimeUnixNano string     `json:"timeUnixNano"`
+		AsDouble     float64    `json:"asDouble"`
+		Attributes   []keyValue `json:"attributes,omitempty"`
+	}
+	otlpMetric struct {
+		Name  string `json:"name"`
+		Unit  string `json:"unit,omitempty"`
+		Gauge struct {
+			DataPoints []dataPoint `json:"dataPoints"`
+		} `json:"gauge"`
+	}
+	scopeMetrics struct {
+		Scope   scope        `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	resourceMetrics struct {
+		Resource     resource       `json:"resource"`
+		ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+	}
+	metricsRequest struct {
+		ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+	}
+)
+
+// Status codes of OTLP spans.
+const (
+	statusOK    = 1
+	statusError = 2
+	// spanKindInternal is the kind of all spans of the build.
+	spanKindInternal = 1
+)
+
+func attributes(m map[string]any) []keyValue {
+	var kvs []keyValue
+	for _, key := range sortedKeys(m) {
+		var v anyValue
+		switch value := m[key].(type) {
+		case bool:
+			v.BoolValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &value
+		case string:
+			v.StringValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		kvs = append(kvs, keyValue{Key: key, Value: v})
+	}
+	return kvs
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// TracesJSON returns the OTLP JSON trace export request of the recorded spans.
+// Spans not ended yet are ended now.
+func (r *Recorder) TracesJSON() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ss := scopeSpans{Scope: scope{Name: scopeName}, Spans: []otlpSpan{}}
+	for _, s := range r.spans {
+		end := s.EndTime
+		if end.IsZero() {
+			end = r.now()
+		}
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.context.traceID[:]),
+			SpanID:            hex.EncodeToString(s.context.spanID[:]),
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: unixNano(s.StartTime),
+			EndTimeUnixNano:   unixNano(end),
+			Attributes:        attributes(s.Attributes),
+			Status:            status{Code: statusOK},
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.Error != "" {
+			span.Status = status{Code: statusError, Message: s.Error}
+		}
+		ss.Spans = append(ss.Spans, span)
+	}
+	return json.Marshal(tracesRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: attributes(r.Resource)},
+		ScopeSpans: []scopeSpans{ss},
+	}}})
+}
+
+// MetricsJSON returns the OTLP JSON metrics export request of the recorded metrics,
+// as gauges.
+func (r *Recorder) MetricsJSON() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sm := scopeMetrics{Scope: scope{Name: scopeName}, Metrics: []otlpMetric{}}
+	// Data points of the same metric are grouped.
+	index := map[string]int{}
+	for _, m := range r.metrics {
+		i, ok := index[m.Name]
+		if !ok {
+			i = len(sm.Metrics)
+			index[m.Name] = i
+			sm.Metrics = append(sm.Metrics, otlpMetric{Name: m.Name, Unit: m.Unit})
+		}
+		sm.Metrics[i].Gauge.DataPoints = append(sm.Metrics[i].Gauge.DataPoints, dataPoint{
+			TimeUnixNano: unixNano(m.Time),
+			AsDouble:     m.Value,
+			Attributes:   attributes(m.Attributes),
+		})
+	}
+	return json.Marshal(metricsRequest{ResourceMetrics: []resourceMetrics{{
+		Resource:     resource{Attributes: attributes(r.Resource)},
+		ScopeMetrics: []scopeMetrics{sm},
+	}}})
+}
+
+// WriteFile writes the trace and the metrics export requests to path, a JSON
+// document per line, as the file exporter of the OpenTelemetry collector does.
+func (r *Recorder) WriteFile(path string) error {
+	if r == nil {
+		return nil
+	}
+	traces, err := r.TracesJSON()
+	if err != nil {
+		return err
+	}
+	metrics, err := r.MetricsJSON()
+	if err != nil {
+		return err
+	}
+	content := append(append(append(traces, '\n'), metrics...), '\n')
+	return os.WriteFile(path, content, 0640)
+}
+
+// Export sends the spans and metrics to the OTLP/HTTP endpoint, such as
+// http://collector:4318, at its /v1/traces and /v1/metrics paths.
+func (r *Recorder) Export(ctx context.Context, client HTTPClient, endpoint string, headers map[string]string) error {
+	if r == nil {
+		return nil
+	}
+	traces, err := r.TracesJSON()
+	if err != nil {
+		return err
+	}
+	metrics, err := r.MetricsJSON()
+	if err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(endpoint, "/")
+	if err = post(ctx, client, base+"/v1/traces", headers, traces); err != nil {
+		return err
+	}
+	return post(ctx, client, base+"/v1/metrics", headers, metrics)
+}
+
+func post(ctx context.Context, client HTTPClient, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("POST %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("POST %s: unexpected status %d: %s", url, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// ParseHeaders parses the comma separated key=value pairs of OTEL_EXPORTER_OTLP_HEADERS,
+// with percent-encoded values, a plus sign not being a space.
+func ParseHeaders(value string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header %q", pair)
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %q: %w", key, err)
+		}
+		headers[strings.TrimSpace(key)] = decoded
+	}
+	return headers, nil
+}
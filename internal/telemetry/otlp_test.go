@@ -0,0 +1,159 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testRecorder returns a Recorder with a failed build span, a push span and a metric.
+func testRecorder(t *testing.T) *Recorder {
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "")
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	t.Setenv("TRACEPARENT", "")
+	r := New("kaniko-action", "v1.2.3")
+	start := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return start }
+
+	build := r.Start(nil, "build")
+	build.SetAttribute("kaniko.backend", "kaniko")
+	push := r.Start(build, "push")
+	push.SetAttribute("kaniko.layers", 3)
+	push.EndAt(start.Add(time.Second), nil)
+	build.EndAt(start.Add(2*time.Second), errors.New("push failed"))
+	r.Record("kaniko.stage.duration", "s", 1.5, map[string]any{"kaniko.stage": "build"})
+	r.Record("kaniko.stage.duration", "s", 0.5, map[string]any{"kaniko.stage": "1"})
+	r.Record("kaniko.cache.hit_ratio", "1", 0.75, nil)
+	return r
+}
+
+func Test_TracesJSON(t *testing.T) {
+	r := testRecorder(t)
+	b, err := r.TracesJSON()
+	require.NoError(t, err)
+
+	spans := r.Spans()
+	traceID := spans[0].TraceID()
+	buildID := spans[0].Traceparent()[36:52]
+	pushID := spans[1].Traceparent()[36:52]
+	require.JSONEq(t, `{"resourceSpans": [{
+  "resource": {"attributes": [
+    {"key": "service.name", "value": {"stringValue": "kaniko-action"}},
+    {"key": "service.version", "value": {"stringValue": "v1.2.3"}}
+  ]},
+  "scopeSpans": [{
+    "scope": {"name": "github.com/cloudbees-io/kaniko"},
+    "spans": [
+      {
+        "traceId": "`+traceID+`", "spanId": "`+buildID+`", "name": "build", "kind": 1,
+        "startTimeUnixNano": "1700000000000000000", "endTimeUnixNano": "1700000002000000000",
+        "attributes": [{"key": "kaniko.backend", "value": {"stringValue": "kaniko"}}],
+        "status": {"code": 2, "message": "push failed"}
+      },
+      {
+        "traceId": "`+traceID+`", "spanId": "`+pushID+`", "parentSpanId": "`+buildID+`", "name": "push", "kind": 1,
+        "startTimeUnixNano": "1700000000000000000", "endTimeUnixNano": "1700000001000000000",
+        "attributes": [{"key": "kaniko.layers", "value": {"intValue": "3"}}],
+        "status": {"code": 1}
+      }
+    ]
+  }]
+}]}`, string(b))
+}
+
+func Test_MetricsJSON(t *testing.T) {
+	b, err := testRecorder(t).MetricsJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"resourceMetrics": [{
+  "resource": {"attributes": [
+    {"key": "service.name", "value": {"stringValue": "kaniko-action"}},
+    {"key": "service.version", "value": {"stringValue": "v1.2.3"}}
+  ]},
+  "scopeMetrics": [{
+    "scope": {"name": "github.com/cloudbees-io/kaniko"},
+    "metrics": [
+      {"name": "kaniko.stage.duration", "unit": "s", "gauge": {"dataPoints": [
+        {"timeUnixNano": "1700000000000000000", "asDouble": 1.5, "attributes": [{"key": "kaniko.stage", "value": {"stringValue": "build"}}]},
+        {"timeUnixNano": "1700000000000000000", "asDouble": 0.5, "attributes": [{"key": "kaniko.stage", "value": {"stringValue": "1"}}]}
+      ]}},
+      {"name": "kaniko.cache.hit_ratio", "unit": "1", "gauge": {"dataPoints": [
+        {"timeUnixNano": "1700000000000000000", "asDouble": 0.75}
+      ]}}
+    ]
+  }]
+}]}`, string(b))
+}
+
+func Test_WriteFile(t *testing.T) {
+	r := testRecorder(t)
+	path := filepath.Join(t.TempDir(), "telemetry.json")
+	require.NoError(t, r.WriteFile(path))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	require.Len(t, lines, 2)
+	traces, err := r.TracesJSON()
+	require.NoError(t, err)
+	require.Equal(t, string(traces), lines[0])
+	metrics, err := r.MetricsJSON()
+	require.NoError(t, err)
+	require.Equal(t, string(metrics), lines[1])
+}
+
+func Test_Export(t *testing.T) {
+	r := testRecorder(t)
+	received := map[string]map[string]any{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, http.MethodPost, req.Method)
+		require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		require.Equal(t, "Bearer s3cr3t", req.Header.Get("Authorization"))
+		b, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(b, &body))
+		received[req.URL.Path] = body
+	}))
+	defer srv.Close()
+
+	require.NoError(t, r.Export(context.Background(), srv.Client(), srv.URL+"/", map[string]string{"Authorization": "Bearer s3cr3t"}))
+	require.Contains(t, received["/v1/traces"], "resourceSpans")
+	require.Contains(t, received["/v1/metrics"], "resourceMetrics")
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer failing.Close()
+	err := r.Export(context.Background(), failing.Client(), failing.URL, nil)
+	require.EqualError(t, err, "POST "+failing.URL+"/v1/traces: unexpected status 429: quota exceeded")
+}
+
+func Test_ParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders("Authorization=Bearer%20s3cr3t, x-tenant = ci ,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"Authorization": "Bearer s3cr3t", "x-tenant": "ci"}, headers)
+
+	// A plus sign is kept, as in base64 encoded credentials.
+	headers, err = ParseHeaders("Authorization=Basic dXNlcjpw+ss/w==")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"Authorization": "Basic dXNlcjpw+ss/w=="}, headers)
+
+	headers, err = ParseHeaders("")
+	require.NoError(t, err)
+	require.Empty(t, headers)
+
+	_, err = ParseHeaders("Authorization")
+	require.EqualError(t, err, `invalid header "Authorization"`)
+	_, err = ParseHeaders("Authorization=%zz")
+	require.ErrorContains(t, err, `invalid header "Authorization"`)
+}
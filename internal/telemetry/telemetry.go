@@ -0,0 +1,225 @@
+// Package telemetry records the spans and metrics of a build and exports them with
+// the OTLP/HTTP JSON encoding, to an OTLP collector or to a file.
+//
+// All methods are safe to call on a nil Recorder or Span, which record nothing,
+// so that callers need not check whether telemetry is enabled.
+package telemetry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recorder collects the spans and metrics of a process.
+type Recorder struct {
+	// Resource holds the attributes describing the process, such as service.name.
+	Resource map[string]any
+
+	mu      sync.Mutex
+	now     func() time.Time
+	spans   []*Span
+	metrics []*Metric
+	// remote is the span of the calling process, from TRACEPARENT.
+	remote *spanContext
+}
+
+// New returns a Recorder of the named service. The resource attributes are completed
+// by OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES, and spans continue the trace of
+// the TRACEPARENT environment variable when set.
+func New(serviceName, version string) *Recorder {
+	r := &Recorder{
+		Resource: map[string]any{"service.name": serviceName, "service.version": version},
+		now:      time.Now,
+	}
+	for _, attr := range strings.Split(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"), ",") {
+		if key, value, ok := strings.Cut(attr, "="); ok && strings.TrimSpace(key) != "" {
+			r.Resource[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		r.Resource["service.name"] = name
+	}
+	if sc, ok := parseTraceparent(os.Getenv("TRACEPARENT")); ok {
+		r.remote = &sc
+	}
+	return r
+}
+
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+}
+
+// parseTraceparent parses a W3C trace context traceparent header value.
+func parseTraceparent(value string) (spanContext, bool) {
+	var sc spanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != len(sc.traceID) {
+		return sc, false
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != len(sc.spanID) {
+		return sc, false
+	}
+	copy(sc.traceID[:], traceID)
+	copy(sc.spanID[:], spanID)
+	if sc.traceID == [16]byte{} || sc.spanID == [8]byte{} {
+		return sc, false
+	}
+	return sc, true
+}
+
+// Span is a timed operation of a trace.
+type Span struct {
+	Name               string
+	StartTime, EndTime time.Time
+	Attributes         map[string]any
+	// Error is the error the operation failed with, empty on success.
+	Error string
+
+	recorder *Recorder
+	context  spanContext
+	parentID [8]byte
+}
+
+// Start starts a span below parent, or below the span of the calling process when
+// parent is nil.
+func (r *Recorder) Start(parent *Span, name string) *Span {
+	if r == nil {
+		return nil
+	}
+	return r.StartAt(parent, name, r.now())
+}
+
+// StartAt starts a span at the given time, e.g. for operations parsed from logs.
+func (r *Recorder) StartAt(parent *Span, name string, start time.Time) *Span {
+	if r == nil {
+		return nil
+	}
+	s := &Span{Name: name, StartTime: start, Attributes: map[string]any{}, recorder: r}
+	switch {
+	case parent != nil:
+		s.context.traceID = parent.context.traceID
+		s.parentID = parent.context.spanID
+	case r.remote != nil:
+		s.context.traceID = r.remote.traceID
+		s.parentID = r.remote.spanID
+	default:
+		_, _ = rand.Read(s.context.traceID[:])
+	}
+	_, _ = rand.Read(s.context.spanID[:])
+
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+	return s
+}
+
+// SetAttribute sets an attribute of the span, a string, bool, integer or float.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// End ends the span, failed when err is not nil. Ending a span again has no effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.EndAt(s.recorder.now(), err)
+}
+
+// EndAt ends the span at the given time.
+func (s *Span) EndAt(end time.Time, err error) {
+	if s == nil {
+		return
+	}
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	if !s.EndTime.IsZero() {
+		return
+	}
+	s.EndTime = end
+	if err != nil {
+		s.Error = err.Error()
+	}
+}
+
+// Traceparent returns the W3C trace context of the span, to propagate it to child
+// processes in the TRACEPARENT environment variable.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.context.traceID[:]), hex.EncodeToString(s.context.spanID[:]))
+}
+
+// TraceID returns the hexadecimal trace ID of the span.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.context.traceID[:])
+}
+
+// Metric is a gauge value recorded at a point in time.
+type Metric struct {
+	Name       string
+	Unit       string
+	Value      float64
+	Time       time.Time
+	Attributes map[string]any
+}
+
+// Record records the value of a metric.
+func (r *Recorder) Record(name, unit string, value float64, attributes map[string]any) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, &Metric{Name: name, Unit: unit, Value: value, Time: r.now(), Attributes: attributes})
+}
+
+// Spans returns the recorded spans.
+func (r *Recorder) Spans() []*Span {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Span(nil), r.spans...)
+}
+
+// Metrics returns the recorded metrics.
+func (r *Recorder) Metrics() []*Metric {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Metric(nil), r.metrics...)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,89 @@
+package telemetry
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseTraceparent(t *testing.T) {
+	sc, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	require.Equal(t, byte(0x4b), sc.traceID[0])
+	require.Equal(t, byte(0xb7), sc.spanID[7])
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-xyz92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, ok := parseTraceparent(value)
+		require.False(t, ok, value)
+	}
+}
+
+func Test_New(t *testing.T) {
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=ci, team = build,invalid")
+	t.Setenv("OTEL_SERVICE_NAME", "my-builds")
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	r := New("kaniko-action", "v1.2.3")
+	require.Equal(t, map[string]any{
+		"service.name":           "my-builds",
+		"service.version":        "v1.2.3",
+		"deployment.environment": "ci",
+		"team":                   "build",
+	}, r.Resource)
+
+	span := r.Start(nil, "build")
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID())
+	require.Equal(t, [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}, span.parentID)
+}
+
+func Test_Span(t *testing.T) {
+	t.Setenv("TRACEPARENT", "")
+	r := New("kaniko-action", "v1.2.3")
+	start := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return start }
+
+	root := r.Start(nil, "build")
+	require.NotEqual(t, [16]byte{}, root.context.traceID)
+	require.Equal(t, [8]byte{}, root.parentID)
+	child := r.Start(root, "push")
+	require.Equal(t, root.TraceID(), child.TraceID())
+	require.Equal(t, root.context.spanID, child.parentID)
+	require.True(t, strings.HasPrefix(child.Traceparent(), "00-"+root.TraceID()+"-"), child.Traceparent())
+	require.True(t, strings.HasSuffix(child.Traceparent(), "-01"), child.Traceparent())
+
+	child.SetAttribute("kaniko.stage", "build")
+	child.EndAt(start.Add(time.Second), errors.New("denied"))
+	child.End(nil)
+	require.Equal(t, start.Add(time.Second), child.EndTime)
+	require.Equal(t, "denied", child.Error)
+	require.Equal(t, map[string]any{"kaniko.stage": "build"}, child.Attributes)
+	require.Len(t, r.Spans(), 2)
+
+	r.Record("kaniko.build.duration", "s", 12.5, nil)
+	require.Equal(t, []*Metric{{Name: "kaniko.build.duration", Unit: "s", Value: 12.5, Time: start}}, r.Metrics())
+}
+
+func Test_nilRecorder(t *testing.T) {
+	var r *Recorder
+	span := r.Start(nil, "build")
+	require.Nil(t, span)
+	span.SetAttribute("key", "value")
+	span.End(nil)
+	require.Empty(t, span.Traceparent())
+	require.Empty(t, span.TraceID())
+	r.Record("kaniko.build.duration", "s", 1, nil)
+	require.Nil(t, r.Spans())
+	require.Nil(t, r.Metrics())
+	require.NoError(t, r.WriteFile("unused"))
+}
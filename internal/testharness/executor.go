@@ -0,0 +1,189 @@
+package testharness
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// ScenarioFile and InvocationsFile are read and appended to by the fake executor,
+	// from the directory of its binary.
+	ScenarioFile    = "scenario.json"
+	InvocationsFile = "invocations.jsonl"
+
+	// DefaultVersion is the version reported by the fake executor by default.
+	DefaultVersion = "v1.25.16"
+)
+
+// DefaultHelp is the usage printed by the fake executor by default, listing the
+// flags of recent executor releases.
+const DefaultHelp = `Usage:
+  executor [flags]
+  executor [command]
+
+Flags:
+      --build-arg multi-arg type                  This flag allows you to pass in ARG values at build time.
+      --cleanup                                   Clean the filesystem at the end
+  -c, --context string                            Path to the dockerfile build context. (default "/workspace/")
+  -d, --destination multi-arg type                Registry the final image should be pushed to.
+      --digest-file string                        Specify a file to save the digest of the built image to.
+  -f, --dockerfile string                         Path to the dockerfile to be built. (default "Dockerfile")
+      --ignore-path multi-arg type                Ignore these paths when taking a snapshot.
+      --insecure-registry multi-arg type          Insecure registry using plain HTTP to push and pull.
+      --kaniko-dir string                         Path to the kaniko directory. (default "/kaniko")
+      --label multi-arg type                      Set metadata for an image.
+      --no-push                                   Do not push the image to the registry
+      --registry-certificate key-value-arg type   Use the provided certificate for TLS communication with the given registry.
+      --registry-client-cert key-value-arg type   Use the provided client certificate for mutual TLS communication with the given registry.
+      --registry-map multi-key-value-arg type     Registry map of mirror to use as pull-through cache instead.
+      --registry-mirror multi-arg type            Registry mirror to use as pull-through cache instead of docker.io.
+      --reproducible                              Strip timestamps out of the image to make it reproducible
+      --skip-default-registry-fallback            If an image is not found on any mirrors, fail instead of pulling from the default registry.
+      --skip-tls-verify-registry multi-arg type   Insecure registry ignoring TLS verify to push and pull.
+      --tar-path string                           Path to save the image in as a tarball instead of pushing
+      --target string                             Set the target build stage to build
+  -v, --verbosity string                          Log level (trace, debug, info, warn, error, fatal, panic) (default "info")
+`
+
+// Scenario describes how the fake executor behaves.
+type Scenario struct {
+	// Version is printed by "executor version", DefaultVersion when empty.
+	Version string `json:"version,omitempty"`
+	// VersionError makes "executor version" fail, writing it to stderr.
+	VersionError string `json:"versionError,omitempty"`
+	// Help is printed by "executor --help", DefaultHelp when empty.
+	Help string `json:"help,omitempty"`
+	// Log is written to stderr by builds, e.g. the log of a kaniko build.
+	Log string `json:"log,omitempty"`
+	// ExitCode is the exit code of builds; failed builds write no files.
+	ExitCode int `json:"exitCode,omitempty"`
+	// Killed makes builds kill themselves with SIGKILL, as the OOM killer does.
+	Killed bool `json:"killed,omitempty"`
+	// KanikoDirFiles are written by builds into the --kaniko-dir directory, by name.
+	KanikoDirFiles map[string]string `json:"kanikoDirFiles,omitempty"`
+	// Config and Layers are the image built, the layers are uncompressed tarballs.
+	Config image.ConfigFile `json:"config"`
+	Layers [][]byte         `json:"layers,omitempty"`
+	// LayersByBuild replaces Layers for the builds in turn, e.g. to make a rebuild differ.
+	LayersByBuild [][][]byte `json:"layersByBuild,omitempty"`
+	// Digest overrides the digest written to --digest-file.
+	Digest string `json:"digest,omitempty"`
+	// Push pushes the image to the --destination registries over plain HTTP, unless
+	// --no-push is passed.
+	Push bool `json:"push,omitempty"`
+}
+
+// Invocation is a recorded run of the fake executor.
+type Invocation struct {
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+}
+
+// IsBuild reports whether the invocation is a build rather than a version or help probe.
+func (inv Invocation) IsBuild() bool {
+	if len(inv.Args) > 0 && inv.Args[0] == "version" {
+		return false
+	}
+	return !inv.Has("help")
+}
+
+// Has reports whether the --name flag was passed.
+func (inv Invocation) Has(name string) bool {
+	for _, arg := range inv.Args {
+		if arg == "--"+name || strings.HasPrefix(arg, "--"+name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// Flag returns the values of the --name flag, passed as "--name value" or "--name=value".
+func (inv Invocation) Flag(name string) []string {
+	var values []string
+	for i, arg := range inv.Args {
+		if value, ok := strings.CutPrefix(arg, "--"+name+"="); ok {
+			values = append(values, value)
+		} else if arg == "--"+name && i+1 < len(inv.Args) {
+			values = append(values, inv.Args[i+1])
+		}
+	}
+	return values
+}
+
+// Getenv returns the value of the environment variable of the invocation.
+func (inv Invocation) Getenv(key string) string {
+	for _, kv := range inv.Env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// Executor is a fake kaniko executor binary following a scenario.
+type Executor struct {
+	// Path is the executor binary, e.g. for --executor-path.
+	Path string
+	dir  string
+}
+
+// NewExecutor builds the fake executor for the scenario into a temporary directory of
+// the test. The test is skipped when the go command is not available.
+func NewExecutor(t *testing.T, scenario Scenario) *Executor {
+	t.Helper()
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go command is required to build the fake executor")
+	}
+	dir := t.TempDir()
+	e := &Executor{Path: filepath.Join(dir, "executor"), dir: dir}
+	out, err := exec.Command(goCmd, "build", "-o", e.Path, "github.com/cloudbees-io/kaniko/internal/testharness/fakeexecutor").CombinedOutput()
+	require.NoError(t, err, "build fake executor: %s", out)
+
+	b, err := json.Marshal(scenario)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ScenarioFile), b, 0644))
+	return e
+}
+
+// Invocations returns the recorded runs of the executor, in order.
+func (e *Executor) Invocations(t *testing.T) []Invocation {
+	t.Helper()
+	f, err := os.Open(filepath.Join(e.dir, InvocationsFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	defer f.Close()
+
+	var invocations []Invocation
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var inv Invocation
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &inv))
+		invocations = append(invocations, inv)
+	}
+	require.NoError(t, scanner.Err())
+	return invocations
+}
+
+// Builds returns the recorded builds, without the version and help probes.
+func (e *Executor) Builds(t *testing.T) []Invocation {
+	t.Helper()
+	var builds []Invocation
+	for _, inv := range e.Invocations(t) {
+		if inv.IsBuild() {
+			builds = append(builds, inv)
+		}
+	}
+	return builds
+}
@@ -0,0 +1,126 @@
+package testharness
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Invocation(t *testing.T) {
+	inv := Invocation{
+		Args: []string{"--destination", "a:1", "--destination=b:2", "--no-push", "--cleanup"},
+		Env:  []string{"KANIKO_DIR=/kaniko/dir", "EMPTY="},
+	}
+	require.Equal(t, []string{"a:1", "b:2"}, inv.Flag("destination"))
+	require.Empty(t, inv.Flag("tar-path"))
+	require.True(t, inv.Has("no-push"))
+	require.False(t, inv.Has("no"))
+	require.True(t, inv.IsBuild())
+	require.Equal(t, "/kaniko/dir", inv.Getenv("KANIKO_DIR"))
+	require.Empty(t, inv.Getenv("MISSING"))
+
+	require.False(t, Invocation{Args: []string{"version"}}.IsBuild())
+	require.False(t, Invocation{Args: []string{"--help"}}.IsBuild())
+}
+
+func Test_Executor(t *testing.T) {
+	r := NewRegistry(t)
+	layer := []byte("layer")
+	e := NewExecutor(t, Scenario{
+		Log:    "INFO[0000] Built\n",
+		Config: image.ConfigFile{OS: "linux"},
+		Layers: [][]byte{layer},
+		Push:   true,
+	})
+
+	out, err := exec.Command(e.Path, "version").Output()
+	require.NoError(t, err)
+	require.Equal(t, "Kaniko version :  "+DefaultVersion+"\n", string(out))
+	out, err = exec.Command(e.Path, "--help").Output()
+	require.NoError(t, err)
+	require.Equal(t, DefaultHelp, string(out))
+
+	dir := t.TempDir()
+	digestFile := filepath.Join(dir, "digest")
+	tarPath := filepath.Join(dir, "image.tar")
+	cmd := exec.Command(e.Path, "--destination", r.Host()+"/team/app:1.0", "--digest-file", digestFile, "--tarPath", tarPath)
+	cmd.Env = append(os.Environ(), "KANIKO_DIR="+dir)
+	out, err = cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.Contains(t, string(out), "INFO[0000] Built")
+
+	digest, _, ok := r.Manifest("team/app", "1.0")
+	require.True(t, ok)
+	b, err := os.ReadFile(digestFile)
+	require.NoError(t, err)
+	require.Equal(t, digest, string(b))
+
+	tarball, err := image.OpenTarball(tarPath)
+	require.NoError(t, err)
+	require.Equal(t, []string{Digest(layer)}, tarball.Config.RootFS.DiffIDs)
+
+	invocations := e.Invocations(t)
+	require.Len(t, invocations, 3)
+	builds := e.Builds(t)
+	require.Len(t, builds, 1)
+	require.Equal(t, []string{digestFile}, builds[0].Flag("digest-file"))
+	require.Equal(t, dir, builds[0].Getenv("KANIKO_DIR"))
+}
+
+func Test_ExecutorNoPush(t *testing.T) {
+	r := NewRegistry(t)
+	e := NewExecutor(t, Scenario{Digest: "sha256:0123", Push: true})
+	digestFile := filepath.Join(t.TempDir(), "digest")
+	out, err := exec.Command(e.Path, "--destination", r.Host()+"/team/app:1.0", "--digest-file", digestFile, "--no-push").CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	b, err := os.ReadFile(digestFile)
+	require.NoError(t, err)
+	require.Equal(t, "sha256:0123", string(b))
+	require.Empty(t, r.Requests())
+}
+
+func Test_ExecutorFailure(t *testing.T) {
+	e := NewExecutor(t, Scenario{Log: "ERROR: build failed\n", ExitCode: 3})
+	digestFile := filepath.Join(t.TempDir(), "digest")
+	out, err := exec.Command(e.Path, "--destination", "registry.example/app", "--digest-file", digestFile).CombinedOutput()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, 3, exitErr.ExitCode())
+	require.Equal(t, "ERROR: build failed\n", string(out))
+	require.NoFileExists(t, digestFile)
+	require.Len(t, e.Builds(t), 1)
+}
+
+func Test_ExecutorScenario(t *testing.T) {
+	e := NewExecutor(t, Scenario{
+		VersionError:   "boom",
+		KanikoDirFiles: map[string]string{"layer.tar": "layer"},
+		LayersByBuild:  [][][]byte{{[]byte("first")}},
+		Layers:         [][]byte{[]byte("later")},
+	})
+	out, err := exec.Command(e.Path, "version").CombinedOutput()
+	require.Error(t, err)
+	require.Equal(t, "boom\n", string(out))
+
+	dir := t.TempDir()
+	for _, layer := range []string{"first", "later"} {
+		tarPath := filepath.Join(dir, layer+".tar")
+		out, err = exec.Command(e.Path, "--kaniko-dir", dir, "--tar-path", tarPath).CombinedOutput()
+		require.NoError(t, err, string(out))
+		tarball, err := image.OpenTarball(tarPath)
+		require.NoError(t, err)
+		require.Equal(t, []string{Digest([]byte(layer))}, tarball.Config.RootFS.DiffIDs)
+	}
+	require.FileExists(t, filepath.Join(dir, "layer.tar"))
+
+	killed := NewExecutor(t, Scenario{Killed: true})
+	err = exec.Command(killed.Path, "--no-push").Run()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, -1, exitErr.ExitCode())
+}
@@ -0,0 +1,175 @@
+// Command fakeexecutor is a fake kaniko executor for tests, see testharness.NewExecutor.
+// It follows the scenario stored next to its binary and records its invocations there.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+	"github.com/cloudbees-io/kaniko/internal/testharness"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "fake executor: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(exe)
+	var scenario testharness.Scenario
+	b, err := os.ReadFile(filepath.Join(dir, testharness.ScenarioFile))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(b, &scenario); err != nil {
+		return err
+	}
+
+	inv := testharness.Invocation{Args: args, Env: os.Environ()}
+	if err = record(filepath.Join(dir, testharness.InvocationsFile), inv); err != nil {
+		return err
+	}
+
+	switch {
+	case len(args) > 0 && args[0] == "version":
+		if scenario.VersionError != "" {
+			fmt.Fprintln(os.Stderr, scenario.VersionError)
+			os.Exit(1)
+		}
+		version := scenario.Version
+		if version == "" {
+			version = testharness.DefaultVersion
+		}
+		fmt.Printf("Kaniko version :  %s\n", version)
+		return nil
+	case inv.Has("help"):
+		help := scenario.Help
+		if help == "" {
+			help = testharness.DefaultHelp
+		}
+		fmt.Print(help)
+		return nil
+	}
+
+	fmt.Fprint(os.Stderr, scenario.Log)
+	if scenario.Killed {
+		p, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			return err
+		}
+		return p.Kill()
+	}
+	if scenario.ExitCode != 0 {
+		os.Exit(scenario.ExitCode)
+	}
+	if n := countBuilds(filepath.Join(dir, testharness.InvocationsFile)); n <= len(scenario.LayersByBuild) {
+		scenario.Layers = scenario.LayersByBuild[n-1]
+	}
+	return build(inv, scenario)
+}
+
+func record(path string, inv testharness.Invocation) error {
+	b, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// countBuilds returns the number of recorded builds, including the current one.
+func countBuilds(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var inv testharness.Invocation
+		if json.Unmarshal([]byte(line), &inv) == nil && inv.IsBuild() {
+			n++
+		}
+	}
+	return n
+}
+
+// build writes the kaniko directory files and the image of the scenario to the tarball
+// and pushes it, then writes its digest.
+func build(inv testharness.Invocation, scenario testharness.Scenario) error {
+	img, err := testharness.NewImage(scenario.Config, scenario.Layers...)
+	if err != nil {
+		return err
+	}
+	destinations := inv.Flag("destination")
+
+	for _, dir := range inv.Flag("kaniko-dir") {
+		for name, content := range scenario.KanikoDirFiles {
+			if err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	tarPaths := append(inv.Flag("tar-path"), inv.Flag("tarPath")...)
+	for _, path := range tarPaths {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err = image.WriteTarball(f, scenario.Config, destinations, scenario.Layers...); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+	}
+
+	if scenario.Push && !inv.Has("no-push") {
+		for _, destination := range destinations {
+			ref, err := registry.ParseReference(destination)
+			if err != nil {
+				return err
+			}
+			tag := ref.Tag
+			if tag == "" {
+				tag = "latest"
+			}
+			if err = img.Push(context.Background(), http.DefaultClient, "http://"+ref.Registry, ref.Repository, tag); err != nil {
+				return fmt.Errorf("push %s: %w", destination, err)
+			}
+			fmt.Fprintf(os.Stderr, "INFO[0001] Pushed %s@%s\n", destination, img.Digest)
+		}
+	}
+
+	digest := img.Digest
+	if scenario.Digest != "" {
+		digest = scenario.Digest
+	}
+	for _, path := range inv.Flag("digest-file") {
+		if err = os.WriteFile(path, []byte(digest), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package testharness
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+)
+
+// Image is an OCI image with gzipped layers, as pushed to a registry.
+type Image struct {
+	// Digest is the digest of the manifest.
+	Digest   string
+	Manifest []byte
+	// Blobs holds the config and the layers by digest.
+	Blobs map[string][]byte
+}
+
+// NewImage returns the image of cfg and the uncompressed layer tarballs. The diff IDs
+// of cfg are set from the layers.
+func NewImage(cfg image.ConfigFile, layers ...[]byte) (*Image, error) {
+	img := &Image{Blobs: map[string][]byte{}}
+	m := registry.Manifest{SchemaVersion: 2, MediaType: registry.MediaTypeOCIManifest}
+	cfg.RootFS = image.RootFS{Type: "layers"}
+	for _, layer := range layers {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		if _, err := gz.Write(layer); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		d := Digest(compressed.Bytes())
+		img.Blobs[d] = compressed.Bytes()
+		m.Layers = append(m.Layers, registry.Descriptor{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: d, Size: int64(compressed.Len())})
+		cfg.RootFS.DiffIDs = append(cfg.RootFS.DiffIDs, Digest(layer))
+	}
+	cfgBlob, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	img.Blobs[Digest(cfgBlob)] = cfgBlob
+	m.Config = registry.Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: Digest(cfgBlob), Size: int64(len(cfgBlob))}
+	if img.Manifest, err = json.Marshal(m); err != nil {
+		return nil, err
+	}
+	img.Digest = Digest(img.Manifest)
+	return img, nil
+}
+
+// Digest returns the sha256 digest of b.
+func Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Push uploads the blobs and the manifest of the image to the repository of the
+// registry at baseURL, e.g. http://localhost:5000, and tags it.
+func (img *Image) Push(ctx context.Context, client *http.Client, baseURL, repository, tag string) error {
+	do := func(method, u, contentType string, body []byte, want int) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != want {
+			return nil, fmt.Errorf("%s %s: unexpected status %s", method, u, resp.Status)
+		}
+		return resp, nil
+	}
+
+	for digest, blob := range img.Blobs {
+		resp, err := do(http.MethodPost, baseURL+"/v2/"+repository+"/blobs/uploads/", "", nil, http.StatusAccepted)
+		if err != nil {
+			return err
+		}
+		location, err := resp.Location()
+		if err != nil {
+			return fmt.Errorf("upload %s: %w", digest, err)
+		}
+		q := location.Query()
+		q.Set("digest", digest)
+		location.RawQuery = q.Encode()
+		if _, err = do(http.MethodPut, location.String(), "application/octet-stream", blob, http.StatusCreated); err != nil {
+			return err
+		}
+	}
+	_, err := do(http.MethodPut, baseURL+"/v2/"+repository+"/manifests/"+url.PathEscape(tag), registry.MediaTypeOCIManifest, img.Manifest, http.StatusCreated)
+	return err
+}
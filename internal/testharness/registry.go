@@ -0,0 +1,302 @@
+// Package testharness provides a fake kaniko executor and an in-memory OCI registry,
+// so that builds, their outputs and their registry interactions can be tested
+// end to end without a container runtime or network access.
+package testharness
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+	"github.com/stretchr/testify/require"
+)
+
+// Request is a request received by the registry.
+type Request struct {
+	Method string
+	Path   string
+}
+
+type storedManifest struct {
+	mediaType string
+	content   []byte
+}
+
+// Registry is an in-memory registry implementing the pull and push parts of the
+// OCI distribution API over plain HTTP. Blobs are shared by all repositories.
+type Registry struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	manifests map[string]map[string]storedManifest
+	blobs     map[string][]byte
+	uploads   map[string][]byte
+	requests  []Request
+
+	username, password, token string
+}
+
+// NewRegistry starts a registry which is stopped when the test ends.
+func NewRegistry(t *testing.T) *Registry {
+	r := &Registry{
+		manifests: map[string]map[string]storedManifest{},
+		blobs:     map[string][]byte{},
+		uploads:   map[string][]byte{},
+	}
+	r.server = httptest.NewServer(r)
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+// Host returns the host and port of the registry, as used in image references.
+func (r *Registry) Host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+// URL returns the base URL of the registry.
+func (r *Registry) URL() string {
+	return r.server.URL
+}
+
+// Requests returns the requests received so far.
+func (r *Registry) Requests() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Request(nil), r.requests...)
+}
+
+// RequireToken makes the registry require the bearer token, issued by its /token
+// endpoint to the basic auth credentials.
+func (r *Registry) RequireToken(username, password, token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.username, r.password, r.token = username, password, token
+}
+
+// AddImage stores the image of cfg and the uncompressed layer tarballs in the
+// repository under tag, and returns its digest.
+func (r *Registry) AddImage(t *testing.T, repository, tag string, cfg image.ConfigFile, layers ...[]byte) string {
+	img, err := NewImage(cfg, layers...)
+	require.NoError(t, err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for digest, blob := range img.Blobs {
+		r.blobs[digest] = blob
+	}
+	r.putManifest(repository, tag, storedManifest{mediaType: registry.MediaTypeOCIManifest, content: img.Manifest})
+	return img.Digest
+}
+
+// PutManifest stores the manifest in the repository under tag, e.g. an image index,
+// and returns its digest.
+func (r *Registry) PutManifest(repository, tag, mediaType string, content []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.putManifest(repository, tag, storedManifest{mediaType: mediaType, content: content})
+}
+
+// SetBlob stores the blob under digest, which is not verified.
+func (r *Registry) SetBlob(digest string, content []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blobs[digest] = content
+}
+
+// Manifest returns the manifest of the repository by tag or digest, and its digest.
+func (r *Registry) Manifest(repository, ref string) (digest string, content []byte, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.manifests[repository][ref]
+	if !ok {
+		return "", nil, false
+	}
+	return Digest(m.content), m.content, true
+}
+
+// Blob returns the blob of the digest.
+func (r *Registry) Blob(digest string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.blobs[digest]
+	return b, ok
+}
+
+// putManifest stores a manifest under its digest and tag, r.mu must be held.
+func (r *Registry) putManifest(repository, tag string, m storedManifest) string {
+	if r.manifests[repository] == nil {
+		r.manifests[repository] = map[string]storedManifest{}
+	}
+	digest := Digest(m.content)
+	r.manifests[repository][digest] = m
+	if tag != "" && tag != digest {
+		r.manifests[repository][tag] = m
+	}
+	return digest
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, Request{Method: req.Method, Path: req.URL.Path})
+
+	if req.URL.Path == "/token" {
+		r.serveToken(w, req)
+		return
+	}
+	if r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+req.Host+`/token",service="fake"`)
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED")
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case req.URL.Path == "/v2/" || req.URL.Path == "/v2":
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, "{}")
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		r.serveManifest(w, req, path[:i], path[i+len("/manifests/"):])
+	case strings.Contains(path, "/blobs/uploads/"):
+		i := strings.LastIndex(path, "/blobs/uploads/")
+		r.serveUpload(w, req, path[:i], path[i+len("/blobs/uploads/"):])
+	case strings.Contains(path, "/blobs/"):
+		i := strings.LastIndex(path, "/blobs/")
+		r.serveBlob(w, req, path[i+len("/blobs/"):])
+	default:
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN")
+	}
+}
+
+func (r *Registry) serveToken(w http.ResponseWriter, req *http.Request) {
+	username, password, _ := req.BasicAuth()
+	if r.token == "" || username != r.username || password != r.password {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"token": r.token})
+}
+
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, repository, ref string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		m, ok := r.manifests[repository][ref]
+		if !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN")
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", Digest(m.content))
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.content)))
+		if req.Method == http.MethodGet {
+			_, _ = w.Write(m.content)
+		}
+	case http.MethodPut:
+		content, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID")
+			return
+		}
+		mediaType := req.Header.Get("Content-Type")
+		if mediaType == "" {
+			mediaType = registry.MediaTypeOCIManifest
+		}
+		digest := r.putManifest(repository, ref, storedManifest{mediaType: mediaType, content: content})
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Location", "/v2/"+repository+"/manifests/"+digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED")
+	}
+}
+
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, digest string) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED")
+		return
+	}
+	b, ok := r.blobs[digest]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	if req.Method == http.MethodGet {
+		_, _ = w.Write(b)
+	}
+}
+
+// serveUpload implements monolithic and chunked blob uploads.
+func (r *Registry) serveUpload(w http.ResponseWriter, req *http.Request, repository, id string) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID")
+		return
+	}
+	if req.Method == http.MethodPost && id == "" {
+		if digest := req.URL.Query().Get("digest"); digest != "" {
+			r.completeUpload(w, repository, digest, body)
+			return
+		}
+		id = randomID()
+		r.uploads[id] = nil
+		w.Header().Set("Location", "/v2/"+repository+"/blobs/uploads/"+id)
+		w.Header().Set("Range", "0-0")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	content, ok := r.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN")
+		return
+	}
+	content = append(content, body...)
+	switch req.Method {
+	case http.MethodPatch:
+		r.uploads[id] = content
+		w.Header().Set("Location", "/v2/"+repository+"/blobs/uploads/"+id)
+		w.Header().Set("Range", "0-"+strconv.Itoa(max(len(content)-1, 0)))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		delete(r.uploads, id)
+		r.completeUpload(w, repository, req.URL.Query().Get("digest"), content)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED")
+	}
+}
+
+func (r *Registry) completeUpload(w http.ResponseWriter, repository, digest string, content []byte) {
+	if digest != Digest(content) {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID")
+		return
+	}
+	r.blobs[digest] = content
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Location", "/v2/"+repository+"/blobs/"+digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, `{"errors":[{"code":"`+code+`"}]}`)
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,137 @@
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/cloudbees-io/kaniko/internal/image"
+	"github.com/cloudbees-io/kaniko/internal/registry"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RegistryPushPull(t *testing.T) {
+	r := NewRegistry(t)
+	img, err := NewImage(image.ConfigFile{OS: "linux", Architecture: "amd64"}, []byte("layer one"), []byte("layer two"))
+	require.NoError(t, err)
+	require.NoError(t, img.Push(context.Background(), http.DefaultClient, r.URL(), "team/app", "1.0"))
+
+	digest, content, ok := r.Manifest("team/app", "1.0")
+	require.True(t, ok)
+	require.Equal(t, img.Digest, digest)
+	require.Equal(t, img.Manifest, content)
+	_, _, ok = r.Manifest("team/other", "1.0")
+	require.False(t, ok)
+
+	var m registry.Manifest
+	require.NoError(t, json.Unmarshal(content, &m))
+	require.Len(t, m.Layers, 2)
+	for _, d := range append(m.Layers, m.Config) {
+		blob, ok := r.Blob(d.Digest)
+		require.True(t, ok)
+		require.Equal(t, d.Digest, Digest(blob))
+	}
+
+	client := registry.NewClient(http.DefaultClient, nil)
+	client.PlainHTTP = map[string]bool{r.Host(): true}
+	ref, err := registry.ParseReference(r.Host() + "/team/app:1.0")
+	require.NoError(t, err)
+	pulled, _, err := client.ImageManifest(context.Background(), ref)
+	require.NoError(t, err)
+	b, err := client.ReadBlob(context.Background(), ref, pulled.Config)
+	require.NoError(t, err)
+	var cfg image.ConfigFile
+	require.NoError(t, json.Unmarshal(b, &cfg))
+	require.Equal(t, "amd64", cfg.Architecture)
+	require.Len(t, cfg.RootFS.DiffIDs, 2)
+
+	require.Contains(t, r.Requests(), Request{Method: http.MethodPut, Path: "/v2/team/app/manifests/1.0"})
+}
+
+func Test_RegistryAddImage(t *testing.T) {
+	r := NewRegistry(t)
+	digest := r.AddImage(t, "library/alpine", "3.20", image.ConfigFile{OS: "linux"}, []byte("rootfs"))
+
+	for _, ref := range []string{"3.20", digest} {
+		resp, err := http.Get(r.URL() + "/v2/library/alpine/manifests/" + ref)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, digest, resp.Header.Get("Docker-Content-Digest"))
+		require.Equal(t, registry.MediaTypeOCIManifest, resp.Header.Get("Content-Type"))
+	}
+
+	resp, err := http.Get(r.URL() + "/v2/library/alpine/manifests/latest")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func Test_RegistryUploads(t *testing.T) {
+	r := NewRegistry(t)
+	do := func(method, path string, body []byte) *http.Response {
+		req, err := http.NewRequest(method, r.URL()+path, bytes.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	t.Run("chunked", func(t *testing.T) {
+		resp := do(http.MethodPost, "/v2/team/app/blobs/uploads/", nil)
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		location := resp.Header.Get("Location")
+		resp = do(http.MethodPatch, location, []byte("hello "))
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		require.Equal(t, "0-5", resp.Header.Get("Range"))
+		resp = do(http.MethodPut, location+"?digest="+Digest([]byte("hello world")), []byte("world"))
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		blob, ok := r.Blob(Digest([]byte("hello world")))
+		require.True(t, ok)
+		require.Equal(t, "hello world", string(blob))
+	})
+
+	t.Run("monolithic", func(t *testing.T) {
+		resp := do(http.MethodPost, "/v2/team/app/blobs/uploads/?digest="+Digest([]byte("blob")), []byte("blob"))
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		resp = do(http.MethodHead, "/v2/team/app/blobs/"+Digest([]byte("blob")), nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		resp := do(http.MethodPost, "/v2/team/app/blobs/uploads/?digest="+Digest([]byte("other")), []byte("blob"))
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("unknown upload", func(t *testing.T) {
+		resp := do(http.MethodPut, "/v2/team/app/blobs/uploads/unknown?digest="+Digest(nil), nil)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func Test_RegistryToken(t *testing.T) {
+	r := NewRegistry(t)
+	r.RequireToken("user", "secret", "t0k3n")
+	get := func(path string, auth func(*http.Request)) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, r.URL()+path, nil)
+		require.NoError(t, err)
+		auth(req)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("/v2/", func(*http.Request) {})
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, `Bearer realm="`+r.URL()+`/token",service="fake"`, resp.Header.Get("WWW-Authenticate"))
+	resp = get("/token", func(req *http.Request) { req.SetBasicAuth("user", "wrong") })
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = get("/token", func(req *http.Request) { req.SetBasicAuth("user", "secret") })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = get("/v2/", func(req *http.Request) { req.Header.Set("Authorization", "Bearer t0k3n") })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}